@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type ShardAdvice struct {
+	StreamName    string `json:"stream_name"`
+	Mode          string `json:"mode"`
+	CurrentShards int    `json:"current_shards"`
+
+	// Per-second rates at the percentile, and at the busiest period
+	Percentile              float64 `json:"percentile"`
+	IncomingBytesPerS       float64 `json:"incoming_bytes_per_second"`
+	IncomingRecordsPerS     float64 `json:"incoming_records_per_second"`
+	ReadBytesPerS           float64 `json:"read_bytes_per_second"`
+	PeakIncomingBytesPerS   float64 `json:"peak_incoming_bytes_per_second"`
+	PeakIncomingRecordsPerS float64 `json:"peak_incoming_records_per_second"`
+
+	RecommendedShards int    `json:"recommended_shards"`
+	RecommendedMode   string `json:"recommended_mode"`
+	Reason            string `json:"reason"`
+
+	ProvisionedMonthly float64 `json:"provisioned_monthly"`
+	OnDemandMonthly    float64 `json:"on_demand_monthly"`
+
+	// Periods in which writes were throttled, or incoming throughput exceeded the current shards'
+	// capacity
+	OverCapacity []CapacityPeriod `json:"over_capacity"`
+}
+
+type CapacityPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Highest incoming throughput as a percentage of the current shards' capacity
+	PeakUtilization float64 `json:"peak_utilization"`
+	WriteThrottles  float64 `json:"write_throttles"`
+}
+
+func init() {
+	adviseCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	adviseCmd.Flags().Int("days", 7, "Number of days of CloudWatch metrics to analyze")
+	adviseCmd.Flags().Duration("period", time.Minute, "Width of each datapoint; must be a multiple of a minute")
+	adviseCmd.Flags().Float64("percentile", 99, "Percentile of per-period throughput to size shards for; 100 sizes for the busiest period")
+	adviseCmd.Flags().Float64("headroom", 20, "Percentage of spare capacity to leave on top of the sized throughput")
+	adviseCmd.Flags().String("prices", "", "JSON file of prices to compare modes with, as for kin cost")
+	adviseCmd.Flags().Bool("apply", false, "Scale the stream to the recommended shard count with UpdateShardCount")
+	adviseCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	adviseCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(adviseCmd)
+}
+
+var adviseCmd = &cobra.Command{
+	Use:   "advise",
+	Short: "Recommend a shard count from recent throughput",
+	Long: `Analyzes the last --days of a stream's CloudWatch throughput and recommends how many shards it
+needs: enough for the --percentile busiest period's incoming bytes and records, and for what
+shared-throughput consumers read, plus --headroom. Periods in which writes were throttled or
+incoming throughput exceeded the current shards' capacity are listed.
+
+If on-demand mode would cost less than the recommended shards, going by the same estimates as
+kin cost, switching to it is recommended instead; spiky streams that sit mostly idle often are.
+
+With --apply, the stream is scaled to the recommended shard count, or as close as a single
+UpdateShardCount call allows. Switching modes is left to kin mode.
+
+Example:
+  kin advise -n orders --days 14 --percentile 99.9 --apply`,
+	Run: runAdviseCmd,
+}
+
+func runAdviseCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	days, _ := cmd.Flags().GetInt("days")
+	period, _ := cmd.Flags().GetDuration("period")
+	percentile, _ := cmd.Flags().GetFloat64("percentile")
+	headroom, _ := cmd.Flags().GetFloat64("headroom")
+	pricesFile, _ := cmd.Flags().GetString("prices")
+	apply, _ := cmd.Flags().GetBool("apply")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if period < time.Minute || period%time.Minute != 0 {
+		cmd.PrintErrln("--period must be a whole number of minutes")
+		os.Exit(1)
+	}
+	if days < 1 || percentile <= 0 || percentile > 100 || headroom < 0 {
+		cmd.PrintErrln("--days must be at least 1, --percentile between 0 and 100, and --headroom not negative")
+		os.Exit(1)
+	}
+
+	prices, err := loadKinesisPrices(pricesFile)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cloudwatch, err := aws.GetCloudWatchClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	description, err := describeStream(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	metrics := []string{"IncomingBytes", "IncomingRecords", "GetRecords.Bytes", "WriteProvisionedThroughputExceeded"}
+	var queries []aws.MetricQuery
+	for i, metric := range metrics {
+		queries = append(queries, aws.MetricQuery{
+			Id:         fmt.Sprintf("m%d", i),
+			Namespace:  "AWS/Kinesis",
+			MetricName: metric,
+			Dimensions: map[string]string{"StreamName": streamName},
+			Stat:       "Sum",
+			Period:     period,
+		})
+	}
+	window := time.Duration(days) * 24 * time.Hour
+	end := time.Now().Truncate(period)
+	results, err := cloudwatch.GetMetricData(cmd.Context(), queries, end.Add(-window), end)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if len(results[0].Values) == 0 {
+		cmd.PrintErrf("no CloudWatch metrics for %s in the last %d days\n", streamName, days)
+		os.Exit(1)
+	}
+
+	advice := adviseShards(description, results, period, window, percentile, headroom, prices)
+
+	if output == "json" {
+		printJSON(advice)
+	} else {
+		printShardAdvice(advice)
+	}
+
+	if !apply {
+		return
+	}
+	if description.Mode == "ON_DEMAND" {
+		cmd.PrintErrln("--apply: the stream is on-demand and manages its own shards; use kin mode --provisioned to switch")
+		os.Exit(1)
+	}
+	if advice.RecommendedShards == advice.CurrentShards {
+		cmd.PrintErrln("--apply: the stream already has the recommended number of shards")
+		return
+	}
+
+	// A single call can at most double or halve the shard count
+	target := int32(advice.RecommendedShards)
+	current := int32(advice.CurrentShards)
+	target = min(max(target, (current+1)/2), current*2)
+
+	summary, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{StreamName: &streamName})
+	if err == nil {
+		err = validateShardCountChange(summary.StreamDescriptionSummary, target)
+	}
+	if err == nil {
+		_, err = client.UpdateShardCount(cmd.Context(), &kinesis.UpdateShardCountInput{
+			StreamName:       &streamName,
+			TargetShardCount: awssdk.Int32(target),
+			ScalingType:      types.ScalingTypeUniformScaling,
+		})
+	}
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Scaling %s from %d to %d shards\n", streamName, current, target)
+	if int(target) != advice.RecommendedShards {
+		cmd.PrintErrf("Run advise --apply again once it's ACTIVE to continue to %d shards\n", advice.RecommendedShards)
+	}
+}
+
+// adviseShards sizes a stream from its metrics: incoming bytes, incoming records, bytes read
+// with GetRecords and write throttles, each summed over periods.
+func adviseShards(
+	description *StreamDescription,
+	results []aws.MetricResult,
+	period, window time.Duration,
+	percentile, headroom float64,
+	prices KinesisPrices,
+) ShardAdvice {
+	perSecond := func(values []float64) []float64 {
+		rates := make([]float64, len(values))
+		for i, v := range values {
+			rates[i] = v / period.Seconds()
+		}
+		return rates
+	}
+	incomingBytes := perSecond(results[0].Values)
+	incomingRecords := perSecond(results[1].Values)
+	readBytes := perSecond(results[2].Values)
+
+	advice := ShardAdvice{
+		StreamName:              description.StreamName,
+		Mode:                    description.Mode,
+		CurrentShards:           int(description.OpenShardCount),
+		Percentile:              percentile,
+		IncomingBytesPerS:       percentileOf(incomingBytes, percentile),
+		IncomingRecordsPerS:     percentileOf(incomingRecords, percentile),
+		ReadBytesPerS:           percentileOf(readBytes, percentile),
+		PeakIncomingBytesPerS:   percentileOf(incomingBytes, 100),
+		PeakIncomingRecordsPerS: percentileOf(incomingRecords, 100),
+		OverCapacity:            []CapacityPeriod{},
+	}
+
+	scale := 1 + headroom/100
+	advice.RecommendedShards = shardsForThroughput(advice.IncomingBytesPerS*scale, advice.IncomingRecordsPerS*scale, advice.ReadBytesPerS*scale)
+
+	// Compare modes at the average throughput over the whole window, as billed
+	average := func(result aws.MetricResult) float64 {
+		total := 0.0
+		for _, v := range result.Values {
+			total += v
+		}
+		return total / window.Seconds()
+	}
+	estimate := &CostEstimate{
+		IncomingBytesPerS:   average(results[0]),
+		IncomingRecordsPerS: average(results[1]),
+		ReadBytesPerS:       average(results[2]),
+	}
+	retention, consumers := int(description.RetentionPeriodHours), len(description.Consumers)
+	advice.ProvisionedMonthly = provisionedCost(prices, estimate, advice.RecommendedShards, retention, consumers).Monthly
+	advice.OnDemandMonthly = onDemandCost(prices, estimate, retention, consumers).Monthly
+
+	if advice.OnDemandMonthly < advice.ProvisionedMonthly {
+		advice.RecommendedMode = "ON_DEMAND"
+		advice.Reason = fmt.Sprintf(
+			"on-demand would cost about $%.2f a month, less than $%.2f for %d provisioned shards",
+			advice.OnDemandMonthly, advice.ProvisionedMonthly, advice.RecommendedShards,
+		)
+	} else {
+		advice.RecommendedMode = "PROVISIONED"
+		advice.Reason = fmt.Sprintf(
+			"%d shards take the p%g throughput with %g%% headroom, for about $%.2f a month against $%.2f on-demand",
+			advice.RecommendedShards, percentile, headroom, advice.ProvisionedMonthly, advice.OnDemandMonthly,
+		)
+	}
+
+	// Group consecutive periods over capacity or throttled into one
+	records := map[time.Time]float64{}
+	for i, t := range results[1].Timestamps {
+		records[t] = incomingRecords[i]
+	}
+	throttles := map[time.Time]float64{}
+	for i, t := range results[3].Timestamps {
+		throttles[t] = results[3].Values[i]
+	}
+	var current *CapacityPeriod
+	for i, t := range results[0].Timestamps {
+		utilization := 0.0
+		if description.Mode != "ON_DEMAND" && advice.CurrentShards > 0 {
+			capacity := float64(advice.CurrentShards)
+			utilization = 100 * math.Max(incomingBytes[i]/(capacity*(1<<20)), records[t]/(capacity*1000))
+		}
+		if utilization <= 100 && throttles[t] == 0 {
+			current = nil
+			continue
+		}
+
+		if current == nil || !current.End.Equal(t) {
+			advice.OverCapacity = append(advice.OverCapacity, CapacityPeriod{Start: t})
+			current = &advice.OverCapacity[len(advice.OverCapacity)-1]
+		}
+		current.End = t.Add(period)
+		current.PeakUtilization = math.Max(current.PeakUtilization, utilization)
+		current.WriteThrottles += throttles[t]
+	}
+	return advice
+}
+
+// percentileOf returns the nearest-rank percentile of values, or 0 if there are none.
+func percentileOf(values []float64, percentile float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	rank := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func printShardAdvice(advice ShardAdvice) {
+	printTable(os.Stdout, []string{"FIELD", "VALUE"}, [][]string{
+		{"Stream", advice.StreamName},
+		{"Mode", advice.Mode},
+		{"Current shards", fmt.Sprint(advice.CurrentShards)},
+		{fmt.Sprintf("Incoming (p%g)", advice.Percentile), fmt.Sprintf("%s/s, %.0f records/s", formatBytes(advice.IncomingBytesPerS), advice.IncomingRecordsPerS)},
+		{"Incoming (peak)", fmt.Sprintf("%s/s, %.0f records/s", formatBytes(advice.PeakIncomingBytesPerS), advice.PeakIncomingRecordsPerS)},
+		{fmt.Sprintf("Read (p%g)", advice.Percentile), formatBytes(advice.ReadBytesPerS) + "/s"},
+		{"Recommended shards", fmt.Sprint(advice.RecommendedShards)},
+		{"Recommended mode", advice.RecommendedMode},
+	})
+	fmt.Println()
+	fmt.Println(advice.Reason)
+
+	if len(advice.OverCapacity) == 0 {
+		return
+	}
+	fmt.Println()
+	rows := [][]string{}
+	for _, period := range advice.OverCapacity {
+		utilization := "-"
+		if period.PeakUtilization > 0 {
+			utilization = fmt.Sprintf("%.0f%%", period.PeakUtilization)
+		}
+		rows = append(rows, []string{
+			period.Start.Local().Format(time.DateTime),
+			period.End.Local().Format(time.DateTime),
+			utilization,
+			fmt.Sprintf("%.0f", period.WriteThrottles),
+		})
+	}
+	printTable(os.Stdout, []string{"OVER CAPACITY FROM", "UNTIL", "PEAK UTILIZATION", "WRITE THROTTLES"}, rows)
+}
@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+// How often the archiver lists shards, to pick up the children of closed shards
+const archiveShardSyncInterval = 30 * time.Second
+
+func init() {
+	archiveCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	archiveCmd.Flags().String("s3", "", "S3 location to archive to, as s3://<bucket>/<prefix> (required)")
+	archiveCmd.Flags().String("checkpoint", "", "Checkpoint store URI, either file://<path> or dynamodb://<table>, recording what has been archived (required)")
+	archiveCmd.Flags().String("app-name", "", "KCL application name; used as the lease table name when --checkpoint is dynamodb:// without a table")
+	archiveCmd.Flags().String("from", "", "Where to start shards that have no checkpoint, as an RFC 3339 timestamp or a duration ago (ex: 2h); defaults to the trim horizon")
+	archiveCmd.Flags().Int("max-object-size", 64*1024*1024, "Write an object once its records add up to this many bytes, before compression")
+	archiveCmd.Flags().Duration("max-object-age", 5*time.Minute, "Write an object once its first record has been waiting this long")
+	archiveCmd.Flags().Bool("no-data", false, "Leave out the decoded payload, keeping only the raw payload and metadata")
+	archiveCmd.Flags().Duration("poll-interval", defaultPollInterval, "How long to wait between GetRecords calls on each shard")
+	archiveCmd.MarkFlagRequired("stream-name")
+	archiveCmd.MarkFlagRequired("s3")
+	archiveCmd.MarkFlagRequired("checkpoint")
+
+	rootCmd.AddCommand(archiveCmd)
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Continuously archive a stream to S3",
+	Long: `Reads every shard of the stream until interrupted and writes its records to S3 as
+gzipped NDJSON objects, in the same form as export, partitioned by the hour records arrived in:
+
+  <prefix>/date=YYYY-MM-DD/hour=HH/<shard>-<first sequence number>.ndjson.gz
+
+An object is written once it reaches --max-object-size, its first record has waited
+--max-object-age, or a record arrives in a later hour. Only then is the shard's checkpoint
+advanced, so a restarted archiver carries on after the last object written; records that were
+still buffered are read again, and an object that was written but not checkpointed is rewritten
+under the same key.
+
+The archiver follows resharding: the children of a closed shard are only archived once their
+parents have been, so each shard's objects follow on from its parents'. Run a single archiver per
+stream and checkpoint store.
+
+Example:
+  kin archive -n orders --s3 s3://archive-bucket/kinesis/orders --checkpoint dynamodb://orders-archive`,
+	Run: runArchiveCmd,
+}
+
+func runArchiveCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	s3URI, _ := cmd.Flags().GetString("s3")
+	checkpointURI, _ := cmd.Flags().GetString("checkpoint")
+	appName, _ := cmd.Flags().GetString("app-name")
+	fromS, _ := cmd.Flags().GetString("from")
+	maxObjectSize, _ := cmd.Flags().GetInt("max-object-size")
+	maxObjectAge, _ := cmd.Flags().GetDuration("max-object-age")
+	noData, _ := cmd.Flags().GetBool("no-data")
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+
+	bucket, prefix, err := parseS3URI(s3URI)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var from *time.Time
+	if fromS != "" {
+		t, err := ParseTimeOrAgo(fromS, time.Now())
+		if err != nil {
+			cmd.PrintErrln("invalid --from:", err)
+			os.Exit(1)
+		}
+		from = &t
+	}
+
+	checkpointer, err := NewCheckpointer(checkpointURI, streamName, appName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	s3Client, err := aws.GetS3Client()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	a := &archiver{
+		client:        client,
+		s3:            s3Client,
+		streamName:    streamName,
+		bucket:        bucket,
+		prefix:        prefix,
+		checkpointer:  checkpointer,
+		maxObjectSize: maxObjectSize,
+		maxObjectAge:  maxObjectAge,
+		tailOptions: &TailOptions{
+			AtTimestamp:     from,
+			NoData:          noData,
+			IncludeRaw:      true,
+			TimestampFormat: &TimestampFormat{Layout: time.RFC3339Nano},
+			PollInterval:    pollInterval,
+			Checkpointer:    checkpointer,
+			Resume:          true,
+		},
+		started:  map[string]bool{},
+		finished: map[string]bool{},
+	}
+
+	if err := a.Run(cmd.Context()); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// parseS3URI splits s3://<bucket>/<prefix> into the bucket and the prefix, without slashes at
+// either end.
+func parseS3URI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 location %q: must be s3://<bucket>/<prefix>", uri)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// archiver reads every shard of a stream and writes its records to S3, checkpointing each shard
+// once its records are safely written.
+type archiver struct {
+	client       aws.KinesisAPI
+	s3           *s3.Client
+	streamName   string
+	bucket       string
+	prefix       string
+	checkpointer Checkpointer
+	tailOptions  *TailOptions
+
+	maxObjectSize int
+	maxObjectAge  time.Duration
+
+	mu       sync.Mutex
+	started  map[string]bool
+	finished map[string]bool
+}
+
+// Run archives shards until ctx is cancelled, starting each once its parents are finished.
+func (a *archiver) Run(ctx context.Context) error {
+	ticker := time.NewTicker(archiveShardSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.startShards(ctx); err != nil {
+			// Shards already being archived carry on regardless, so only give up at the start
+			a.mu.Lock()
+			running := len(a.started) > 0
+			a.mu.Unlock()
+			if !running {
+				return err
+			}
+			slog.Warn("failed to list shards", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// startShards starts archiving every shard that isn't already started and whose parents, if still
+// within the retention period, have been archived to the end.
+func (a *archiver) startShards(ctx context.Context) error {
+	shards, err := listShards(ctx, a.client, a.streamName)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+		if a.started[shardId] {
+			continue
+		}
+
+		ready := true
+		for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			if parent != nil && findShard(shards, *parent) != nil && !a.finished[*parent] {
+				ready = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		a.started[shardId] = true
+		go a.archiveShard(ctx, shardId)
+	}
+	return nil
+}
+
+// archiveShard archives a shard until it's closed or ctx is cancelled. If it fails, the shard is
+// left to be started again, from its checkpoint, by the next startShards.
+func (a *archiver) archiveShard(ctx context.Context, shardId string) {
+	logger := slog.With("shard", shardId)
+	logger.Info("archiving shard")
+
+	err := a.readShard(ctx, shardId)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+	case err != nil:
+		logger.Error("failed to archive shard; retrying", "error", err)
+		delete(a.started, shardId)
+	default:
+		logger.Info("archived closed shard")
+		a.finished[shardId] = true
+	}
+}
+
+// readShard reads a shard into objects, writing each when it's full, old enough or a record
+// arrives in a later hour, until the shard is closed and its last object written.
+func (a *archiver) readShard(ctx context.Context, shardId string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	records := make(chan *RecordOutput)
+	var tailErr error
+	go func() {
+		tailErr = tailStreamShard(ctx, a.client, &a.streamName, &shardId, a.tailOptions, records)
+		close(records)
+	}()
+
+	ticker := time.NewTicker(min(a.maxObjectAge, time.Second))
+	defer ticker.Stop()
+
+	var object *archiveObject
+	flush := func() error {
+		if object == nil {
+			return nil
+		}
+		err := a.writeObject(ctx, shardId, object)
+		object = nil
+		return err
+	}
+
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return errors.Join(tailErr, flush())
+			}
+
+			arrival := record.ApproximateArrivalTimestamp.UTC()
+			if object != nil && arrival.Truncate(time.Hour).After(object.hour) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if object == nil {
+				object = newArchiveObject(arrival)
+			}
+			if err := object.Add(record); err != nil {
+				return err
+			}
+			if object.size >= a.maxObjectSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case <-ticker.C:
+			if object != nil && time.Since(object.opened) >= a.maxObjectAge {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// writeObject uploads an object, retrying until it's written or ctx is cancelled, then
+// checkpoints the shard up to the object's last record.
+func (a *archiver) writeObject(ctx context.Context, shardId string, object *archiveObject) error {
+	body, err := object.Close()
+	if err != nil {
+		return err
+	}
+
+	key := path.Join(
+		a.prefix,
+		object.hour.Format("date=2006-01-02"),
+		object.hour.Format("hour=15"),
+		fmt.Sprintf("%s-%s.ndjson.gz", shardId, object.firstSequenceNumber),
+	)
+	logger := slog.With("shard", shardId, "key", key)
+
+	for attempt := 1; ; attempt++ {
+		_, err = a.s3.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      &a.bucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: awssdk.String("application/x-ndjson"),
+		})
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		logger.Warn("failed to write object; retrying", "error", err, "attempt", attempt)
+		aws.SleepContext(ctx, aws.Backoff(min(attempt, 7)))
+	}
+	logger.Info("wrote object", "records", object.records, "bytes", len(body))
+
+	a.checkpointer.Set(shardId, object.lastSequenceNumber)
+	if err := a.checkpointer.Flush(); err != nil {
+		// The object is written, so it's only a matter of rewriting it if this is never retried
+		logger.Error("failed to write checkpoint", "error", err)
+	}
+	return nil
+}
+
+// archiveObject buffers the gzipped records of one object in memory.
+type archiveObject struct {
+	hour   time.Time
+	opened time.Time
+
+	buffer  bytes.Buffer
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+
+	records             int
+	size                int
+	firstSequenceNumber string
+	lastSequenceNumber  string
+}
+
+func newArchiveObject(arrival time.Time) *archiveObject {
+	object := &archiveObject{hour: arrival.Truncate(time.Hour), opened: time.Now()}
+	object.gzip = gzip.NewWriter(&object.buffer)
+	object.encoder = json.NewEncoder(object.gzip)
+	return object
+}
+
+func (o *archiveObject) Add(record *RecordOutput) error {
+	if err := o.encoder.Encode(record); err != nil {
+		return err
+	}
+
+	if o.records == 0 {
+		o.firstSequenceNumber = *record.SequenceNumber
+	}
+	o.lastSequenceNumber = *record.SequenceNumber
+	o.records++
+	o.size += *record.Size
+	return nil
+}
+
+// Close finishes the object and returns its contents.
+func (o *archiveObject) Close() ([]byte, error) {
+	if err := o.gzip.Close(); err != nil {
+		return nil, errors.Join(errors.New("failed to compress object"), err)
+	}
+	return o.buffer.Bytes(), nil
+}
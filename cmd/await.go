@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"os"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	awaitCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	awaitCmd.Flags().String("filter", "", "jq expression a record's payload must make true to match (ex: '.orderId==\"123\"') (required)")
+	awaitCmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for a matching record before giving up")
+	awaitCmd.Flags().String("from", "", "Also match records that arrived since this time, as an RFC 3339 timestamp or a duration ago (ex: 5m); defaults to now")
+	awaitCmd.Flags().Int("count", 1, "Number of matching records to wait for")
+	awaitCmd.Flags().Duration("poll-interval", 500*time.Millisecond, "How long to wait between GetRecords calls on each shard")
+	addRecordOutputFlags(awaitCmd.Flags())
+	awaitCmd.MarkFlagRequired("stream-name")
+	awaitCmd.MarkFlagRequired("filter")
+
+	rootCmd.AddCommand(awaitCmd)
+}
+
+var awaitCmd = &cobra.Command{
+	Use:   "await",
+	Short: "Wait for a record matching a filter to arrive",
+	Long: `Tails every shard of a stream until a record whose payload matches --filter arrives, prints it,
+and exits. The command exits non-zero if no record matches within --timeout, so integration tests
+can wait on an event their system under test should publish.
+
+The filter is a jq expression evaluated against each decoded JSON payload, and matches if its
+first result is anything other than false or null. Payloads that aren't JSON, or that the
+expression fails on, don't match.
+
+Only records arriving after the command starts are considered unless --from is given, so use
+--from when the record may have been published before await was started.
+
+Example:
+  kin await -n orders --filter '.orderId=="123" and .status=="SHIPPED"' --timeout 2m`,
+	Run: runAwaitCmd,
+}
+
+func runAwaitCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	filterS, _ := cmd.Flags().GetString("filter")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	fromS, _ := cmd.Flags().GetString("from")
+	count, _ := cmd.Flags().GetInt("count")
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+
+	filter, err := newJQFilter(filterS)
+	if err != nil {
+		cmd.PrintErrln("invalid --filter:", err)
+		os.Exit(1)
+	}
+
+	from := time.Now()
+	if fromS != "" {
+		from, err = ParseTimeOrAgo(fromS, from)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+
+	tailOptions := &TailOptions{AtTimestamp: &from, PollInterval: pollInterval}
+	if err := parseRecordOutputOpts(cmd.Flags(), tailOptions); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if tailOptions.NoData {
+		cmd.PrintErrln("--no-data can't be used with await, which filters on the payload")
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shardIds, err := getShardIds(client, &streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+
+	records := make(chan *RecordOutput)
+	for _, shardId := range shardIds {
+		go func() {
+			if err := tailStreamShard(ctx, client, &streamName, shardId, tailOptions, records); err != nil {
+				cmd.PrintErrf("%s: %s\n", *shardId, err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	matched := 0
+	for matched < count {
+		select {
+		case record := <-records:
+			if record.Data == nil || !filter.Match(ctx, *record.Data) {
+				continue
+			}
+
+			jsonBytes, _ := sink.MarshalRecord(record, tailOptions.FieldCase)
+			fmt.Println(string(jsonBytes))
+			matched++
+
+		case <-ctx.Done():
+			cmd.PrintErrf("%d of %d matching records arrived within %s\n", matched, count, timeout)
+			os.Exit(1)
+		}
+	}
+}
+
+// jqFilter matches decoded payloads against a jq expression.
+type jqFilter struct {
+	code *gojq.Code
+}
+
+func newJQFilter(expr string) (*jqFilter, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return &jqFilter{code}, nil
+}
+
+// Match returns whether the first result of the expression for payload is truthy: anything but
+// false or null. An expression that fails, or has no results, doesn't match.
+func (f *jqFilter) Match(ctx context.Context, payload interface{}) bool {
+	matched, _ := f.Eval(ctx, payload)
+	return matched
+}
+
+// Eval is Match, but returns the error an expression fails with.
+func (f *jqFilter) Eval(ctx context.Context, payload interface{}) (bool, error) {
+	result, ok := f.code.RunWithContext(ctx, decode.Plain(payload)).Next()
+	if !ok {
+		return false, nil
+	}
+	if err, failed := result.(error); failed {
+		return false, err
+	}
+	return result != nil && result != false, nil
+}
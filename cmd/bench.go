@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	mathrand "math/rand"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type BenchReport struct {
+	Duration         float64            `json:"duration_seconds"`
+	Records          int                `json:"records"`
+	Bytes            int                `json:"bytes"`
+	Throttles        int                `json:"throttles"`
+	Errors           int                `json:"errors"`
+	RecordsPerSecond float64            `json:"records_per_second"`
+	BytesPerSecond   float64            `json:"bytes_per_second"`
+	Shards           []BenchShardReport `json:"shards"`
+}
+
+type BenchShardReport struct {
+	ShardId   string  `json:"shard_id"`
+	Records   int     `json:"records"`
+	Throttles int     `json:"throttles"`
+	Errors    int     `json:"errors"`
+	P50       float64 `json:"p50_ms"`
+	P95       float64 `json:"p95_ms"`
+	P99       float64 `json:"p99_ms"`
+}
+
+// benchShard accumulates results for a single shard. Throttled and failed puts have no shard in
+// their response, so they are attributed to the shard the partition key hashes to.
+type benchShard struct {
+	records   int
+	throttles int
+	errors    int
+	latencies []time.Duration
+}
+
+type benchRecorder struct {
+	mu     sync.Mutex
+	shards map[string]*benchShard
+	bytes  int
+}
+
+func (r *benchRecorder) shard(shardId string) *benchShard {
+	s, ok := r.shards[shardId]
+	if !ok {
+		s = &benchShard{}
+		r.shards[shardId] = s
+	}
+	return s
+}
+
+func (r *benchRecorder) Observe(shardId string, size int, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.shard(shardId)
+	var throttled *types.ProvisionedThroughputExceededException
+	switch {
+	case errors.As(err, &throttled):
+		s.throttles++
+	case err != nil:
+		s.errors++
+	default:
+		s.records++
+		s.latencies = append(s.latencies, latency)
+		r.bytes += size
+	}
+}
+
+func (r *benchRecorder) Report(elapsed time.Duration) BenchReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := BenchReport{
+		Duration: elapsed.Seconds(),
+		Bytes:    r.bytes,
+		Shards:   []BenchShardReport{},
+	}
+	for shardId, s := range r.shards {
+		slices.Sort(s.latencies)
+		report.Shards = append(report.Shards, BenchShardReport{
+			ShardId:   shardId,
+			Records:   s.records,
+			Throttles: s.throttles,
+			Errors:    s.errors,
+			P50:       percentileMillis(s.latencies, 0.50),
+			P95:       percentileMillis(s.latencies, 0.95),
+			P99:       percentileMillis(s.latencies, 0.99),
+		})
+		report.Records += s.records
+		report.Throttles += s.throttles
+		report.Errors += s.errors
+	}
+	sort.Slice(report.Shards, func(i, j int) bool {
+		return report.Shards[i].ShardId < report.Shards[j].ShardId
+	})
+
+	if elapsed > 0 {
+		report.RecordsPerSecond = float64(report.Records) / elapsed.Seconds()
+		report.BytesPerSecond = float64(report.Bytes) / elapsed.Seconds()
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return sorted[i]
+}
+
+// percentileMillis returns the nearest-rank percentile p of sorted, in milliseconds.
+func percentileMillis(sorted []time.Duration, p float64) float64 {
+	return float64(percentile(sorted, p).Microseconds()) / 1000
+}
+
+func init() {
+	benchCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	benchCmd.Flags().Duration("duration", 30*time.Second, "How long to write for")
+	benchCmd.Flags().Int("record-size", 1024, "Size in bytes of each record's payload")
+	benchCmd.Flags().Int("keys", 0, "Number of distinct partition keys to spread records across; random keys are used if 0")
+	benchCmd.Flags().Int("concurrency", 16, "Number of PutRecord calls in flight at once")
+	benchCmd.Flags().StringP("output", "o", "table", "Report format: table or json")
+	addRateLimitFlags(benchCmd.Flags())
+	benchCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(benchCmd)
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure write throughput and latency against a Kinesis Data Stream",
+	Long: `Writes records to the target stream for a fixed duration, optionally paced with --rate and
+--bytes-rate, and reports the throughput achieved along with throttle counts and PutRecord latency
+percentiles for each shard.
+
+Throttled calls are not retried, so the throttle count reflects how far the requested rate exceeds
+what the stream can accept. This makes it useful for capacity planning before a launch, but note
+that the records written are real: run it against a stream whose consumers can ignore them.
+
+Example:
+  kin bench -n my-stream --rate 2000/s --duration 1m --record-size 512`,
+	Run: runBenchCmd,
+}
+
+func runBenchCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	recordSize, _ := cmd.Flags().GetInt("record-size")
+	keys, _ := cmd.Flags().GetInt("keys")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if recordSize < 1 || recordSize > maxRecordSize {
+		cmd.PrintErrf("--record-size must be between 1 and %d\n", maxRecordSize)
+		os.Exit(1)
+	}
+	if concurrency < 1 {
+		cmd.PrintErrln("--concurrency must be at least 1")
+		os.Exit(1)
+	}
+
+	limiter, err := NewWriteLimiterFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	// Throttles should be counted rather than hidden behind the SDK's retries
+	client, err := aws.GetKinesisClient(func(o *kinesis.Options) {
+		o.Retryer = awssdk.NopRetryer{}
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	payload := make([]byte, (recordSize+1)/2)
+	rand.Read(payload)
+	data := []byte(hex.EncodeToString(payload)[:recordSize])
+
+	nextKey := randomPartitionKey
+	if keys > 0 {
+		nextKey = func() string { return fmt.Sprintf("key-%d", mathrand.Intn(keys)) }
+	}
+
+	recorder := &benchRecorder{shards: map[string]*benchShard{}}
+	start := time.Now()
+
+	finish := sync.OnceFunc(func() {
+		printBenchReport(recorder.Report(time.Since(start)), output)
+	})
+	onShutdown(finish)
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key := nextKey()
+				if err := limiter.Wait(ctx, len(data)+len(key)); err != nil || ctx.Err() != nil {
+					return
+				}
+
+				putStart := time.Now()
+				output, err := client.PutRecord(ctx, &kinesis.PutRecordInput{
+					Data:         data,
+					PartitionKey: &key,
+					StreamName:   &streamName,
+				})
+				latency := time.Since(putStart)
+
+				// A put cut short by the end of the run says nothing about the stream
+				if ctx.Err() != nil {
+					return
+				}
+
+				shardId := "unknown"
+				if err == nil {
+					shardId = *output.ShardId
+				} else if shard := shardForHashKey(shards, hashKeyForPartitionKey(key)); shard != nil {
+					shardId = *shard.ShardId
+				}
+				if err != nil {
+					slog.Debug("put failed", "shard", shardId, "error", err)
+				}
+				recorder.Observe(shardId, len(data)+len(key), latency, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	finish()
+}
+
+func printBenchReport(report BenchReport, output string) {
+	if output == "json" {
+		printJSON(report)
+		return
+	}
+
+	rows := [][]string{}
+	for _, shard := range report.Shards {
+		rows = append(rows, []string{
+			shard.ShardId,
+			fmt.Sprint(shard.Records),
+			fmt.Sprint(shard.Throttles),
+			fmt.Sprint(shard.Errors),
+			fmt.Sprintf("%.1f", shard.P50),
+			fmt.Sprintf("%.1f", shard.P95),
+			fmt.Sprintf("%.1f", shard.P99),
+		})
+	}
+	printTable(os.Stdout, []string{"SHARD", "RECORDS", "THROTTLES", "ERRORS", "P50 MS", "P95 MS", "P99 MS"}, rows)
+
+	fmt.Printf("\n%d records (%s) in %.1fs: %.1f records/s, %s/s; %d throttled, %d failed\n",
+		report.Records,
+		formatBytes(float64(report.Bytes)),
+		report.Duration,
+		report.RecordsPerSecond,
+		formatBytes(report.BytesPerSecond),
+		report.Throttles,
+		report.Errors,
+	)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"kin/pkg/aws"
+	"kin/pkg/checkpoint"
+	"strings"
+	"time"
+)
+
+// Checkpointer tracks the last sequence number consumed from each shard of a stream; see
+// checkpoint.Store.
+type Checkpointer = checkpoint.Store
+
+// Attribute names and values used by the Kinesis Client Library's lease table
+const (
+	kclLeaseKey                     = checkpoint.LeaseKeyAttribute
+	kclCheckpoint                   = checkpoint.CheckpointAttribute
+	kclLeaseCounter                 = checkpoint.LeaseCounterAttribute
+	kclOwnerSwitchesSinceCheckpoint = checkpoint.OwnerSwitchesSinceCheckpointAttribute
+	kclLeaseOwner                   = checkpoint.LeaseOwnerAttribute
+	kclShardEnd                     = checkpoint.ShardEnd
+)
+
+// NewCheckpointer creates a Checkpointer from a URI of the form file://<path> or
+// dynamodb://<table>. A bare path is treated as a file. For DynamoDB, the table defaults to the
+// KCL application name when omitted, matching the KCL's own default.
+func NewCheckpointer(uri, streamName, appName string) (Checkpointer, error) {
+	switch {
+	case strings.HasPrefix(uri, "dynamodb://"):
+		table := strings.TrimPrefix(uri, "dynamodb://")
+		if table == "" {
+			table = appName
+		}
+		if table == "" {
+			return nil, errors.New("a DynamoDB checkpoint requires a table name or --app-name")
+		}
+
+		return newDynamoDBCheckpointer(table)
+
+	default:
+		return checkpoint.LoadFile(strings.TrimPrefix(uri, "file://"), streamName)
+	}
+}
+
+func newDynamoDBCheckpointer(table string) (*checkpoint.DynamoDB, error) {
+	client, err := aws.GetDynamoDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint.NewDynamoDB(client, table), nil
+}
+
+// runCheckpointer flushes checkpoints every interval, forever. Errors are reported through
+// onError.
+func runCheckpointer(c Checkpointer, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := c.Flush(); err != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// completionTimeout bounds the AWS calls made to complete a flag, so that a slow or unreachable
+// endpoint doesn't hang the shell
+const completionTimeout = 5 * time.Second
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Generate a shell completion script",
+	Long: `Writes a completion script for the given shell to stdout. Besides commands and flags, it completes
+--stream-name with the account's streams, --shard with the stream's shards and --alias with the
+config file's stream aliases, using the profile, region and other flags given so far.
+
+To load completions in the current shell:
+
+  bash:  source <(kin completion bash)
+  zsh:   source <(kin completion zsh)
+  fish:  kin completion fish | source
+
+To load them in every new shell, write the script to your shell's completions directory, such as
+/etc/bash_completion.d/kin, a directory in zsh's $fpath as _kin, or
+~/.config/fish/completions/kin.fish.`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	DisableFlagsInUseLine: true,
+
+	// Writing a script doesn't need AWS or the config file
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			err = rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			err = rootCmd.GenFishCompletion(os.Stdout, true)
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// flagCompletions are the functions that complete flags' values, by flag name
+var flagCompletions = map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+	"stream-name":    completeStreamNames,
+	"shard":          completeShardIds,
+	"adjacent-shard": completeShardIds,
+	"alias":          completeAliases,
+}
+
+// registerFlagCompletions registers flagCompletions for the flags of cmd and every command below
+// it. It's called once every command has been added, since each defines its own flags.
+func registerFlagCompletions(cmd *cobra.Command) {
+	for name, complete := range flagCompletions {
+		if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+			cmd.RegisterFlagCompletionFunc(name, complete)
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		registerFlagCompletions(sub)
+	}
+}
+
+// configureCompletion sets up AWS for a completion function as the command itself would be, from
+// the flags, environment variables and config file, without logging anything to the shell.
+func configureCompletion(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := applyEnv(cmd); err != nil {
+		return nil, nil, err
+	}
+	if err := loadConfig(cmd); err != nil {
+		return nil, nil, err
+	}
+	if err := configureAWS(cmd); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	return ctx, cancel, nil
+}
+
+// completeStreamNames completes the names of the account's streams.
+func completeStreamNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ctx, cancel, err := configureCompletion(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer cancel()
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	streams, err := listStreams(ctx, client, toComplete, nil)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	names := make([]string, len(streams))
+	for i, stream := range streams {
+		names[i] = stream.StreamName
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeShardIds completes the ids of the shards of the stream given so far, describing closed
+// ones as such.
+func completeShardIds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ctx, cancel, err := configureCompletion(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer cancel()
+
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	if streamName == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var ids []string
+	for _, shard := range shards {
+		id := awssdk.ToString(shard.ShardId)
+		if !strings.HasPrefix(id, toComplete) {
+			continue
+		}
+		if shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+			id += "\tclosed"
+		}
+		ids = append(ids, id)
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAliases completes the names of the config file's stream aliases.
+func completeAliases(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := applyEnv(cmd); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	path, _, err := configPath(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var aliases []string
+	for alias := range v.GetStringMap(streamAliasesKey) {
+		if strings.HasPrefix(alias, toComplete) {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,469 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	configCmd.AddCommand(configSaveSessionCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the config file of flag defaults and stream aliases",
+	Long: `Manages the config file, ~/.kin.yaml unless --config names another, which holds defaults for
+flags, at the top level for every command and under a command's name for that command alone, and
+stream aliases in its streams section. An alias is a set of flags, such as the stream, region,
+profile, decoders and filter, which any command uses when given @<alias>:
+
+  streams:
+    prod-orders:
+      stream-name: orders
+      region: us-east-1
+      profile: prod
+      decode: gzip,json
+
+  kin tail @prod-orders
+
+Flags given on the command line and their KIN_* environment variables override an alias's values,
+which override the command's section, which overrides the top level.`,
+}
+
+var configSaveSessionCmd = &cobra.Command{
+	Use:   "save-session alias -- command [flags...]",
+	Short: "Save the flags given to a command as a stream alias",
+	Long: `Saves the flags given to a command in the config file as a stream alias, replacing any alias of
+the same name, so that the same session can be resumed with @<alias>:
+
+  kin config save-session prod-orders -- tail -n orders --profile prod --decode gzip,json
+  kin tail @prod-orders
+
+Only flags are saved, not the command: an alias's flags are used by any command that has them,
+so one saved from tail works with describe or export as well.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		alias := args[0]
+		if !aliasPattern.MatchString(alias) {
+			cmd.PrintErrf("invalid alias %q: must be letters, digits, - and _\n", alias)
+			os.Exit(1)
+		}
+
+		values, err := sessionFlags(args[1:])
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		path, _, err := configPath(cmd)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		if err := saveStreamAlias(path, alias, values); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Saved %d flags to %s as @%s\n", len(values.Content)/2, path, alias)
+	},
+}
+
+// defaultConfigName is the config file read from the home directory when --config isn't given
+const defaultConfigName = ".kin.yaml"
+
+// loadConfig reads the config file and uses it for the defaults of the flags that weren't given.
+// The file holds flag names and values, at the top level for every command that has the flag and
+// under a command's name, such as tail or consumers.list, for that command alone. Its streams
+// section holds aliases, each a set of flags to use with --alias or @<alias>:
+//
+//	region: eu-west-1
+//	profile: dev
+//	tail:
+//	  output: logfmt
+//	  decode: gzip,json
+//	streams:
+//	  prod-orders:
+//	    stream-name: orders
+//	    profile: prod
+//	    filter: '.status=="FAILED"'
+//
+// An alias's values override the command's, which override the top-level ones, and flags and
+// their KIN_* environment variables override all of them. Without --config, a missing ~/.kin.yaml
+// isn't an error.
+func loadConfig(cmd *cobra.Command) error {
+	alias, _ := cmd.Flags().GetString("alias")
+	path, explicit, err := configPath(cmd)
+	if err != nil {
+		if alias == "" {
+			return nil
+		}
+		return err
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		if !explicit && alias == "" && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	if err := applyConfig(cmd, v, alias); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// configPath returns the path of the config file, and whether it was given rather than the
+// default.
+func configPath(cmd *cobra.Command) (string, bool, error) {
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		return path, true, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false, err
+	}
+	return filepath.Join(home, defaultConfigName), false, nil
+}
+
+// applyConfig sets the flags of cmd that weren't given from v, preferring the alias's values and
+// then the command's section.
+func applyConfig(cmd *cobra.Command, v *viper.Viper, alias string) error {
+	section := configSection(cmd)
+	if err := checkConfigSection(cmd, v, section); err != nil {
+		return err
+	}
+
+	var aliasKey string
+	if alias != "" {
+		aliasKey = streamAliasesKey + "." + alias
+		if err := checkStreamAlias(cmd.Root(), v, alias); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || err != nil {
+			return
+		}
+
+		key := flag.Name
+		switch {
+		case aliasKey != "" && v.IsSet(aliasKey+"."+flag.Name):
+			key = aliasKey + "." + flag.Name
+		case section != "" && v.IsSet(section+"."+flag.Name):
+			key = section + "." + flag.Name
+		case !v.IsSet(key):
+			return
+		case isCommandName(cmd.Root(), key):
+			// A top-level key naming a command is that command's section, not a value for a
+			// flag that happens to share its name
+			return
+		}
+		if _, isSection := v.Get(key).(map[string]interface{}); isSection && key == flag.Name {
+			return
+		}
+
+		if setErr := setFlagFromConfig(flag, v.Get(key)); setErr != nil {
+			err = fmt.Errorf("%s: %w", key, setErr)
+		}
+	})
+	return err
+}
+
+// isCommandName reports whether name is one of root's subcommands, or an alias of one.
+func isCommandName(root *cobra.Command, name string) bool {
+	for _, c := range root.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// configSection returns the key of a command's section of the config file: its path below the
+// root, separated by dots.
+func configSection(cmd *cobra.Command) string {
+	var names []string
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		names = append([]string{c.Name()}, names...)
+	}
+	return strings.Join(names, ".")
+}
+
+// checkConfigSection fails if a command's section has a key that's neither one of its flags nor
+// the section of one of its subcommands, so that misspelled flags aren't silently ignored.
+func checkConfigSection(cmd *cobra.Command, v *viper.Viper, section string) error {
+	if section == "" {
+		return nil
+	}
+
+	values, ok := v.Get(section).(map[string]interface{})
+	if !ok {
+		if v.IsSet(section) {
+			return fmt.Errorf("%s must hold flag names and values", section)
+		}
+		return nil
+	}
+
+	for key := range values {
+		if cmd.Flags().Lookup(key) != nil {
+			continue
+		}
+		if sub, _, err := cmd.Find([]string{key}); err == nil && sub != cmd {
+			continue
+		}
+		return fmt.Errorf("%s: %s has no flag --%s", section+"."+key, cmd.CommandPath(), key)
+	}
+	return nil
+}
+
+// streamAliasesKey is the section of the config file holding stream aliases
+const streamAliasesKey = "streams"
+
+// aliasPattern is what alias names may be made of, leaving out the dots that separate the config
+// file's keys.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// checkStreamAlias fails if the alias isn't in the config file, or has a key that no command has a
+// flag for. Other keys are fine, since an alias is used with commands that have different flags,
+// such as --filter for tail but not for describe.
+func checkStreamAlias(root *cobra.Command, v *viper.Viper, alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q: must be letters, digits, - and _", alias)
+	}
+
+	key := streamAliasesKey + "." + alias
+	values, ok := v.Get(key).(map[string]interface{})
+	if !ok {
+		if v.IsSet(key) {
+			return fmt.Errorf("%s must hold flag names and values", key)
+		}
+		return fmt.Errorf("no stream alias %s in its %s section", alias, streamAliasesKey)
+	}
+
+	for name := range values {
+		if name == "alias" || name == "config" || !anyCommandHasFlag(root, name) {
+			return fmt.Errorf("%s.%s: no command has a flag --%s that an alias can set", key, name, name)
+		}
+	}
+	return nil
+}
+
+// anyCommandHasFlag reports whether cmd or any command below it has the flag.
+func anyCommandHasFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if anyCommandHasFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandAliasArgs replaces each @<alias> argument with --alias=<alias>, unless it's the value of
+// the flag before it or comes after --.
+func expandAliasArgs(args []string) []string {
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		cmd = rootCmd
+	}
+
+	expanded := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...)
+		}
+
+		alias, ok := strings.CutPrefix(arg, "@")
+		if ok && aliasPattern.MatchString(alias) && (i == 0 || !flagTakesValue(cmd, args[i-1])) {
+			arg = "--alias=" + alias
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// flagTakesValue reports whether arg is a flag of cmd whose value is the next argument.
+func flagTakesValue(cmd *cobra.Command, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+
+	var flag *pflag.Flag
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		flag = cmd.Flags().Lookup(name)
+		if flag == nil {
+			flag = cmd.InheritedFlags().Lookup(name)
+		}
+	} else {
+		shorthand := arg[len(arg)-1:]
+		flag = cmd.Flags().ShorthandLookup(shorthand)
+		if flag == nil {
+			flag = cmd.InheritedFlags().ShorthandLookup(shorthand)
+		}
+	}
+	return flag != nil && flag.NoOptDefVal == ""
+}
+
+// setFlagFromConfig sets a flag to a value from the config file as its default, so that it isn't
+// taken to have been given. Required flags are the exception, since the config file satisfies
+// them.
+func setFlagFromConfig(flag *pflag.Flag, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return errors.New("expected a value")
+
+	case map[string]interface{}:
+		return errors.New("expected a value, not a map")
+
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			if err := slice.Replace(items); err != nil {
+				return err
+			}
+		} else if err := flag.Value.Set(strings.Join(items, ",")); err != nil {
+			return err
+		}
+
+	default:
+		if err := flag.Value.Set(fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+
+	if _, required := flag.Annotations[cobra.BashCompOneRequiredFlag]; required {
+		flag.Changed = true
+	}
+	return nil
+}
+
+// sessionFlags parses the flags of the command args names, returning the ones given as a YAML
+// mapping of flag names to values.
+func sessionFlags(args []string) (*yaml.Node, error) {
+	target, flagArgs, err := rootCmd.Find(args)
+	if err != nil {
+		return nil, err
+	}
+	if target == rootCmd {
+		return nil, fmt.Errorf("unknown command %q", args[0])
+	}
+
+	if err := target.ParseFlags(flagArgs); err != nil {
+		return nil, err
+	}
+	if extra := target.Flags().Args(); len(extra) > 0 {
+		return nil, fmt.Errorf("only flags can be saved, not %q", extra[0])
+	}
+
+	values := &yaml.Node{Kind: yaml.MappingNode}
+	target.Flags().Visit(func(flag *pflag.Flag) {
+		if flag.Name == "alias" || flag.Name == "config" || flag.Name == "help" {
+			return
+		}
+
+		value := &yaml.Node{}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			value.Encode(slice.GetSlice())
+		} else {
+			value.Encode(flag.Value.String())
+		}
+		values.Content = append(values.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: flag.Name}, value)
+	})
+	if len(values.Content) == 0 {
+		return nil, fmt.Errorf("no flags given to %s to save", target.CommandPath())
+	}
+	return values, nil
+}
+
+// saveStreamAlias sets an alias in the config file at path, creating the file if there isn't one.
+// The rest of the file is left as it was, comments and all.
+func saveStreamAlias(path, alias string, values *yaml.Node) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file %s must hold flag names and values", path)
+	}
+
+	streams := yamlMapping(root, streamAliasesKey)
+	if streams == nil {
+		return fmt.Errorf("config file %s: %s must hold stream aliases", path, streamAliasesKey)
+	}
+	setYAMLKey(streams, alias, values)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0o600)
+}
+
+// yamlMapping returns the mapping under key in node, adding an empty one if there isn't one, or
+// nil if key holds something else.
+func yamlMapping(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			continue
+		}
+		value := node.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			value.Kind, value.Tag = yaml.MappingNode, ""
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil
+		}
+		return value
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	setYAMLKey(node, key, value)
+	return value
+}
+
+// setYAMLKey sets key in a mapping node to value, replacing its value if it's already there.
+func setYAMLKey(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	consumersCmd.PersistentFlags().StringP("stream-name", "n", "", "Stream name (required)")
+	consumersCmd.MarkPersistentFlagRequired("stream-name")
+
+	consumersListCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	consumersRegisterCmd.Flags().Bool("wait", false, "Wait until the consumer is ACTIVE before exiting")
+	consumersDeregisterCmd.Flags().Bool("wait", false, "Wait until the consumers have been deleted before exiting")
+
+	consumersCmd.AddCommand(consumersListCmd, consumersRegisterCmd, consumersDeregisterCmd)
+	rootCmd.AddCommand(consumersCmd)
+}
+
+var consumersCmd = &cobra.Command{
+	Use:   "consumers",
+	Short: "Manage a stream's enhanced fan-out consumers",
+	Long: `Lists, registers and deregisters enhanced fan-out consumers. Each stream allows only a limited
+number of these, so it's worth checking which applications hold them and cleaning up any that are
+no longer used.`,
+}
+
+var consumersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a stream's enhanced fan-out consumers",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := validateOutput(output, "table", "json"); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		client, streamARN := consumersClient(cmd, streamName)
+		consumers, err := listStreamConsumers(cmd.Context(), client, streamARN)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		descriptions := []ConsumerDescription{}
+		for _, consumer := range consumers {
+			descriptions = append(descriptions, ConsumerDescription{
+				ConsumerName: awssdk.ToString(consumer.ConsumerName),
+				ConsumerARN:  awssdk.ToString(consumer.ConsumerARN),
+				Status:       string(consumer.ConsumerStatus),
+				CreatedAt:    consumer.ConsumerCreationTimestamp,
+			})
+		}
+
+		if output == "json" {
+			for _, description := range descriptions {
+				printJSON(description)
+			}
+			return
+		}
+
+		rows := [][]string{}
+		for _, d := range descriptions {
+			created := "-"
+			if d.CreatedAt != nil {
+				created = d.CreatedAt.Format(time.RFC3339)
+			}
+			rows = append(rows, []string{d.ConsumerName, d.Status, created, d.ConsumerARN})
+		}
+		printTable(os.Stdout, []string{"CONSUMER", "STATUS", "CREATED", "ARN"}, rows)
+	},
+}
+
+var consumersRegisterCmd = &cobra.Command{
+	Use:   "register name",
+	Short: "Register an enhanced fan-out consumer",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+		wait, _ := cmd.Flags().GetBool("wait")
+		consumerName := args[0]
+
+		client, streamARN := consumersClient(cmd, streamName)
+		output, err := client.RegisterStreamConsumer(cmd.Context(), &kinesis.RegisterStreamConsumerInput{
+			StreamARN:    &streamARN,
+			ConsumerName: &consumerName,
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		fmt.Println(*output.Consumer.ConsumerARN)
+
+		if !wait {
+			return
+		}
+		if err := waitForConsumer(cmd.Context(), client, streamARN, consumerName, types.ConsumerStatusActive); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Consumer %s is ACTIVE\n", consumerName)
+	},
+}
+
+var consumersDeregisterCmd = &cobra.Command{
+	Use:   "deregister name...",
+	Short: "Deregister enhanced fan-out consumers",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		client, streamARN := consumersClient(cmd, streamName)
+		for _, consumerName := range args {
+			_, err := client.DeregisterStreamConsumer(cmd.Context(), &kinesis.DeregisterStreamConsumerInput{
+				StreamARN:    &streamARN,
+				ConsumerName: &consumerName,
+			})
+			if err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+			cmd.PrintErrf("Deregistering consumer %s\n", consumerName)
+		}
+
+		if !wait {
+			return
+		}
+		for _, consumerName := range args {
+			if err := waitForConsumer(cmd.Context(), client, streamARN, consumerName, ""); err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+			cmd.PrintErrf("Consumer %s deleted\n", consumerName)
+		}
+	},
+}
+
+// consumersClient returns a Kinesis client and the stream's ARN, which the consumer APIs take in
+// place of its name.
+func consumersClient(cmd *cobra.Command, streamName string) (aws.KinesisAPI, string) {
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	return client, *output.StreamDescriptionSummary.StreamARN
+}
+
+// waitForConsumer polls until the consumer reaches status, or if status is empty, until it no
+// longer exists.
+func waitForConsumer(ctx context.Context, client aws.KinesisAPI, streamARN, consumerName string, status types.ConsumerStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, streamWaitTimeout)
+	defer cancel()
+
+	for {
+		output, err := client.DescribeStreamConsumer(ctx, &kinesis.DescribeStreamConsumerInput{
+			StreamARN:    &streamARN,
+			ConsumerName: &consumerName,
+		})
+		var notFound *types.ResourceNotFoundException
+		switch {
+		case errors.As(err, &notFound) && status == "":
+			return nil
+		case err != nil:
+			return err
+		case output.ConsumerDescription.ConsumerStatus == status:
+			return nil
+		}
+		slog.Info(
+			"waiting for consumer",
+			"consumer", consumerName,
+			"status", output.ConsumerDescription.ConsumerStatus,
+		)
+
+		aws.SleepContext(ctx, streamPollInterval)
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for consumer %s: %w", consumerName, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/producer"
+	"kin/pkg/transform"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// How long records read from the source may wait before being written, when there aren't enough
+// to fill a batch
+const copyFlushInterval = time.Second
+
+func init() {
+	copyCmd.Flags().StringP("stream-name", "n", "", "Source stream name (required)")
+	copyCmd.Flags().String("dest-stream", "", "Destination stream name (required)")
+	copyCmd.Flags().String("dest-region", "", "Region of the destination stream; defaults to the source's")
+	copyCmd.Flags().String("dest-profile", "", "Shared config profile to use for the destination stream, for copying into another account")
+	copyCmd.Flags().String("from", "", "Copy records from this long ago or from this RFC 3339 timestamp, rather than only new records")
+	copyCmd.Flags().String("until", "", "Stop once every shard has been copied up to this long ago or this RFC 3339 timestamp, rather than copying forever")
+	copyCmd.Flags().String("checkpoint", "", "Checkpoint store URI, either file://<path> or dynamodb://<table>, recording what has been copied so that a later copy resumes after it")
+	copyCmd.Flags().String("app-name", "", "KCL application name; used as the lease table name when --checkpoint is dynamodb:// without a table")
+	copyCmd.Flags().Int("max-attempts", 5, "Maximum number of attempts to write each record before giving up on it")
+	copyCmd.Flags().Duration("progress-interval", 10*time.Second, "How often to report progress to stderr")
+	addCELTransformFlag(copyCmd.Flags())
+	addErrorPolicyFlags(copyCmd.Flags())
+	addProgressFlag(copyCmd.Flags())
+	addRateLimitFlags(copyCmd.Flags())
+	copyCmd.MarkFlagRequired("stream-name")
+	copyCmd.MarkFlagRequired("dest-stream")
+
+	rootCmd.AddCommand(copyCmd)
+}
+
+var copyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy records from one stream to another",
+	Long: `Reads every shard of the source stream and writes each record to the destination stream with
+the same partition key and payload, using PutRecords with retries as put-batch does. The destination
+may be in another region (--dest-region) or, through a shared config profile, another account
+(--dest-profile).
+
+By default only new records are copied, until interrupted. --from starts from a point in the past,
+and --until stops once every shard has been copied up to a point, so that a bounded range can be
+copied for a migration or to refresh a staging stream. A summary is printed when done, and the
+command exits non-zero if any records could not be written.
+
+With --checkpoint, each shard's progress is recorded once its records have been written, and a
+later copy with the same checkpoint resumes each shard after it rather than at --from. Once any
+record read from a shard fails to be written, the shard's checkpoint stays where it was, so that
+resuming retries it, along with the records after it that were written.
+
+--transform rewrites each payload with a CEL expression before it's written, seeing it as data
+decoded the way tail decodes it. Strings and bytes are written as they are, and anything else as
+JSON; records the expression fails on are counted as failed.
+
+--strict stops at the first record that can't be transformed or written, exiting non-zero once
+what was read before it has been written and checkpointed. --skip-errors leaves such records out
+and summarizes how many were, exiting zero.
+
+--progress json writes a line of JSON to stderr for each step, such as a batch being read or a
+checkpoint being written, ending with a done event, alongside the periodic progress report.
+
+Records are written in the order they're read from each shard, but retried records may land after
+records read later. Explicit hash keys aren't returned by GetRecords, so records written with one
+are routed by their partition key in the destination.`,
+	Run: runCopyCmd,
+}
+
+func runCopyCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	destStream, _ := cmd.Flags().GetString("dest-stream")
+	destRegion, _ := cmd.Flags().GetString("dest-region")
+	destProfile, _ := cmd.Flags().GetString("dest-profile")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+	checkpointURI, _ := cmd.Flags().GetString("checkpoint")
+	appName, _ := cmd.Flags().GetString("app-name")
+	progressInterval, _ := cmd.Flags().GetDuration("progress-interval")
+	if progressInterval <= 0 {
+		cmd.PrintErrln("--progress-interval must be positive")
+		os.Exit(1)
+	}
+	stage, err := celTransformFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	errs, err := errorPolicyFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	progress, err := progressFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	from := time.Now()
+	var until *time.Time
+	switch {
+	case untilS != "":
+		if fromS == "" {
+			cmd.PrintErrln("--until requires --from")
+			os.Exit(1)
+		}
+		f, u, err := parseTimeRange(fromS, untilS)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		from, until = f, &u
+
+	case fromS != "":
+		var err error
+		from, err = ParseTimeOrAgo(fromS, from)
+		if err != nil {
+			cmd.PrintErrln("invalid --from:", err)
+			os.Exit(1)
+		}
+	}
+
+	opts, err := producerOptions(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	source, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var destOptions []func(*config.LoadOptions) error
+	if destRegion != "" {
+		destOptions = append(destOptions, config.WithRegion(destRegion))
+	}
+	if destProfile != "" {
+		destOptions = append(destOptions, config.WithSharedConfigProfile(destProfile))
+	}
+	dest, err := aws.GetKinesisClientWithConfig(destOptions...)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), source, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var checkpointer Checkpointer
+	if checkpointURI != "" {
+		checkpointer, err = NewCheckpointer(checkpointURI, streamName, appName)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		checkpointer = progress.Checkpointer(checkpointer)
+	}
+
+	p := producer.New(dest, destStream, append(opts, producer.WithMaxAttempts(maxAttempts))...)
+	stats := NewTailStats()
+	tailOptions := &TailOptions{
+		AtTimestamp:  &from,
+		NoData:       true,
+		IncludeRaw:   true,
+		Stats:        stats,
+		Checkpointer: checkpointer,
+		Resume:       checkpointer != nil,
+		Progress:     progress,
+	}
+
+	report := func() {
+		var read, millisBehind int64
+		for _, totals := range stats.Shards() {
+			read += totals.Records
+			millisBehind = max(millisBehind, totals.MillisBehindLatest)
+		}
+		summary := p.Summary()
+		cmd.PrintErrf(
+			"[copy] read %d, written %d, failed %d, retries %d, behind %s\n",
+			read, summary.Succeeded, summary.Failed, summary.Retries,
+			formatMillis(float64(millisBehind), 0),
+		)
+	}
+	onShutdown(report)
+
+	// Closed shards hold the records from before the stream was last resharded, so they're only
+	// left out when copying new records
+	var shardIds []string
+	for _, shard := range shards {
+		if fromS != "" || isOpenShard(shard) {
+			shardIds = append(shardIds, *shard.ShardId)
+		}
+	}
+	progress.ShardsDiscovered(shardIds)
+
+	records := make(chan *RecordOutput)
+	var wg sync.WaitGroup
+	for _, shardId := range shardIds {
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var err error
+			if until == nil {
+				err = tailStreamShard(cmd.Context(), source, &streamName, &shardId, tailOptions, records)
+			} else {
+				logger := slog.With("shard", shardId)
+				err = scanShard(cmd.Context(), source, streamName, shardId, tailOptions, func(record types.Record, millisBehindLatest *int64) bool {
+					if record.ApproximateArrivalTimestamp.After(*until) {
+						return false
+					}
+					stats.Observe(shardId, 1, len(record.Data), millisBehindLatest)
+					output := newRecordOutput(&shardId, record, millisBehindLatest, tailOptions, logger)
+					records <- &output
+					return true
+				})
+			}
+			if err != nil {
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+			}
+			progress.ShardDone(shardId, err)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	err = copyRecords(cmd.Context(), p, checkpointer, stage, errs, records, report, progressInterval)
+
+	summary := p.Summary()
+	jsonBytes, _ := json.Marshal(summary)
+	fmt.Println(string(jsonBytes))
+	progress.Done(map[string]interface{}{
+		"succeeded": summary.Succeeded,
+		"failed":    summary.Failed,
+		"retries":   summary.Retries,
+	})
+
+	if err != nil {
+		cmd.PrintErrln(err)
+		runShutdownHooks()
+		os.Exit(1)
+	}
+	if errs.Skipping() {
+		errs.Count(errWrite, summary.Failed)
+		errs.Summarize(cmd.ErrOrStderr())
+	} else if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// copyRecords adds records to the producer until the channel is closed, flushing whenever records
+// have been waiting for copyFlushInterval and reporting progress every progressInterval. Each
+// shard is checkpointed, if checkpointer isn't nil, once the records read from it are flushed,
+// unless any of them failed to be written, after which it's no longer checkpointed at all.
+// Records are transformed by stage first, unless it's nil; those it fails on count as failures,
+// unless errs says otherwise. With --strict, it returns the first failure once what was read
+// before it has been flushed.
+func copyRecords(
+	ctx context.Context,
+	p *producer.Producer,
+	checkpointer Checkpointer,
+	stage transform.Func,
+	errs *errorPolicy,
+	records <-chan *RecordOutput,
+	report func(),
+	progressInterval time.Duration,
+) error {
+	flushTicker := time.NewTicker(copyFlushInterval)
+	defer flushTicker.Stop()
+	progressTicker := time.NewTicker(progressInterval)
+	defer progressTicker.Stop()
+
+	// The last sequence number added from each shard since the last flush
+	pending := map[string]string{}
+	// Shards with records that failed to be written, whose checkpoints stay where they were so
+	// that a later copy resumes before those records and retries them
+	held := map[string]bool{}
+	failedBefore := p.Summary().Failed
+	flush := func() error {
+		if err := p.Flush(ctx); err != nil {
+			return err
+		}
+		failed := p.Summary().Failed
+		if failed > 0 && errs.Strict() {
+			// Leave the checkpoints behind the records that failed
+			return fmt.Errorf("%d records could not be written", failed)
+		}
+		if failed > failedBefore {
+			// The producer doesn't say which records failed, so hold back every shard that had
+			// records waiting to be written
+			for shardId := range pending {
+				if !held[shardId] && checkpointer != nil {
+					slog.Warn("records failed to be written; no longer checkpointing shard, so that a resumed copy retries them", "shard", shardId)
+				}
+				held[shardId] = true
+			}
+			failedBefore = failed
+		}
+		if checkpointer == nil {
+			return nil
+		}
+
+		for shardId, sequenceNumber := range pending {
+			if !held[shardId] {
+				checkpointer.Set(shardId, sequenceNumber)
+			}
+			delete(pending, shardId)
+		}
+		if err := checkpointer.Flush(); err != nil {
+			slog.Error("failed to write checkpoint", "error", err)
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return flush()
+			}
+
+			data, ok := record.RawData, true
+			if stage != nil {
+				var err error
+				data, ok, err = transformPayload(ctx, stage, record, data)
+				if err != nil {
+					skip, stop := errs.Handle(errTransform, record, err)
+					if stop != nil {
+						return errors.Join(flush(), stop)
+					}
+					if !skip {
+						slog.Error("failed to transform record", "shard_id", *record.ShardId, "sequence_number", *record.SequenceNumber, "error", err)
+						p.CountFailure("TransformFailed", 1)
+					}
+				}
+			}
+			pending[*record.ShardId] = *record.SequenceNumber
+			if ok {
+				p.Add(ctx, producer.Record{PartitionKey: *record.PartitionKey, Data: data})
+			}
+
+		case <-flushTicker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+
+		case <-progressTicker.C:
+			report()
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
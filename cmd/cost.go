@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Kinesis bills by the hour, and a month is taken to be this many of them
+const hoursPerMonth = 730
+
+// Billed gigabytes are binary
+const bytesPerGB = 1 << 30
+
+// Each record written to a provisioned stream is billed for one PUT payload unit per 25 KB
+const putPayloadUnitBytes = 25 * 1024
+
+// KinesisPrices are the list prices estimates are made with, in US dollars. The defaults are
+// those of us-east-1; --prices overrides them for other regions or negotiated rates.
+type KinesisPrices struct {
+	ShardHour                  float64 `json:"shard_hour"`
+	PutPayloadUnitsPerMillion  float64 `json:"put_payload_units_per_million"`
+	ExtendedRetentionShardHour float64 `json:"extended_retention_shard_hour"`
+	LongTermRetentionGBMonth   float64 `json:"long_term_retention_gb_month"`
+	EFOConsumerShardHour       float64 `json:"efo_consumer_shard_hour"`
+	EFORetrievalGB             float64 `json:"efo_retrieval_gb"`
+
+	OnDemandStreamHour               float64 `json:"on_demand_stream_hour"`
+	OnDemandIngestGB                 float64 `json:"on_demand_ingest_gb"`
+	OnDemandRetrievalGB              float64 `json:"on_demand_retrieval_gb"`
+	OnDemandEFORetrievalGB           float64 `json:"on_demand_efo_retrieval_gb"`
+	OnDemandExtendedRetentionGBMonth float64 `json:"on_demand_extended_retention_gb_month"`
+}
+
+var defaultKinesisPrices = KinesisPrices{
+	ShardHour:                  0.015,
+	PutPayloadUnitsPerMillion:  0.014,
+	ExtendedRetentionShardHour: 0.02,
+	LongTermRetentionGBMonth:   0.023,
+	EFOConsumerShardHour:       0.015,
+	EFORetrievalGB:             0.013,
+
+	OnDemandStreamHour:               0.04,
+	OnDemandIngestGB:                 0.08,
+	OnDemandRetrievalGB:              0.04,
+	OnDemandEFORetrievalGB:           0.05,
+	OnDemandExtendedRetentionGBMonth: 0.1,
+}
+
+type CostEstimate struct {
+	StreamName string `json:"stream_name"`
+	Mode       string `json:"mode"`
+
+	// Throughput averaged over the metrics window, and the busiest hour's average
+	Window                  string  `json:"window"`
+	IncomingBytesPerS       float64 `json:"incoming_bytes_per_second"`
+	IncomingRecordsPerS     float64 `json:"incoming_records_per_second"`
+	ReadBytesPerS           float64 `json:"read_bytes_per_second"`
+	EFOBytesPerS            float64 `json:"efo_bytes_per_second"`
+	PeakIncomingBytesPerS   float64 `json:"peak_incoming_bytes_per_second"`
+	PeakIncomingRecordsPerS float64 `json:"peak_incoming_records_per_second"`
+	PeakReadBytesPerS       float64 `json:"peak_read_bytes_per_second"`
+
+	Prices      KinesisPrices `json:"prices"`
+	Provisioned CostBreakdown `json:"provisioned"`
+	OnDemand    CostBreakdown `json:"on_demand"`
+}
+
+// CostBreakdown is the estimated monthly cost of the stream in one capacity mode.
+type CostBreakdown struct {
+	Shards  int        `json:"shards,omitempty"`
+	Items   []CostItem `json:"items"`
+	Monthly float64    `json:"monthly"`
+}
+
+type CostItem struct {
+	Name    string  `json:"name"`
+	Monthly float64 `json:"monthly"`
+}
+
+func (b *CostBreakdown) add(name string, monthly float64) {
+	b.Items = append(b.Items, CostItem{Name: name, Monthly: monthly})
+	b.Monthly += monthly
+}
+
+func init() {
+	costCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	costCmd.Flags().Duration("since", 7*24*time.Hour, "How much recent throughput to base the estimate on")
+	costCmd.Flags().String("prices", "", "JSON file of prices to use instead of the us-east-1 list prices, keyed as in the prices of the json output")
+	costCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	costCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(costCmd)
+}
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate a stream's monthly cost",
+	Long: `Combines a stream's capacity mode, open shard count, retention period and enhanced fan-out
+consumers with its CloudWatch throughput over --since into an estimated monthly cost, broken
+down by what Kinesis bills for, in both provisioned and on-demand mode for comparison.
+
+For an on-demand stream, the provisioned estimate uses the fewest shards that could have taken
+the busiest hour's average throughput; real traffic is burstier than an hourly average, so
+leave headroom. Estimates use us-east-1 list prices unless --prices gives others, and leave out
+data transfer, KMS requests and the consumers' own costs.
+
+Example:
+  kin cost -n orders --since 336h`,
+	Run: runCostCmd,
+}
+
+func runCostCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	since, _ := cmd.Flags().GetDuration("since")
+	pricesFile, _ := cmd.Flags().GetString("prices")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if since < time.Hour {
+		cmd.PrintErrln("--since must be at least an hour")
+		os.Exit(1)
+	}
+
+	prices, err := loadKinesisPrices(pricesFile)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cloudwatch, err := aws.GetCloudWatchClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	description, err := describeStream(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	metrics := []string{"IncomingBytes", "IncomingRecords", "GetRecords.Bytes", "SubscribeToShardEvent.Bytes"}
+	var queries []aws.MetricQuery
+	for i, metric := range metrics {
+		queries = append(queries, aws.MetricQuery{
+			Id:         fmt.Sprintf("m%d", i),
+			Namespace:  "AWS/Kinesis",
+			MetricName: metric,
+			Dimensions: map[string]string{"StreamName": streamName},
+			Stat:       "Sum",
+			Period:     time.Hour,
+		})
+	}
+	end := time.Now().Truncate(time.Hour)
+	results, err := cloudwatch.GetMetricData(cmd.Context(), queries, end.Add(-since), end)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	// Average rate over the window, and the highest hourly average
+	rates := func(result aws.MetricResult) (float64, float64) {
+		if len(result.Values) == 0 {
+			return 0, 0
+		}
+		total := 0.0
+		for _, v := range result.Values {
+			total += v
+		}
+		return total / since.Seconds(), slices.Max(result.Values) / 3600
+	}
+
+	estimate := CostEstimate{StreamName: streamName, Mode: description.Mode, Window: since.String(), Prices: prices}
+	estimate.IncomingBytesPerS, estimate.PeakIncomingBytesPerS = rates(results[0])
+	estimate.IncomingRecordsPerS, estimate.PeakIncomingRecordsPerS = rates(results[1])
+	estimate.ReadBytesPerS, estimate.PeakReadBytesPerS = rates(results[2])
+	estimate.EFOBytesPerS, _ = rates(results[3])
+
+	shards := int(description.OpenShardCount)
+	if description.Mode == "ON_DEMAND" {
+		shards = shardsForThroughput(estimate.PeakIncomingBytesPerS, estimate.PeakIncomingRecordsPerS, estimate.PeakReadBytesPerS)
+	}
+	estimate.Provisioned = provisionedCost(prices, &estimate, shards, int(description.RetentionPeriodHours), len(description.Consumers))
+	estimate.OnDemand = onDemandCost(prices, &estimate, int(description.RetentionPeriodHours), len(description.Consumers))
+
+	if output == "json" {
+		printJSON(estimate)
+		return
+	}
+
+	fmt.Printf(
+		"%s (%s): %s/s and %.1f records/s in, %s/s read, over the last %s\n\n",
+		streamName, description.Mode,
+		formatBytes(estimate.IncomingBytesPerS), estimate.IncomingRecordsPerS, formatBytes(estimate.ReadBytesPerS+estimate.EFOBytesPerS), since,
+	)
+
+	printCostBreakdown(fmt.Sprintf("PROVISIONED (%d SHARDS)", shards), estimate.Provisioned, description.Mode != "ON_DEMAND")
+	fmt.Println()
+	printCostBreakdown("ON-DEMAND", estimate.OnDemand, description.Mode == "ON_DEMAND")
+	fmt.Println()
+
+	current, other, otherMode := estimate.Provisioned.Monthly, estimate.OnDemand.Monthly, "on-demand"
+	if description.Mode == "ON_DEMAND" {
+		current, other, otherMode = other, current, "provisioned"
+	}
+	if other < current {
+		fmt.Printf("Switching to %s could save about $%.2f a month\n", otherMode, current-other)
+	} else {
+		fmt.Printf("%s mode would cost about $%.2f a month more\n", otherMode, other-current)
+	}
+}
+
+// loadKinesisPrices returns the default prices, overridden by any given in a JSON file.
+func loadKinesisPrices(path string) (KinesisPrices, error) {
+	prices := defaultKinesisPrices
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return prices, err
+	}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return prices, fmt.Errorf("%s: %w", path, err)
+	}
+	return prices, nil
+}
+
+func printCostBreakdown(title string, breakdown CostBreakdown, current bool) {
+	if current {
+		title += " (CURRENT)"
+	}
+	rows := [][]string{}
+	for _, item := range breakdown.Items {
+		rows = append(rows, []string{item.Name, fmt.Sprintf("$%.2f", item.Monthly)})
+	}
+	rows = append(rows, []string{"Total", fmt.Sprintf("$%.2f", breakdown.Monthly)})
+	printTable(os.Stdout, []string{title, "MONTHLY"}, rows)
+}
+
+// shardsForThroughput returns the fewest provisioned shards that could take the given rates: each
+// shard accepts 1 MiB/s or 1000 records/s and serves 2 MiB/s to shared-throughput consumers.
+func shardsForThroughput(incomingBytes, incomingRecords, readBytes float64) int {
+	shards := math.Max(incomingBytes/(1<<20), incomingRecords/1000)
+	shards = math.Max(shards, readBytes/(2<<20))
+	return max(1, int(math.Ceil(shards)))
+}
+
+func provisionedCost(prices KinesisPrices, estimate *CostEstimate, shards, retentionHours, consumers int) CostBreakdown {
+	breakdown := CostBreakdown{Shards: shards, Items: []CostItem{}}
+	shardHours := float64(shards) * hoursPerMonth
+	breakdown.add("Shard hours", shardHours*prices.ShardHour)
+
+	// Every record is at least one unit, and larger ones are billed per 25 KB
+	unitsPerRecord := 1.0
+	if estimate.IncomingRecordsPerS > 0 {
+		unitsPerRecord = math.Max(1, math.Ceil(estimate.IncomingBytesPerS/estimate.IncomingRecordsPerS/putPayloadUnitBytes))
+	}
+	units := estimate.IncomingRecordsPerS * unitsPerRecord * hoursPerMonth * 3600
+	breakdown.add("PUT payload units", units/1e6*prices.PutPayloadUnitsPerMillion)
+
+	if retentionHours > 24 {
+		breakdown.add("Extended retention", shardHours*prices.ExtendedRetentionShardHour)
+	}
+	if retentionHours > 7*24 {
+		breakdown.add("Long-term retention", retainedGB(estimate, retentionHours-7*24)*prices.LongTermRetentionGBMonth)
+	}
+
+	if consumers > 0 {
+		breakdown.add("Enhanced fan-out consumer shard hours", float64(consumers)*shardHours*prices.EFOConsumerShardHour)
+		breakdown.add("Enhanced fan-out data", monthlyGB(estimate.EFOBytesPerS)*prices.EFORetrievalGB)
+	}
+	return breakdown
+}
+
+func onDemandCost(prices KinesisPrices, estimate *CostEstimate, retentionHours, consumers int) CostBreakdown {
+	breakdown := CostBreakdown{Items: []CostItem{}}
+	breakdown.add("Stream hours", hoursPerMonth*prices.OnDemandStreamHour)
+	breakdown.add("Data in", monthlyGB(estimate.IncomingBytesPerS)*prices.OnDemandIngestGB)
+	breakdown.add("Data out", monthlyGB(estimate.ReadBytesPerS)*prices.OnDemandRetrievalGB)
+
+	if retentionHours > 24 {
+		breakdown.add("Extended retention", retainedGB(estimate, min(retentionHours, 7*24)-24)*prices.OnDemandExtendedRetentionGBMonth)
+	}
+	if retentionHours > 7*24 {
+		breakdown.add("Long-term retention", retainedGB(estimate, retentionHours-7*24)*prices.LongTermRetentionGBMonth)
+	}
+
+	if consumers > 0 {
+		breakdown.add("Enhanced fan-out data", monthlyGB(estimate.EFOBytesPerS)*prices.OnDemandEFORetrievalGB)
+	}
+	return breakdown
+}
+
+// monthlyGB returns the gigabytes a month at a rate in bytes per second.
+func monthlyGB(bytesPerS float64) float64 {
+	return bytesPerS * hoursPerMonth * 3600 / bytesPerGB
+}
+
+// retainedGB returns how many gigabytes are stored at any one time for hours of retention, which
+// is what storage billed by the GB-month charges for.
+func retainedGB(estimate *CostEstimate, hours int) float64 {
+	return estimate.IncomingBytesPerS * float64(hours) * 3600 / bytesPerGB
+}
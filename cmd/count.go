@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type CountBucket struct {
+	Start   time.Time `json:"start"`
+	ShardId string    `json:"shard_id,omitempty"`
+	Records int       `json:"records"`
+	Bytes   int       `json:"bytes"`
+}
+
+func init() {
+	countCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	countCmd.Flags().String("from", "1h", "Start of the time range to count, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	countCmd.Flags().String("until", "", "End of the time range to count, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	countCmd.Flags().Duration("interval", time.Minute, "Width of each time bucket")
+	countCmd.Flags().Bool("total", false, "Sum each bucket across all shards instead of reporting shards separately")
+	countCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	countCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(countCmd)
+}
+
+var countCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Count records and bytes per shard over time",
+	Long: `Reads every shard from --from until --until and reports how many records and bytes arrived in
+each --interval, by approximate arrival time, so that the shape of a stream's traffic can be seen
+at a glance. Only buckets with records in them are reported.
+
+Example:
+  kin count -n orders --from 6h --interval 15m --total`,
+	Run: runCountCmd,
+}
+
+func runCountCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	total, _ := cmd.Flags().GetBool("total")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if interval <= 0 {
+		cmd.PrintErrln("--interval must be positive")
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	type bucketKey struct {
+		start   time.Time
+		shardId string
+	}
+	var mu sync.Mutex
+	buckets := map[bucketKey]*CountBucket{}
+
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	var wg sync.WaitGroup
+	failed := false
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+		bucketShardId := shardId
+		if total {
+			bucketShardId = ""
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				key := bucketKey{record.ApproximateArrivalTimestamp.Truncate(interval).UTC(), bucketShardId}
+				mu.Lock()
+				defer mu.Unlock()
+				bucket, ok := buckets[key]
+				if !ok {
+					bucket = &CountBucket{Start: key.start, ShardId: key.shardId}
+					buckets[key] = bucket
+				}
+				bucket.Records++
+				bucket.Bytes += len(record.Data)
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	results := []*CountBucket{}
+	for _, bucket := range buckets {
+		results = append(results, bucket)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].Start.Equal(results[j].Start) {
+			return results[i].Start.Before(results[j].Start)
+		}
+		return results[i].ShardId < results[j].ShardId
+	})
+
+	if output == "json" {
+		for _, bucket := range results {
+			printJSON(bucket)
+		}
+	} else {
+		headers := []string{"START", "SHARD", "RECORDS", "BYTES"}
+		if total {
+			headers = []string{"START", "RECORDS", "BYTES"}
+		}
+
+		rows := [][]string{}
+		for _, bucket := range results {
+			row := []string{bucket.Start.Format(time.RFC3339), bucket.ShardId, fmt.Sprint(bucket.Records), formatBytes(float64(bucket.Bytes))}
+			if total {
+				row = append(row[:1], row[2:]...)
+			}
+			rows = append(rows, row)
+		}
+		printTable(os.Stdout, headers, rows)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"kin/pkg/aws"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	createStreamCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	createStreamCmd.Flags().Int32("shards", 0, "Number of shards for a provisioned stream")
+	createStreamCmd.Flags().Bool("on-demand", false, "Create an on-demand stream, which scales its shards automatically")
+	createStreamCmd.Flags().StringArray("tag", nil, "Tag to apply to the stream as key=value; may be repeated")
+	createStreamCmd.Flags().String("kms-key", "", "KMS key ID, ARN or alias to encrypt the stream with (ex: alias/aws/kinesis); implies --wait")
+	createStreamCmd.Flags().Bool("wait", false, "Wait until the stream is ACTIVE before exiting")
+	createStreamCmd.MarkFlagRequired("stream-name")
+	createStreamCmd.MarkFlagsMutuallyExclusive("shards", "on-demand")
+	createStreamCmd.MarkFlagsOneRequired("shards", "on-demand")
+
+	rootCmd.AddCommand(createStreamCmd)
+}
+
+var createStreamCmd = &cobra.Command{
+	Use:   "create-stream",
+	Short: "Create a Kinesis Data Stream",
+	Long: `Creates a stream, either provisioned with --shards or on-demand with --on-demand.
+
+Streams take a short while to become ACTIVE after they're created, and can't be read from or
+written to until then; with --wait, kin blocks until the stream is ready. Encryption can only be
+enabled on an ACTIVE stream, so --kms-key always waits.
+
+Example:
+  kin create-stream -n test-orders --shards 2 --tag team=payments --wait`,
+	Run: runCreateStreamCmd,
+}
+
+func runCreateStreamCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	shards, _ := cmd.Flags().GetInt32("shards")
+	onDemand, _ := cmd.Flags().GetBool("on-demand")
+	tagPairs, _ := cmd.Flags().GetStringArray("tag")
+	kmsKey, _ := cmd.Flags().GetString("kms-key")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	tags, err := parseTags(tagPairs)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	input := &kinesis.CreateStreamInput{StreamName: &streamName}
+	if onDemand {
+		input.StreamModeDetails = &types.StreamModeDetails{StreamMode: types.StreamModeOnDemand}
+	} else {
+		if shards < 1 {
+			cmd.PrintErrln("--shards must be at least 1")
+			os.Exit(1)
+		}
+		input.ShardCount = &shards
+		input.StreamModeDetails = &types.StreamModeDetails{StreamMode: types.StreamModeProvisioned}
+	}
+	if len(tags) > 0 {
+		input.Tags = tags
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if _, err := client.CreateStream(cmd.Context(), input); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Creating stream %s\n", streamName)
+
+	if !wait && kmsKey == "" {
+		return
+	}
+
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Stream %s is ACTIVE\n", streamName)
+
+	if kmsKey != "" {
+		_, err := client.StartStreamEncryption(cmd.Context(), &kinesis.StartStreamEncryptionInput{
+			StreamName:     &streamName,
+			EncryptionType: types.EncryptionTypeKms,
+			KeyId:          &kmsKey,
+		})
+		if err != nil {
+			cmd.PrintErrln("stream created, but enabling encryption failed:", err)
+			os.Exit(1)
+		}
+
+		// Enabling encryption puts the stream back into UPDATING for a moment
+		if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Stream %s is encrypted with %s\n", streamName, kmsKey)
+	}
+}
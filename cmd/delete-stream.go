@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	deleteStreamCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	deleteStreamCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	deleteStreamCmd.Flags().Bool("deregister-consumers", false, "Deregister any enhanced fan-out consumers before deleting the stream")
+	deleteStreamCmd.Flags().Bool("wait", false, "Wait until the stream has been deleted before exiting")
+	deleteStreamCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(deleteStreamCmd)
+}
+
+var deleteStreamCmd = &cobra.Command{
+	Use:   "delete-stream",
+	Short: "Delete a Kinesis Data Stream",
+	Long: `Deletes a stream and every record in it, after asking for the stream name to be typed back as
+confirmation. Use --yes to skip the prompt in scripts.
+
+Kinesis refuses to delete a stream that still has enhanced fan-out consumers registered. With
+--deregister-consumers, kin deregisters them first; otherwise it lists them and stops.`,
+	Run: runDeleteStreamCmd,
+}
+
+func runDeleteStreamCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	yes, _ := cmd.Flags().GetBool("yes")
+	deregisterConsumers, _ := cmd.Flags().GetBool("deregister-consumers")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	summary, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	streamARN := *summary.StreamDescriptionSummary.StreamARN
+
+	consumers, err := listStreamConsumers(cmd.Context(), client, streamARN)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if len(consumers) > 0 && !deregisterConsumers {
+		cmd.PrintErrf("%s has %d enhanced fan-out consumers registered:\n", streamName, len(consumers))
+		for _, consumer := range consumers {
+			cmd.PrintErrf("  %s\n", awssdk.ToString(consumer.ConsumerName))
+		}
+		cmd.PrintErrln("Deregister them first, or use --deregister-consumers")
+		os.Exit(1)
+	}
+
+	if !yes && !confirm(cmd, fmt.Sprintf("This will delete %s and all of its records. Type the stream name to confirm: ", streamName), streamName) {
+		cmd.PrintErrln("Aborted")
+		os.Exit(1)
+	}
+
+	for _, consumer := range consumers {
+		_, err := client.DeregisterStreamConsumer(cmd.Context(), &kinesis.DeregisterStreamConsumerInput{
+			ConsumerARN: consumer.ConsumerARN,
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Deregistered consumer %s\n", awssdk.ToString(consumer.ConsumerName))
+	}
+
+	// Consumers we just deregistered may still be DELETING, which would otherwise block the delete
+	_, err = client.DeleteStream(cmd.Context(), &kinesis.DeleteStreamInput{
+		StreamName:              &streamName,
+		EnforceConsumerDeletion: awssdk.Bool(len(consumers) > 0),
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Deleting stream %s\n", streamName)
+
+	if wait {
+		if err := waitForStreamDeleted(cmd.Context(), client, streamName); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Stream %s deleted\n", streamName)
+	}
+}
+
+// confirm prompts on stderr and reports whether the line read from stdin is exactly expected.
+func confirm(cmd *cobra.Command, prompt, expected string) bool {
+	cmd.PrintErr(prompt)
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	return strings.TrimSpace(line) == expected
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/spf13/cobra"
+)
+
+type StreamDescription struct {
+	StreamName           string                `json:"stream_name"`
+	StreamARN            string                `json:"stream_arn"`
+	Status               string                `json:"status"`
+	Mode                 string                `json:"mode,omitempty"`
+	CreatedAt            *time.Time            `json:"created_at,omitempty"`
+	RetentionPeriodHours int32                 `json:"retention_period_hours"`
+	OpenShardCount       int32                 `json:"open_shard_count"`
+	ClosedShardCount     int                   `json:"closed_shard_count"`
+	EncryptionType       string                `json:"encryption_type"`
+	KeyId                string                `json:"key_id,omitempty"`
+	EnhancedMonitoring   []string              `json:"enhanced_monitoring"`
+	Consumers            []ConsumerDescription `json:"consumers"`
+}
+
+type ConsumerDescription struct {
+	ConsumerName string     `json:"consumer_name"`
+	ConsumerARN  string     `json:"consumer_arn"`
+	Status       string     `json:"status"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+func init() {
+	describeCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	describeCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	describeCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(describeCmd)
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Describe a Kinesis Data Stream's configuration and consumers",
+	Long: `Shows a stream's status, capacity mode, retention period, shard counts, encryption settings,
+enhanced monitoring metrics, and the enhanced fan-out consumers registered against it.`,
+	Run: runDescribeCmd,
+}
+
+func runDescribeCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	description, err := describeStream(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if output == "json" {
+		printJSON(description)
+		return
+	}
+	printStreamDescription(description)
+}
+
+func describeStream(ctx context.Context, client aws.KinesisAPI, streamName string) (*StreamDescription, error) {
+	summaryOutput, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	summary := summaryOutput.StreamDescriptionSummary
+
+	description := &StreamDescription{
+		StreamName:           awssdk.ToString(summary.StreamName),
+		StreamARN:            awssdk.ToString(summary.StreamARN),
+		Status:               string(summary.StreamStatus),
+		CreatedAt:            summary.StreamCreationTimestamp,
+		RetentionPeriodHours: awssdk.ToInt32(summary.RetentionPeriodHours),
+		OpenShardCount:       awssdk.ToInt32(summary.OpenShardCount),
+		EncryptionType:       string(summary.EncryptionType),
+		KeyId:                awssdk.ToString(summary.KeyId),
+		EnhancedMonitoring:   []string{},
+		Consumers:            []ConsumerDescription{},
+	}
+	if summary.StreamModeDetails != nil {
+		description.Mode = string(summary.StreamModeDetails.StreamMode)
+	}
+	for _, monitoring := range summary.EnhancedMonitoring {
+		for _, metric := range monitoring.ShardLevelMetrics {
+			description.EnhancedMonitoring = append(description.EnhancedMonitoring, string(metric))
+		}
+	}
+
+	// Closed shards only matter until they pass the retention period, but they're still read by
+	// consumers starting from the trim horizon, so they're worth knowing about
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return nil, err
+	}
+	description.ClosedShardCount = len(shards) - int(description.OpenShardCount)
+
+	consumers, err := listStreamConsumers(ctx, client, *summary.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	for _, consumer := range consumers {
+		description.Consumers = append(description.Consumers, ConsumerDescription{
+			ConsumerName: awssdk.ToString(consumer.ConsumerName),
+			ConsumerARN:  awssdk.ToString(consumer.ConsumerARN),
+			Status:       string(consumer.ConsumerStatus),
+			CreatedAt:    consumer.ConsumerCreationTimestamp,
+		})
+	}
+
+	return description, nil
+}
+
+func printStreamDescription(d *StreamDescription) {
+	monitoring := "none"
+	if len(d.EnhancedMonitoring) > 0 {
+		monitoring = strings.Join(d.EnhancedMonitoring, ", ")
+	}
+	encryption := d.EncryptionType
+	if d.KeyId != "" {
+		encryption = fmt.Sprintf("%s (%s)", d.EncryptionType, d.KeyId)
+	}
+	created := "-"
+	if d.CreatedAt != nil {
+		created = d.CreatedAt.Format(time.RFC3339)
+	}
+
+	printTable(os.Stdout, []string{"FIELD", "VALUE"}, [][]string{
+		{"Name", d.StreamName},
+		{"ARN", d.StreamARN},
+		{"Status", d.Status},
+		{"Mode", d.Mode},
+		{"Created", created},
+		{"Retention", fmt.Sprintf("%d hours", d.RetentionPeriodHours)},
+		{"Open shards", fmt.Sprint(d.OpenShardCount)},
+		{"Closed shards", fmt.Sprint(d.ClosedShardCount)},
+		{"Encryption", encryption},
+		{"Enhanced monitoring", monitoring},
+	})
+
+	fmt.Println()
+	if len(d.Consumers) == 0 {
+		fmt.Println("No enhanced fan-out consumers registered")
+		return
+	}
+
+	rows := [][]string{}
+	for _, consumer := range d.Consumers {
+		created := "-"
+		if consumer.CreatedAt != nil {
+			created = consumer.CreatedAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{consumer.ConsumerName, consumer.Status, created, consumer.ConsumerARN})
+	}
+	printTable(os.Stdout, []string{"CONSUMER", "STATUS", "CREATED", "ARN"}, rows)
+}
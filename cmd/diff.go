@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/decode"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/jmespath/go-jmespath"
+	"github.com/spf13/cobra"
+)
+
+type StreamDiff struct {
+	Records      int `json:"records"`
+	OtherRecords int `json:"other_records"`
+
+	Matching  int `json:"matching"`
+	Differing int `json:"differing"`
+
+	// Missing records are only in the first stream, and extra records only in the other
+	Missing int `json:"missing"`
+	Extra   int `json:"extra"`
+
+	// Duplicates counts keys seen more than once in either stream; only the first record with a
+	// key is compared
+	Duplicates int `json:"duplicates"`
+
+	// Records whose key path matched nothing
+	Unkeyed int `json:"unkeyed"`
+
+	Examples []DiffExample `json:"examples"`
+}
+
+type DiffExample struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+
+	// Top-level fields whose values differ, for differing JSON records
+	Fields []string `json:"fields,omitempty"`
+
+	SequenceNumber      string `json:"sequence_number,omitempty"`
+	OtherSequenceNumber string `json:"other_sequence_number,omitempty"`
+}
+
+// diffRecord is the first record seen with a key, and how many records had it.
+type diffRecord struct {
+	sequenceNumber string
+	arrival        time.Time
+	data           []byte
+	count          int
+}
+
+func init() {
+	diffCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	diffCmd.Flags().String("other", "", "Stream to compare with (required)")
+	diffCmd.Flags().String("other-region", "", "Region of the other stream; defaults to the first's")
+	diffCmd.Flags().String("other-profile", "", "Shared config profile to use for the other stream, for comparing with another account")
+	diffCmd.Flags().String("key-path", "", "JMESPath expression selecting the key that identifies each record in both streams (ex: orderId) (required)")
+	diffCmd.Flags().String("from", "1h", "Start of the time range to compare, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	diffCmd.Flags().String("until", "", "End of the time range to compare, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	diffCmd.Flags().Duration("grace", time.Minute, "Also read this much either side of the time range, so records that reached one stream just outside it aren't reported missing")
+	diffCmd.Flags().StringSlice("ignore", nil, "Top-level payload fields to leave out of the comparison, such as processing timestamps")
+	diffCmd.Flags().Int("examples", 20, "Maximum number of differences to list")
+	diffCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	diffCmd.MarkFlagRequired("stream-name")
+	diffCmd.MarkFlagRequired("other")
+	diffCmd.MarkFlagRequired("key-path")
+
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the records in two streams",
+	Long: `Reads the same time range from two streams, such as the old and new pipelines during a
+dual-write migration, matches their records by the key --key-path selects from each payload, and
+reports records missing from the other stream, extra records only in the other stream, and
+records whose payloads differ.
+
+JSON payloads are compared by value, so field order and whitespace don't matter, leaving out any
+--ignore fields; other payloads must be byte-for-byte identical. The range is widened by --grace
+when reading, so that a record is only reported missing if it never reached the other stream
+near the range. Both ranges are held in memory while comparing.
+
+The command exits non-zero if the streams differ.
+
+Example:
+  kin diff -n orders --other orders-v2 --key-path orderId --from 2h --ignore processedAt`,
+	Run: runDiffCmd,
+}
+
+func runDiffCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	other, _ := cmd.Flags().GetString("other")
+	otherRegion, _ := cmd.Flags().GetString("other-region")
+	otherProfile, _ := cmd.Flags().GetString("other-profile")
+	keyPath, _ := cmd.Flags().GetString("key-path")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	grace, _ := cmd.Flags().GetDuration("grace")
+	ignore, _ := cmd.Flags().GetStringSlice("ignore")
+	maxExamples, _ := cmd.Flags().GetInt("examples")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	keyExpr, err := jmespath.Compile(keyPath)
+	if err != nil {
+		cmd.PrintErrln("invalid --key-path:", err)
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var otherOptions []func(*config.LoadOptions) error
+	if otherRegion != "" {
+		otherOptions = append(otherOptions, config.WithRegion(otherRegion))
+	}
+	if otherProfile != "" {
+		otherOptions = append(otherOptions, config.WithSharedConfigProfile(otherProfile))
+	}
+	otherClient, err := aws.GetKinesisClientWithConfig(otherOptions...)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var records, otherRecords map[string]*diffRecord
+	var unkeyed, otherUnkeyed int
+	var readErr, otherReadErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		records, unkeyed, readErr = readDiffRecords(cmd.Context(), client, streamName, keyExpr, from.Add(-grace), until.Add(grace))
+	}()
+	go func() {
+		defer wg.Done()
+		otherRecords, otherUnkeyed, otherReadErr = readDiffRecords(cmd.Context(), otherClient, other, keyExpr, from.Add(-grace), until.Add(grace))
+	}()
+	wg.Wait()
+
+	if err := errors.Join(readErr, otherReadErr); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	ignored := map[string]bool{}
+	for _, field := range ignore {
+		ignored[field] = true
+	}
+	diff := diffRecords(records, otherRecords, from, until, ignored, maxExamples)
+	diff.Unkeyed = unkeyed + otherUnkeyed
+
+	if output == "json" {
+		printJSON(diff)
+	} else {
+		fmt.Printf(
+			"%d records in %s, %d in %s: %d matching, %d differing, %d missing from %s, %d extra in %s\n",
+			diff.Records, streamName, diff.OtherRecords, other, diff.Matching, diff.Differing, diff.Missing, other, diff.Extra, other,
+		)
+		if diff.Duplicates > 0 || diff.Unkeyed > 0 {
+			fmt.Printf("%d duplicate keys; %d records without a key\n", diff.Duplicates, diff.Unkeyed)
+		}
+
+		if len(diff.Examples) > 0 {
+			fmt.Println()
+			rows := [][]string{}
+			for _, example := range diff.Examples {
+				rows = append(rows, []string{
+					example.Key,
+					strings.ToUpper(example.Status),
+					orDash(strings.Join(example.Fields, ", ")),
+					orDash(example.SequenceNumber),
+					orDash(example.OtherSequenceNumber),
+				})
+			}
+			printTable(os.Stdout, []string{"KEY", "STATUS", "FIELDS", "SEQUENCE NUMBER", "OTHER SEQUENCE NUMBER"}, rows)
+		}
+	}
+
+	if diff.Differing > 0 || diff.Missing > 0 || diff.Extra > 0 {
+		os.Exit(1)
+	}
+}
+
+// readDiffRecords reads every shard of a stream from from until until and returns the first
+// record with each key, along with the number of records that had no key.
+func readDiffRecords(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	keyExpr *jmespath.JMESPath,
+	from, until time.Time,
+) (map[string]*diffRecord, int, error) {
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var mu sync.Mutex
+	records := map[string]*diffRecord{}
+	unkeyed := 0
+	var errs []error
+
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(ctx, client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				key, err := extractPartitionKey(keyExpr, record.Data)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					unkeyed++
+					return true
+				}
+				if existing, ok := records[key]; ok {
+					existing.count++
+					return true
+				}
+				records[key] = &diffRecord{
+					sequenceNumber: *record.SequenceNumber,
+					arrival:        *record.ApproximateArrivalTimestamp,
+					data:           record.Data,
+					count:          1,
+				}
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s %s: %w", streamName, shardId, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return records, unkeyed, errors.Join(errs...)
+}
+
+// diffRecords compares the records of two streams with keys whose record, in either stream,
+// arrived between from and until.
+func diffRecords(records, otherRecords map[string]*diffRecord, from, until time.Time, ignored map[string]bool, maxExamples int) StreamDiff {
+	inRange := func(record *diffRecord) bool {
+		return record != nil && !record.arrival.Before(from) && !record.arrival.After(until)
+	}
+
+	keys := map[string]bool{}
+	for key, record := range records {
+		if inRange(record) || inRange(otherRecords[key]) {
+			keys[key] = true
+		}
+	}
+	for key, record := range otherRecords {
+		if inRange(record) || inRange(records[key]) {
+			keys[key] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	diff := StreamDiff{Examples: []DiffExample{}}
+	for _, key := range sorted {
+		record, otherRecord := records[key], otherRecords[key]
+		if (record != nil && record.count > 1) || (otherRecord != nil && otherRecord.count > 1) {
+			diff.Duplicates++
+		}
+
+		example := DiffExample{Key: key}
+		switch {
+		case otherRecord == nil:
+			diff.Records++
+			diff.Missing++
+			example.Status = "missing"
+			example.SequenceNumber = record.sequenceNumber
+
+		case record == nil:
+			diff.OtherRecords++
+			diff.Extra++
+			example.Status = "extra"
+			example.OtherSequenceNumber = otherRecord.sequenceNumber
+
+		default:
+			diff.Records++
+			diff.OtherRecords++
+			fields, same := comparePayloads(record.data, otherRecord.data, ignored)
+			if same {
+				diff.Matching++
+				continue
+			}
+			diff.Differing++
+			example.Status = "differing"
+			example.Fields = fields
+			example.SequenceNumber = record.sequenceNumber
+			example.OtherSequenceNumber = otherRecord.sequenceNumber
+		}
+
+		if len(diff.Examples) < maxExamples {
+			diff.Examples = append(diff.Examples, example)
+		}
+	}
+	return diff
+}
+
+// comparePayloads reports whether two payloads are the same and, if they're both JSON objects,
+// which top-level fields differ. Numbers are compared exactly, so that large integers such as IDs
+// that differ aren't taken to be the same.
+func comparePayloads(a, b []byte, ignored map[string]bool) ([]string, bool) {
+	decodedA, errA := decode.JSON(a)
+	decodedB, errB := decode.JSON(b)
+	if errA != nil || errB != nil {
+		return nil, bytes.Equal(a, b)
+	}
+
+	objectA, okA := decodedA.(map[string]interface{})
+	objectB, okB := decodedB.(map[string]interface{})
+	if !okA || !okB {
+		return nil, jsonEqual(decodedA, decodedB)
+	}
+
+	var fields []string
+	for field, valueA := range objectA {
+		valueB, ok := objectB[field]
+		if !ignored[field] && (!ok || !jsonEqual(valueA, valueB)) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range objectB {
+		if _, ok := objectA[field]; !ok && !ignored[field] {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, len(fields) == 0
+}
+
+// jsonEqual reports whether two values decoded by decode.JSON are the same, taking numbers
+// written differently, such as 1 and 1.0, to be the same if they're exactly equal.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ratA, okA := new(big.Rat).SetString(a.String())
+		ratB, okB := new(big.Rat).SetString(b.String())
+		if !okA || !okB {
+			return a == b
+		}
+		return ratA.Cmp(ratB) == 0
+
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, valueA := range a {
+			valueB, ok := b[key]
+			if !ok || !jsonEqual(valueA, valueB) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffRecords(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	until := from.Add(time.Hour)
+	record := func(sequenceNumber string, arrival time.Time, data string) *diffRecord {
+		return &diffRecord{sequenceNumber: sequenceNumber, arrival: arrival, data: []byte(data), count: 1}
+	}
+	inside, before, after := from.Add(time.Minute), from.Add(-time.Minute), until.Add(time.Minute)
+
+	records := map[string]*diffRecord{
+		"same":       record("1", inside, `{"id":1,"total":10}`),
+		"reformed":   record("2", inside, `{"id":2,"total":10.0}`),
+		"changed":    record("3", inside, `{"id":3,"total":10,"status":"new"}`),
+		"ignored":    record("4", inside, `{"id":4,"processed_at":"12:00"}`),
+		"missing":    record("5", inside, `{"id":5}`),
+		"duplicated": {sequenceNumber: "6", arrival: inside, data: []byte(`{"id":6}`), count: 2},
+		// Its copy arrived in range, so it's compared even though it didn't
+		"late": record("7", before, `{"id":7}`),
+		// Neither arrived in range
+		"old":   record("8", before, `{"id":8}`),
+		"text":  record("9", inside, `plain text`),
+		"newer": record("10", after, `{"id":10}`),
+	}
+	otherRecords := map[string]*diffRecord{
+		"same":       record("a", inside, `{"total":10,"id":1}`),
+		"reformed":   record("b", inside, `{"id":2,"total":1e1}`),
+		"changed":    record("c", inside, `{"id":3,"total":11,"status":"new","extra":true}`),
+		"ignored":    record("d", inside, `{"id":4,"processed_at":"12:01"}`),
+		"extra":      record("e", inside, `{"id":11}`),
+		"duplicated": record("f", inside, `{"id":6}`),
+		"late":       record("g", inside, `{"id":7}`),
+		"old":        record("h", before, `{"id":9}`),
+		"text":       record("i", inside, `other text`),
+	}
+
+	diff := diffRecords(records, otherRecords, from, until, map[string]bool{"processed_at": true}, 10)
+
+	want := StreamDiff{
+		Records:      8,
+		OtherRecords: 8,
+		Matching:     5,
+		Differing:    2,
+		Missing:      1,
+		Extra:        1,
+		Duplicates:   1,
+		Examples: []DiffExample{
+			{Key: "changed", Status: "differing", Fields: []string{"extra", "total"}, SequenceNumber: "3", OtherSequenceNumber: "c"},
+			{Key: "extra", Status: "extra", OtherSequenceNumber: "e"},
+			{Key: "missing", Status: "missing", SequenceNumber: "5"},
+			{Key: "text", Status: "differing", SequenceNumber: "9", OtherSequenceNumber: "i"},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diffRecords = %+v\nwant %+v", diff, want)
+	}
+}
+
+func TestDiffRecordsLimitsExamples(t *testing.T) {
+	arrival := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := map[string]*diffRecord{}
+	for _, key := range []string{"a", "b", "c"} {
+		records[key] = &diffRecord{sequenceNumber: key, arrival: arrival, data: []byte(`{}`), count: 1}
+	}
+
+	diff := diffRecords(records, map[string]*diffRecord{}, arrival, arrival, nil, 2)
+	if diff.Missing != 3 || len(diff.Examples) != 2 || diff.Examples[0].Key != "a" || diff.Examples[1].Key != "b" {
+		t.Errorf("diffRecords = %+v; want 3 missing and the first 2 as examples", diff)
+	}
+}
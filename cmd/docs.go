@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func init() {
+	docsCmd.Flags().String("format", "markdown", "Format of the docs: man or markdown")
+	docsCmd.Flags().String("out", "", "Directory to write a page per command to, creating it if need be (required)")
+	docsCmd.MarkFlagRequired("out")
+
+	rootCmd.AddCommand(docsCmd)
+}
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate man pages or markdown docs for every command",
+	Long: `Writes a page for every command, with its description and flags, to a directory: man pages in
+section 1, such as kin-tail.1, for packages to install, or markdown, such as kin_tail.md, with
+links between the pages. Markdown pages leave out when they were generated, and man pages are dated
+when kin was built, so they can be kept in version control and regenerated whenever flags change.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+
+		if format != "man" && format != "markdown" {
+			cmd.PrintErrf("unknown --format %q: must be man or markdown\n", format)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(out, 0o755); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		// Leave out the generation date, which would change every page whenever they're regenerated
+		root := cmd.Root()
+		root.DisableAutoGenTag = true
+
+		var err error
+		if format == "man" {
+			info := versionInfo()
+			header := &doc.GenManHeader{
+				Title:   "KIN",
+				Section: "1",
+				Source:  fmt.Sprintf("kin %s", info.Version),
+				Manual:  "kin manual",
+			}
+			if built, parseErr := time.Parse(time.RFC3339, info.BuildDate); parseErr == nil {
+				header.Date = &built
+			}
+			err = doc.GenManTree(root, header, out)
+		} else {
+			err = doc.GenMarkdownTree(root, out)
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	},
+}
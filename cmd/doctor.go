@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
+)
+
+type DoctorCheck struct {
+	Name string `json:"name"`
+	// Status is ok, warn, fail, or skip for checks that couldn't be made
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Hint says how to fix a failure
+	Hint string `json:"hint,omitempty"`
+}
+
+// doctorReport collects the results of the checks as they're made.
+type doctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+}
+
+func (r *doctorReport) add(name, status, detail, hint string) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+// call records the result of an API call that needs action, returning whether it succeeded.
+func (r *doctorReport) call(name, action, resource string, err error, detail string) bool {
+	if err == nil {
+		r.add(name, "ok", detail, "")
+		return true
+	}
+
+	hint := ""
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorCode(), "AccessDenied") {
+		hint = fmt.Sprintf("Allow %s on %s", action, resource)
+	}
+	r.add(name, "fail", err.Error(), hint)
+	return false
+}
+
+func (r *doctorReport) failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == "fail" {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	doctorCmd.Flags().StringP("stream-name", "n", "", "Stream to check reading from and writing to")
+	doctorCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the Kinesis endpoint to respond")
+	doctorCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check credentials, connectivity and permissions",
+	Long: `Runs the checks that would otherwise fail partway into a tail or put, and says how to fix any
+that fail: that a region and credentials can be found, who they belong to, and that the Kinesis
+endpoint can be reached.
+
+Given a stream, doctor also makes the calls tail makes, DescribeStreamSummary, ListShards,
+GetShardIterator and GetRecords, reading nothing since the iterator is at the tip of a shard.
+Writes aren't attempted; instead the IAM policy simulator is asked whether PutRecord and
+PutRecords would be allowed, which needs iam:SimulatePrincipalPolicy and doesn't take SCPs or
+session policies into account.
+
+The command exits non-zero if any check fails.
+
+Example:
+  kin doctor -n orders`,
+	Run: runDoctorCmd,
+}
+
+func runDoctorCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	report := &doctorReport{Checks: []DoctorCheck{}}
+	runDoctorChecks(cmd.Context(), report, streamName, timeout)
+
+	if output == "json" {
+		printJSON(report)
+	} else {
+		rows := [][]string{}
+		for _, check := range report.Checks {
+			rows = append(rows, []string{check.Name, strings.ToUpper(check.Status), orDash(check.Detail)})
+		}
+		printTable(os.Stdout, []string{"CHECK", "STATUS", "DETAIL"}, rows)
+
+		var hints []string
+		for _, check := range report.Checks {
+			if check.Hint != "" {
+				hints = append(hints, fmt.Sprintf("  %s: %s", check.Name, check.Hint))
+			}
+		}
+		if len(hints) > 0 {
+			fmt.Println()
+			fmt.Println("To fix:")
+			fmt.Println(strings.Join(hints, "\n"))
+		}
+	}
+
+	if report.failed() {
+		os.Exit(1)
+	}
+}
+
+// runDoctorChecks makes each check in turn, stopping early when a failure means the rest can't
+// be made.
+func runDoctorChecks(ctx context.Context, report *doctorReport, streamName string, timeout time.Duration) {
+	cfg, err := aws.GetConfig()
+	if err != nil {
+		report.add("Configuration", "fail", err.Error(), "Check ~/.aws/config and the AWS_* environment variables")
+		return
+	}
+
+	if cfg.Region == "" {
+		report.add("Region", "fail", "no region configured", "Set AWS_REGION, or region in the profile in ~/.aws/config")
+		return
+	}
+	report.add("Region", "ok", cfg.Region, "")
+
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		report.add("Credentials", "fail", err.Error(), "Run aws configure, or aws sso login for an SSO profile, or set AWS_PROFILE")
+		return
+	}
+	detail := "from " + credentials.Source
+	switch {
+	case credentials.CanExpire && time.Until(credentials.Expires) < 15*time.Minute:
+		report.add("Credentials", "warn", fmt.Sprintf("%s, expiring in %s", detail, time.Until(credentials.Expires).Round(time.Second)), "Refresh the credentials before a long-running command")
+	case credentials.CanExpire:
+		report.add("Credentials", "ok", fmt.Sprintf("%s, expiring at %s", detail, credentials.Expires.Local().Format(time.DateTime)), "")
+	default:
+		report.add("Credentials", "ok", detail, "")
+	}
+
+	stsClient, err := aws.GetSTSClient()
+	if err != nil {
+		report.add("Identity", "fail", err.Error(), "")
+		return
+	}
+	identity, err := stsClient.GetCallerIdentity(ctx, nil)
+	if err != nil {
+		report.add("Identity", "fail", err.Error(), "The credentials were rejected; they may have expired or been revoked")
+		return
+	}
+	callerARN := awssdk.ToString(identity.Arn)
+	report.add("Identity", "ok", callerARN, "")
+
+	// Any HTTP response at all means the endpoint is reachable
+	endpoint := aws.KinesisEndpointURL(cfg)
+	endpointCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	req, _ := http.NewRequestWithContext(endpointCtx, http.MethodGet, endpoint, nil)
+	res, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		report.add("Endpoint", "fail", err.Error(), fmt.Sprintf("Check that %s can be reached through any proxy (HTTPS_PROXY) or VPC endpoint", endpoint))
+		return
+	}
+	res.Body.Close()
+	report.add("Endpoint", "ok", fmt.Sprintf("%s responded in %s", endpoint, time.Since(start).Round(time.Millisecond)), "")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		report.add("Kinesis client", "fail", err.Error(), "")
+		return
+	}
+
+	if streamName == "" {
+		_, err := client.ListStreams(ctx, &kinesis.ListStreamsInput{Limit: awssdk.Int32(1)})
+		report.call("ListStreams", "kinesis:ListStreams", "*", err, "")
+		report.add("Stream", "skip", "no stream given; pass -n to check reading and writing one", "")
+		return
+	}
+
+	summary, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{StreamName: &streamName})
+	streamARN := fmt.Sprintf("stream/%s", streamName)
+	if err == nil {
+		streamARN = awssdk.ToString(summary.StreamDescriptionSummary.StreamARN)
+	}
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		report.add("DescribeStreamSummary", "fail", err.Error(), "Check the stream name and region")
+		return
+	}
+	if !report.call("DescribeStreamSummary", "kinesis:DescribeStreamSummary", streamARN, err, "") {
+		return
+	}
+	s := summary.StreamDescriptionSummary
+	report.Checks[len(report.Checks)-1].Detail = fmt.Sprintf(
+		"%s, %d open shards, encryption %s", s.StreamStatus, awssdk.ToInt32(s.OpenShardCount), s.EncryptionType,
+	)
+
+	shards, err := listShards(ctx, client, streamName)
+	if !report.call("ListShards", "kinesis:ListShards", streamARN, err, fmt.Sprintf("%d shards", len(shards))) {
+		return
+	}
+
+	var shardId string
+	for _, shard := range shards {
+		if isOpenShard(shard) {
+			shardId = *shard.ShardId
+			break
+		}
+	}
+	if shardId == "" {
+		report.add("GetShardIterator", "skip", "no open shards", "")
+	} else {
+		iterator, err := client.GetShardIterator(ctx, &kinesis.GetShardIteratorInput{
+			StreamName:        &streamName,
+			ShardId:           &shardId,
+			ShardIteratorType: types.ShardIteratorTypeLatest,
+		})
+		if report.call("GetShardIterator", "kinesis:GetShardIterator", streamARN, err, shardId) {
+			_, err := client.GetRecords(ctx, &kinesis.GetRecordsInput{ShardIterator: iterator.ShardIterator})
+			report.call("GetRecords", "kinesis:GetRecords", streamARN, err, shardId)
+		}
+	}
+
+	if s.EncryptionType == types.EncryptionTypeKms {
+		report.add("KMS", "warn", "records are encrypted with "+awssdk.ToString(s.KeyId), "Run kin encryption check to confirm kms:Decrypt is allowed, since no records were read")
+	}
+
+	simulateWrites(ctx, report, callerARN, streamARN)
+}
+
+// simulateWrites asks the IAM policy simulator whether the caller may write to the stream.
+func simulateWrites(ctx context.Context, report *doctorReport, callerARN, streamARN string) {
+	const name = "PutRecord, PutRecords"
+
+	iamClient, err := aws.GetIAMClient()
+	if err != nil {
+		report.add(name, "skip", err.Error(), "")
+		return
+	}
+
+	principalARN, err := principalForSimulation(ctx, iamClient, callerARN)
+	if err != nil {
+		report.add(name, "skip", err.Error(), "")
+		return
+	}
+	if principalARN == "" {
+		report.add(name, "ok", "the account root user may do anything", "")
+		return
+	}
+
+	output, err := iamClient.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: &principalARN,
+		ActionNames:     []string{"kinesis:PutRecord", "kinesis:PutRecords"},
+		ResourceArns:    []string{streamARN},
+	})
+	if err != nil {
+		report.add(name, "skip", "couldn't simulate: "+err.Error(), "")
+		return
+	}
+
+	var denied []string
+	for _, result := range output.EvaluationResults {
+		if result.EvalDecision != "allowed" {
+			denied = append(denied, fmt.Sprintf("%s (%s)", awssdk.ToString(result.EvalActionName), result.EvalDecision))
+		}
+	}
+	if len(denied) > 0 {
+		report.add(name, "fail", "denied: "+strings.Join(denied, ", "), fmt.Sprintf("Allow kinesis:PutRecord and kinesis:PutRecords on %s", streamARN))
+		return
+	}
+	report.add(name, "ok", "allowed by the policy simulator", "")
+}
+
+// principalForSimulation returns the IAM user or role behind the caller's ARN, or "" for the
+// root user. Assumed-role session ARNs don't include the role's path, so the role is looked up.
+func principalForSimulation(ctx context.Context, client *iam.Client, callerARN string) (string, error) {
+	parts := strings.SplitN(callerARN, ":", 6)
+	if len(parts) < 6 {
+		return "", fmt.Errorf("unrecognized caller ARN %s", callerARN)
+	}
+	resource := parts[5]
+
+	switch {
+	case resource == "root":
+		return "", nil
+	case strings.HasPrefix(resource, "user/"):
+		return callerARN, nil
+	case strings.HasPrefix(resource, "assumed-role/"):
+		roleName := strings.Split(resource, "/")[1]
+		role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: &roleName})
+		if err != nil {
+			// Most roles have no path, so this is usually right
+			return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], roleName), nil
+		}
+		return awssdk.ToString(role.Role.Arn), nil
+	default:
+		return "", fmt.Errorf("can't simulate policies for %s", callerARN)
+	}
+}
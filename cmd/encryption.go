@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/tailer"
+	"os"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/spf13/cobra"
+)
+
+// The AWS-managed key used when --kms-key isn't given
+const defaultKinesisKMSKey = "alias/aws/kinesis"
+
+func init() {
+	encryptionCmd.PersistentFlags().StringP("stream-name", "n", "", "Stream name (required)")
+	encryptionCmd.MarkPersistentFlagRequired("stream-name")
+	encryptionCmd.Flags().Bool("enable", false, "Enable server-side encryption")
+	encryptionCmd.Flags().Bool("disable", false, "Disable server-side encryption")
+	encryptionCmd.Flags().String("kms-key", defaultKinesisKMSKey, "KMS key ID, ARN or alias to encrypt with")
+	encryptionCmd.Flags().Bool("wait", false, "Wait for the change to finish before exiting")
+	encryptionCmd.MarkFlagsMutuallyExclusive("enable", "disable")
+
+	encryptionCmd.AddCommand(encryptionCheckCmd)
+	rootCmd.AddCommand(encryptionCmd)
+}
+
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Show, enable or disable a stream's server-side encryption",
+	Long: `Without flags, prints a stream's encryption type and KMS key. With --enable or --disable, starts
+or stops server-side encryption with StartStreamEncryption or StopStreamEncryption.
+
+Changing encryption briefly puts the stream into the UPDATING state, though it stays readable and
+writable throughout. Only records written after the change are affected.
+
+Example:
+  kin encryption -n my-stream --enable --kms-key alias/my-key --wait`,
+	Run: runEncryptionCmd,
+}
+
+var encryptionCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that kin can read a stream's encrypted records",
+	Long: `Reading an encrypted stream requires kms:Decrypt on its key, and a missing permission only shows
+up once a record is read. check looks up the stream's key and reads a record from the first shard
+that has one, reporting whether KMS allowed it, so that problems surface before a long tail rather
+than partway through.`,
+	Run: runEncryptionCheckCmd,
+}
+
+func runEncryptionCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	enable, _ := cmd.Flags().GetBool("enable")
+	disable, _ := cmd.Flags().GetBool("disable")
+	kmsKey, _ := cmd.Flags().GetString("kms-key")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary := output.StreamDescriptionSummary
+
+	switch {
+	case enable:
+		_, err = client.StartStreamEncryption(cmd.Context(), &kinesis.StartStreamEncryptionInput{
+			StreamName:     &streamName,
+			EncryptionType: types.EncryptionTypeKms,
+			KeyId:          &kmsKey,
+		})
+		if err == nil {
+			cmd.PrintErrf("Enabling encryption of %s with %s\n", streamName, kmsKey)
+		}
+
+	case disable:
+		if summary.EncryptionType != types.EncryptionTypeKms {
+			cmd.PrintErrf("%s is not encrypted\n", streamName)
+			return
+		}
+		// StopStreamEncryption requires the key currently in use
+		_, err = client.StopStreamEncryption(cmd.Context(), &kinesis.StopStreamEncryptionInput{
+			StreamName:     &streamName,
+			EncryptionType: types.EncryptionTypeKms,
+			KeyId:          summary.KeyId,
+		})
+		if err == nil {
+			cmd.PrintErrf("Disabling encryption of %s\n", streamName)
+		}
+
+	default:
+		fmt.Printf("%s\t%s\n", summary.EncryptionType, orDash(awssdk.ToString(summary.KeyId)))
+		return
+	}
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if !wait {
+		return
+	}
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Stream %s is ACTIVE\n", streamName)
+}
+
+func runEncryptionCheckCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary := output.StreamDescriptionSummary
+
+	if summary.EncryptionType != types.EncryptionTypeKms {
+		fmt.Printf("ok    %s is not encrypted\n", streamName)
+		return
+	}
+	keyId := *summary.KeyId
+	fmt.Printf("ok    %s is encrypted with %s\n", streamName, keyId)
+
+	// Describing the key isn't needed to read the stream, so failing here is only a warning, but
+	// it catches keys that have been disabled or scheduled for deletion
+	kmsClient, err := aws.GetKMSClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	key, err := kmsClient.DescribeKey(cmd.Context(), &kms.DescribeKeyInput{KeyId: &keyId})
+	switch {
+	case err != nil:
+		fmt.Printf("warn  couldn't describe key: %s\n", aws.ErrorCode(err))
+	case !key.KeyMetadata.Enabled:
+		fmt.Printf("FAIL  key %s is %s\n", *key.KeyMetadata.KeyId, key.KeyMetadata.KeyState)
+		os.Exit(1)
+	default:
+		fmt.Printf("ok    key %s is %s\n", *key.KeyMetadata.KeyId, key.KeyMetadata.KeyState)
+	}
+
+	read, err := readOneRecord(cmd.Context(), client, streamName)
+	switch {
+	case err != nil && strings.HasPrefix(aws.ErrorCode(err), "KMS"):
+		fmt.Printf("FAIL  reading records: %s\n", err)
+		os.Exit(1)
+	case err != nil:
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	case !read:
+		fmt.Printf("warn  %s has no records to test decryption with\n", streamName)
+	default:
+		fmt.Println("ok    records can be decrypted")
+	}
+}
+
+// readOneRecord reads from each open shard's trim horizon until a record is returned, reporting
+// whether one was. Kinesis only calls KMS when there's a record to decrypt, so an empty read
+// proves nothing.
+func readOneRecord(ctx context.Context, client aws.KinesisAPI, streamName string) (bool, error) {
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return false, err
+	}
+
+	for _, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+
+		iterator, err := getShardIterator(client, &streamName, shard.ShardId, &TailOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		// A shard's first records may be some way from its trim horizon, so follow the iterator
+		// for a few calls before moving on
+		limiter := newGetRecordsLimiter()
+		for range 5 {
+			if err := tailer.WaitGetRecords(ctx, limiter); err != nil {
+				return false, err
+			}
+
+			output, err := client.GetRecords(ctx, &kinesis.GetRecordsInput{
+				ShardIterator: iterator,
+				Limit:         awssdk.Int32(1),
+			})
+			if err != nil {
+				return false, err
+			}
+			if len(output.Records) > 0 {
+				return true, nil
+			}
+			if output.NextShardIterator == nil || awssdk.ToInt64(output.MillisBehindLatest) == 0 {
+				break
+			}
+			iterator = output.NextShardIterator
+		}
+	}
+	return false, nil
+}
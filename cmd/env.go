@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the name of the environment variable of every flag
+const envPrefix = "KIN_"
+
+// envName returns the name of a flag's environment variable: KIN_ followed by its name in upper
+// case, with underscores for dashes, such as KIN_STREAM_NAME for --stream-name.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets each flag of cmd that wasn't given from its environment variable, if that's set
+// and not empty, as though it had been given. Flags given on the command line override their
+// environment variables, which override the config file.
+func applyEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == "help" || err != nil {
+			return
+		}
+
+		name := envName(flag.Name)
+		value := os.Getenv(name)
+		if value == "" {
+			return
+		}
+
+		if setErr := cmd.Flags().Set(flag.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", name, setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"math/big"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type KeyExplanation struct {
+	PartitionKey string `json:"partition_key"`
+	MD5          string `json:"md5"`
+	HashKey      string `json:"hash_key"`
+
+	// The open shard whose hash key range contains the hash key
+	ShardId         string `json:"shard_id"`
+	StartingHashKey string `json:"starting_hash_key"`
+	EndingHashKey   string `json:"ending_hash_key"`
+
+	// Which child of a proposed split would receive the key: 1 for the lower half of the range,
+	// 2 for the upper, or 0 if the key's shard isn't the one being split
+	SplitChild int `json:"split_child,omitempty"`
+}
+
+func init() {
+	explainKeyCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	explainKeyCmd.Flags().StringArrayP("key", "k", nil, "Partition key to explain; may be repeated (required)")
+	explainKeyCmd.Flags().String("split-shard", "", "Also show which child of this shard each key would go to if it were split")
+	explainKeyCmd.Flags().String("split-hash-key", "", "Starting hash key of the second child of the proposed split; defaults to the midpoint of the shard's range")
+	explainKeyCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	explainKeyCmd.MarkFlagRequired("stream-name")
+	explainKeyCmd.MarkFlagRequired("key")
+
+	rootCmd.AddCommand(explainKeyCmd)
+}
+
+var explainKeyCmd = &cobra.Command{
+	Use:   "explain-key",
+	Short: "Show which shard a partition key is routed to",
+	Long: `Computes the hash key Kinesis derives from a partition key, the MD5 digest of the key read as
+a 128-bit integer, and shows which open shard's hash key range contains it.
+
+With --split-shard, also shows which of the two children would receive the key if that shard were
+split at --split-hash-key, as split-shard would split it. This helps check that a split will
+separate the hot keys it's meant to.
+
+Example:
+  kin explain-key -n orders -k customer-42 -k customer-43 --split-shard shardId-000000000003`,
+	Run: runExplainKeyCmd,
+}
+
+func runExplainKeyCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	keys, _ := cmd.Flags().GetStringArray("key")
+	splitShardId, _ := cmd.Flags().GetString("split-shard")
+	splitHashKeyS, _ := cmd.Flags().GetString("split-hash-key")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if splitHashKeyS != "" && splitShardId == "" {
+		cmd.PrintErrln("--split-hash-key requires --split-shard")
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var splitAt *big.Int
+	if splitShardId != "" {
+		shard := findShard(shards, splitShardId)
+		if shard == nil {
+			cmd.PrintErrf("%s has no shard %s\n", streamName, splitShardId)
+			os.Exit(1)
+		}
+		if !isOpenShard(*shard) {
+			cmd.PrintErrf("%s is closed and can't be split\n", splitShardId)
+			os.Exit(1)
+		}
+
+		if splitHashKeyS != "" {
+			var ok bool
+			splitAt, ok = new(big.Int).SetString(splitHashKeyS, 10)
+			if !ok {
+				cmd.PrintErrf("invalid --split-hash-key %q: must be a decimal integer\n", splitHashKeyS)
+				os.Exit(1)
+			}
+		}
+		splitAt, err = splitHashKey(*shard, splitAt)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+
+	var explanations []KeyExplanation
+	for _, key := range keys {
+		hashKey := hashKeyForPartitionKey(key)
+		explanation := KeyExplanation{
+			PartitionKey: key,
+			MD5:          fmt.Sprintf("%032x", hashKey),
+			HashKey:      hashKey.String(),
+		}
+
+		shard := shardForHashKey(shards, hashKey)
+		if shard == nil {
+			// Only possible while the stream is mid-reshard and ListShards raced with it
+			cmd.PrintErrf("no open shard covers hash key %s of %q\n", hashKey, key)
+			os.Exit(1)
+		}
+		explanation.ShardId = *shard.ShardId
+		explanation.StartingHashKey = *shard.HashKeyRange.StartingHashKey
+		explanation.EndingHashKey = *shard.HashKeyRange.EndingHashKey
+
+		if splitAt != nil && *shard.ShardId == splitShardId {
+			explanation.SplitChild = 1
+			if hashKey.Cmp(splitAt) >= 0 {
+				explanation.SplitChild = 2
+			}
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	if output == "json" {
+		for _, explanation := range explanations {
+			printJSON(explanation)
+		}
+		return
+	}
+
+	headers := []string{"PARTITION KEY", "MD5", "HASH KEY", "SHARD"}
+	if splitAt != nil {
+		headers = append(headers, "AFTER SPLIT")
+	}
+	rows := [][]string{}
+	for _, e := range explanations {
+		row := []string{e.PartitionKey, e.MD5, e.HashKey, e.ShardId}
+		if splitAt != nil {
+			switch e.SplitChild {
+			case 1:
+				row = append(row, fmt.Sprintf("first child (below %s)", splitAt))
+			case 2:
+				row = append(row, fmt.Sprintf("second child (from %s)", splitAt))
+			default:
+				row = append(row, "unchanged")
+			}
+		}
+		rows = append(rows, row)
+	}
+	printTable(os.Stdout, headers, rows)
+}
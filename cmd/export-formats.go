@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Records are appended to an Avro file in blocks of this many, each compressed on its own
+const avroBlockRecords = 1000
+
+// recordEncoder writes records to an export file in one format. Close flushes anything buffered
+// without closing the underlying writer.
+type recordEncoder interface {
+	Encode(record *RecordOutput) error
+	Close() error
+}
+
+type exportFormat struct {
+	extension string
+
+	// columnar formats have a schema, and compress their own data with compression when --gzip
+	// is given rather than being gzipped whole
+	columnar    bool
+	compression string
+
+	newEncoder func(w io.Writer, schema *exportSchema, compress bool) (recordEncoder, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"ndjson":  {".ndjson", false, "gzip", newNDJSONEncoder},
+	"parquet": {".parquet", true, "gzip", newParquetEncoder},
+	"avro":    {".avro", true, "deflate", newAvroEncoder},
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer, _ *exportSchema, _ bool) (recordEncoder, error) {
+	return &ndjsonEncoder{json.NewEncoder(w)}, nil
+}
+
+func (e *ndjsonEncoder) Encode(record *RecordOutput) error {
+	return e.encoder.Encode(record)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// exportColumn is a column of a columnar export, typed with the payload field types or bytes.
+type exportColumn struct {
+	name     string
+	typ      string
+	optional bool
+}
+
+const columnBytes = "bytes"
+
+// Columns describing every record, ahead of those for its payload
+var exportMetadataColumns = []exportColumn{
+	{"shard_id", fieldString, false},
+	{"partition_key", fieldString, false},
+	{"sequence_number", fieldString, false},
+	{"approximate_arrival_timestamp", fieldTimestamp, false},
+	{"size", fieldLong, false},
+	{"raw_data", columnBytes, false},
+}
+
+// exportSchema lays out records as columns: the metadata columns, followed by a column for each
+// payload field or, without any fields, a single data column holding the payload as JSON.
+type exportSchema struct {
+	columns []exportColumn
+	fields  []payloadField
+}
+
+func newExportSchema(fields []payloadField) (*exportSchema, error) {
+	schema := &exportSchema{columns: append([]exportColumn{}, exportMetadataColumns...), fields: fields}
+	if len(fields) == 0 {
+		schema.columns = append(schema.columns, exportColumn{"data", fieldString, true})
+		return schema, nil
+	}
+
+	names := map[string]bool{}
+	for _, column := range exportMetadataColumns {
+		names[column.name] = true
+	}
+	for _, field := range fields {
+		if names[field.Name] {
+			return nil, fmt.Errorf("payload field %s clashes with another column of the same name", field.Name)
+		}
+		names[field.Name] = true
+		schema.columns = append(schema.columns, exportColumn{field.Name, field.Type, true})
+	}
+	return schema, nil
+}
+
+// row returns the value of every column for a record, in column order. Payload values that are
+// missing or don't suit their column are null.
+func (s *exportSchema) row(record *RecordOutput) []any {
+	row := []any{
+		*record.ShardId,
+		*record.PartitionKey,
+		*record.SequenceNumber,
+		record.ApproximateArrivalTimestamp.UnixMilli(),
+		int64(*record.Size),
+		record.RawData,
+	}
+
+	if len(s.fields) == 0 {
+		if record.Data == nil {
+			return append(row, nil)
+		}
+		return append(row, jsonString(*record.Data))
+	}
+
+	var object map[string]interface{}
+	if record.Data != nil {
+		object, _ = (*record.Data).(map[string]interface{})
+	}
+	for _, field := range s.fields {
+		row = append(row, payloadValue(field.Type, object[field.Key]))
+	}
+	return row
+}
+
+// Rows are buffered until their values add up to about this many bytes, then written as a row
+// group
+const parquetRowGroupBytes = 64 << 20
+
+type parquetEncoder struct {
+	writer   *parquet.Writer
+	schema   *exportSchema
+	rows     []parquet.Row
+	buffered int
+}
+
+func newParquetEncoder(w io.Writer, schema *exportSchema, compress bool) (recordEncoder, error) {
+	nodes := map[string]parquet.Node{
+		fieldBoolean:   parquet.Leaf(parquet.BooleanType),
+		fieldLong:      parquet.Int(64),
+		fieldDouble:    parquet.Leaf(parquet.DoubleType),
+		fieldString:    parquet.String(),
+		fieldTimestamp: parquet.Timestamp(parquet.Millisecond),
+		columnBytes:    parquet.Leaf(parquet.ByteArrayType),
+	}
+
+	group := parquet.Group{}
+	for _, column := range schema.columns {
+		node := nodes[column.typ]
+		if column.optional {
+			node = parquet.Optional(node)
+		}
+		group[column.name] = node
+	}
+
+	codec := parquet.Compression(&parquet.Uncompressed)
+	if compress {
+		codec = parquet.Compression(&parquet.Gzip)
+	}
+	writer := parquet.NewWriter(w, parquet.NewSchema("record", orderedGroup{group, schema.columns}), codec, parquet.CreatedBy("kin", "", ""))
+	return &parquetEncoder{writer: writer, schema: schema}, nil
+}
+
+// orderedGroup is a Group whose fields are in the order of the export's columns, rather than
+// sorted by name.
+type orderedGroup struct {
+	parquet.Group
+	columns []exportColumn
+}
+
+func (g orderedGroup) Fields() []parquet.Field {
+	fields := g.Group.Fields()
+	byName := make(map[string]parquet.Field, len(fields))
+	for _, field := range fields {
+		byName[field.Name()] = field
+	}
+
+	ordered := make([]parquet.Field, len(g.columns))
+	for i, column := range g.columns {
+		ordered[i] = byName[column.name]
+	}
+	return ordered
+}
+
+func (e *parquetEncoder) Encode(record *RecordOutput) error {
+	values := e.schema.row(record)
+	row := make(parquet.Row, len(values))
+	for i, value := range values {
+		column := e.schema.columns[i]
+		definitionLevel := 0
+		if column.optional {
+			definitionLevel = 1
+		}
+
+		var v parquet.Value
+		switch value := value.(type) {
+		case nil:
+			v, definitionLevel = parquet.NullValue(), 0
+		case bool:
+			v = parquet.BooleanValue(value)
+		case int64:
+			v = parquet.Int64Value(value)
+		case float64:
+			v = parquet.DoubleValue(value)
+		case string:
+			v = parquet.ByteArrayValue([]byte(value))
+		case []byte:
+			v = parquet.ByteArrayValue(value)
+		default:
+			return fmt.Errorf("column %s can't hold a %T", column.name, value)
+		}
+		if v.IsNull() && !column.optional {
+			return fmt.Errorf("column %s is required but the value is null", column.name)
+		}
+		row[i] = v.Level(0, definitionLevel, i)
+		e.buffered += len(v.Bytes()) + 4
+	}
+
+	e.rows = append(e.rows, row)
+	if e.buffered >= parquetRowGroupBytes {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group.
+func (e *parquetEncoder) flush() error {
+	if len(e.rows) == 0 {
+		return nil
+	}
+	if _, err := e.writer.WriteRows(e.rows); err != nil {
+		return err
+	}
+	e.rows = e.rows[:0]
+	e.buffered = 0
+	return e.writer.Flush()
+}
+
+func (e *parquetEncoder) Close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	return e.writer.Close()
+}
+
+type avroEncoder struct {
+	writer  *goavro.OCFWriter
+	schema  *exportSchema
+	pending []interface{}
+}
+
+func newAvroEncoder(w io.Writer, schema *exportSchema, compress bool) (recordEncoder, error) {
+	compression := goavro.CompressionNullLabel
+	if compress {
+		compression = goavro.CompressionDeflateLabel
+	}
+
+	writer, err := goavro.NewOCFWriter(goavro.OCFConfig{W: w, Schema: schema.avroSchema(), CompressionName: compression})
+	if err != nil {
+		return nil, err
+	}
+	return &avroEncoder{writer: writer, schema: schema}, nil
+}
+
+func (e *avroEncoder) Encode(record *RecordOutput) error {
+	datum := map[string]interface{}{}
+	for i, value := range e.schema.row(record) {
+		column := e.schema.columns[i]
+		if column.optional && value != nil {
+			value = goavro.Union(avroTypeName(column.typ), value)
+		}
+		datum[column.name] = value
+	}
+
+	e.pending = append(e.pending, datum)
+	if len(e.pending) >= avroBlockRecords {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *avroEncoder) Close() error {
+	return e.flush()
+}
+
+func (e *avroEncoder) flush() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	err := e.writer.Append(e.pending)
+	e.pending = e.pending[:0]
+	return err
+}
+
+// avroSchema returns the Avro schema of a record with a field for every column.
+func (s *exportSchema) avroSchema() string {
+	var fields []map[string]interface{}
+	for _, column := range s.columns {
+		var typ interface{} = column.typ
+		if column.typ == fieldTimestamp {
+			typ = map[string]string{"type": "long", "logicalType": fieldTimestamp}
+		}
+
+		field := map[string]interface{}{"name": column.name, "type": typ}
+		if column.optional {
+			field["type"] = []interface{}{"null", typ}
+			field["default"] = nil
+		}
+		fields = append(fields, field)
+	}
+
+	schema, _ := json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      "Record",
+		"namespace": "kin",
+		"fields":    fields,
+	})
+	return string(schema)
+}
+
+// avroTypeName returns the name goavro gives the branch of a union holding a column's type.
+func avroTypeName(typ string) string {
+	if typ == fieldTimestamp {
+		return "long.timestamp-millis"
+	}
+	return typ
+}
@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+const exportManifestName = "manifest.json"
+
+// ExportManifest describes a completed export, so that it can be found and replayed later.
+type ExportManifest struct {
+	StreamName  string       `json:"stream_name"`
+	From        time.Time    `json:"from"`
+	Until       time.Time    `json:"until"`
+	ExportedAt  time.Time    `json:"exported_at"`
+	Format      string       `json:"format"`
+	Compression string       `json:"compression,omitempty"`
+	Records     int          `json:"records"`
+	Bytes       int          `json:"bytes"`
+	Files       []ExportFile `json:"files"`
+
+	// Skipped is the number of records left out with --skip-errors because they couldn't be
+	// written
+	Skipped int `json:"skipped,omitempty"`
+}
+
+type ExportFile struct {
+	// Path of the file relative to the manifest
+	Path                string `json:"path"`
+	ShardId             string `json:"shard_id"`
+	Records             int    `json:"records"`
+	Bytes               int    `json:"bytes"`
+	FirstSequenceNumber string `json:"first_sequence_number"`
+	LastSequenceNumber  string `json:"last_sequence_number"`
+}
+
+func init() {
+	exportCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	exportCmd.Flags().String("from", "", "Start of the time range to export, as an RFC 3339 timestamp or a duration ago (ex: 2h) (required)")
+	exportCmd.Flags().String("until", "", "End of the time range to export, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	exportCmd.Flags().String("out", "", "Directory to write the export to; created if it doesn't exist (required)")
+	exportCmd.Flags().String("format", "ndjson", "Format of the exported files: ndjson, parquet or avro")
+	exportCmd.Flags().Bool("gzip", false, "Compress the exported files: whole with gzip for ndjson, gzip pages for parquet, deflate blocks for avro")
+	exportCmd.Flags().String("schema", "", "Avro schema (.avsc) of the payloads, giving the payload columns of a parquet or avro export")
+	exportCmd.Flags().Int("infer-sample", 1000, "Number of records to read first to infer the payload columns of a parquet or avro export without --schema; 0 keeps the payload as a single JSON column")
+	exportCmd.Flags().Bool("no-data", false, "Leave out the decoded payload, keeping only the raw payload and metadata")
+	addErrorPolicyFlags(exportCmd.Flags())
+	addProgressFlag(exportCmd.Flags())
+	exportCmd.MarkFlagRequired("stream-name")
+	exportCmd.MarkFlagRequired("from")
+	exportCmd.MarkFlagRequired("out")
+
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a time range of a stream to files",
+	Long: `Reads every shard in parallel from --from until --until and writes the records to files under
+--out, then exits. Files are partitioned by the hour records arrived in and by shard, as
+date=YYYY-MM-DD/hour=HH/<shard>.<format>, so that they can be queried with Athena or Spark
+partition pruning.
+
+With --format ndjson, each line is a record in the same form tail prints, with timestamps in
+RFC 3339 and the raw payload always included, so that the export can be replayed exactly with the
+replay command. A manifest.json listing every file, with its record count and sequence number
+range, is written last; an export without one didn't finish.
+
+With --format parquet or avro, each record is a row with shard_id, partition_key,
+sequence_number, approximate_arrival_timestamp, size and raw_data columns, followed by a nullable
+column for each top-level field of the JSON payloads. The payload columns come from the Avro record
+schema given by --schema or, without one, are inferred from the first --infer-sample records:
+booleans, integers and other numbers are typed as such, and anything else, including nested
+objects, is a string of JSON. Fields not seen while inferring, and values that don't suit their
+column, are only kept in raw_data. With no payload columns, the payload is a single data column
+of JSON.
+
+A shard that fails stops being exported, and the export is left without a manifest once the
+others finish. --strict stops every shard as soon as one fails instead; --skip-errors leaves out
+records that can't be written and carries on, counting them in the manifest's skipped field.
+
+--progress json writes a line of JSON to stderr for each step, such as a shard's iterator being
+acquired, a batch being read or a file being finished, ending with a done event, so that wrappers
+can follow a long export.
+
+Example:
+  kin export -n orders --from 2024-05-01T00:00:00Z --until 2024-05-02T00:00:00Z --out orders/ --gzip
+  kin export -n orders --from 6h --out orders/ --format parquet --schema order.avsc`,
+	Run: runExportCmd,
+}
+
+func runExportCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	out, _ := cmd.Flags().GetString("out")
+	formatName, _ := cmd.Flags().GetString("format")
+	compress, _ := cmd.Flags().GetBool("gzip")
+	noData, _ := cmd.Flags().GetBool("no-data")
+	schemaPath, _ := cmd.Flags().GetString("schema")
+	inferSample, _ := cmd.Flags().GetInt("infer-sample")
+	errs, err := errorPolicyFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	progress, err := progressFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	format, ok := exportFormats[formatName]
+	if !ok {
+		cmd.PrintErrf("unknown --format %q\n", formatName)
+		os.Exit(1)
+	}
+	if schemaPath != "" && !format.columnar {
+		cmd.PrintErrln("--schema only applies to --format parquet or avro")
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, exportManifestName)); err == nil {
+		cmd.PrintErrf("%s already contains an export\n", out)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	tailOptions := &TailOptions{
+		AtTimestamp:     &from,
+		NoData:          noData,
+		IncludeRaw:      true,
+		TimestampFormat: &TimestampFormat{Layout: time.RFC3339Nano},
+		Errors:          errs,
+	}
+
+	var schema *exportSchema
+	if format.columnar {
+		var fields []payloadField
+		switch {
+		case schemaPath != "":
+			fields, err = loadAvroSchemaFields(schemaPath)
+		case !noData && inferSample > 0:
+			fields, err = sampleAndInferPayloadFields(cmd.Context(), client, streamName, shards, tailOptions, until, inferSample)
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		schema, err = newExportSchema(fields)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+
+	manifest := ExportManifest{
+		StreamName: streamName,
+		From:       from.UTC(),
+		Until:      until.UTC(),
+		Format:     formatName,
+		Files:      []ExportFile{},
+	}
+	if compress {
+		manifest.Compression = format.compression
+	}
+
+	// Progress is only reported for the export itself, not for the records sampled to infer a
+	// schema
+	tailOptions.Progress = progress
+	shardIds := make([]string, len(shards))
+	for i, shard := range shards {
+		shardIds[i] = *shard.ShardId
+	}
+	progress.ShardsDiscovered(shardIds)
+
+	// With --strict, the first shard to fail stops the others
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := false
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+		logger := slog.With("shard", shardId)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			exporter := &shardExporter{dir: out, shardId: shardId, format: format, schema: schema, compress: compress, progress: progress}
+			err := scanShard(ctx, client, streamName, shardId, tailOptions, func(record types.Record, millisBehindLatest *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				output := newRecordOutput(&shardId, record, millisBehindLatest, tailOptions, logger)
+				if err := exporter.Write(*record.ApproximateArrivalTimestamp, &output); err != nil {
+					skip, stop := errs.Handle(errWrite, &output, err)
+					if skip {
+						return true
+					}
+					if stop != nil {
+						cancel()
+						err = stop
+					}
+					logger.Error("failed to write record", "error", err)
+					exporter.err = err
+					return false
+				}
+				return true
+			})
+			if exporter.err == nil && errs.Strict() && errors.Is(err, context.Canceled) {
+				// Stopped by another shard's failure, which is what's reported
+				err = nil
+			}
+			err = errors.Join(err, exporter.err, exporter.Close())
+			progress.ShardDone(shardId, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+				failed = true
+			}
+			manifest.Files = append(manifest.Files, exporter.files...)
+		}()
+	}
+	wg.Wait()
+
+	if failed {
+		// Leave out the manifest so that the partial export can't be mistaken for a complete one
+		os.Exit(1)
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	for _, file := range manifest.Files {
+		manifest.Records += file.Records
+		manifest.Bytes += file.Bytes
+	}
+	manifest.Skipped = errs.Skipped()
+	manifest.ExportedAt = time.Now().UTC()
+
+	if err := writeExportManifest(out, &manifest); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	progress.Done(map[string]interface{}{
+		"records": manifest.Records,
+		"bytes":   manifest.Bytes,
+		"files":   len(manifest.Files),
+		"skipped": manifest.Skipped,
+	})
+	cmd.PrintErrf("Exported %d records (%s) in %d files to %s\n", manifest.Records, formatBytes(float64(manifest.Bytes)), len(manifest.Files), out)
+	errs.Summarize(cmd.ErrOrStderr())
+}
+
+// shardExporter writes the records of one shard to a file per hour. Records in a shard arrive in
+// order, so only one file is open at a time.
+type shardExporter struct {
+	dir      string
+	shardId  string
+	format   exportFormat
+	schema   *exportSchema
+	compress bool
+	progress *progressReporter
+
+	file    *os.File
+	buffer  *bufio.Writer
+	gzip    *gzip.Writer
+	encoder recordEncoder
+	hour    time.Time
+
+	files []ExportFile
+	err   error
+}
+
+func (e *shardExporter) Write(arrival time.Time, record *RecordOutput) error {
+	// Arrival times are approximate and may step back slightly, so a record arriving just after
+	// the hour turned may be followed by one from just before; it stays in the newer file
+	hour := arrival.UTC().Truncate(time.Hour)
+	if e.file == nil || hour.After(e.hour) {
+		if err := e.Close(); err != nil {
+			return err
+		}
+		if err := e.open(hour); err != nil {
+			return err
+		}
+	}
+
+	if err := e.encoder.Encode(record); err != nil {
+		return err
+	}
+
+	file := &e.files[len(e.files)-1]
+	if file.Records == 0 {
+		file.FirstSequenceNumber = *record.SequenceNumber
+	}
+	file.LastSequenceNumber = *record.SequenceNumber
+	file.Records++
+	file.Bytes += *record.Size
+	return nil
+}
+
+func (e *shardExporter) open(hour time.Time) error {
+	path := filepath.Join(hour.Format("date=2006-01-02"), hour.Format("hour=15"), e.shardId+e.format.extension)
+	gzipFile := e.compress && !e.format.columnar
+	if gzipFile {
+		path += ".gz"
+	}
+	if err := os.MkdirAll(filepath.Join(e.dir, filepath.Dir(path)), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(e.dir, path))
+	if err != nil {
+		return err
+	}
+
+	buffer := bufio.NewWriter(file)
+	var w io.Writer = buffer
+	var gz *gzip.Writer
+	if gzipFile {
+		gz = gzip.NewWriter(buffer)
+		w = gz
+	}
+	encoder, err := e.format.newEncoder(w, e.schema, e.compress)
+	if err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	e.file, e.buffer, e.gzip, e.encoder = file, buffer, gz, encoder
+	e.hour = hour
+	e.files = append(e.files, ExportFile{Path: filepath.ToSlash(path), ShardId: e.shardId})
+	return nil
+}
+
+// Close finishes the current file, if any.
+func (e *shardExporter) Close() error {
+	if e.file == nil {
+		return nil
+	}
+
+	err := e.encoder.Close()
+	if e.gzip != nil {
+		err = errors.Join(err, e.gzip.Close())
+	}
+	err = errors.Join(err, e.buffer.Flush(), e.file.Close())
+	if err == nil {
+		e.progress.FileWritten(e.files[len(e.files)-1])
+	}
+
+	e.file, e.buffer, e.gzip, e.encoder = nil, nil, nil, nil
+	return err
+}
+
+// writeExportManifest writes the manifest to a temporary file first, so that a manifest is only
+// ever seen complete.
+func writeExportManifest(dir string, manifest *ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, exportManifestName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, exportManifestName))
+}
+
+// readExportManifest reads the manifest of a finished export.
+func readExportManifest(dir string) (*ExportManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, exportManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s has no %s; is it a finished export?", dir, exportManifestName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", exportManifestName, err)
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"kin/pkg/tailer"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// The kinds of discontinuity a gapDetector warns about
+const (
+	// gapSkipped is a shard being read from somewhere other than right after the last record read,
+	// so that the records in between may never have been read
+	gapSkipped = "skipped"
+	// gapOutOfOrder is a record whose sequence number isn't greater than the one before it
+	gapOutOfOrder = "out_of_order"
+)
+
+// gapDetector tracks the sequence numbers read from each shard, warning whenever records appear
+// to have been skipped or read out of order. Kinesis sequence numbers increase within a shard but
+// aren't contiguous, so a skip can only be seen where reading restarts: a shard iterator acquired
+// after records have already been read from the shard must start right after the last of them.
+// Iterators that start earlier, such as at a checkpoint when a lease is taken back, mean records
+// are read again rather than skipped, and aren't warned about.
+//
+// A nil gapDetector detects nothing. It's safe for concurrent use, and implements
+// tailer.IteratorObserver.
+type gapDetector struct {
+	progress *progressReporter
+
+	mu     sync.Mutex
+	last   map[string]*big.Int
+	counts map[string]int
+}
+
+func newGapDetector(progress *progressReporter) *gapDetector {
+	return &gapDetector{progress: progress, last: map[string]*big.Int{}, counts: map[string]int{}}
+}
+
+func (d *gapDetector) ObserveShardIterator(shardId string, position tailer.Position) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last, ok := d.last[shardId]
+	if !ok {
+		return
+	}
+
+	switch position.Type {
+	case types.ShardIteratorTypeAfterSequenceNumber, types.ShardIteratorTypeAtSequenceNumber:
+		start, ok := new(big.Int).SetString(*position.SequenceNumber, 10)
+		if !ok {
+			return
+		}
+		// The last record the iterator is continuous with
+		if position.Type == types.ShardIteratorTypeAtSequenceNumber {
+			start.Sub(start, big.NewInt(1))
+		}
+
+		if start.Cmp(last) > 0 {
+			d.warn(shardId, gapSkipped, "shard iterator starts past the last record read; records in between may have been skipped",
+				"last_sequence_number", last.String(),
+				"iterator_type", string(position.Type),
+				"sequence_number", *position.SequenceNumber,
+			)
+		}
+		d.last[shardId] = start
+
+	case types.ShardIteratorTypeTrimHorizon:
+		// Everything still in the shard will be read again
+		delete(d.last, shardId)
+
+	default:
+		d.warn(shardId, gapSkipped, "shard iterator restarted without a sequence number; records may have been skipped",
+			"last_sequence_number", last.String(),
+			"iterator_type", string(position.Type),
+		)
+		delete(d.last, shardId)
+	}
+}
+
+func (d *gapDetector) ObserveGetRecords(shardId string, latency time.Duration, records, bytes int, millisBehindLatest *int64) {
+}
+
+func (d *gapDetector) ObserveThrottle(shardId string) {}
+
+// ObserveRecord checks a record read from a shard against the one before it.
+func (d *gapDetector) ObserveRecord(shardId, sequenceNumber string) {
+	if d == nil {
+		return
+	}
+
+	n, ok := new(big.Int).SetString(sequenceNumber, 10)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.last[shardId]; ok && n.Cmp(last) <= 0 {
+		d.warn(shardId, gapOutOfOrder, "sequence number didn't increase; records may have been read twice or out of order",
+			"last_sequence_number", last.String(),
+			"sequence_number", sequenceNumber,
+		)
+	}
+	d.last[shardId] = n
+}
+
+// warn logs a discontinuity and reports it as a gap_detected progress event.
+func (d *gapDetector) warn(shardId, kind, msg string, args ...string) {
+	d.counts[kind]++
+
+	attrs := []interface{}{"shard", shardId, "kind", kind}
+	fields := map[string]interface{}{"shard_id": shardId, "kind": kind}
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs = append(attrs, args[i], args[i+1])
+		fields[args[i]] = args[i+1]
+	}
+	slog.Warn(msg, attrs...)
+	d.progress.emit("gap_detected", fields)
+}
+
+// Summarize writes how many discontinuities were found, if any were.
+func (d *gapDetector) Summarize(w io.Writer) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if skipped := d.counts[gapSkipped]; skipped > 0 {
+		fmt.Fprintf(w, "Detected %d possible gaps in the records read\n", skipped)
+	}
+	if outOfOrder := d.counts[gapOutOfOrder]; outOfOrder > 0 {
+		fmt.Fprintf(w, "Detected %d records read out of order or more than once\n", outOfOrder)
+	}
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/producer"
+	mathrand "math/rand"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultGenerateTemplate = `{"id":"{{uuid}}","key":"{{.Key}}","seq":{{.Seq}},"ts":"{{now}}","value":{{int 0 1000}}}`
+
+// verifiableGenerateTemplate is the payload of --verifiable records, which kin verify reads back
+const verifiableGenerateTemplate = `{"run":"{{.Run}}","key":"{{.Key}}","n":{{.KeySeq}},"ts":"{{now}}"}`
+
+// generateTemplateData is available to templates as "." for each generated record
+type generateTemplateData struct {
+	Run    string
+	Key    string
+	Seq    int64
+	KeySeq int64
+	Time   time.Time
+}
+
+var (
+	firstNames = []string{"Ada", "Alan", "Barbara", "Claude", "Edsger", "Frances", "Grace", "Ken", "Linus", "Margaret", "Niklaus", "Radia"}
+	lastNames  = []string{"Allen", "Hamilton", "Hopper", "Knuth", "Lamport", "Liskov", "Lovelace", "Perlman", "Ritchie", "Shannon", "Thompson", "Turing"}
+	words      = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet", "kilo", "lima"}
+	domains    = []string{"example.com", "example.net", "example.org"}
+)
+
+var generateFuncs = template.FuncMap{
+	"uuid": func() string {
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	},
+	"hex": randomHex,
+	"int": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + mathrand.Intn(max-min+1)
+	},
+	"float": func(min, max float64) float64 {
+		return min + mathrand.Float64()*(max-min)
+	},
+	"bool": func() bool {
+		return mathrand.Intn(2) == 0
+	},
+	"choice": func(choices ...string) string {
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[mathrand.Intn(len(choices))]
+	},
+	"firstName": func() string { return pick(firstNames) },
+	"lastName":  func() string { return pick(lastNames) },
+	"name": func() string {
+		return pick(firstNames) + " " + pick(lastNames)
+	},
+	"email": func() string {
+		return strings.ToLower(pick(firstNames)+"."+pick(lastNames)) + "@" + pick(domains)
+	},
+	"word": func() string { return pick(words) },
+	"words": func(n int) string {
+		chosen := make([]string, n)
+		for i := range chosen {
+			chosen[i] = pick(words)
+		}
+		return strings.Join(chosen, " ")
+	},
+	"ip": func() string {
+		return fmt.Sprintf("10.%d.%d.%d", mathrand.Intn(256), mathrand.Intn(256), 1+mathrand.Intn(254))
+	},
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	},
+	"unixMillis": func() int64 {
+		return time.Now().UnixMilli()
+	},
+	// json quotes a value so it can be embedded safely in a JSON template
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func pick(values []string) string {
+	return values[mathrand.Intn(len(values))]
+}
+
+func init() {
+	generateCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	generateCmd.Flags().String("template", defaultGenerateTemplate, "Go template for each record's payload")
+	generateCmd.Flags().String("template-file", "", "File containing the template for each record's payload")
+	generateCmd.Flags().Int("keys", 100, "Number of distinct partition keys to spread records over")
+	generateCmd.Flags().Int64("count", 0, "Number of records to generate; 0 generates until interrupted")
+	generateCmd.Flags().Duration("duration", 0, "Stop generating after this long (ex: 5m)")
+	generateCmd.Flags().Bool("dry-run", false, "Print generated records to stdout instead of publishing them")
+	generateCmd.Flags().Bool("verifiable", false, "Publish numbered records that kin verify can check for ordering, gaps and duplicates, instead of using a template")
+	addRateLimitFlags(generateCmd.Flags())
+	generateCmd.MarkFlagRequired("stream-name")
+	generateCmd.MarkFlagsMutuallyExclusive("verifiable", "template")
+	generateCmd.MarkFlagsMutuallyExclusive("verifiable", "template-file")
+
+	rootCmd.AddCommand(generateCmd)
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Publish synthetic records to a Kinesis Data Stream",
+	Long: `Generates fake records from a template and publishes them to the target stream, for putting
+load on development streams.
+
+Templates use Go's text/template syntax. Each record can refer to {{.Key}} (its partition key),
+{{.Seq}} (its sequence in this run, from 0), {{.KeySeq}} (its sequence among this run's records
+with the same key, from 0), {{.Run}} (a random ID for this run) and {{.Time}}, and use these
+functions:
+
+  uuid                 a random UUID
+  hex N                N random bytes, hex-encoded
+  int MIN MAX          a random integer between MIN and MAX inclusive
+  float MIN MAX        a random float between MIN and MAX
+  bool                 true or false
+  choice A B ...       one of the given strings
+  name, firstName, lastName, email, word, words N, ip
+  now                  the current time in RFC 3339 format
+  unixMillis           the current time in milliseconds since the epoch
+  json V               V encoded as JSON
+
+For example:
+
+  kin generate -n my-stream --rate 100/s --keys 10 \
+    --template '{"order":"{{uuid}}","customer":"{{.Key}}","total":{{float 1 500}},"status":"{{choice "new" "paid"}}"}'
+
+With --verifiable, each record is {"run":...,"key":...,"n":...,"ts":...}, numbering each key's
+records from 0, and the run's ID is printed to stderr so that kin verify can check that they were
+all delivered in order. To keep them in order, a batch holds at most one record per key, so use
+more keys for higher rates:
+
+  kin generate -n my-stream --verifiable --count 10000 --keys 10
+  kin verify -n my-stream --from 10m --run <run ID>`,
+	Run: runGenerateCmd,
+}
+
+func runGenerateCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	templateText, _ := cmd.Flags().GetString("template")
+	templateFile, _ := cmd.Flags().GetString("template-file")
+	keys, _ := cmd.Flags().GetInt("keys")
+	count, _ := cmd.Flags().GetInt64("count")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	verifiable, _ := cmd.Flags().GetBool("verifiable")
+
+	if verifiable {
+		templateText = verifiableGenerateTemplate
+	}
+	if templateFile != "" {
+		contents, err := os.ReadFile(templateFile)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		templateText = strings.TrimRight(string(contents), "\n")
+	}
+
+	tmpl, err := template.New("record").Funcs(generateFuncs).Parse(templateText)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if keys < 1 {
+		cmd.PrintErrln("--keys must be at least 1")
+		os.Exit(1)
+	}
+
+	limiter, err := NewWriteLimiterFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var p *producer.Producer
+	finish := func() {}
+	if !dryRun {
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		var opts []producer.Option
+		if verifiable {
+			// kin verify reports records that arrive out of order, so a retried record mustn't be
+			// overtaken by the next one for its key
+			opts = append(opts, producer.WithOrderedKeys())
+		}
+		p = producer.New(client, streamName, opts...)
+
+		// Runs either when we're done or when interrupted, whichever comes first
+		finish = sync.OnceFunc(func() {
+			p.Flush(cmd.Context())
+			printGenerateSummary(p)
+		})
+		onShutdown(finish)
+	}
+
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+
+	runId := randomHex(4)
+	if verifiable {
+		cmd.PrintErrln("Run", runId)
+	}
+	keySeqs := make(map[string]int64, keys)
+
+	lastFlush := time.Now()
+	var buf bytes.Buffer
+	for seq := int64(0); count == 0 || seq < count; seq++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+
+		key := fmt.Sprintf("key-%d", mathrand.Intn(keys))
+		data := generateTemplateData{
+			Run:    runId,
+			Key:    key,
+			Seq:    seq,
+			KeySeq: keySeqs[key],
+			Time:   time.Now(),
+		}
+		keySeqs[key]++
+
+		buf.Reset()
+		if err := tmpl.Execute(&buf, data); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		// Pacing happens here rather than in the producer so that records are generated (and
+		// timestamped) at the requested rate, not in bursts
+		limiter.Wait(cmd.Context(), buf.Len()+len(data.Key))
+
+		if dryRun {
+			fmt.Println(buf.String())
+			continue
+		}
+
+		p.Add(cmd.Context(), producer.Record{PartitionKey: data.Key, Data: append([]byte(nil), buf.Bytes()...)})
+
+		// At low rates a batch could take a long time to fill, so send whatever we have regularly
+		if time.Since(lastFlush) > time.Second {
+			p.Flush(cmd.Context())
+			lastFlush = time.Now()
+		}
+	}
+
+	finish()
+	if p != nil && p.Summary().Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func printGenerateSummary(p *producer.Producer) {
+	jsonBytes, _ := json.Marshal(p.Summary())
+	fmt.Println(string(jsonBytes))
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/checkpoint"
+	"kin/pkg/sink"
+	"kin/pkg/tailer"
+	"log/slog"
+	"os"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// Kinesis can return no records even when there are some to read, so we follow the iterator a few
+// times before concluding the record isn't there
+const maxGetAttempts = 5
+
+func init() {
+	getCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	getCmd.Flags().StringP("shard", "s", "", "ID of the shard the record is in (required)")
+	getCmd.Flags().String("sequence-number", "", "Sequence number of the record (required)")
+	addRecordOutputFlags(getCmd.Flags())
+	getCmd.MarkFlagRequired("stream-name")
+	getCmd.MarkFlagRequired("shard")
+	getCmd.MarkFlagRequired("sequence-number")
+
+	rootCmd.AddCommand(getCmd)
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Fetch a single record by shard and sequence number",
+	Long: `Fetches exactly one record, identified by its shard ID and sequence number, and prints it in the
+same form as tail. Useful for looking up a record that a consumer has reported a problem with.
+
+Records can only be fetched until they pass the stream's retention period.`,
+	Run: runGetCmd,
+}
+
+func runGetCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	shardId, _ := cmd.Flags().GetString("shard")
+	sequenceNumber, _ := cmd.Flags().GetString("sequence-number")
+
+	if !checkpoint.IsSequenceNumber(sequenceNumber) {
+		cmd.PrintErrf("invalid --sequence-number %q: must be a decimal integer\n", sequenceNumber)
+		os.Exit(1)
+	}
+
+	tailOptions := &TailOptions{}
+	if err := parseRecordOutputOpts(cmd.Flags(), tailOptions); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	iteratorOutput, err := client.GetShardIterator(cmd.Context(), &kinesis.GetShardIteratorInput{
+		StreamName:             &streamName,
+		ShardId:                &shardId,
+		ShardIteratorType:      types.ShardIteratorTypeAtSequenceNumber,
+		StartingSequenceNumber: &sequenceNumber,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	record, err := getRecordAt(cmd, client, iteratorOutput.ShardIterator, sequenceNumber)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output := newRecordOutput(&shardId, *record, nil, tailOptions, slog.With("shard", shardId))
+	jsonBytes, _ := sink.MarshalRecord(&output, tailOptions.FieldCase)
+	fmt.Println(string(jsonBytes))
+}
+
+// getRecordAt reads from an AT_SEQUENCE_NUMBER iterator until it returns the record with the given
+// sequence number.
+func getRecordAt(cmd *cobra.Command, client aws.KinesisAPI, iterator *string, sequenceNumber string) (*types.Record, error) {
+	limiter := newGetRecordsLimiter()
+	for range maxGetAttempts {
+		if err := tailer.WaitGetRecords(cmd.Context(), limiter); err != nil {
+			return nil, err
+		}
+
+		output, err := client.GetRecords(cmd.Context(), &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         awssdk.Int32(1),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(output.Records) > 0 {
+			record := output.Records[0]
+			if *record.SequenceNumber != sequenceNumber {
+				// The requested record has passed the retention period, and we got the next one
+				return nil, fmt.Errorf("no record with sequence number %s; the earliest remaining is %s", sequenceNumber, *record.SequenceNumber)
+			}
+			return &record, nil
+		}
+
+		iterator = output.NextShardIterator
+		if iterator == nil {
+			break
+		}
+	}
+	return nil, errors.New("record not found")
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/sink"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	grepCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	grepCmd.Flags().StringP("pattern", "e", "", "Regular expression to search record payloads and partition keys for (required)")
+	grepCmd.Flags().BoolP("ignore-case", "i", false, "Match the pattern case-insensitively")
+	grepCmd.Flags().BoolP("fixed-strings", "F", false, "Treat the pattern as a literal string rather than a regular expression")
+	grepCmd.Flags().String("from", "1h", "Start of the time range to search, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	grepCmd.Flags().String("until", "", "End of the time range to search, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	grepCmd.Flags().IntP("max-count", "m", 0, "Stop after this many matches; 0 for no limit")
+	addRecordOutputFlags(grepCmd.Flags())
+	grepCmd.MarkFlagRequired("stream-name")
+	grepCmd.MarkFlagRequired("pattern")
+
+	rootCmd.AddCommand(grepCmd)
+}
+
+var grepCmd = &cobra.Command{
+	Use:   "grep",
+	Short: "Search a time range of a Kinesis Data Stream for matching records",
+	Long: `Reads every shard in parallel from --from until --until, printing each record whose payload or
+partition key matches --pattern, and exits once every shard has passed the end of the range.
+
+The pattern is matched against the raw payload, so for JSON records it sees the payload exactly as
+it was written.
+
+Example:
+  kin grep -n orders --from 2h --until 1h --pattern 'order-1234'`,
+	Run: runGrepCmd,
+}
+
+func runGrepCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	pattern, _ := cmd.Flags().GetString("pattern")
+	ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
+	fixedStrings, _ := cmd.Flags().GetBool("fixed-strings")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	maxCount, _ := cmd.Flags().GetInt("max-count")
+
+	if fixedStrings {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		cmd.PrintErrln("invalid --pattern:", err)
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	if err := parseRecordOutputOpts(cmd.Flags(), tailOptions); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var scanned, matched atomic.Int64
+	out := make(chan *RecordOutput)
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+		logger := slog.With("shard", shardId)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, millisBehindLatest *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+				if maxCount > 0 && matched.Load() >= int64(maxCount) {
+					return false
+				}
+				scanned.Add(1)
+
+				if !re.Match(record.Data) && !re.MatchString(*record.PartitionKey) {
+					return true
+				}
+				if maxCount > 0 && matched.Add(1) > int64(maxCount) {
+					return false
+				}
+
+				output := newRecordOutput(&shardId, record, millisBehindLatest, tailOptions, logger)
+				out <- &output
+				return true
+			})
+			if err != nil {
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+				failed.Store(true)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	printed := 0
+	for record := range out {
+		jsonBytes, _ := sink.MarshalRecord(record, tailOptions.FieldCase)
+		fmt.Println(string(jsonBytes))
+		printed++
+	}
+
+	slog.Info("search complete", "scanned", scanned.Load(), "matched", printed, "shards", len(shards))
+	if failed.Load() {
+		os.Exit(1)
+	}
+	if printed == 0 {
+		// Like grep, exit non-zero when nothing matched
+		os.Exit(1)
+	}
+}
+
+// parseTimeRange parses --from and --until, where an empty until means now.
+func parseTimeRange(fromS, untilS string) (time.Time, time.Time, error) {
+	now := time.Now()
+
+	from, err := ParseTimeOrAgo(fromS, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --from: %w", err)
+	}
+
+	until := now
+	if untilS != "" {
+		until, err = ParseTimeOrAgo(untilS, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+
+	if !from.Before(until) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from (%s) must be before --until (%s)", from.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+	return from, until, nil
+}
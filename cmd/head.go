@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/sink"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	headCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	headCmd.Flags().StringP("shard", "s", "", "Shard id; if not specified, every shard is read")
+	headCmd.Flags().IntP("count", "c", 10, "Number of records to read from each shard")
+	addRecordOutputFlags(headCmd.Flags())
+	headCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(headCmd)
+}
+
+var headCmd = &cobra.Command{
+	Use:   "head",
+	Short: "Print the oldest records in a Kinesis Data Stream",
+	Long: `Reads the first --count records of each shard, starting from its trim horizon, and exits. Shards
+are read in parallel, and their records printed one shard at a time.`,
+	Run: runHeadCmd,
+}
+
+func runHeadCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	shardId, _ := cmd.Flags().GetString("shard")
+	count, _ := cmd.Flags().GetInt("count")
+
+	if count < 1 {
+		cmd.PrintErrln("--count must be at least 1")
+		os.Exit(1)
+	}
+
+	tailOptions := &TailOptions{}
+	if err := parseRecordOutputOpts(cmd.Flags(), tailOptions); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shardIds := []string{shardId}
+	if shardId == "" {
+		shards, err := listShards(cmd.Context(), client, streamName)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		shardIds = nil
+		for _, shard := range shards {
+			shardIds = append(shardIds, *shard.ShardId)
+		}
+	}
+
+	results := make([][]RecordOutput, len(shardIds))
+	errs := make([]error, len(shardIds))
+	var wg sync.WaitGroup
+	for i, shardId := range shardIds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger := slog.With("shard", shardId)
+			errs[i] = scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, millisBehindLatest *int64) bool {
+				results[i] = append(results[i], newRecordOutput(&shardId, record, millisBehindLatest, tailOptions, logger))
+				return len(results[i]) < count
+			})
+		}()
+	}
+	wg.Wait()
+
+	failed := false
+	for i := range shardIds {
+		for _, record := range results[i] {
+			jsonBytes, _ := sink.MarshalRecord(&record, tailOptions.FieldCase)
+			fmt.Println(string(jsonBytes))
+		}
+		if errs[i] != nil {
+			cmd.PrintErrf("%s: %s\n", shardIds[i], errs[i])
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// A shard using this fraction of either per-shard write limit is reported as hot whatever its skew
+const hotShardLoad = 0.8
+
+type HotShard struct {
+	ShardId          string  `json:"shard_id"`
+	RecordsPerSecond float64 `json:"records_per_second"`
+	BytesPerSecond   float64 `json:"bytes_per_second"`
+
+	// Load is the fraction of the nearer per-shard write limit in use. From CloudWatch, it's
+	// taken from the busiest minute rather than the average.
+	Load float64 `json:"load"`
+
+	// Skew is how many times busier than the average shard this one is, by records or bytes,
+	// whichever is greater
+	Skew float64 `json:"skew"`
+
+	Hot     bool       `json:"hot"`
+	TopKeys []KeyCount `json:"top_keys,omitempty"`
+}
+
+func init() {
+	hotShardsCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	hotShardsCmd.Flags().Duration("duration", 30*time.Second, "How long to sample new records for")
+	hotShardsCmd.Flags().String("from", "", "Examine a past time range starting here instead of sampling new records, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	hotShardsCmd.Flags().String("until", "", "End of the past time range, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	hotShardsCmd.Flags().Bool("cloudwatch", false, "Use shard-level CloudWatch metrics instead of reading records; requires enhanced monitoring, and --from defaults to 1h")
+	hotShardsCmd.Flags().Float64("threshold", 2, "Report shards at least this many times busier than the average shard as hot")
+	hotShardsCmd.Flags().Int("top", 3, "Number of busiest partition keys to report per shard")
+	hotShardsCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	hotShardsCmd.MarkFlagRequired("stream-name")
+	hotShardsCmd.MarkFlagsMutuallyExclusive("cloudwatch", "duration")
+
+	rootCmd.AddCommand(hotShardsCmd)
+}
+
+var hotShardsCmd = &cobra.Command{
+	Use:   "hotshards",
+	Short: "Find shards taking more than their share of traffic",
+	Long: fmt.Sprintf(`Measures the traffic into every shard, scores each by how much busier it is than the average
+shard, and flags as hot any shard at least --threshold times busier, or using %.0f%% of either
+per-shard write limit (1,000 records or 1 MiB per second). Shards are listed busiest first, along
+with the partition keys driving their traffic.
+
+Traffic is measured by sampling new records for --duration, by reading a past time range with
+--from, or with --cloudwatch from the shard-level IncomingRecords and IncomingBytes metrics, which
+are only published for streams with enhanced monitoring enabled. CloudWatch can't break traffic
+down by partition key.`, 100*hotShardLoad),
+	Run: runHotShardsCmd,
+}
+
+func runHotShardsCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	useCloudWatch, _ := cmd.Flags().GetBool("cloudwatch")
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	top, _ := cmd.Flags().GetInt("top")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var hotShards []HotShard
+	if useCloudWatch {
+		if fromS == "" {
+			fromS = "1h"
+		}
+		hotShards, err = shardMetricsFromCloudWatch(cmd, streamName, shards, fromS, untilS)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	} else {
+		profiler, shardIds, window, err := profileShards(cmd, client, streamName, shards, duration, fromS, untilS)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		for _, profile := range profiler.Profiles(shardIds, window, top) {
+			hotShards = append(hotShards, HotShard{
+				ShardId:          profile.ShardId,
+				RecordsPerSecond: profile.RecordsPerSecond,
+				BytesPerSecond:   profile.BytesPerSecond,
+				Load:             shardLoad(profile.RecordsPerSecond, profile.BytesPerSecond),
+				TopKeys:          profile.TopKeys,
+			})
+		}
+	}
+
+	scoreHotShards(hotShards, threshold)
+
+	if output == "json" {
+		for _, shard := range hotShards {
+			printJSON(shard)
+		}
+		return
+	}
+
+	rows := [][]string{}
+	for _, shard := range hotShards {
+		status := "-"
+		if shard.Hot {
+			status = "HOT"
+		}
+
+		var keys []string
+		for _, key := range shard.TopKeys {
+			keys = append(keys, fmt.Sprintf("%s (%d)", key.PartitionKey, key.Records))
+		}
+		rows = append(rows, []string{
+			shard.ShardId,
+			status,
+			fmt.Sprintf("%.1fx", shard.Skew),
+			fmt.Sprintf("%.0f%%", 100*shard.Load),
+			fmt.Sprintf("%.1f", shard.RecordsPerSecond),
+			formatBytes(shard.BytesPerSecond) + "/s",
+			orDash(strings.Join(keys, ", ")),
+		})
+	}
+	printTable(os.Stdout, []string{"SHARD", "STATUS", "SKEW", "% OF LIMIT", "RECORDS/S", "BYTES/S", "TOP KEYS"}, rows)
+}
+
+// shardLoad returns the fraction of the nearer per-shard write limit a rate of traffic uses.
+func shardLoad(recordsPerSecond, bytesPerSecond float64) float64 {
+	return max(recordsPerSecond/shardRecordsPerSecondLimit, bytesPerSecond/shardBytesPerSecondLimit)
+}
+
+// scoreHotShards sets the skew of every shard against the average, marks hot shards and sorts the
+// shards busiest first.
+func scoreHotShards(shards []HotShard, threshold float64) {
+	var totalRecords, totalBytes float64
+	for _, shard := range shards {
+		totalRecords += shard.RecordsPerSecond
+		totalBytes += shard.BytesPerSecond
+	}
+
+	n := float64(len(shards))
+	for i := range shards {
+		shard := &shards[i]
+		if totalRecords > 0 {
+			shard.Skew = shard.RecordsPerSecond / (totalRecords / n)
+		}
+		if totalBytes > 0 {
+			shard.Skew = max(shard.Skew, shard.BytesPerSecond/(totalBytes/n))
+		}
+		shard.Hot = shard.Load >= hotShardLoad || (len(shards) > 1 && shard.Skew >= threshold)
+	}
+
+	sort.SliceStable(shards, func(i, j int) bool {
+		return shards[i].Skew > shards[j].Skew
+	})
+}
+
+// shardMetricsFromCloudWatch measures the traffic into each shard over a time range from its
+// shard-level CloudWatch metrics.
+func shardMetricsFromCloudWatch(cmd *cobra.Command, streamName string, shards []types.Shard, fromS, untilS string) ([]HotShard, error) {
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := aws.GetCloudWatchClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []aws.MetricQuery
+	for i, shard := range shards {
+		dimensions := map[string]string{"StreamName": streamName, "ShardId": *shard.ShardId}
+		queries = append(queries,
+			aws.MetricQuery{Id: fmt.Sprintf("records%d", i), Namespace: "AWS/Kinesis", MetricName: "IncomingRecords", Dimensions: dimensions, Stat: "Sum", Period: time.Minute},
+			aws.MetricQuery{Id: fmt.Sprintf("bytes%d", i), Namespace: "AWS/Kinesis", MetricName: "IncomingBytes", Dimensions: dimensions, Stat: "Sum", Period: time.Minute},
+		)
+	}
+
+	results, err := client.GetMetricData(cmd.Context(), queries, from.Truncate(time.Minute), until)
+	if err != nil {
+		return nil, err
+	}
+
+	window := until.Sub(from).Seconds()
+	hotShards := []HotShard{}
+	noData := true
+	for i, shard := range shards {
+		records, bytes := results[2*i].Values, results[2*i+1].Values
+		hotShard := HotShard{ShardId: *shard.ShardId}
+		if len(records) > 0 || len(bytes) > 0 {
+			noData = false
+			hotShard.RecordsPerSecond = sum(records) / window
+			hotShard.BytesPerSecond = sum(bytes) / window
+			hotShard.Load = shardLoad(maxOrZero(records)/60, maxOrZero(bytes)/60)
+		}
+		hotShards = append(hotShards, hotShard)
+	}
+
+	if noData {
+		cmd.PrintErrln("No shard-level metrics found; is enhanced monitoring enabled for IncomingRecords and IncomingBytes?")
+	}
+	return hotShards, nil
+}
+
+func maxOrZero(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return slices.Max(values)
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
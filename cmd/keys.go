@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type KeyReport struct {
+	Records      int `json:"records"`
+	Bytes        int `json:"bytes"`
+	DistinctKeys int `json:"distinct_keys"`
+
+	// Skew is the largest ratio, over the open shards, of a shard's share of records to its share
+	// of the key space; 1 means records are spread exactly in proportion to the key space
+	Skew float64 `json:"skew"`
+
+	TopKeys []KeyUsage      `json:"top_keys"`
+	Shards  []KeyShardShare `json:"shards"`
+}
+
+type KeyUsage struct {
+	PartitionKey string  `json:"partition_key"`
+	Records      int     `json:"records"`
+	Bytes        int     `json:"bytes"`
+	Percent      float64 `json:"percent"`
+}
+
+// KeyShardShare compares the share of the key space an open shard covers with the share of the
+// partition keys seen, and of their records, that hash into it.
+type KeyShardShare struct {
+	ShardId         string  `json:"shard_id"`
+	KeyspacePercent float64 `json:"keyspace_percent"`
+	KeysPercent     float64 `json:"keys_percent"`
+	RecordsPercent  float64 `json:"records_percent"`
+}
+
+func init() {
+	keysCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	keysCmd.Flags().String("from", "1h", "Start of the time range to analyse, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	keysCmd.Flags().String("until", "", "End of the time range to analyse, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	keysCmd.Flags().Int("top", 10, "Number of busiest partition keys to report")
+	keysCmd.Flags().String("sort", "records", "Rank the busiest keys by records or bytes")
+	keysCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	keysCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(keysCmd)
+}
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Analyse the partition keys written to a stream",
+	Long: `Reads every shard from --from until --until and reports how many distinct partition keys were
+written, the busiest keys by records or bytes, and how evenly the keys hash across the stream's
+open shards.
+
+For each open shard, the share of the key space it covers is compared with the share of distinct
+keys and of records whose keys hash into it. A shard with its fair share of keys but far more than
+its share of records has a few hot keys; one with more than its share of keys is covering too much
+of the key space for how the keys hash.
+
+Example:
+  kin keys -n orders --from 6h --top 20`,
+	Run: runKeysCmd,
+}
+
+func runKeysCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	top, _ := cmd.Flags().GetInt("top")
+	sortBy, _ := cmd.Flags().GetString("sort")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if sortBy != "records" && sortBy != "bytes" {
+		cmd.PrintErrf("unknown --sort %q: must be records or bytes\n", sortBy)
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var mu sync.Mutex
+	keys := map[string]*KeyUsage{}
+
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	var wg sync.WaitGroup
+	failed := false
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				usage, ok := keys[*record.PartitionKey]
+				if !ok {
+					usage = &KeyUsage{PartitionKey: *record.PartitionKey}
+					keys[*record.PartitionKey] = usage
+				}
+				usage.Records++
+				usage.Bytes += len(record.Data)
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := newKeyReport(keys, shards, top, sortBy)
+	if output == "json" {
+		printJSON(report)
+	} else {
+		fmt.Printf(
+			"%d records, %s, %d distinct partition keys; busiest shard has %.1fx its share of records\n\n",
+			report.Records, formatBytes(float64(report.Bytes)), report.DistinctKeys, report.Skew,
+		)
+
+		rows := [][]string{}
+		for _, key := range report.TopKeys {
+			rows = append(rows, []string{key.PartitionKey, fmt.Sprint(key.Records), formatBytes(float64(key.Bytes)), fmt.Sprintf("%.1f%%", key.Percent)})
+		}
+		printTable(os.Stdout, []string{"PARTITION KEY", "RECORDS", "BYTES", "% OF " + strings.ToUpper(sortBy)}, rows)
+		fmt.Println()
+
+		rows = [][]string{}
+		for _, shard := range report.Shards {
+			rows = append(rows, []string{
+				shard.ShardId,
+				fmt.Sprintf("%.1f%%", shard.KeyspacePercent),
+				fmt.Sprintf("%.1f%%", shard.KeysPercent),
+				fmt.Sprintf("%.1f%%", shard.RecordsPercent),
+			})
+		}
+		printTable(os.Stdout, []string{"SHARD", "KEYSPACE", "KEYS", "RECORDS"}, rows)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// newKeyReport summarises the usage of each partition key, hashing every key to the open shard
+// that would receive it now.
+func newKeyReport(keys map[string]*KeyUsage, shards []types.Shard, top int, sortBy string) KeyReport {
+	report := KeyReport{DistinctKeys: len(keys), TopKeys: []KeyUsage{}, Shards: []KeyShardShare{}}
+
+	shardKeys := map[string]int{}
+	shardRecords := map[string]int{}
+	usages := make([]KeyUsage, 0, len(keys))
+	for key, usage := range keys {
+		report.Records += usage.Records
+		report.Bytes += usage.Bytes
+		usages = append(usages, *usage)
+
+		if shard := shardForHashKey(shards, hashKeyForPartitionKey(key)); shard != nil {
+			shardKeys[*shard.ShardId]++
+			shardRecords[*shard.ShardId] += usage.Records
+		}
+	}
+
+	total := report.Records
+	if sortBy == "bytes" {
+		total = report.Bytes
+	}
+	for i := range usages {
+		value := usages[i].Records
+		if sortBy == "bytes" {
+			value = usages[i].Bytes
+		}
+		if total > 0 {
+			usages[i].Percent = 100 * float64(value) / float64(total)
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Percent != usages[j].Percent {
+			return usages[i].Percent > usages[j].Percent
+		}
+		return usages[i].PartitionKey < usages[j].PartitionKey
+	})
+	report.TopKeys = append(report.TopKeys, usages[:min(top, len(usages))]...)
+
+	for _, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+		share := KeyShardShare{
+			ShardId:         *shard.ShardId,
+			KeyspacePercent: NewShardListing(shard).KeyspacePercent,
+		}
+		if report.DistinctKeys > 0 {
+			share.KeysPercent = 100 * float64(shardKeys[share.ShardId]) / float64(report.DistinctKeys)
+			share.RecordsPercent = 100 * float64(shardRecords[share.ShardId]) / float64(report.Records)
+		}
+		report.Shards = append(report.Shards, share)
+		report.Skew = max(report.Skew, share.RecordsPercent/share.KeyspacePercent)
+	}
+
+	return report
+}
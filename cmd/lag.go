@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/checkpoint"
+	"kin/pkg/tailer"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// ShardLag describes how far a consumer's checkpoint on one shard is behind the tip of the shard.
+type ShardLag struct {
+	ShardId    string `json:"shard_id"`
+	Owner      string `json:"owner,omitempty"`
+	Checkpoint string `json:"checkpoint,omitempty"`
+	Status     string `json:"status"`
+
+	// Arrival time of the oldest record after the checkpoint, if there is one
+	OldestPending      *time.Time `json:"oldest_pending,omitempty"`
+	MillisBehindLatest *int64     `json:"millis_behind_latest,omitempty"`
+}
+
+// Statuses a shard's lag can be reported with
+const (
+	lagStatusCaughtUp     = "CAUGHT_UP"
+	lagStatusBehind       = "BEHIND"
+	lagStatusFinished     = "FINISHED"
+	lagStatusNoLease      = "NO_LEASE"
+	lagStatusNoCheckpoint = "NO_CHECKPOINT"
+	lagStatusError        = "ERROR"
+)
+
+// ConsumerLag is the stream-wide lag of an enhanced fan-out consumer, as reported to CloudWatch.
+type ConsumerLag struct {
+	ConsumerName       string     `json:"consumer_name"`
+	MillisBehindLatest *int64     `json:"millis_behind_latest"`
+	At                 *time.Time `json:"at,omitempty"`
+}
+
+func init() {
+	lagCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	lagCmd.Flags().String("lease-table", "", "DynamoDB lease table of a KCL application (or kin consumer group) to report per-shard lag for")
+	lagCmd.Flags().String("consumer", "", "Name of a registered enhanced fan-out consumer to report lag for")
+	lagCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	lagCmd.MarkFlagRequired("stream-name")
+	lagCmd.MarkFlagsOneRequired("lease-table", "consumer")
+	lagCmd.MarkFlagsMutuallyExclusive("lease-table", "consumer")
+
+	rootCmd.AddCommand(lagCmd)
+}
+
+var lagCmd = &cobra.Command{
+	Use:   "lag",
+	Short: "Report how far behind a consumer is",
+	Long: `Reports how far behind the tip of a stream a consumer is.
+
+With --lease-table, the checkpoint of every shard is read from a KCL lease table and compared to
+the stream: for each shard, the arrival time of the oldest record not yet checkpointed and how
+far that record is behind the latest one. Shards the application has finished reading are shown
+as FINISHED.
+
+With --consumer, the lag of an enhanced fan-out consumer is taken from its
+SubscribeToShardEvent.MillisBehindLatest CloudWatch metric over the last few minutes. Kinesis only
+publishes this per stream, so no per-shard breakdown is available; KCL applications using
+enhanced fan-out keep their checkpoints in a lease table, which --lease-table can report on.
+
+Example:
+  kin lag -n orders --lease-table order-processor`,
+	Run: runLagCmd,
+}
+
+func runLagCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	leaseTable, _ := cmd.Flags().GetString("lease-table")
+	consumerName, _ := cmd.Flags().GetString("consumer")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if consumerName != "" {
+		lag, err := consumerLag(cmd.Context(), streamName, consumerName)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if output == "json" {
+			printJSON(lag)
+			return
+		}
+		behind := "no data"
+		if lag.MillisBehindLatest != nil {
+			behind = formatMillis(float64(*lag.MillisBehindLatest), 0)
+		}
+		printTable(os.Stdout, []string{"CONSUMER", "BEHIND LATEST"}, [][]string{{lag.ConsumerName, behind}})
+		return
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	leases, err := scanLeaseTable(cmd.Context(), leaseTable, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	lags := make([]ShardLag, len(shards))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	for i, shard := range shards {
+		lag := &lags[i]
+		lag.ShardId = *shard.ShardId
+
+		lease, ok := leases[lag.ShardId]
+		if !ok {
+			lag.Status = lagStatusNoLease
+			continue
+		}
+		lag.Owner = stringAttr(lease, kclLeaseOwner)
+		lag.Checkpoint = stringAttr(lease, kclCheckpoint)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := measureShardLag(cmd.Context(), client, streamName, lag); err != nil {
+				lag.Status = lagStatusError
+				mu.Lock()
+				cmd.PrintErrf("%s: %s\n", lag.ShardId, err)
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if output == "json" {
+		for _, lag := range lags {
+			printJSON(lag)
+		}
+	} else {
+		rows := [][]string{}
+		for _, lag := range lags {
+			pending, behind := "-", "-"
+			if lag.OldestPending != nil {
+				pending = time.Since(*lag.OldestPending).Truncate(time.Second).String() + " ago"
+			}
+			if lag.MillisBehindLatest != nil {
+				behind = formatMillis(float64(*lag.MillisBehindLatest), 0)
+			}
+			rows = append(rows, []string{lag.ShardId, lag.Status, orDash(lag.Owner), orDash(lag.Checkpoint), pending, behind})
+		}
+		printTable(os.Stdout, []string{"SHARD", "STATUS", "OWNER", "CHECKPOINT", "OLDEST PENDING", "BEHIND LATEST"}, rows)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// scanLeaseTable returns the items of a KCL lease table by shard ID. Multi-stream KCL applications
+// prefix lease keys with the account, stream name and creation time; leases of other streams are
+// left out.
+func scanLeaseTable(ctx context.Context, table, streamName string) (map[string]map[string]dynamodbtypes.AttributeValue, error) {
+	client, err := aws.GetDynamoDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	leases := map[string]map[string]dynamodbtypes.AttributeValue{}
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName:      &table,
+		ConsistentRead: boolPtr(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Items {
+			key := stringAttr(item, kclLeaseKey)
+			if parts := strings.Split(key, ":"); len(parts) == 4 {
+				if parts[1] != streamName {
+					continue
+				}
+				key = parts[3]
+			}
+			leases[key] = item
+		}
+	}
+	return leases, nil
+}
+
+// measureShardLag reads the first record after a shard's checkpoint to find how far behind it is.
+func measureShardLag(ctx context.Context, client aws.KinesisAPI, streamName string, lag *ShardLag) error {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName: &streamName,
+		ShardId:    &lag.ShardId,
+	}
+	switch {
+	case lag.Checkpoint == kclShardEnd:
+		lag.Status = lagStatusFinished
+		return nil
+	case checkpoint.IsSequenceNumber(lag.Checkpoint):
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.StartingSequenceNumber = &lag.Checkpoint
+	case lag.Checkpoint == string(types.ShardIteratorTypeTrimHorizon):
+		input.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	default:
+		// LATEST, AT_TIMESTAMP or no checkpoint at all; there's no position to measure from
+		lag.Status = lagStatusNoCheckpoint
+		return nil
+	}
+
+	iteratorOutput, err := client.GetShardIterator(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	iterator := iteratorOutput.ShardIterator
+	limiter := newGetRecordsLimiter()
+	for range maxGetAttempts {
+		if err := tailer.WaitGetRecords(ctx, limiter); err != nil {
+			return err
+		}
+
+		output, err := client.GetRecords(ctx, &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         awssdk.Int32(1),
+		})
+		if err != nil {
+			return err
+		}
+
+		lag.MillisBehindLatest = output.MillisBehindLatest
+		if len(output.Records) > 0 {
+			lag.Status = lagStatusBehind
+			lag.OldestPending = output.Records[0].ApproximateArrivalTimestamp
+			return nil
+		}
+
+		iterator = output.NextShardIterator
+		if iterator == nil || awssdk.ToInt64(output.MillisBehindLatest) == 0 {
+			// Every record has been checkpointed
+			lag.Status = lagStatusCaughtUp
+			return nil
+		}
+	}
+	return errors.New("no records found after the checkpoint, but the shard isn't caught up; try again")
+}
+
+// consumerLag returns the most recent maximum MillisBehindLatest of an enhanced fan-out consumer.
+func consumerLag(ctx context.Context, streamName, consumerName string) (*ConsumerLag, error) {
+	client, err := aws.GetCloudWatchClient()
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now().Truncate(time.Minute)
+	results, err := client.GetMetricData(ctx, []aws.MetricQuery{{
+		Id:         "millis_behind_latest",
+		Namespace:  "AWS/Kinesis",
+		MetricName: "SubscribeToShardEvent.MillisBehindLatest",
+		Dimensions: map[string]string{"StreamName": streamName, "ConsumerName": consumerName},
+		Stat:       "Maximum",
+		Period:     time.Minute,
+	}}, end.Add(-10*time.Minute), end)
+	if err != nil {
+		return nil, fmt.Errorf("fetching metrics for consumer %s: %w", consumerName, err)
+	}
+
+	lag := &ConsumerLag{ConsumerName: consumerName}
+	if result := results[0]; len(result.Values) > 0 {
+		last := len(result.Values) - 1
+		lag.MillisBehindLatest = awssdk.Int64(int64(result.Values[last]))
+		lag.At = &result.Timestamps[last]
+	}
+	return lag, nil
+}
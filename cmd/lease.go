@@ -0,0 +1,476 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LeaseCoordinator splits the shards of a stream between every kin process in a consumer group,
+// using a KCL-style lease table in DynamoDB. Each worker periodically renews the leases it holds
+// by incrementing their lease counter; a lease whose counter hasn't moved within LeaseDuration is
+// considered expired and may be taken by another worker. Workers holding fewer than their fair
+// share of leases take expired leases first and otherwise steal one lease at a time from the most
+// loaded worker, so the group rebalances as instances join or leave.
+type LeaseCoordinator struct {
+	dynamo     *dynamodb.Client
+	kinesis    aws.KinesisAPI
+	table      string
+	streamName string
+	workerId   string
+
+	LeaseDuration time.Duration
+
+	// onAcquire is called in its own goroutine whenever a lease is acquired, and should process
+	// the shard until ctx is cancelled (the lease was lost) or the shard ends (returns nil).
+	onAcquire func(ctx context.Context, shardId string) error
+
+	mu       sync.Mutex
+	held     map[string]*heldLease
+	observed map[string]*observedLease
+}
+
+type heldLease struct {
+	counter int64
+	cancel  context.CancelFunc
+}
+
+type observedLease struct {
+	owner      string
+	counter    int64
+	checkpoint string
+
+	// When we last saw the lease counter change; used to detect expired leases without relying
+	// on clocks being in sync between workers
+	changedAt time.Time
+}
+
+func NewLeaseCoordinator(
+	kinesisClient aws.KinesisAPI,
+	table, streamName, workerId string,
+	onAcquire func(ctx context.Context, shardId string) error,
+) (*LeaseCoordinator, error) {
+	dynamo, err := aws.GetDynamoDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaseCoordinator{
+		dynamo:        dynamo,
+		kinesis:       kinesisClient,
+		table:         table,
+		streamName:    streamName,
+		workerId:      workerId,
+		LeaseDuration: 30 * time.Second,
+		onAcquire:     onAcquire,
+		held:          map[string]*heldLease{},
+		observed:      map[string]*observedLease{},
+	}, nil
+}
+
+// NewWorkerId returns an identifier for this process that is unique within a consumer group.
+func NewWorkerId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "kin"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Run creates the lease table if necessary, then renews and rebalances leases until ctx is
+// cancelled.
+func (c *LeaseCoordinator) Run(ctx context.Context) error {
+	if err := c.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(c.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		c.renewLeases(ctx)
+
+		if err := c.rebalance(ctx); err != nil {
+			slog.Warn("failed to rebalance leases", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ReleaseAll stops processing and gives up every lease held by this worker so that other workers
+// can pick them up immediately instead of waiting for them to expire.
+func (c *LeaseCoordinator) ReleaseAll() {
+	c.mu.Lock()
+	held := c.held
+	c.held = map[string]*heldLease{}
+	c.mu.Unlock()
+
+	for shardId, lease := range held {
+		lease.cancel()
+
+		_, err := c.dynamo.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+			TableName:                 &c.table,
+			Key:                       leaseKey(shardId),
+			UpdateExpression:          stringPtr("REMOVE #owner"),
+			ConditionExpression:       stringPtr("#owner = :owner"),
+			ExpressionAttributeNames:  map[string]string{"#owner": kclLeaseOwner},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":owner": stringValue(c.workerId)},
+		})
+		if err != nil {
+			slog.Warn("failed to release lease", "shard", shardId, "error", err)
+		}
+	}
+}
+
+func (c *LeaseCoordinator) ensureTable(ctx context.Context) error {
+	_, err := c.dynamo.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &c.table})
+	if err == nil {
+		return nil
+	}
+
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+
+	slog.Info("creating lease table", "table", c.table)
+	_, err = c.dynamo.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   &c.table,
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: stringPtr(kclLeaseKey), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: stringPtr(kclLeaseKey), KeyType: types.KeyTypeHash},
+		},
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return err
+	}
+
+	// Another worker may have raced us to create it; either way, wait until it's usable
+	return dynamodb.NewTableExistsWaiter(c.dynamo).Wait(
+		ctx,
+		&dynamodb.DescribeTableInput{TableName: &c.table},
+		2*time.Minute,
+	)
+}
+
+func (c *LeaseCoordinator) renewLeases(ctx context.Context) {
+	c.mu.Lock()
+	held := make(map[string]*heldLease, len(c.held))
+	for shardId, lease := range c.held {
+		held[shardId] = lease
+	}
+	c.mu.Unlock()
+
+	for shardId, lease := range held {
+		_, err := c.dynamo.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           &c.table,
+			Key:                 leaseKey(shardId),
+			UpdateExpression:    stringPtr("SET #counter = :next"),
+			ConditionExpression: stringPtr("#owner = :owner AND #counter = :counter"),
+			ExpressionAttributeNames: map[string]string{
+				"#owner":   kclLeaseOwner,
+				"#counter": kclLeaseCounter,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":owner":   stringValue(c.workerId),
+				":counter": numberValue(lease.counter),
+				":next":    numberValue(lease.counter + 1),
+			},
+		})
+
+		var lost *types.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &lost):
+			slog.Info("lost lease", "shard", shardId)
+			c.drop(shardId)
+
+		case err != nil:
+			// Transient failures are retried on the next renewal; if they persist, other workers
+			// will see the lease expire and take it
+			slog.Warn("failed to renew lease", "shard", shardId, "error", err)
+
+		default:
+			c.mu.Lock()
+			lease.counter++
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *LeaseCoordinator) rebalance(ctx context.Context) error {
+	if err := c.createMissingLeases(ctx); err != nil {
+		return err
+	}
+
+	if err := c.scanLeases(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	available := []string{}
+	leasesByOwner := map[string][]string{c.workerId: nil}
+	total := 0
+	for shardId, lease := range c.observed {
+		if lease.checkpoint == kclShardEnd {
+			continue
+		}
+		total++
+
+		if _, ok := c.held[shardId]; ok {
+			leasesByOwner[c.workerId] = append(leasesByOwner[c.workerId], shardId)
+			continue
+		}
+
+		if lease.owner == "" || now.Sub(lease.changedAt) > c.LeaseDuration {
+			available = append(available, shardId)
+			continue
+		}
+
+		leasesByOwner[lease.owner] = append(leasesByOwner[lease.owner], shardId)
+	}
+	c.mu.Unlock()
+
+	target := (total + len(leasesByOwner) - 1) / len(leasesByOwner)
+	needed := target - len(leasesByOwner[c.workerId])
+	if needed <= 0 {
+		return nil
+	}
+
+	for _, shardId := range available {
+		if needed == 0 {
+			return nil
+		}
+		if c.take(ctx, shardId) {
+			needed--
+		}
+	}
+
+	// Nothing left unowned, so steal a single lease from the most loaded worker if it has more than
+	// its share. Stealing one at a time keeps the group from thrashing while it converges.
+	victim := ""
+	for owner, shardIds := range leasesByOwner {
+		if owner != c.workerId && len(shardIds) > target &&
+			(victim == "" || len(shardIds) > len(leasesByOwner[victim])) {
+			victim = owner
+		}
+	}
+	if victim != "" {
+		c.take(ctx, leasesByOwner[victim][0])
+	}
+
+	return nil
+}
+
+// createMissingLeases adds an unowned lease for every shard that doesn't have one yet, which picks
+// up new shards after resharding.
+func (c *LeaseCoordinator) createMissingLeases(ctx context.Context) error {
+	shardIds, err := getShardIds(c.kinesis, &c.streamName)
+	if err != nil {
+		return err
+	}
+
+	for _, shardId := range shardIds {
+		c.mu.Lock()
+		_, known := c.observed[*shardId]
+		c.mu.Unlock()
+		if known {
+			continue
+		}
+
+		_, err := c.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: &c.table,
+			Item: map[string]types.AttributeValue{
+				kclLeaseKey:                     stringValue(*shardId),
+				kclLeaseCounter:                 numberValue(0),
+				kclOwnerSwitchesSinceCheckpoint: numberValue(0),
+			},
+			ConditionExpression:      stringPtr("attribute_not_exists(#key)"),
+			ExpressionAttributeNames: map[string]string{"#key": kclLeaseKey},
+		})
+		var exists *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &exists) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *LeaseCoordinator) scanLeases(ctx context.Context) error {
+	paginator := dynamodb.NewScanPaginator(c.dynamo, &dynamodb.ScanInput{
+		TableName:      &c.table,
+		ConsistentRead: boolPtr(true),
+	})
+
+	now := time.Now()
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		for _, item := range page.Items {
+			shardId := stringAttr(item, kclLeaseKey)
+			owner := stringAttr(item, kclLeaseOwner)
+			counter := numberAttr(item, kclLeaseCounter)
+
+			lease, ok := c.observed[shardId]
+			if !ok || lease.owner != owner || lease.counter != counter {
+				lease = &observedLease{changedAt: now}
+				c.observed[shardId] = lease
+			}
+			lease.owner = owner
+			lease.counter = counter
+			lease.checkpoint = stringAttr(item, kclCheckpoint)
+		}
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+// take attempts to acquire a lease, conditional on nobody else having touched it since we last
+// observed it. On success the shard starts being processed.
+func (c *LeaseCoordinator) take(ctx context.Context, shardId string) bool {
+	c.mu.Lock()
+	observed := *c.observed[shardId]
+	c.mu.Unlock()
+
+	_, err := c.dynamo.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &c.table,
+		Key:       leaseKey(shardId),
+		UpdateExpression: stringPtr(
+			"SET #owner = :owner, #counter = :next ADD #ownerSwitches :one",
+		),
+		ConditionExpression: stringPtr("#counter = :counter"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner":         kclLeaseOwner,
+			"#counter":       kclLeaseCounter,
+			"#ownerSwitches": kclOwnerSwitchesSinceCheckpoint,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner":   stringValue(c.workerId),
+			":counter": numberValue(observed.counter),
+			":next":    numberValue(observed.counter + 1),
+			":one":     numberValue(1),
+		},
+	})
+	if err != nil {
+		var lost *types.ConditionalCheckFailedException
+		if !errors.As(err, &lost) {
+			slog.Warn("failed to take lease", "shard", shardId, "error", err)
+		}
+		return false
+	}
+
+	slog.Info("acquired lease", "shard", shardId, "previousOwner", observed.owner)
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.held[shardId] = &heldLease{counter: observed.counter + 1, cancel: cancel}
+	c.mu.Unlock()
+
+	go func() {
+		err := c.onAcquire(leaseCtx, shardId)
+		if leaseCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Give up the lease so that another worker (or this one, later) can retry the shard
+			slog.Error("failed processing shard; releasing lease", "shard", shardId, "error", err)
+		}
+		c.release(shardId)
+	}()
+
+	return true
+}
+
+// release gives up a single lease held by this worker.
+func (c *LeaseCoordinator) release(shardId string) {
+	c.drop(shardId)
+
+	_, err := c.dynamo.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 &c.table,
+		Key:                       leaseKey(shardId),
+		UpdateExpression:          stringPtr("REMOVE #owner"),
+		ConditionExpression:       stringPtr("#owner = :owner"),
+		ExpressionAttributeNames:  map[string]string{"#owner": kclLeaseOwner},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":owner": stringValue(c.workerId)},
+	})
+	if err != nil {
+		slog.Warn("failed to release lease", "shard", shardId, "error", err)
+	}
+}
+
+// drop stops processing a shard without touching the lease table.
+func (c *LeaseCoordinator) drop(shardId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lease, ok := c.held[shardId]; ok {
+		lease.cancel()
+		delete(c.held, shardId)
+	}
+}
+
+func leaseKey(shardId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{kclLeaseKey: stringValue(shardId)}
+}
+
+func stringValue(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+func numberValue(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func numberAttr(item map[string]types.AttributeValue, name string) int64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
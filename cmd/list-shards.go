@@ -1,18 +1,63 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"kin/pkg/aws"
+	"math/big"
 	"os"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 	"github.com/spf13/cobra"
 )
 
+// The hash key space runs from 0 to 2^128 - 1
+var hashKeySpace = new(big.Int).Lsh(big.NewInt(1), 128)
+
+type ShardListing struct {
+	ShardId                string  `json:"shard_id"`
+	Open                   bool    `json:"open"`
+	ParentShardId          string  `json:"parent_shard_id,omitempty"`
+	AdjacentParentShardId  string  `json:"adjacent_parent_shard_id,omitempty"`
+	StartingHashKey        string  `json:"starting_hash_key"`
+	EndingHashKey          string  `json:"ending_hash_key"`
+	KeyspacePercent        float64 `json:"keyspace_percent"`
+	StartingSequenceNumber string  `json:"starting_sequence_number"`
+	EndingSequenceNumber   string  `json:"ending_sequence_number,omitempty"`
+}
+
+func NewShardListing(shard types.Shard) ShardListing {
+	start, end := shardHashRange(shard)
+	width := new(big.Int).Sub(end, start)
+	width.Add(width, big.NewInt(1))
+	percent, _ := new(big.Rat).SetFrac(width.Mul(width, big.NewInt(100)), hashKeySpace).Float64()
+
+	return ShardListing{
+		ShardId:                *shard.ShardId,
+		Open:                   isOpenShard(shard),
+		ParentShardId:          awssdk.ToString(shard.ParentShardId),
+		AdjacentParentShardId:  awssdk.ToString(shard.AdjacentParentShardId),
+		StartingHashKey:        *shard.HashKeyRange.StartingHashKey,
+		EndingHashKey:          *shard.HashKeyRange.EndingHashKey,
+		KeyspacePercent:        percent,
+		StartingSequenceNumber: awssdk.ToString(shard.SequenceNumberRange.StartingSequenceNumber),
+		EndingSequenceNumber:   awssdk.ToString(shard.SequenceNumberRange.EndingSequenceNumber),
+	}
+}
+
+func (s ShardListing) Status() string {
+	if s.Open {
+		return "OPEN"
+	}
+	return "CLOSED"
+}
+
 func init() {
 	listShardsCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	listShardsCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	listShardsCmd.Flags().Bool("tree", false, "Show shards as a tree of splits and merges")
+	listShardsCmd.Flags().Bool("open", false, "Only list open shards")
 	listShardsCmd.MarkFlagRequired("stream-name")
 
 	rootCmd.AddCommand(listShardsCmd)
@@ -22,9 +67,24 @@ var listShardsCmd = &cobra.Command{
 	Use:     "list-shards",
 	Aliases: []string{"lss"},
 	Short:   "List shards",
+	Long: `Lists every shard in a stream with its hash key range, the share of the key space that covers,
+its sequence number range, and whether it is open or closed.
+
+With --tree, shards are shown nested beneath the shard they were split from, so the lineage of a
+resharded stream can be followed. A shard created by merging two others is shown beneath its
+parent, and notes the adjacent parent it was merged with. Shards whose parents have passed the
+retention period are shown at the top level.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
 		streamName, _ := cmd.Flags().GetString("stream-name")
+		output, _ := cmd.Flags().GetString("output")
+		tree, _ := cmd.Flags().GetBool("tree")
+		openOnly, _ := cmd.Flags().GetBool("open")
+
+		if err := validateOutput(output, "table", "json"); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
 
 		client, err := aws.GetKinesisClient()
 		if err != nil {
@@ -32,17 +92,95 @@ var listShardsCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		output, err := client.ListShards(context.TODO(), &kinesis.ListShardsInput{
-			StreamName: &streamName,
-		})
+		shards, err := listShards(cmd.Context(), client, streamName)
 		if err != nil {
 			cmd.PrintErrln(err)
 			os.Exit(1)
 		}
 
-		for _, shard := range output.Shards {
-			jsonBytes, _ := json.Marshal(shard)
-			fmt.Println(string(jsonBytes))
+		listings := []ShardListing{}
+		for _, shard := range shards {
+			listing := NewShardListing(shard)
+			if openOnly && !listing.Open {
+				continue
+			}
+			listings = append(listings, listing)
+		}
+
+		switch {
+		case tree:
+			printShardTree(listings)
+
+		case output == "json":
+			for _, listing := range listings {
+				printJSON(listing)
+			}
+
+		default:
+			rows := [][]string{}
+			for _, s := range listings {
+				rows = append(rows, []string{
+					s.ShardId,
+					s.Status(),
+					orDash(s.ParentShardId),
+					orDash(s.AdjacentParentShardId),
+					s.StartingHashKey,
+					s.EndingHashKey,
+					fmt.Sprintf("%.2f%%", s.KeyspacePercent),
+					s.StartingSequenceNumber,
+					orDash(s.EndingSequenceNumber),
+				})
+			}
+			printTable(os.Stdout, []string{
+				"SHARD", "STATUS", "PARENT", "ADJACENT PARENT", "START HASH", "END HASH", "KEYSPACE",
+				"START SEQUENCE", "END SEQUENCE",
+			}, rows)
 		}
 	},
 }
+
+// printShardTree prints each shard beneath its parent.
+func printShardTree(listings []ShardListing) {
+	present := map[string]bool{}
+	children := map[string][]ShardListing{}
+	var roots []ShardListing
+	for _, s := range listings {
+		present[s.ShardId] = true
+	}
+	for _, s := range listings {
+		if s.ParentShardId != "" && present[s.ParentShardId] {
+			children[s.ParentShardId] = append(children[s.ParentShardId], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	var printShard func(s ShardListing, prefix, branch, indent string)
+	printShard = func(s ShardListing, prefix, branch, indent string) {
+		line := fmt.Sprintf("%s%s%s [%s] %.2f%% of keyspace", prefix, branch, s.ShardId, s.Status(), s.KeyspacePercent)
+		if s.AdjacentParentShardId != "" {
+			line += fmt.Sprintf(" (merged with %s)", s.AdjacentParentShardId)
+		}
+		fmt.Println(line)
+
+		kids := children[s.ShardId]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				printShard(child, prefix+indent, "└── ", "    ")
+			} else {
+				printShard(child, prefix+indent, "├── ", "│   ")
+			}
+		}
+	}
+
+	for _, root := range roots {
+		printShard(root, "", "", "")
+	}
+}
+
+func orDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
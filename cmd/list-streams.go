@@ -5,12 +5,33 @@ import (
 	"fmt"
 	"kin/pkg/aws"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/spf13/cobra"
 )
 
+// DescribeStreamSummary is limited to 20 calls per second per account, so only a few are made at
+// once
+const describeConcurrency = 4
+
+type StreamListing struct {
+	StreamName           string `json:"stream_name"`
+	StreamARN            string `json:"stream_arn"`
+	Status               string `json:"status"`
+	Mode                 string `json:"mode"`
+	OpenShardCount       *int32 `json:"open_shard_count,omitempty"`
+	RetentionPeriodHours *int32 `json:"retention_period_hours,omitempty"`
+}
+
 func init() {
+	listStreamsCmd.Flags().String("prefix", "", "Only list streams whose names start with this prefix")
+	listStreamsCmd.Flags().String("match", "", "Only list streams whose names match this regular expression")
+	listStreamsCmd.Flags().StringP("output", "o", "table", "Output format: table, json, or name")
+
 	rootCmd.AddCommand(listStreamsCmd)
 }
 
@@ -18,22 +39,148 @@ var listStreamsCmd = &cobra.Command{
 	Use:     "list-streams",
 	Aliases: []string{"ls"},
 	Short:   "List Kinesis streams",
+	Long: `Lists every stream in the account and region, with its status, capacity mode, open shard count
+and retention period.
+
+Open shard count and retention require a DescribeStreamSummary call per stream, which can be slow in
+accounts with many streams; use --output name to list only names, or filter with --prefix or
+--match first.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		match, _ := cmd.Flags().GetString("match")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := validateOutput(output, "table", "json", "name"); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		var pattern *regexp.Regexp
+		if match != "" {
+			var err error
+			pattern, err = regexp.Compile(match)
+			if err != nil {
+				cmd.PrintErrln("invalid --match:", err)
+				os.Exit(1)
+			}
+		}
+
 		client, err := aws.GetKinesisClient()
 		if err != nil {
-			cmd.Println(err)
+			cmd.PrintErrln(err)
 			os.Exit(1)
 		}
 
-		output, err := client.ListStreams(context.TODO(), &kinesis.ListStreamsInput{})
+		streams, err := listStreams(cmd.Context(), client, prefix, pattern)
 		if err != nil {
-			cmd.Println(err)
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if output == "name" {
+			for _, stream := range streams {
+				fmt.Println(stream.StreamName)
+			}
+			return
+		}
+
+		if err := describeStreamListings(cmd.Context(), client, streams); err != nil {
+			cmd.PrintErrln(err)
 			os.Exit(1)
 		}
 
-		for _, name := range output.StreamNames {
-			fmt.Println(name)
+		if output == "json" {
+			for _, stream := range streams {
+				printJSON(stream)
+			}
+			return
 		}
+
+		rows := [][]string{}
+		for _, stream := range streams {
+			rows = append(rows, []string{
+				stream.StreamName,
+				stream.Status,
+				stream.Mode,
+				formatInt32(stream.OpenShardCount),
+				formatInt32(stream.RetentionPeriodHours),
+			})
+		}
+		printTable(os.Stdout, []string{"NAME", "STATUS", "MODE", "OPEN SHARDS", "RETENTION HOURS"}, rows)
 	},
 }
+
+// listStreams returns every stream whose name has the given prefix and, if pattern is set,
+// matches it.
+func listStreams(ctx context.Context, client aws.KinesisAPI, prefix string, pattern *regexp.Regexp) ([]*StreamListing, error) {
+	streams := []*StreamListing{}
+	paginator := kinesis.NewListStreamsPaginator(client, &kinesis.ListStreamsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range page.StreamSummaries {
+			name := *summary.StreamName
+			if !strings.HasPrefix(name, prefix) || (pattern != nil && !pattern.MatchString(name)) {
+				continue
+			}
+
+			stream := &StreamListing{
+				StreamName: name,
+				StreamARN:  awssdk.ToString(summary.StreamARN),
+				Status:     string(summary.StreamStatus),
+			}
+			if summary.StreamModeDetails != nil {
+				stream.Mode = string(summary.StreamModeDetails.StreamMode)
+			}
+			streams = append(streams, stream)
+		}
+	}
+	return streams, nil
+}
+
+// describeStreamListings fills in the details of each stream that ListStreams doesn't return.
+func describeStreamListings(ctx context.Context, client aws.KinesisAPI, streams []*StreamListing) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, describeConcurrency)
+
+	for _, stream := range streams {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			output, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+				StreamName: &stream.StreamName,
+			})
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("describing %s: %w", stream.StreamName, err)
+				}
+				mu.Unlock()
+				return
+			}
+
+			summary := output.StreamDescriptionSummary
+			stream.OpenShardCount = summary.OpenShardCount
+			stream.RetentionPeriodHours = summary.RetentionPeriodHours
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func formatInt32(v *int32) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/docker"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// localContainerName is the name of the emulator's container, so that there's only ever one
+const localContainerName = "kin-local"
+
+type localEmulator struct {
+	image string
+	// port is the emulator's plain HTTP port in the container
+	port string
+	env  []string
+}
+
+var localEmulators = map[string]localEmulator{
+	"kinesis-mock": {image: "ghcr.io/etspaceman/kinesis-mock:0.4.9", port: "4568"},
+	"localstack":   {image: "localstack/localstack:4.0", port: "4566", env: []string{"SERVICES=kinesis"}},
+}
+
+func init() {
+	localUpCmd.Flags().String("emulator", "kinesis-mock", "Emulator to run: kinesis-mock or localstack")
+	localUpCmd.Flags().String("image", "", "Image to run instead of the emulator's default")
+	localUpCmd.Flags().Int("port", 0, "Port to publish the emulator on (default the emulator's own port)")
+	localUpCmd.Flags().StringArray("stream", nil, "Stream to create as name or name:shards; may be repeated")
+	localUpCmd.Flags().Duration("timeout", 2*time.Minute, "How long to wait for the emulator to become ready")
+
+	localCmd.AddCommand(localUpCmd)
+	localCmd.AddCommand(localDownCmd)
+	localCmd.AddCommand(localStatusCmd)
+	rootCmd.AddCommand(localCmd)
+}
+
+var localCmd = &cobra.Command{
+	Use:   "local",
+	Short: "Run a local Kinesis emulator for development",
+	Long: `Manages a kinesis-mock or LocalStack container through the Docker daemon (at DOCKER_HOST, or
+the local socket).
+
+While the emulator is up, kin commands send their Kinesis calls to it instead of AWS, with dummy
+credentials, until it's taken down with kin local down, and warn that they're doing so. Commands
+given --profile, --role-arn, --endpoint-url or a --region other than the emulator's use AWS as
+usual, as do calls to other services, such as DynamoDB checkpoints. If the emulator can't be
+reached, Kinesis commands fail rather than falling back to AWS, until it's started again with kin
+local up or forgotten with kin local down; kin local status forgets it if its container is gone.`,
+}
+
+var localUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Start the emulator and create test streams",
+	Long: `Pulls and starts the emulator if it isn't already running, waits until it responds, and creates
+any streams given with --stream that don't exist yet. Running it again with more streams just
+creates those. Streams are created in --region, us-east-1 by default, which subsequent commands
+use too.
+
+Example:
+  kin local up --stream orders:4 --stream payments`,
+	Run: runLocalUpCmd,
+}
+
+var localDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Stop and remove the emulator",
+	Long: `Removes the emulator's container, along with every stream in it, and points kin commands back
+at AWS.`,
+	Run: runLocalDownCmd,
+}
+
+var localStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the emulator is running",
+	Run:   runLocalStatusCmd,
+}
+
+func runLocalUpCmd(cmd *cobra.Command, args []string) {
+	emulatorName, _ := cmd.Flags().GetString("emulator")
+	image, _ := cmd.Flags().GetString("image")
+	port, _ := cmd.Flags().GetInt("port")
+	streamSpecs, _ := cmd.Flags().GetStringArray("stream")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	emulator, ok := localEmulators[emulatorName]
+	if !ok {
+		cmd.PrintErrf("unknown --emulator %q; must be kinesis-mock or localstack\n", emulatorName)
+		os.Exit(1)
+	}
+	if image != "" {
+		emulator.image = image
+	}
+	// The emulator's streams are kept in a region, like real ones
+	region := aws.Region()
+	if region == "" {
+		region = "us-east-1"
+	}
+	hostPort := emulator.port
+	if port != 0 {
+		hostPort = strconv.Itoa(port)
+	}
+
+	streams, err := parseLocalStreams(streamSpecs)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	ctx := cmd.Context()
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := dockerClient.Ping(ctx); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	container, err := dockerClient.InspectContainer(ctx, localContainerName)
+	if err != nil && !errors.Is(err, docker.ErrNotFound) {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if container != nil && !container.Running {
+		// A stopped emulator has lost its streams anyway, so it's simplest to start afresh
+		if err := dockerClient.RemoveContainer(ctx, container.Id); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		container = nil
+	}
+
+	if container == nil {
+		container, err = startLocalEmulator(ctx, cmd, dockerClient, emulatorName, emulator, hostPort)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	} else {
+		emulatorName = container.Labels["kin.emulator"]
+		cmd.PrintErrf("Emulator already running in %s\n", localContainerName)
+	}
+
+	endpoint := &aws.LocalEndpoint{
+		ContainerId: container.Id,
+		Emulator:    emulatorName,
+		URL:         localEmulatorURL(container),
+		Region:      region,
+	}
+	// Streams live in a region even in an emulator, so keep to the one they were created in
+	// unless told otherwise
+	existing, _ := aws.LoadLocalEndpoint()
+	if existing != nil && existing.ContainerId == container.Id && aws.Region() == "" {
+		endpoint.Region = existing.Region
+	}
+	if err := aws.SaveLocalEndpoint(endpoint); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetLocalKinesisClient(endpoint)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := waitForLocalEmulator(ctx, client, timeout); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	for _, stream := range streams {
+		_, err := client.CreateStream(ctx, &kinesis.CreateStreamInput{
+			StreamName: &stream.name,
+			ShardCount: &stream.shards,
+		})
+		var inUse *types.ResourceInUseException
+		if errors.As(err, &inUse) {
+			continue
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		if err := waitForStreamActive(ctx, client, stream.name, nil); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Created stream %s with %d shards\n", stream.name, stream.shards)
+	}
+
+	fmt.Printf("%s is running at %s; kin commands will use it until kin local down\n", endpoint.Emulator, endpoint.URL)
+}
+
+func runLocalDownCmd(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	err = dockerClient.RemoveContainer(ctx, localContainerName)
+	notRunning := errors.Is(err, docker.ErrNotFound)
+	if err != nil && !notRunning {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := aws.RemoveLocalEndpoint(); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if notRunning {
+		cmd.PrintErrln("Emulator wasn't running")
+		return
+	}
+	cmd.PrintErrln("Removed the emulator; kin commands will use AWS again")
+}
+
+func runLocalStatusCmd(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	endpoint, err := aws.LoadLocalEndpoint()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	container, err := dockerClient.InspectContainer(ctx, localContainerName)
+	if errors.Is(err, docker.ErrNotFound) {
+		if endpoint != nil {
+			if err := aws.RemoveLocalEndpoint(); err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+			fmt.Println("The emulator's container is gone, so kin commands use AWS again")
+			return
+		}
+		fmt.Println("Emulator isn't running; kin commands use AWS")
+		return
+	}
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	rows := [][]string{
+		{"Emulator", orDash(container.Labels["kin.emulator"])},
+		{"Image", container.Image},
+		{"Container", fmt.Sprintf("%s (%s)", localContainerName, container.Status)},
+		{"Endpoint", localEmulatorURL(container)},
+	}
+	if endpoint != nil {
+		rows = append(rows, []string{"Region", endpoint.Region})
+	}
+
+	var streamNames []string
+	if container.Running && endpoint != nil {
+		client, err := aws.GetLocalKinesisClient(endpoint)
+		if err == nil {
+			var output *kinesis.ListStreamsOutput
+			output, err = client.ListStreams(ctx, &kinesis.ListStreamsInput{})
+			if err == nil {
+				streamNames = output.StreamNames
+			}
+		}
+		if err != nil {
+			cmd.PrintErrln("Warning: couldn't list streams:", err)
+		}
+	}
+	rows = append(rows, []string{"Streams", orDash(strings.Join(streamNames, ", "))})
+	printTable(os.Stdout, []string{"FIELD", "VALUE"}, rows)
+
+	if endpoint == nil {
+		fmt.Println()
+		fmt.Println("kin commands aren't using the emulator; run kin local up to use it")
+	}
+}
+
+// startLocalEmulator pulls the emulator's image if needed, then creates and starts its container.
+func startLocalEmulator(
+	ctx context.Context,
+	cmd *cobra.Command,
+	client *docker.Client,
+	name string,
+	emulator localEmulator,
+	hostPort string,
+) (*docker.Container, error) {
+	present, err := client.HasImage(ctx, emulator.image)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		cmd.PrintErrf("Pulling %s\n", emulator.image)
+		if err := client.PullImage(ctx, emulator.image); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := client.CreateContainer(ctx, localContainerName, docker.ContainerConfig{
+		Image:  emulator.image,
+		Env:    emulator.env,
+		Labels: map[string]string{"kin.emulator": name},
+		Ports:  map[string]string{emulator.port + "/tcp": hostPort},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := client.StartContainer(ctx, id); err != nil {
+		return nil, err
+	}
+	cmd.PrintErrf("Started %s in %s\n", name, localContainerName)
+
+	return client.InspectContainer(ctx, id)
+}
+
+// localEmulatorURL returns the endpoint the container's emulator is published on.
+func localEmulatorURL(container *docker.Container) string {
+	for _, hostPort := range container.Ports {
+		return fmt.Sprintf("http://localhost:%s", hostPort)
+	}
+	return ""
+}
+
+// waitForLocalEmulator polls until the emulator answers Kinesis calls.
+func waitForLocalEmulator(ctx context.Context, client aws.KinesisAPI, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		_, err := client.ListStreams(ctx, &kinesis.ListStreamsInput{})
+		if err == nil {
+			return nil
+		}
+
+		aws.SleepContext(ctx, time.Second)
+		if ctx.Err() != nil {
+			return fmt.Errorf("emulator wasn't ready within %s: %w", timeout, err)
+		}
+	}
+}
+
+type localStream struct {
+	name   string
+	shards int32
+}
+
+// parseLocalStreams parses name or name:shards specs, defaulting to a single shard.
+func parseLocalStreams(specs []string) ([]localStream, error) {
+	var streams []localStream
+	for _, spec := range specs {
+		name, shards, found := strings.Cut(spec, ":")
+		stream := localStream{name: name, shards: 1}
+		if found {
+			n, err := strconv.ParseInt(shards, 10, 32)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid --stream %q: shards must be a positive number", spec)
+			}
+			stream.shards = int32(n)
+		}
+		if stream.name == "" {
+			return nil, fmt.Errorf("invalid --stream %q: missing stream name", spec)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
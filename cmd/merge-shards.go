@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	mergeShardsCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	mergeShardsCmd.Flags().StringP("shard", "s", "", "ID of the first shard to merge (required)")
+	mergeShardsCmd.Flags().String("adjacent-shard", "", "ID of the shard to merge it with, whose hash key range must be adjacent (required)")
+	mergeShardsCmd.Flags().Bool("wait", false, "Wait for the merge to finish, then print the resulting shards")
+	mergeShardsCmd.MarkFlagRequired("stream-name")
+	mergeShardsCmd.MarkFlagRequired("shard")
+	mergeShardsCmd.MarkFlagRequired("adjacent-shard")
+
+	rootCmd.AddCommand(mergeShardsCmd)
+}
+
+var mergeShardsCmd = &cobra.Command{
+	Use:   "merge-shards",
+	Short: "Merge two adjacent shards into one",
+	Long: `Merges two open shards into a single child covering both of their hash key ranges. The ranges
+must be adjacent: one shard's ending hash key must be immediately before the other's starting hash
+key. Use list-shards to find which shards qualify.`,
+	Run: runMergeShardsCmd,
+}
+
+func runMergeShardsCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	shardId, _ := cmd.Flags().GetString("shard")
+	adjacentShardId, _ := cmd.Flags().GetString("adjacent-shard")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shard := findShard(shards, shardId)
+	adjacent := findShard(shards, adjacentShardId)
+	for id, s := range map[string]*types.Shard{shardId: shard, adjacentShardId: adjacent} {
+		if s == nil {
+			cmd.PrintErrf("%s has no shard %s\n", streamName, id)
+			os.Exit(1)
+		}
+	}
+
+	if err := mergeShards(cmd.Context(), client, streamName, *shard, *adjacent); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if !wait {
+		return
+	}
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := printOpenShardMap(cmd, client, streamName); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// mergeShards merges two shards after checking that the merge is one Kinesis will accept.
+func mergeShards(ctx context.Context, client aws.KinesisAPI, streamName string, shard, adjacent types.Shard) error {
+	for _, s := range []types.Shard{shard, adjacent} {
+		if !isOpenShard(s) {
+			return fmt.Errorf("%s is closed and can't be merged", *s.ShardId)
+		}
+	}
+	if *shard.ShardId == *adjacent.ShardId {
+		return fmt.Errorf("can't merge %s with itself", *shard.ShardId)
+	}
+	if !shardsAdjacent(shard, adjacent) {
+		return fmt.Errorf("%s and %s don't have adjacent hash key ranges", *shard.ShardId, *adjacent.ShardId)
+	}
+
+	_, err := client.MergeShards(ctx, &kinesis.MergeShardsInput{
+		StreamName:           &streamName,
+		ShardToMerge:         shard.ShardId,
+		AdjacentShardToMerge: adjacent.ShardId,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Merging %s and %s\n", *shard.ShardId, *adjacent.ShardId)
+	return nil
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// streamMetric is one of the standard stream-level metrics Kinesis publishes to CloudWatch.
+type streamMetric struct {
+	id    string
+	name  string
+	stat  string
+	label string
+
+	// format renders a value for display; values that are sums over a period are shown per second
+	format func(value float64, period time.Duration) string
+}
+
+var streamMetrics = []streamMetric{
+	{"incoming_records", "IncomingRecords", "Sum", "Incoming records", formatPerSecond},
+	{"incoming_bytes", "IncomingBytes", "Sum", "Incoming bytes", formatBytesPerSecond},
+	{"iterator_age", "GetRecords.IteratorAgeMilliseconds", "Maximum", "Iterator age (max)", formatMillis},
+	{"read_throttles", "ReadProvisionedThroughputExceeded", "Sum", "Read throttles", formatCount},
+	{"write_throttles", "WriteProvisionedThroughputExceeded", "Sum", "Write throttles", formatCount},
+}
+
+type MetricSeries struct {
+	Metric     string      `json:"metric"`
+	Stat       string      `json:"stat"`
+	Timestamps []time.Time `json:"timestamps"`
+	Values     []float64   `json:"values"`
+}
+
+func formatPerSecond(v float64, period time.Duration) string {
+	return fmt.Sprintf("%.1f/s", v/period.Seconds())
+}
+
+func formatBytesPerSecond(v float64, period time.Duration) string {
+	return formatBytes(v/period.Seconds()) + "/s"
+}
+
+func formatMillis(v float64, _ time.Duration) string {
+	return (time.Duration(v) * time.Millisecond).String()
+}
+
+func formatCount(v float64, _ time.Duration) string {
+	return fmt.Sprintf("%.0f", v)
+}
+
+func init() {
+	metricsCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	metricsCmd.Flags().Duration("since", 3*time.Hour, "How far back to fetch metrics for")
+	metricsCmd.Flags().Duration("period", 5*time.Minute, "Width of each datapoint; must be a multiple of a minute")
+	metricsCmd.Flags().StringP("output", "o", "spark", "Output format: spark, table or json")
+	metricsCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(metricsCmd)
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Show a stream's CloudWatch metrics",
+	Long: `Fetches a stream's standard CloudWatch metrics for the last --since: incoming records and bytes,
+the maximum GetRecords iterator age, and read and write throttles.
+
+By default each metric is drawn as a sparkline with its minimum, maximum and latest values. Use
+--output table for every datapoint, or json for the raw series. Incoming records and bytes are
+shown per second; throttles are totals for each period.`,
+	Run: runMetricsCmd,
+}
+
+func runMetricsCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	since, _ := cmd.Flags().GetDuration("since")
+	period, _ := cmd.Flags().GetDuration("period")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "spark", "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if period < time.Minute || period%time.Minute != 0 {
+		cmd.PrintErrln("--period must be a whole number of minutes")
+		os.Exit(1)
+	}
+
+	client, err := aws.GetCloudWatchClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var queries []aws.MetricQuery
+	for _, metric := range streamMetrics {
+		queries = append(queries, aws.MetricQuery{
+			Id:         metric.id,
+			Namespace:  "AWS/Kinesis",
+			MetricName: metric.name,
+			Dimensions: map[string]string{"StreamName": streamName},
+			Stat:       metric.stat,
+			Period:     period,
+		})
+	}
+
+	end := time.Now().Truncate(period)
+	results, err := client.GetMetricData(cmd.Context(), queries, end.Add(-since), end)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	switch output {
+	case "json":
+		for i, result := range results {
+			printJSON(MetricSeries{
+				Metric:     streamMetrics[i].name,
+				Stat:       streamMetrics[i].stat,
+				Timestamps: result.Timestamps,
+				Values:     result.Values,
+			})
+		}
+
+	case "table":
+		printMetricsTable(results, period)
+
+	default:
+		rows := [][]string{}
+		for i, result := range results {
+			metric := streamMetrics[i]
+			if len(result.Values) == 0 {
+				rows = append(rows, []string{metric.label, "no data", "", "", ""})
+				continue
+			}
+			rows = append(rows, []string{
+				metric.label,
+				sparkline(result.Values),
+				"min " + metric.format(slices.Min(result.Values), period),
+				"max " + metric.format(slices.Max(result.Values), period),
+				"last " + metric.format(result.Values[len(result.Values)-1], period),
+			})
+		}
+		printTable(os.Stdout, []string{"METRIC", fmt.Sprintf("LAST %s", since), "", "", ""}, rows)
+	}
+}
+
+// printMetricsTable prints a row per period with a column per metric.
+func printMetricsTable(results []aws.MetricResult, period time.Duration) {
+	values := map[time.Time][]string{}
+	var timestamps []time.Time
+	for i, result := range results {
+		for j, t := range result.Timestamps {
+			row, ok := values[t]
+			if !ok {
+				row = make([]string, len(results))
+				for k := range row {
+					row[k] = "-"
+				}
+				values[t] = row
+				timestamps = append(timestamps, t)
+			}
+			row[i] = streamMetrics[i].format(result.Values[j], period)
+		}
+	}
+	slices.SortFunc(timestamps, time.Time.Compare)
+
+	headers := []string{"TIME"}
+	for _, metric := range streamMetrics {
+		headers = append(headers, strings.ToUpper(metric.label))
+	}
+
+	rows := [][]string{}
+	for _, t := range timestamps {
+		rows = append(rows, append([]string{t.Local().Format(time.DateTime)}, values[t]...))
+	}
+	printTable(os.Stdout, headers, rows)
+}
+
+// sparkline draws values as a line of block characters scaled between their minimum and maximum.
+func sparkline(values []float64) string {
+	const blocks = "▁▂▃▄▅▆▇█"
+	ticks := []rune(blocks)
+
+	lo, hi := slices.Min(values), slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int(math.Round((v - lo) / (hi - lo) * float64(len(ticks)-1)))
+		}
+		b.WriteRune(ticks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/kinesismock"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// mockInMemory is --mock's value when it's given without a file
+	mockInMemory = "memory"
+
+	// mockShards is how many shards the mock gives a stream that's named before it's created
+	mockShards = 1
+)
+
+// configureMock points every Kinesis client at an in-memory mock when --mock is given, so that
+// commands can be tried without AWS. Streams are created as soon as they're named. With
+// --mock=<file>, they're loaded from the file and saved back to it when the command finishes.
+// Only Kinesis is mocked: commands that also use other services will still fail without AWS.
+func configureMock(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("mock")
+	if path == "" {
+		return nil
+	}
+	if endpoint, _ := cmd.Flags().GetString("endpoint-url"); endpoint != "" {
+		return fmt.Errorf("--mock can't be used with --endpoint-url")
+	}
+
+	mock := kinesismock.New(kinesismock.WithAutoCreate(mockShards))
+	if path != mockInMemory {
+		var err error
+		mock, err = kinesismock.Load(path, kinesismock.WithAutoCreate(mockShards))
+		if err != nil {
+			return err
+		}
+	}
+
+	server := kinesismock.NewServer(mock)
+	onShutdown(func() {
+		server.Close()
+		if path == mockInMemory {
+			return
+		}
+		if err := mock.Save(path); err != nil {
+			slog.Error("couldn't save the mock's streams", "path", path, "error", err)
+		}
+	})
+
+	if aws.Region() == "" {
+		aws.SetRegion(kinesismock.Region)
+	}
+	aws.SetOffline(true)
+	aws.SetKinesisEndpointURL(server.URL)
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"kin/pkg/aws"
+	"os"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	modeCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	modeCmd.Flags().Bool("on-demand", false, "Switch the stream to on-demand capacity")
+	modeCmd.Flags().Bool("provisioned", false, "Switch the stream to provisioned capacity")
+	modeCmd.Flags().Int32("shards", 0, "With --provisioned, scale to this many shards once the switch is complete; implies --wait")
+	modeCmd.Flags().Bool("wait", false, "Wait for the switch to finish before exiting")
+	modeCmd.MarkFlagRequired("stream-name")
+	modeCmd.MarkFlagsMutuallyExclusive("on-demand", "provisioned")
+	modeCmd.MarkFlagsOneRequired("on-demand", "provisioned")
+
+	rootCmd.AddCommand(modeCmd)
+}
+
+var modeCmd = &cobra.Command{
+	Use:   "mode",
+	Short: "Switch a stream between provisioned and on-demand capacity",
+	Long: `Switches a stream's capacity mode with UpdateStreamMode.
+
+A stream switched to provisioned keeps the shards it had while on-demand; pass --shards to scale it
+to a specific count afterwards, subject to the same limits as the scale command.
+
+Kinesis only allows a stream's mode to be switched twice in any 24 hours, so avoid switching back
+and forth.`,
+	Run: runModeCmd,
+}
+
+func runModeCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	onDemand, _ := cmd.Flags().GetBool("on-demand")
+	shards, _ := cmd.Flags().GetInt32("shards")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	mode := types.StreamModeProvisioned
+	if onDemand {
+		mode = types.StreamModeOnDemand
+	}
+	if shards != 0 && onDemand {
+		cmd.PrintErrln("--shards can only be used with --provisioned")
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary := output.StreamDescriptionSummary
+
+	if summary.StreamStatus != types.StreamStatusActive {
+		cmd.PrintErrf("%s is %s; its mode can only be changed when ACTIVE\n", streamName, summary.StreamStatus)
+		os.Exit(1)
+	}
+	if summary.StreamModeDetails != nil && summary.StreamModeDetails.StreamMode == mode {
+		cmd.PrintErrf("%s is already %s\n", streamName, mode)
+		if shards == 0 {
+			return
+		}
+	} else {
+		_, err = client.UpdateStreamMode(cmd.Context(), &kinesis.UpdateStreamModeInput{
+			StreamARN:         summary.StreamARN,
+			StreamModeDetails: &types.StreamModeDetails{StreamMode: mode},
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Switching %s to %s\n", streamName, mode)
+	}
+
+	if !wait && shards == 0 {
+		return
+	}
+
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Stream %s is %s\n", streamName, mode)
+
+	if shards == 0 {
+		return
+	}
+
+	// The shard count may have changed while on-demand, so check against the latest
+	output, err = client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary = output.StreamDescriptionSummary
+	if awssdk.ToInt32(summary.OpenShardCount) == shards {
+		return
+	}
+
+	if err := validateShardCountChange(summary, shards); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	_, err = client.UpdateShardCount(cmd.Context(), &kinesis.UpdateShardCountInput{
+		StreamName:       &streamName,
+		TargetShardCount: &shards,
+		ScalingType:      types.ScalingTypeUniformScaling,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Scaling %s to %d shards\n", streamName, shards)
+
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := printOpenShardMap(cmd, client, streamName); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
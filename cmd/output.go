@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// validateOutput checks that an --output flag value is one of the formats a command supports.
+func validateOutput(output string, formats ...string) error {
+	if !slices.Contains(formats, output) {
+		return fmt.Errorf("unknown --output %q: must be one of %s", output, strings.Join(formats, ", "))
+	}
+	return nil
+}
+
+// printTable writes rows as aligned columns with a header line.
+func printTable(w io.Writer, headers []string, rows [][]string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// printJSON writes v to stdout as a single line of JSON.
+func printJSON(v interface{}) {
+	jsonBytes, _ := json.Marshal(v)
+	fmt.Fprintln(os.Stdout, string(jsonBytes))
+}
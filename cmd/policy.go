@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kin/pkg/aws"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	policyCmd.PersistentFlags().StringP("stream-name", "n", "", "Stream name; the policy is attached to the stream unless --resource-arn is given")
+	policyCmd.PersistentFlags().String("resource-arn", "", "ARN of the stream or consumer whose policy to manage")
+	policyCmd.MarkFlagsOneRequired("stream-name", "resource-arn")
+
+	policyPutCmd.Flags().StringP("file", "f", "", "File containing the policy document, or - for stdin (required)")
+	policyPutCmd.Flags().BoolP("yes", "y", false, "Apply without asking for confirmation")
+	policyPutCmd.Flags().Bool("dry-run", false, "Show the changes that would be made without applying them")
+	policyPutCmd.MarkFlagRequired("file")
+	policyDeleteCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+
+	policyCmd.AddCommand(policyGetCmd, policyPutCmd, policyDeleteCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage the resource policy of a stream or consumer",
+	Long: `Gets, puts and deletes the resource-based policy attached to a stream or enhanced fan-out
+consumer, which is how other accounts are granted access to read from or write to it.`,
+}
+
+var policyGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print the resource policy",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, resourceARN := policyClient(cmd)
+
+		policy, err := getResourcePolicy(cmd.Context(), client, resourceARN)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		if policy == "" {
+			cmd.PrintErrln("No resource policy")
+			return
+		}
+		fmt.Println(policy)
+	},
+}
+
+var policyPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Replace the resource policy",
+	Long: `Validates a policy document, shows how it differs from the current policy, and after
+confirmation replaces the current policy with it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		yes, _ := cmd.Flags().GetBool("yes")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var contents []byte
+		var err error
+		if file == "-" {
+			contents, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			contents, err = os.ReadFile(file)
+		}
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		policy, err := normalizePolicy(contents)
+		if err != nil {
+			cmd.PrintErrf("invalid policy in %s: %s\n", file, err)
+			os.Exit(1)
+		}
+
+		client, resourceARN := policyClient(cmd)
+		current, err := getResourcePolicy(cmd.Context(), client, resourceARN)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if current == policy {
+			cmd.PrintErrln("Policy is unchanged")
+			return
+		}
+		for _, line := range lineDiff(splitLines(current), splitLines(policy)) {
+			fmt.Println(line)
+		}
+		if dryRun {
+			return
+		}
+
+		if !yes && !confirm(cmd, "Apply this policy? Type yes to confirm: ", "yes") {
+			cmd.PrintErrln("Aborted")
+			os.Exit(1)
+		}
+
+		_, err = client.PutResourcePolicy(cmd.Context(), &kinesis.PutResourcePolicyInput{
+			ResourceARN: &resourceARN,
+			Policy:      &policy,
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrln("Policy applied")
+	},
+}
+
+var policyDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the resource policy",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		client, resourceARN := policyClient(cmd)
+		if !yes && !confirm(cmd, fmt.Sprintf("Delete the resource policy of %s? Type yes to confirm: ", resourceARN), "yes") {
+			cmd.PrintErrln("Aborted")
+			os.Exit(1)
+		}
+
+		_, err := client.DeleteResourcePolicy(cmd.Context(), &kinesis.DeleteResourcePolicyInput{
+			ResourceARN: &resourceARN,
+		})
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrln("Policy deleted")
+	},
+}
+
+// policyClient returns a Kinesis client and the ARN of the resource named by --resource-arn or
+// --stream-name.
+func policyClient(cmd *cobra.Command) (aws.KinesisAPI, string) {
+	resourceARN, _ := cmd.Flags().GetString("resource-arn")
+	streamName, _ := cmd.Flags().GetString("stream-name")
+
+	if resourceARN != "" {
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		return client, resourceARN
+	}
+	return consumersClient(cmd, streamName)
+}
+
+// getResourcePolicy returns the resource's policy, indented for display, or "" if it has none.
+func getResourcePolicy(ctx context.Context, client aws.KinesisAPI, resourceARN string) (string, error) {
+	output, err := client.GetResourcePolicy(ctx, &kinesis.GetResourcePolicyInput{
+		ResourceARN: &resourceARN,
+	})
+	if err != nil {
+		return "", err
+	}
+	if output.Policy == nil || *output.Policy == "" || *output.Policy == "{}" {
+		return "", nil
+	}
+	return normalizePolicy([]byte(*output.Policy))
+}
+
+// normalizePolicy checks that a policy is a JSON object with at least one statement, and returns
+// it consistently indented so that two versions can be compared line by line.
+func normalizePolicy(policy []byte) (string, error) {
+	var document struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(policy, &document); err != nil {
+		return "", err
+	}
+	if len(document.Statement) == 0 || string(document.Statement) == "null" {
+		return "", errors.New("policy has no Statement")
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, bytes.TrimSpace(policy), "", "  "); err != nil {
+		return "", err
+	}
+	return indented.String(), nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lineDiff returns the lines of a and b prefixed with "- " where only in a, "+ " where only in b,
+// and "  " where in both, using their longest common subsequence.
+func lineDiff(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			diff = append(diff, "+ "+b[j])
+			j++
+		default:
+			diff = append(diff, "- "+a[i])
+			i++
+		}
+	}
+	return diff
+}
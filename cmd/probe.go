@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// Upper bounds of the latency histogram's buckets; anything slower lands in a final overflow bucket
+var probeBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// probeRecord is the payload of each probe. Run identifies this kin process, so that probes from
+// others probing the same stream are ignored.
+type probeRecord struct {
+	Run    string    `json:"kin_probe"`
+	Seq    int64     `json:"seq"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+type probeSample struct {
+	receivedAt time.Time
+
+	// put is the time from sending the probe to Kinesis accepting it; endToEnd is the time until
+	// we read it back
+	put      time.Duration
+	endToEnd time.Duration
+}
+
+type probeTracker struct {
+	mu      sync.Mutex
+	pending map[int64]time.Time
+	samples []probeSample
+	sent    int
+	lost    int
+}
+
+func (t *probeTracker) Sent(seq int64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending[seq] = at
+	t.sent++
+}
+
+func (t *probeTracker) Received(probe probeRecord, arrivedAt, receivedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.pending[probe.Seq]; !ok {
+		// Already counted as lost, or a duplicate from a producer retry
+		return
+	}
+	delete(t.pending, probe.Seq)
+
+	t.samples = append(t.samples, probeSample{
+		receivedAt: receivedAt,
+		put:        arrivedAt.Sub(probe.SentAt),
+		endToEnd:   receivedAt.Sub(probe.SentAt),
+	})
+}
+
+// Expire counts probes sent before cutoff that were never received as lost, and drops samples
+// received before windowStart.
+func (t *probeTracker) Expire(cutoff, windowStart time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for seq, sentAt := range t.pending {
+		if sentAt.Before(cutoff) {
+			delete(t.pending, seq)
+			t.lost++
+		}
+	}
+
+	t.samples = slices.DeleteFunc(t.samples, func(s probeSample) bool {
+		return s.receivedAt.Before(windowStart)
+	})
+}
+
+func (t *probeTracker) Report(window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	endToEnd := make([]time.Duration, len(t.samples))
+	put := make([]time.Duration, len(t.samples))
+	for i, s := range t.samples {
+		endToEnd[i] = s.endToEnd
+		put[i] = s.put
+	}
+	slices.Sort(endToEnd)
+	slices.Sort(put)
+
+	p := func(sorted []time.Duration, p float64) time.Duration {
+		return percentile(sorted, p).Round(time.Millisecond)
+	}
+
+	fmt.Printf(
+		"%s  sent %d, lost %d; last %s: %d received, end-to-end p50 %s p95 %s p99 %s max %s, put p50 %s p99 %s\n",
+		time.Now().Format(time.TimeOnly),
+		t.sent,
+		t.lost,
+		window,
+		len(endToEnd),
+		p(endToEnd, 0.50),
+		p(endToEnd, 0.95),
+		p(endToEnd, 0.99),
+		p(endToEnd, 1),
+		p(put, 0.50),
+		p(put, 0.99),
+	)
+
+	counts := make([]int, len(probeBuckets)+1)
+	for _, d := range endToEnd {
+		i, _ := slices.BinarySearch(probeBuckets, d)
+		counts[i]++
+	}
+
+	most := max(1, slices.Max(counts))
+	for i, count := range counts {
+		label := fmt.Sprintf("> %s", probeBuckets[len(probeBuckets)-1])
+		if i < len(probeBuckets) {
+			label = fmt.Sprintf("<= %s", probeBuckets[i])
+		}
+		fmt.Printf("  %8s |%-40s %d\n", label, strings.Repeat("#", count*40/most), count)
+	}
+}
+
+func init() {
+	probeCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	probeCmd.Flags().Duration("interval", time.Second, "How often to send a probe to each shard")
+	probeCmd.Flags().Duration("poll-interval", time.Second, "How often to poll each shard for probes; Kinesis allows five reads per second per shard, shared with other consumers")
+	probeCmd.Flags().Duration("report-interval", 10*time.Second, "How often to print the latency histogram")
+	probeCmd.Flags().Duration("window", time.Minute, "How far back the latency histogram looks")
+	probeCmd.Flags().Duration("timeout", 30*time.Second, "How long to wait for a probe before counting it as lost")
+	probeCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(probeCmd)
+}
+
+var probeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Measure producer-to-consumer latency through a Kinesis Data Stream",
+	Long: `Periodically writes small timestamped probe records to every open shard while tailing the
+stream, and prints a rolling histogram of how long each probe took to be read back.
+
+Two latencies are reported: put, from sending the probe until Kinesis timestamped its arrival, and
+end-to-end, until kin read it back. End-to-end includes up to --poll-interval of waiting between
+reads, just as any polling consumer would. If these are healthy but your application is slow to
+see records, the problem is likely in the consumer rather than the stream.
+
+Probe records are JSON objects with a "kin_probe" field, and are written to the stream like any
+other record, so consumers of the stream will see them.`,
+	Run: runProbeCmd,
+}
+
+func runProbeCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+	reportInterval, _ := cmd.Flags().GetDuration("report-interval")
+	window, _ := cmd.Flags().GetDuration("window")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var openShards []types.Shard
+	for _, shard := range shards {
+		if isOpenShard(shard) {
+			openShards = append(openShards, shard)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	tracker := &probeTracker{pending: map[int64]time.Time{}}
+	run := randomPartitionKey()
+
+	// Start reading before the first probe is sent so that none are missed
+	start := time.Now()
+	tailOptions := &TailOptions{AtTimestamp: &start, PollInterval: pollInterval}
+	out := make(chan *RecordOutput)
+	for _, shard := range openShards {
+		go tailStreamShard(ctx, client, &streamName, shard.ShardId, tailOptions, out)
+	}
+
+	go sendProbes(ctx, client, streamName, openShards, run, interval, tracker)
+
+	report := time.NewTicker(reportInterval)
+	defer report.Stop()
+
+	for {
+		select {
+		case record := <-out:
+			receivedAt := time.Now()
+			if record.Data == nil || record.ApproximateArrivalTimestamp == nil {
+				continue
+			}
+
+			// Round-trip the decoded record to pick out probes from everything else on the stream
+			jsonBytes, _ := json.Marshal(*record.Data)
+			var probe probeRecord
+			if json.Unmarshal(jsonBytes, &probe) != nil || probe.Run != run {
+				continue
+			}
+			tracker.Received(probe, record.ApproximateArrivalTimestamp.Time, receivedAt)
+
+		case <-report.C:
+			now := time.Now()
+			tracker.Expire(now.Add(-timeout), now.Add(-window))
+			tracker.Report(window)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendProbes writes a probe to each shard every interval until ctx is cancelled. Each is sent with
+// the shard's starting hash key, so that every shard is probed whatever its key range.
+func sendProbes(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	shards []types.Shard,
+	run string,
+	interval time.Duration,
+	tracker *probeTracker,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seq int64
+	for {
+		for _, shard := range shards {
+			probe := probeRecord{Run: run, Seq: seq, SentAt: time.Now()}
+			data, _ := json.Marshal(probe)
+			tracker.Sent(seq, probe.SentAt)
+			seq++
+
+			_, err := client.PutRecord(ctx, &kinesis.PutRecordInput{
+				Data:            data,
+				PartitionKey:    &run,
+				ExplicitHashKey: shard.HashKeyRange.StartingHashKey,
+				StreamName:      &streamName,
+			})
+			if err != nil && ctx.Err() == nil {
+				// The probe will be counted as lost once it times out
+				slog.Warn("failed to send probe", "shard", *shard.ShardId, "error", err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
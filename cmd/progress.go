@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"kin/pkg/tailer"
+	"os"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/pflag"
+)
+
+// addProgressFlag registers --progress, for commands that may read for a long time.
+func addProgressFlag(flags *pflag.FlagSet) {
+	flags.String("progress", "", "Write progress events to stderr: json for a line of JSON per event, such as shards discovered, batches read and checkpoints written")
+}
+
+// progressReporter writes progress events to stderr as newline-delimited JSON, each with an event
+// name and time followed by its own fields, so that wrappers can follow a long-running command
+// while its records go to stdout:
+//
+//	{"event":"batch_read","time":"2024-05-01T12:00:00Z","bytes":5120,"latency_ms":35,"records":10,"shard_id":"shardId-000000000000"}
+//
+// A nil progressReporter reports nothing. It's safe for concurrent use, and implements
+// tailer.IteratorObserver.
+type progressReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// progressFromFlags returns the reporter --progress asks for, or nil without it.
+func progressFromFlags(flags *pflag.FlagSet) (*progressReporter, error) {
+	format, err := flags.GetString("progress")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "":
+		return nil, nil
+	case "json":
+		return &progressReporter{w: os.Stderr}, nil
+	default:
+		return nil, fmt.Errorf("unknown --progress %q: must be json", format)
+	}
+}
+
+// emit writes an event with the given fields.
+func (p *progressReporter) emit(event string, fields map[string]interface{}) {
+	if p == nil {
+		return
+	}
+
+	line, _ := json.Marshal(struct {
+		Event string    `json:"event"`
+		Time  time.Time `json:"time"`
+	}{event, time.Now().UTC()})
+	if len(fields) > 0 {
+		rest, _ := json.Marshal(fields)
+		line = append(append(line[:len(line)-1], ','), rest[1:]...)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(append(line, '\n'))
+}
+
+// ShardsDiscovered reports the shards a command is going to read.
+func (p *progressReporter) ShardsDiscovered(shardIds []string) {
+	p.emit("shards_discovered", map[string]interface{}{"shards": len(shardIds), "shard_ids": shardIds})
+}
+
+func (p *progressReporter) ObserveShardIterator(shardId string, position tailer.Position) {
+	fields := map[string]interface{}{"shard_id": shardId, "iterator_type": position.Type}
+	if position.SequenceNumber != nil {
+		fields["sequence_number"] = *position.SequenceNumber
+	}
+	if position.Timestamp != nil {
+		fields["timestamp"] = position.Timestamp.UTC()
+	}
+	p.emit("iterator_acquired", fields)
+}
+
+func (p *progressReporter) ObserveGetRecords(shardId string, latency time.Duration, records, bytes int, millisBehindLatest *int64) {
+	fields := map[string]interface{}{
+		"shard_id":   shardId,
+		"records":    records,
+		"bytes":      bytes,
+		"latency_ms": latency.Milliseconds(),
+	}
+	if millisBehindLatest != nil {
+		fields["millis_behind_latest"] = *millisBehindLatest
+	}
+	p.emit("batch_read", fields)
+}
+
+func (p *progressReporter) ObserveThrottle(shardId string) {
+	p.emit("throttled", map[string]interface{}{"shard_id": shardId})
+}
+
+// CheckpointWritten reports that a shard's checkpoint was persisted.
+func (p *progressReporter) CheckpointWritten(shardId, sequenceNumber string) {
+	p.emit("checkpoint_written", map[string]interface{}{"shard_id": shardId, "sequence_number": sequenceNumber})
+}
+
+// FileWritten reports that a file of records was finished.
+func (p *progressReporter) FileWritten(file ExportFile) {
+	p.emit("file_written", map[string]interface{}{
+		"path":     file.Path,
+		"shard_id": file.ShardId,
+		"records":  file.Records,
+		"bytes":    file.Bytes,
+	})
+}
+
+// ShardDone reports that a shard has been read as far as the command reads it.
+func (p *progressReporter) ShardDone(shardId string, err error) {
+	fields := map[string]interface{}{"shard_id": shardId}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	p.emit("shard_done", fields)
+}
+
+// Done reports that the command finished, with a summary of what it did.
+func (p *progressReporter) Done(summary map[string]interface{}) {
+	p.emit("done", summary)
+}
+
+// Checkpointer returns c, reporting each checkpoint it persists, or c as it is if p is nil.
+func (p *progressReporter) Checkpointer(c Checkpointer) Checkpointer {
+	if p == nil || c == nil {
+		return c
+	}
+	return &progressCheckpointer{Checkpointer: c, progress: p, pending: map[string]string{}}
+}
+
+// progressCheckpointer reports the checkpoints set since the last flush once they're flushed.
+type progressCheckpointer struct {
+	Checkpointer
+	progress *progressReporter
+
+	mu      sync.Mutex
+	pending map[string]string
+}
+
+func (c *progressCheckpointer) Set(shardId, sequenceNumber string) {
+	c.Checkpointer.Set(shardId, sequenceNumber)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[shardId] = sequenceNumber
+}
+
+func (c *progressCheckpointer) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Checkpointer.Flush(); err != nil {
+		return err
+	}
+	for shardId, sequenceNumber := range c.pending {
+		c.progress.CheckpointWritten(shardId, sequenceNumber)
+		delete(c.pending, shardId)
+	}
+	return nil
+}
+
+// shardIdsOf returns the ids of shards given as pointers, as ListShards returns them.
+func shardIdsOf(shardIds []*string) []string {
+	ids := make([]string, len(shardIds))
+	for i, id := range shardIds {
+		ids[i] = awssdk.ToString(id)
+	}
+	return ids
+}
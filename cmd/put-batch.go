@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kin/pkg/aws"
+	"kin/pkg/producer"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	putBatchCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	putBatchCmd.Flags().StringP("file", "f", "", "File of newline-delimited records to put; reads stdin if not given")
+	putBatchCmd.Flags().StringP("partition-key", "k", "", "Partition key for every record")
+	putBatchCmd.Flags().String("key-path", "", "JMESPath expression selecting each record's partition key (ex: orderId); random keys are used if neither this nor --partition-key is given")
+	putBatchCmd.Flags().Bool("aggregate", false, "Pack records into KPL aggregated records, grouped by partition key")
+	putBatchCmd.Flags().Int("max-attempts", 5, "Maximum number of attempts for each record before giving up on it")
+	putBatchCmd.Flags().String("explicit-hash-key", "", "Explicit hash key (a decimal 128-bit integer) overriding the partition key's hash for every record, to target a specific shard")
+	addRateLimitFlags(putBatchCmd.Flags())
+	putBatchCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(putBatchCmd)
+}
+
+var putBatchCmd = &cobra.Command{
+	Use:   "put-batch",
+	Short: "Put many records onto a Kinesis Data Stream using PutRecords",
+	Long: `Reads newline-delimited records and writes them to the target stream in batches of up to 500
+records or 5MB. Records that fail within a batch (for example due to throttling) are retried with
+exponential backoff, without resending the records that succeeded. A summary is printed when done,
+and the command exits non-zero if any records could not be put.
+
+With --aggregate, records are first packed using the Kinesis Producer Library's aggregation format,
+which greatly reduces the number of Kinesis records (and so cost and throttling) for small records.`,
+	Run: runPutBatchCmd,
+}
+
+func runPutBatchCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	file, _ := cmd.Flags().GetString("file")
+	partitionKey, _ := cmd.Flags().GetString("partition-key")
+	keyPath, _ := cmd.Flags().GetString("key-path")
+	maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+
+	partitionKeyFor, err := newPartitionKeyFunc(partitionKey, keyPath)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var input io.Reader = os.Stdin
+	if file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	opts, err := producerOptions(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	opts = append(opts, producer.WithMaxAttempts(maxAttempts))
+	if aggregate, _ := cmd.Flags().GetBool("aggregate"); aggregate {
+		opts = append(opts, producer.WithAggregation(partitionKey != "" || keyPath != ""))
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	p := producer.New(client, streamName, opts...)
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		key, err := partitionKeyFor(line)
+		if err != nil {
+			cmd.PrintErrf("line %d: %v\n", lineNumber, err)
+			p.CountFailure("InvalidPartitionKey", 1)
+			continue
+		}
+
+		// The scanner reuses its buffer, so the line has to be copied before being batched
+		record := producer.Record{PartitionKey: key, Data: append([]byte(nil), line...)}
+		if err := p.Add(cmd.Context(), record); err != nil {
+			cmd.PrintErrf("line %d: %v\n", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	p.Flush(cmd.Context())
+
+	summary := p.Summary()
+	jsonBytes, _ := json.Marshal(summary)
+	fmt.Println(string(jsonBytes))
+
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
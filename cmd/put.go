@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/decode"
+	"kin/pkg/kpl"
+	"kin/pkg/producer"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmespath/go-jmespath"
+	"github.com/spf13/cobra"
+)
+
+// The largest payload Kinesis will accept in a single record
+const maxRecordSize = 1024 * 1024
+
+// How long records may wait in a partially filled aggregate before it's put, when --aggregate is
+// given and they aren't arriving fast enough to fill it
+const putAggregateFlushInterval = time.Second
+
+type PutOutput struct {
+	ShardId        *string `json:"shard_id"`
+	SequenceNumber *string `json:"sequence_number"`
+
+	// Records is the number of user records packed into an aggregated record
+	Records int `json:"records,omitempty"`
+}
+
+func init() {
+	putCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	putCmd.Flags().StringP("partition-key", "k", "", "Partition key for the record; required unless --stdin is given")
+	putCmd.Flags().StringP("data", "d", "", "Record payload")
+	putCmd.Flags().String("data-file", "", "File containing the record payload, sent as-is")
+	putCmd.Flags().Bool("stdin", false, "Read newline-delimited JSON from stdin and put each line as a record")
+	putCmd.Flags().String("key-path", "", "JMESPath expression selecting each record's partition key when using --stdin (ex: orderId); random keys are used if neither this nor --partition-key is given")
+	putCmd.Flags().Bool("aggregate", false, "Pack records into KPL aggregated records, grouped by partition key")
+	putCmd.Flags().String("explicit-hash-key", "", "Explicit hash key (a decimal 128-bit integer) overriding the partition key's hash, to target a specific shard")
+	addRateLimitFlags(putCmd.Flags())
+	putCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(putCmd)
+}
+
+var putCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Put a single record onto a Kinesis Data Stream",
+	Long: `Writes a single record to the target stream and prints the shard ID and sequence number it
+was assigned. The payload is given either inline with --data or read from a file with --data-file.
+
+With --stdin, each line of newline-delimited JSON read from stdin is written as its own record,
+and the shard ID and sequence number of each is printed in turn.
+
+With --aggregate, records are packed using the Kinesis Producer Library's aggregation format, so
+that many small records are sent as a single Kinesis record of up to 1MB. Consumers must
+deaggregate them, as the KCL does automatically. With --stdin, an aggregate is put once it's full or
+within a second of its first record, and when the command is interrupted.`,
+	Run: runPutCmd,
+}
+
+func runPutCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	partitionKey, _ := cmd.Flags().GetString("partition-key")
+	useStdin, _ := cmd.Flags().GetBool("stdin")
+
+	if useStdin {
+		runPutStdin(cmd, streamName, partitionKey)
+		return
+	}
+
+	if partitionKey == "" {
+		cmd.PrintErrln("--partition-key is required")
+		os.Exit(1)
+	}
+
+	data, err := readPutData(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	opts, err := producerOptions(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if aggregate, _ := cmd.Flags().GetBool("aggregate"); aggregate {
+		opts = append(opts, producer.WithAggregation(true))
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	p := producer.New(client, streamName, opts...)
+	if err := putRecord(cmd.Context(), p, producer.Record{PartitionKey: partitionKey, Data: data}); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// producerOptions returns the options shared by the commands that put records: --explicit-hash-key
+// and the rate limits.
+func producerOptions(cmd *cobra.Command) ([]producer.Option, error) {
+	limiter, err := NewWriteLimiterFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+	opts := []producer.Option{producer.WithLimiter(limiter)}
+
+	if cmd.Flags().Lookup("explicit-hash-key") != nil {
+		explicitHashKey, err := explicitHashKeyFlag(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if explicitHashKey != nil {
+			opts = append(opts, producer.WithExplicitHashKey(*explicitHashKey))
+		}
+	}
+
+	return opts, nil
+}
+
+// putRecord puts a single record and prints where it landed.
+func putRecord(ctx context.Context, p *producer.Producer, record producer.Record) error {
+	result, err := p.Put(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, _ := json.Marshal(PutOutput{
+		ShardId:        result.ShardId,
+		SequenceNumber: result.SequenceNumber,
+		Records:        result.Records,
+	})
+	fmt.Println(string(jsonBytes))
+	return nil
+}
+
+func readPutData(cmd *cobra.Command) ([]byte, error) {
+	data, _ := cmd.Flags().GetString("data")
+	dataFile, _ := cmd.Flags().GetString("data-file")
+
+	switch {
+	case cmd.Flags().Changed("data") && dataFile != "":
+		return nil, fmt.Errorf("only one of --data and --data-file may be given")
+
+	case dataFile != "":
+		return os.ReadFile(dataFile)
+
+	case cmd.Flags().Changed("data"):
+		return []byte(data), nil
+
+	default:
+		return nil, fmt.Errorf("one of --data or --data-file is required")
+	}
+}
+
+// runPutStdin puts every line of NDJSON on stdin as a separate record. Lines that fail are
+// reported and skipped; the command exits non-zero at the end if any did.
+func runPutStdin(cmd *cobra.Command, streamName, partitionKey string) {
+	keyPath, _ := cmd.Flags().GetString("key-path")
+	partitionKeyFor, err := newPartitionKeyFunc(partitionKey, keyPath)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	opts, err := producerOptions(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	p := producer.New(client, streamName, opts...)
+
+	// Each record is put as soon as it's ready, so aggregates are built here rather than by the
+	// producer, which only aggregates batches
+	var aggregator *producer.Aggregator
+	if aggregate, _ := cmd.Flags().GetBool("aggregate"); aggregate {
+		// Random keys don't need to be kept together, so they can all share one aggregate
+		aggregator = producer.NewAggregator(partitionKey != "" || keyPath != "")
+	}
+
+	// mu guards the aggregator and failed, which the shutdown hook uses when interrupted
+	var mu sync.Mutex
+	failed := 0
+	putAggregated := func(aggregated *kpl.Record) {
+		record := producer.Record{PartitionKey: aggregated.PartitionKey, Data: aggregated.Data, Count: aggregated.Count}
+		if err := putRecord(cmd.Context(), p, record); err != nil {
+			cmd.PrintErrf("aggregated record of %d records: %v\n", aggregated.Count, err)
+			failed += aggregated.Count
+		}
+	}
+	putLine := func(lineNumber int, line []byte) {
+		key, err := partitionKeyFor(line)
+		if err != nil {
+			cmd.PrintErrf("line %d: %v\n", lineNumber, err)
+			failed++
+			return
+		}
+
+		if aggregator != nil {
+			aggregated, err := aggregator.Add(key, line)
+			if aggregated != nil {
+				putAggregated(aggregated)
+			}
+			if err != nil {
+				cmd.PrintErrf("line %d: %v\n", lineNumber, err)
+				failed++
+			}
+			return
+		}
+
+		if err := putRecord(cmd.Context(), p, producer.Record{PartitionKey: key, Data: line}); err != nil {
+			cmd.PrintErrf("line %d: %v\n", lineNumber, err)
+			failed++
+		}
+	}
+	flushAggregates := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, aggregated := range aggregator.Flush() {
+			putAggregated(aggregated)
+		}
+	}
+
+	// Lines are read in the background so that partially filled aggregates can still be put
+	// while stdin is quiet
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- bytes.Clone(scanner.Bytes())
+		}
+	}()
+
+	var flushTicks <-chan time.Time
+	if aggregator != nil {
+		onShutdown(flushAggregates)
+		flushTicker := time.NewTicker(putAggregateFlushInterval)
+		defer flushTicker.Stop()
+		flushTicks = flushTicker.C
+	}
+
+	lineNumber := 0
+	for done := false; !done; {
+		select {
+		case <-flushTicks:
+			flushAggregates()
+
+		case line, ok := <-lines:
+			if !ok {
+				done = true
+				break
+			}
+			lineNumber++
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			mu.Lock()
+			putLine(lineNumber, line)
+			mu.Unlock()
+		}
+	}
+
+	if aggregator != nil {
+		flushAggregates()
+	}
+
+	if err := scanner.Err(); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		cmd.PrintErrf("%d records failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// newPartitionKeyFunc returns a function choosing the partition key for each record: a fixed key,
+// one extracted from the record with a JMESPath expression, or otherwise a random one.
+func newPartitionKeyFunc(partitionKey, keyPath string) (func(data []byte) (string, error), error) {
+	switch {
+	case partitionKey != "" && keyPath != "":
+		return nil, fmt.Errorf("only one of --partition-key and --key-path may be given")
+
+	case partitionKey != "":
+		return func([]byte) (string, error) { return partitionKey, nil }, nil
+
+	case keyPath != "":
+		keyExpr, err := jmespath.Compile(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) (string, error) { return extractPartitionKey(keyExpr, data) }, nil
+
+	default:
+		return func([]byte) (string, error) { return randomPartitionKey(), nil }, nil
+	}
+}
+
+// extractPartitionKey evaluates a JMESPath expression against a JSON document, returning the
+// result as a string. Numbers are kept as they were written, so that large integer IDs don't
+// lose precision and collide.
+func extractPartitionKey(expr *jmespath.JMESPath, line []byte) (string, error) {
+	document, err := decode.JSON(line)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := expr.Search(document)
+	if err != nil {
+		return "", err
+	}
+
+	switch key := result.(type) {
+	case nil:
+		return "", fmt.Errorf("partition key path matched nothing")
+	case string:
+		if key == "" {
+			return "", fmt.Errorf("partition key is empty")
+		}
+		return key, nil
+	case json.Number:
+		return key.String(), nil
+	case float64:
+		// Results computed by JMESPath functions, such as length()
+		return strconv.FormatFloat(key, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(key), nil
+	default:
+		return "", fmt.Errorf("partition key must be a string or number, not %T", key)
+	}
+}
+
+// explicitHashKeyFlag returns the validated --explicit-hash-key, or nil if it wasn't given.
+func explicitHashKeyFlag(cmd *cobra.Command) (*string, error) {
+	explicitHashKey, _ := cmd.Flags().GetString("explicit-hash-key")
+	if explicitHashKey == "" {
+		return nil, nil
+	}
+
+	hashKey, ok := new(big.Int).SetString(explicitHashKey, 10)
+	if !ok || hashKey.Sign() < 0 || hashKey.BitLen() > 128 {
+		return nil, fmt.Errorf("explicit hash key must be an integer between 0 and 2^128-1")
+	}
+
+	return &explicitHashKey, nil
+}
+
+func randomPartitionKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
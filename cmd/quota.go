@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/spf13/cobra"
+)
+
+type RegionQuotas struct {
+	Region string       `json:"region"`
+	Quotas []QuotaUsage `json:"quotas"`
+	Error  string       `json:"error,omitempty"`
+
+	// ServiceQuotasError is set if Service Quotas couldn't be read, leaving only the quotas
+	// DescribeLimits reports on
+	ServiceQuotasError string `json:"service_quotas_error,omitempty"`
+}
+
+type QuotaUsage struct {
+	Name  string  `json:"name"`
+	Code  string  `json:"code,omitempty"`
+	Limit float64 `json:"limit"`
+	// Usage is only known for the quotas DescribeLimits reports on
+	Usage      *float64 `json:"usage,omitempty"`
+	Adjustable bool     `json:"adjustable"`
+	// Applied is set when the account's value differs from the AWS default
+	Applied bool `json:"applied"`
+}
+
+func init() {
+	quotaCmd.Flags().StringSlice("regions", nil, "Regions to report on; defaults to the configured region")
+	quotaCmd.Flags().Int("add-shards", 0, "Shards a planned scale-up will add, to check it fits within the shard quota")
+	quotaCmd.Flags().Float64("threshold", 80, "Warn when usage, including --add-shards, reaches this percentage of a quota")
+	quotaCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	rootCmd.AddCommand(quotaCmd)
+}
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show the account's Kinesis quotas and how much of them is used",
+	Long: `Lists the account's Kinesis quotas in each region from Service Quotas, with current usage from
+DescribeLimits for the shard and on-demand stream quotas, and warns about any quota whose usage
+has reached --threshold percent of it.
+
+Before a scale-up, pass the number of shards it will add with --add-shards: the command exits
+non-zero if they wouldn't fit within the shard quota, so the increase can be requested first.
+
+Example:
+  kin quota --regions us-east-1,eu-west-1 --add-shards 64`,
+	Run: runQuotaCmd,
+}
+
+func runQuotaCmd(cmd *cobra.Command, args []string) {
+	regions, _ := cmd.Flags().GetStringSlice("regions")
+	addShards, _ := cmd.Flags().GetInt("add-shards")
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if len(regions) == 0 {
+		// The configured region, whatever it is
+		regions = []string{""}
+	}
+
+	reports := make([]RegionQuotas, len(regions))
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = getRegionQuotas(cmd.Context(), region)
+		}()
+	}
+	wg.Wait()
+
+	var warnings []string
+	wontFit := false
+	for _, report := range reports {
+		if report.Error != "" {
+			continue
+		}
+		for _, quota := range report.Quotas {
+			if quota.Usage == nil || quota.Limit <= 0 {
+				continue
+			}
+			usage := *quota.Usage
+			if quota.Code == "shards" {
+				usage += float64(addShards)
+				if usage > quota.Limit {
+					wontFit = true
+					warnings = append(warnings, fmt.Sprintf(
+						"%s: %.0f open shards and %d more would exceed the limit of %.0f",
+						report.Region, *quota.Usage, addShards, quota.Limit,
+					))
+					continue
+				}
+			}
+			if percent := 100 * usage / quota.Limit; percent >= threshold {
+				warnings = append(warnings, fmt.Sprintf("%s: %s at %.0f%% (%.0f of %.0f)", report.Region, quota.Name, percent, usage, quota.Limit))
+			}
+		}
+	}
+
+	if output == "json" {
+		printJSON(reports)
+	} else {
+		rows := [][]string{}
+		for _, report := range reports {
+			if report.Error != "" {
+				continue
+			}
+			for _, quota := range report.Quotas {
+				usage, percent := "-", "-"
+				if quota.Usage != nil {
+					usage = fmt.Sprintf("%.0f", *quota.Usage)
+					if quota.Limit > 0 {
+						percent = fmt.Sprintf("%.0f%%", 100**quota.Usage/quota.Limit)
+					}
+				}
+				adjustable := "no"
+				if quota.Adjustable {
+					adjustable = "yes"
+				}
+				limit := fmt.Sprintf("%g", quota.Limit)
+				if quota.Applied {
+					limit += " (applied)"
+				}
+				rows = append(rows, []string{report.Region, quota.Name, usage, limit, percent, adjustable})
+			}
+		}
+		printTable(os.Stdout, []string{"REGION", "QUOTA", "USAGE", "LIMIT", "USED", "ADJUSTABLE"}, rows)
+	}
+
+	for _, report := range reports {
+		if report.ServiceQuotasError != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: couldn't list quotas from Service Quotas: %s", report.Region, report.ServiceQuotasError))
+		}
+	}
+	for _, warning := range warnings {
+		cmd.PrintErrln("Warning:", warning)
+	}
+	failed := false
+	for _, report := range reports {
+		if report.Error != "" {
+			cmd.PrintErrf("%s: %s\n", report.Region, report.Error)
+			failed = true
+		}
+	}
+	if failed || wontFit {
+		os.Exit(1)
+	}
+}
+
+// getRegionQuotas reports on a region's quotas, or the configured region's if region is "".
+// Errors are returned in the report so that other regions can still be shown.
+func getRegionQuotas(ctx context.Context, region string) RegionQuotas {
+	var cfgOptFns []func(*config.LoadOptions) error
+	if region != "" {
+		cfgOptFns = append(cfgOptFns, config.WithRegion(region))
+	}
+	report := RegionQuotas{Region: region, Quotas: []QuotaUsage{}}
+
+	quotasClient, err := aws.GetServiceQuotasClient(cfgOptFns...)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Region = quotasClient.Region()
+
+	client, err := aws.GetKinesisClientWithConfig(cfgOptFns...)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	limits, err := client.DescribeLimits(ctx, &kinesis.DescribeLimitsInput{})
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	// DescribeLimits covers the quotas with usage that matters before scaling
+	openShards := float64(awssdk.ToInt32(limits.OpenShardCount))
+	onDemandStreams := float64(awssdk.ToInt32(limits.OnDemandStreamCount))
+	report.Quotas = append(report.Quotas,
+		QuotaUsage{Name: "Open shards", Code: "shards", Limit: float64(awssdk.ToInt32(limits.ShardLimit)), Usage: &openShards, Adjustable: true},
+		QuotaUsage{Name: "On-demand streams", Code: "on-demand-streams", Limit: float64(awssdk.ToInt32(limits.OnDemandStreamCountLimit)), Usage: &onDemandStreams, Adjustable: true},
+	)
+
+	// Service Quotas has the rest, along with whether they've been raised. Not every account can
+	// call it, and the usage above is still worth showing without it.
+	quotas, err := quotasClient.ListQuotas(ctx, "kinesis")
+	if err != nil {
+		report.ServiceQuotasError = err.Error()
+		return report
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].QuotaName < quotas[j].QuotaName })
+	for _, quota := range quotas {
+		// Service Quotas' own shard quota is the one DescribeLimits already reported
+		if strings.EqualFold(quota.QuotaName, "Shards per Region") {
+			report.Quotas[0].Applied = quota.Applied
+			continue
+		}
+		report.Quotas = append(report.Quotas, QuotaUsage{
+			Name:       quota.QuotaName,
+			Code:       quota.QuotaCode,
+			Limit:      quota.Value,
+			Adjustable: quota.Adjustable,
+			Applied:    quota.Applied,
+		})
+	}
+	return report
+}
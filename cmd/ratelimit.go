@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/tailer"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+)
+
+// getRecordsRate is --get-records-rate, the most GetRecords calls made per second on each shard
+var getRecordsRate = tailer.DefaultGetRecordsRate
+
+// configureGetRecordsRate applies --get-records-rate to every shard read.
+func configureGetRecordsRate(cmd *cobra.Command) error {
+	perSecond, _ := cmd.Flags().GetFloat64("get-records-rate")
+	if perSecond < 0 {
+		return fmt.Errorf("--get-records-rate can't be negative")
+	}
+	getRecordsRate = perSecond
+	return nil
+}
+
+// newGetRecordsLimiter returns a limiter pacing GetRecords calls on one shard to
+// --get-records-rate, for commands reading shards without a Tailer.
+func newGetRecordsLimiter() *rate.Limiter {
+	return tailer.NewGetRecordsLimiter(getRecordsRate)
+}
+
+// Units accepted by --bytes-rate. Kinesis documents its limits in binary megabytes, so these are
+// powers of 1024 regardless of spelling.
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// WriteLimiter paces writes to a stream by record count and/or bytes. A nil limiter for either
+// dimension means that dimension is unlimited.
+type WriteLimiter struct {
+	records *rate.Limiter
+	bytes   *rate.Limiter
+}
+
+func addRateLimitFlags(flags *pflag.FlagSet) {
+	flags.String("rate", "", "Maximum records written per second (ex: 1000/s, 500/m)")
+	flags.String("bytes-rate", "", "Maximum bytes written per second (ex: 1MB/s, 512KB/s)")
+}
+
+// NewWriteLimiterFromFlags builds a WriteLimiter from --rate and --bytes-rate.
+func NewWriteLimiterFromFlags(flags *pflag.FlagSet) (*WriteLimiter, error) {
+	rateS, err := flags.GetString("rate")
+	if err != nil {
+		return nil, err
+	}
+
+	bytesRateS, err := flags.GetString("bytes-rate")
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := &WriteLimiter{}
+
+	if rateS != "" {
+		perSecond, err := parseRate(rateS, func(s string) (float64, error) {
+			return strconv.ParseFloat(s, 64)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid --rate: %w", err)
+		}
+		limiter.records = rate.NewLimiter(rate.Limit(perSecond), max(1, int(perSecond)))
+	}
+
+	if bytesRateS != "" {
+		perSecond, err := parseRate(bytesRateS, parseByteSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --bytes-rate: %w", err)
+		}
+
+		// The burst has to allow at least one maximum-size record through, or it could never be
+		// written at all
+		limiter.bytes = rate.NewLimiter(rate.Limit(perSecond), max(maxRecordSize, int(perSecond)))
+	}
+
+	return limiter, nil
+}
+
+// Wait blocks until a record of the given size may be written.
+func (l *WriteLimiter) Wait(ctx context.Context, size int) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.records != nil {
+		if err := l.records.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.bytes != nil {
+		if err := l.bytes.WaitN(ctx, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRate parses "<amount>/<unit>" where unit is s, m or h (defaulting to per second),
+// returning the rate per second.
+func parseRate(s string, parseAmount func(string) (float64, error)) (float64, error) {
+	amountS, unit, _ := strings.Cut(strings.TrimSpace(s), "/")
+
+	amount, err := parseAmount(strings.TrimSpace(amountS))
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("rate must be a finite number")
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("rate must be positive")
+	}
+
+	var per time.Duration
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "", "s", "sec":
+		per = time.Second
+	case "m", "min":
+		per = time.Minute
+	case "h", "hr":
+		per = time.Hour
+	default:
+		return 0, fmt.Errorf("unknown rate unit %q", unit)
+	}
+
+	return amount / per.Seconds(), nil
+}
+
+// parseByteSize parses sizes like 512, 64KB or 1.5MB.
+func parseByteSize(s string) (float64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	amount, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", s[i:])
+	}
+
+	return amount * unit, nil
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	parseFloat := func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+
+	for s, want := range map[string]float64{
+		"5":       5,
+		"10/s":    10,
+		"120/min": 2,
+		"36/h":    0.01,
+	} {
+		got, err := parseRate(s, parseFloat)
+		if err != nil || got != want {
+			t.Errorf("parseRate(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"0/s", "-1", "NaN/s", "Inf", "-inf/m", "1e400", "5/day", "fast"} {
+		if got, err := parseRate(s, parseFloat); err == nil {
+			t.Errorf("parseRate(%q) = %v; want an error", s, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"math/big"
+	"os"
+	"slices"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// rebalanceStep adds (split) or removes (merge) the shard boundary at hashKey: the starting hash
+// key of the shard above it.
+type rebalanceStep struct {
+	split   bool
+	hashKey *big.Int
+}
+
+func (s rebalanceStep) String() string {
+	if s.split {
+		return fmt.Sprintf("split at %s", s.hashKey)
+	}
+	return fmt.Sprintf("merge at %s", s.hashKey)
+}
+
+func init() {
+	rebalanceCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	rebalanceCmd.Flags().Int32("shards", 0, "Number of evenly sized shards to end up with; defaults to the current open shard count")
+	rebalanceCmd.Flags().Float64("tolerance", 1, "Leave shard boundaries within this percentage of the key space of where they should be")
+	rebalanceCmd.Flags().Bool("dry-run", false, "Print the splits and merges that would be made without making them")
+	rebalanceCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(rebalanceCmd)
+}
+
+var rebalanceCmd = &cobra.Command{
+	Use:   "rebalance",
+	Short: "Even out the hash key ranges of a stream's shards",
+	Long: `Splits and merges shards until the hash key space is divided evenly between them, as it would be
+after UpdateShardCount. Use this after splitting individual hot shards has left the ranges lopsided.
+
+Every shard boundary that isn't where it should be takes one merge to remove, and every missing
+boundary one split to add, so kin makes exactly as many changes as are needed. Boundaries within
+--tolerance of their ideal position are left alone. Kinesis allows only one reshard at a time, so
+each step waits for the stream to become ACTIVE before starting the next.`,
+	Run: runRebalanceCmd,
+}
+
+func runRebalanceCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	target, _ := cmd.Flags().GetInt32("shards")
+	tolerance, _ := cmd.Flags().GetFloat64("tolerance")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary := output.StreamDescriptionSummary
+	if summary.StreamModeDetails != nil && summary.StreamModeDetails.StreamMode == types.StreamModeOnDemand {
+		cmd.PrintErrf("%s is on-demand, and manages its own shards\n", streamName)
+		os.Exit(1)
+	}
+	if target == 0 {
+		target = awssdk.ToInt32(summary.OpenShardCount)
+	}
+	if target < 1 {
+		cmd.PrintErrln("--shards must be at least 1")
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	steps := planRebalance(shards, int(target), tolerance)
+	if len(steps) == 0 {
+		cmd.PrintErrf("%s is already balanced\n", streamName)
+		return
+	}
+
+	cmd.PrintErrf("Rebalancing %s into %d shards takes %d steps:\n", streamName, target, len(steps))
+	for i, step := range steps {
+		cmd.PrintErrf("  %d. %s\n", i+1, step)
+	}
+	if dryRun {
+		return
+	}
+
+	for _, step := range steps {
+		if err := applyRebalanceStep(cmd.Context(), client, streamName, step); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+
+	if err := printOpenShardMap(cmd, client, streamName); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// planRebalance returns the splits and merges that move the open shards' boundaries to those of
+// target evenly sized shards. Merges and splits are interleaved so that the shard count stays
+// close to where it started throughout.
+func planRebalance(shards []types.Shard, target int, tolerance float64) []rebalanceStep {
+	var current []*big.Int
+	for _, shard := range shards {
+		start, _ := shardHashRange(shard)
+		if isOpenShard(shard) && start.Sign() > 0 {
+			current = append(current, start)
+		}
+	}
+	slices.SortFunc(current, (*big.Int).Cmp)
+
+	var ideal []*big.Int
+	for i := 1; i < target; i++ {
+		boundary := new(big.Int).Mul(hashKeySpace, big.NewInt(int64(i)))
+		ideal = append(ideal, boundary.Div(boundary, big.NewInt(int64(target))))
+	}
+
+	// tolerance is a percentage of the whole key space
+	slack, _ := new(big.Float).Mul(
+		new(big.Float).SetInt(hashKeySpace),
+		big.NewFloat(tolerance/100),
+	).Int(nil)
+
+	// Both lists are sorted, so walk them together, keeping any current boundary close enough to
+	// an ideal one
+	var merges, splits []rebalanceStep
+	i, j := 0, 0
+	for i < len(current) || j < len(ideal) {
+		switch {
+		case j == len(ideal):
+			merges = append(merges, rebalanceStep{hashKey: current[i]})
+			i++
+		case i == len(current):
+			splits = append(splits, rebalanceStep{split: true, hashKey: ideal[j]})
+			j++
+		case new(big.Int).Abs(new(big.Int).Sub(current[i], ideal[j])).Cmp(slack) <= 0:
+			i++
+			j++
+		case current[i].Cmp(ideal[j]) < 0:
+			merges = append(merges, rebalanceStep{hashKey: current[i]})
+			i++
+		default:
+			splits = append(splits, rebalanceStep{split: true, hashKey: ideal[j]})
+			j++
+		}
+	}
+
+	var steps []rebalanceStep
+	for k := 0; k < max(len(merges), len(splits)); k++ {
+		if k < len(merges) {
+			steps = append(steps, merges[k])
+		}
+		if k < len(splits) {
+			steps = append(steps, splits[k])
+		}
+	}
+	return steps
+}
+
+// applyRebalanceStep finds the shards on either side of the step's boundary as they are now, and
+// splits or merges them.
+func applyRebalanceStep(ctx context.Context, client aws.KinesisAPI, streamName string, step rebalanceStep) error {
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return err
+	}
+
+	if step.split {
+		shard := shardForHashKey(shards, step.hashKey)
+		if shard == nil {
+			return fmt.Errorf("no open shard covers hash key %s", step.hashKey)
+		}
+		return splitShard(ctx, client, streamName, *shard, step.hashKey)
+	}
+
+	below := shardForHashKey(shards, new(big.Int).Sub(step.hashKey, big.NewInt(1)))
+	above := shardForHashKey(shards, step.hashKey)
+	if below == nil || above == nil {
+		return fmt.Errorf("no open shards on either side of hash key %s", step.hashKey)
+	}
+	return mergeShards(ctx, client, streamName, *below, *above)
+}
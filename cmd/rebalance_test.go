@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// testShards returns open shards whose hash key ranges start at each of starts, which must begin
+// with 0 and be in order.
+func testShards(starts ...*big.Int) []types.Shard {
+	var shards []types.Shard
+	for i, start := range starts {
+		end := new(big.Int).Sub(hashKeySpace, big.NewInt(1))
+		if i+1 < len(starts) {
+			end.Sub(starts[i+1], big.NewInt(1))
+		}
+		shards = append(shards, types.Shard{
+			ShardId: awssdk.String(fmt.Sprintf("shardId-%012d", i)),
+			HashKeyRange: &types.HashKeyRange{
+				StartingHashKey: awssdk.String(start.String()),
+				EndingHashKey:   awssdk.String(end.String()),
+			},
+			SequenceNumberRange: &types.SequenceNumberRange{StartingSequenceNumber: awssdk.String("0")},
+		})
+	}
+	return shards
+}
+
+// fraction returns the hash key n/d of the way through the key space.
+func fraction(n, d int64) *big.Int {
+	key := new(big.Int).Mul(hashKeySpace, big.NewInt(n))
+	return key.Div(key, big.NewInt(d))
+}
+
+func TestPlanRebalance(t *testing.T) {
+	// 1% of the key space away from a quarter of it
+	nearQuarter := new(big.Int).Add(fraction(1, 4), fraction(1, 100))
+
+	tests := []struct {
+		name      string
+		shards    []types.Shard
+		target    int
+		tolerance float64
+		want      []string
+	}{
+		{
+			name:   "balanced",
+			shards: testShards(fraction(0, 4), fraction(1, 4), fraction(2, 4), fraction(3, 4)),
+			target: 4,
+		},
+		{
+			name:   "split one shard",
+			shards: testShards(fraction(0, 1)),
+			target: 4,
+			want: []string{
+				"split at " + fraction(1, 4).String(),
+				"split at " + fraction(2, 4).String(),
+				"split at " + fraction(3, 4).String(),
+			},
+		},
+		{
+			name:   "merge into halves",
+			shards: testShards(fraction(0, 4), fraction(1, 4), fraction(2, 4), fraction(3, 4)),
+			target: 2,
+			want: []string{
+				"merge at " + fraction(1, 4).String(),
+				"merge at " + fraction(3, 4).String(),
+			},
+		},
+		{
+			name:   "uneven into thirds",
+			shards: testShards(fraction(0, 4), fraction(1, 4), fraction(2, 4)),
+			target: 3,
+			want: []string{
+				"merge at " + fraction(1, 4).String(),
+				"split at " + fraction(1, 3).String(),
+				"merge at " + fraction(2, 4).String(),
+				"split at " + fraction(2, 3).String(),
+			},
+		},
+		{
+			name:      "within tolerance",
+			shards:    testShards(fraction(0, 4), nearQuarter, fraction(2, 4), fraction(3, 4)),
+			target:    4,
+			tolerance: 2,
+		},
+		{
+			name:      "outside tolerance",
+			shards:    testShards(fraction(0, 4), nearQuarter, fraction(2, 4), fraction(3, 4)),
+			target:    4,
+			tolerance: 0.5,
+			want: []string{
+				"merge at " + nearQuarter.String(),
+				"split at " + fraction(1, 4).String(),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, step := range planRebalance(test.shards, test.target, test.tolerance) {
+				got = append(got, step.String())
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("planRebalance = %q; want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanRebalanceIgnoresClosedShards(t *testing.T) {
+	shards := testShards(fraction(0, 2), fraction(1, 2))
+	// A parent shard split before, which still shows up in ListShards
+	closed := testShards(fraction(0, 1))[0]
+	closed.ShardId = awssdk.String("shardId-closed")
+	closed.SequenceNumberRange.EndingSequenceNumber = awssdk.String("1")
+	shards = append(shards, closed)
+
+	if steps := planRebalance(shards, 2, 0); len(steps) != 0 {
+		t.Errorf("planRebalance = %v; want no steps", steps)
+	}
+}
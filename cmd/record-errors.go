@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"kin/pkg/transform"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/pflag"
+)
+
+// The kinds of failure an errorPolicy handles, each a stage records go through
+const (
+	errDecode    = "decode"
+	errTransform = "transform"
+	errFilter    = "filter"
+	errWrite     = "write"
+)
+
+// addErrorPolicyFlags registers --strict and --skip-errors, for commands that read records and
+// write them somewhere.
+func addErrorPolicyFlags(flags *pflag.FlagSet) {
+	flags.Bool("strict", false, "Stop and exit non-zero at the first record that fails to decode, transform, filter or be written")
+	flags.Bool("skip-errors", false, "Leave out records that fail to decode, transform, filter or be written, and summarize how many did at the end")
+}
+
+// errorPolicy is how a command treats records that fail to decode, transform, filter or be written.
+// By default each command carries on as it always has, which depends on the command; --strict
+// stops at the first failure, and --skip-errors leaves the record out and counts it. A nil
+// errorPolicy is the default. It's safe for concurrent use.
+type errorPolicy struct {
+	strict bool
+	skip   bool
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// errorPolicyFromFlags returns the policy given with addErrorPolicyFlags's flags.
+func errorPolicyFromFlags(flags *pflag.FlagSet) (*errorPolicy, error) {
+	strict, err := flags.GetBool("strict")
+	if err != nil {
+		return nil, err
+	}
+
+	skip, err := flags.GetBool("skip-errors")
+	if err != nil {
+		return nil, err
+	}
+
+	if strict && skip {
+		return nil, errors.New("--strict and --skip-errors are mutually exclusive")
+	}
+	return &errorPolicy{strict: strict, skip: skip, counts: map[string]int{}}, nil
+}
+
+// recordError is a record's failure that stopped a command under --strict.
+type recordError struct {
+	kind           string
+	shardId        string
+	sequenceNumber string
+	err            error
+}
+
+func (e *recordError) Error() string {
+	return fmt.Sprintf("%s: record %s failed to %s: %s", e.shardId, e.sequenceNumber, e.kind, e.err)
+}
+
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// Strict reports whether the first failure stops the command.
+func (p *errorPolicy) Strict() bool {
+	return p != nil && p.strict
+}
+
+// Skipping reports whether records that fail are left out and counted.
+func (p *errorPolicy) Skipping() bool {
+	return p != nil && p.skip
+}
+
+// Lenient reports whether failures are left to each command, as without either flag.
+func (p *errorPolicy) Lenient() bool {
+	return !p.Strict() && !p.Skipping()
+}
+
+// Handle is told that record failed at the given stage. It returns an error the command should
+// stop with under --strict, and whether to leave the record out under --skip-errors; if neither,
+// the command carries on as it would by default. Errors that already stopped the command are
+// returned as they are, so that a failure isn't reported again by each stage it passes up through.
+func (p *errorPolicy) Handle(kind string, record *RecordOutput, err error) (skip bool, stop error) {
+	var stopped *recordError
+	if errors.As(err, &stopped) {
+		return false, stopped
+	}
+
+	switch {
+	case p.Strict():
+		return false, &recordError{
+			kind:           kind,
+			shardId:        awssdk.ToString(record.ShardId),
+			sequenceNumber: awssdk.ToString(record.SequenceNumber),
+			err:            err,
+		}
+
+	case p.Skipping():
+		slog.Debug(
+			"skipping record",
+			"shard", awssdk.ToString(record.ShardId),
+			"sequenceNumber", awssdk.ToString(record.SequenceNumber),
+			"stage", kind,
+			"error", err,
+		)
+		p.Count(kind, 1)
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// Count counts records left out after failing at the given stage, for failures found other than
+// through Handle, such as records a producer gave up on.
+func (p *errorPolicy) Count(kind string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counts[kind] += n
+}
+
+// Stage wraps a transform stage so that records it fails on are handled by the policy: left out
+// under --skip-errors, and otherwise failing as they would anyway, stopping the command.
+func (p *errorPolicy) Stage(kind string, stage transform.Func) transform.Func {
+	return func(ctx context.Context, record *RecordOutput) (*RecordOutput, error) {
+		transformed, err := stage(ctx, record)
+		if err == nil {
+			return transformed, nil
+		}
+
+		skip, stop := p.Handle(kind, record, err)
+		if skip {
+			return nil, nil
+		}
+		if stop != nil {
+			return nil, stop
+		}
+		return nil, err
+	}
+}
+
+// Skipped returns how many records were left out.
+func (p *errorPolicy) Skipped() int {
+	if !p.Skipping() {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	for _, count := range p.counts {
+		total += count
+	}
+	return total
+}
+
+// Summarize writes how many records were left out, and why, if any were.
+func (p *errorPolicy) Summarize(w io.Writer) {
+	if !p.Skipping() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	var kinds []string
+	for kind, count := range p.counts {
+		if count > 0 {
+			total += count
+			kinds = append(kinds, kind)
+		}
+	}
+	if total == 0 {
+		return
+	}
+	sort.Strings(kinds)
+
+	counts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		counts[i] = fmt.Sprintf("%d failed to %s", p.counts[kind], kind)
+	}
+	fmt.Fprintf(w, "Skipped %d records: %s\n", total, strings.Join(counts, ", "))
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/pflag"
+)
+
+// The record output types live in pkg/sink, which writes them, but are built throughout the
+// commands
+type (
+	RecordOutput    = sink.RecordOutput
+	TimestampFormat = sink.TimestampFormat
+)
+
+// addRecordOutputFlags registers the flags controlling how records are printed, shared by every
+// command that reads from a stream.
+func addRecordOutputFlags(flags *pflag.FlagSet) {
+	flags.Bool("no-data", false, "Skip decoding record payloads and only output record metadata")
+	flags.String("timestamp-format", "rfc3339nano", "Format for output timestamps: rfc3339, rfc3339nano, rfc1123, datetime, unix, unix-millis, unix-nano, or a Go time layout")
+	flags.Bool("include-raw", false, "Include the raw base64-encoded payload of every record alongside the decoded data")
+	flags.String("field-case", "snake", "Naming convention for output field names: snake or camel")
+	flags.Bool("local-time", false, "Output timestamps in the local timezone instead of UTC")
+	flags.String("decode", "", "Comma-separated chain of decoders to apply to each payload, each optionally followed by :<argument> (ex: gzip,json or kpl,avro:order.avsc); available: "+strings.Join(decode.Names(), ", "))
+	flags.Bool("preserve-key-order", false, "Output the fields of JSON payloads in the order they were in rather than sorted; with --decode, use json:ordered or auto:ordered instead")
+}
+
+// parseRecordOutputOpts reads the flags registered by addRecordOutputFlags into tailOptions.
+func parseRecordOutputOpts(flags *pflag.FlagSet, tailOptions *TailOptions) error {
+	noData, err := flags.GetBool("no-data")
+	if err != nil {
+		return err
+	}
+
+	timestampFormatName, err := flags.GetString("timestamp-format")
+	if err != nil {
+		return err
+	}
+
+	localTime, err := flags.GetBool("local-time")
+	if err != nil {
+		return err
+	}
+
+	timestampFormat, err := sink.ParseTimestampFormat(timestampFormatName, localTime)
+	if err != nil {
+		return err
+	}
+
+	includeRaw, err := flags.GetBool("include-raw")
+	if err != nil {
+		return err
+	}
+
+	fieldCase, err := flags.GetString("field-case")
+	if err != nil {
+		return err
+	}
+	if fieldCase != "snake" && fieldCase != "camel" {
+		return fmt.Errorf("unknown field case %q; expected snake or camel", fieldCase)
+	}
+
+	preserveKeyOrder, err := flags.GetBool("preserve-key-order")
+	if err != nil {
+		return err
+	}
+
+	decodeSpec, err := flags.GetString("decode")
+	if err != nil {
+		return err
+	}
+	if decodeSpec != "" {
+		tailOptions.Decoder, err = decode.New(decodeSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	tailOptions.NoData = noData
+	tailOptions.TimestampFormat = timestampFormat
+	tailOptions.IncludeRaw = includeRaw
+	tailOptions.FieldCase = fieldCase
+	tailOptions.PreserveKeyOrder = preserveKeyOrder
+	return nil
+}
+
+// newRecordOutput converts a record read from shardId into its output form, decoding the payload
+// unless tailOptions.NoData is set.
+func newRecordOutput(
+	shardId *string,
+	record types.Record,
+	millisBehindLatest *int64,
+	tailOptions *TailOptions,
+	logger *slog.Logger,
+) RecordOutput {
+	size := len(record.Data)
+	output := RecordOutput{
+		ShardId:                     shardId,
+		PartitionKey:                record.PartitionKey,
+		SequenceNumber:              record.SequenceNumber,
+		ApproximateArrivalTimestamp: sink.NewTimestamp(record.ApproximateArrivalTimestamp, tailOptions.TimestampFormat),
+		EncryptionType:              record.EncryptionType,
+		MillisBehindLatest:          millisBehindLatest,
+		Size:                        &size,
+	}
+
+	if tailOptions.IncludeRaw {
+		output.RawData = record.Data
+	}
+
+	// In metadata-only mode, skip decoding entirely
+	if !tailOptions.NoData {
+		var data interface{} = record.Data
+		if tailOptions.Decoder != nil {
+			decoded, err := tailOptions.Decoder.Decode(record.Data)
+			if err != nil {
+				// Commands with --strict or --skip-errors don't output it at all
+				if tailOptions.Errors.Lenient() {
+					logger.Warn(
+						"failed to decode record; outputting it undecoded",
+						"sequenceNumber", *record.SequenceNumber,
+						"error", err,
+					)
+				}
+				output.DecodeErr = err
+			} else {
+				data = decoded
+			}
+		}
+
+		data = decodeFallback(data, *record.SequenceNumber, tailOptions.PreserveKeyOrder, logger)
+		output.Data = &data
+	}
+
+	return output
+}
+
+// decodeFallback decodes payloads that are still bytes, whether because no decoder was given or
+// because the decoders only unwrapped them, as JSON, or failing that plain text, or failing that
+// base64-encoded binary. JSON objects are decoded as *decode.Object if ordered is set.
+func decodeFallback(value interface{}, sequenceNumber string, ordered bool, logger *slog.Logger) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		decodeJSON := decode.JSON
+		if ordered {
+			decodeJSON = decode.JSONOrdered
+		}
+
+		data, err := decodeJSON(v)
+		if err != nil {
+			if decode.IsPrintableText(v) {
+				logger.Debug(
+					"record is not JSON; falling back to text",
+					"sequenceNumber", sequenceNumber,
+					"error", err,
+				)
+				data = string(v)
+			} else {
+				logger.Debug(
+					"record is not JSON; falling back to base64",
+					"sequenceNumber", sequenceNumber,
+					"error", err,
+				)
+				data = v
+			}
+		}
+		return data
+
+	case []interface{}:
+		// Payloads split into several, such as KPL aggregates, may still hold bytes
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = decodeFallback(item, sequenceNumber, ordered, logger)
+		}
+		return items
+
+	default:
+		return value
+	}
+}
@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kin/pkg/aws"
+	"kin/pkg/producer"
+	"kin/pkg/sink"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Export lines hold a record's payload twice, decoded and base64-encoded, so they can be several
+// times the size of the largest record
+const replayMaxLineSize = 8 * maxRecordSize
+
+func init() {
+	replayCmd.Flags().StringP("stream-name", "n", "", "Stream name to publish to (required)")
+	replayCmd.Flags().StringP("file", "f", "", "Export directory, or NDJSON file of records (gzipped if it ends in .gz), to replay; reads stdin if not given")
+	replayCmd.Flags().String("speed", "max", "Pacing: realtime, a multiple of it (ex: 2x), or max to publish as fast as the stream allows")
+	replayCmd.Flags().Int("max-attempts", 5, "Maximum number of attempts to write each record before giving up on it")
+	addCELTransformFlag(replayCmd.Flags())
+	addRateLimitFlags(replayCmd.Flags())
+	replayCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(replayCmd)
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Publish exported records to a stream again",
+	Long: `Reads records written by export, or by tail with --include-raw, and publishes them to a stream
+with their original partition keys and payloads, using PutRecords with retries as put-batch does.
+
+Given an export directory, replay reads the files listed in its manifest an hour at a time,
+merging the shards of each hour in the order records arrived. Otherwise it reads one NDJSON file,
+or stdin, in order.
+
+With --speed realtime, records are published with the same gaps between them as when they first
+arrived, going by their approximate_arrival_timestamp; 2x halves the gaps, and max publishes as
+fast as the stream and any rate limit allow. Records without raw_data have their decoded data
+published instead, which may not be byte-for-byte identical to the original. A summary is printed
+when done, and the command exits non-zero if any records could not be read or written.
+
+--transform rewrites each payload with a CEL expression before it's published, as copy does.
+
+Example:
+  kin export -n orders --from 2h --until 1h --out orders/
+  kin replay -n orders-fixed -f orders/ --speed 4x`,
+	Run: runReplayCmd,
+}
+
+func runReplayCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	file, _ := cmd.Flags().GetString("file")
+	speedS, _ := cmd.Flags().GetString("speed")
+	maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+
+	speed, err := parseReplaySpeed(speedS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	stage, err := celTransformFromFlags(cmd.Flags())
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	groups, err := replayFileGroups(file)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	opts, err := producerOptions(cmd)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	p := producer.New(client, streamName, append(opts, producer.WithMaxAttempts(maxAttempts))...)
+	pacer := &replayPacer{speed: speed}
+
+	for _, group := range groups {
+		err := replayFiles(group, func(record *replayRecord) {
+			if record.err == nil && speed > 0 && record.arrival.IsZero() {
+				record.err = errors.New("no approximate_arrival_timestamp to pace by")
+			}
+			if record.err != nil {
+				cmd.PrintErrf("%s:%d: %v\n", record.source, record.line, record.err)
+				p.CountFailure("InvalidRecord", 1)
+				return
+			}
+
+			if stage != nil {
+				output := &RecordOutput{PartitionKey: &record.partitionKey}
+				if !record.arrival.IsZero() {
+					output.ApproximateArrivalTimestamp = sink.NewTimestamp(&record.arrival, nil)
+				}
+
+				data, ok, err := transformPayload(cmd.Context(), stage, output, record.data)
+				if err != nil {
+					cmd.PrintErrf("%s:%d: --transform: %v\n", record.source, record.line, err)
+					p.CountFailure("TransformFailed", 1)
+					return
+				}
+				if !ok {
+					return
+				}
+				record.data = data
+			}
+
+			if wait := pacer.Delay(record.arrival); wait > 0 {
+				// Send what's due before waiting, so that records aren't held back by later ones
+				p.Flush(cmd.Context())
+				aws.SleepContext(cmd.Context(), wait)
+			}
+			p.Add(cmd.Context(), producer.Record{PartitionKey: record.partitionKey, Data: record.data})
+		})
+		if err != nil {
+			p.Flush(cmd.Context())
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+	p.Flush(cmd.Context())
+
+	summary := p.Summary()
+	jsonBytes, _ := json.Marshal(summary)
+	fmt.Println(string(jsonBytes))
+
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseReplaySpeed returns how many times faster than realtime to replay, or 0 for as fast as
+// possible.
+func parseReplaySpeed(s string) (float64, error) {
+	switch s {
+	case "max":
+		return 0, nil
+	case "realtime":
+		return 1, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || !strings.HasSuffix(s, "x") || speed <= 0 {
+		return 0, fmt.Errorf("invalid --speed %q: must be realtime, a multiple like 2x, or max", s)
+	}
+	return speed, nil
+}
+
+// replayFileGroups returns the files to replay, grouped so that the files in a group are merged by
+// arrival time and the groups are replayed one after another. An export directory has a group per
+// hour; anything else is a single file, where "" and "-" are stdin.
+func replayFileGroups(file string) ([][]string, error) {
+	if file == "" || file == "-" {
+		return [][]string{{"-"}}, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return [][]string{{file}}, nil
+	}
+
+	manifest, err := readExportManifest(file)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Format != "ndjson" {
+		return nil, fmt.Errorf("%s is a %s export; only ndjson exports can be replayed", file, manifest.Format)
+	}
+
+	// Manifest paths are sorted, and start with the date and hour
+	var groups [][]string
+	lastDir := ""
+	for _, exported := range manifest.Files {
+		if dir := path.Dir(exported.Path); dir != lastDir || len(groups) == 0 {
+			groups = append(groups, nil)
+			lastDir = dir
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], filepath.Join(file, filepath.FromSlash(exported.Path)))
+	}
+	return groups, nil
+}
+
+// replayRecord is a record read back from a file. Lines that can't be replayed are returned with
+// err set, so that they can be reported and counted.
+type replayRecord struct {
+	partitionKey string
+	data         []byte
+	arrival      time.Time
+
+	source string
+	line   int
+	err    error
+}
+
+// replayFiles reads every file and calls fn with their records, merged in arrival order. Each file
+// is assumed to be in arrival order already, as the records of a shard are.
+func replayFiles(files []string, fn func(record *replayRecord)) error {
+	var readers []*replayReader
+	defer func() {
+		for _, reader := range readers {
+			reader.Close()
+		}
+	}()
+
+	var heads []*replayRecord
+	for _, file := range files {
+		reader, err := newReplayReader(file)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, reader)
+
+		head, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		heads = append(heads, head)
+	}
+
+	for {
+		next := -1
+		for i, head := range heads {
+			if head != nil && (next < 0 || head.arrival.Before(heads[next].arrival)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+
+		fn(heads[next])
+
+		var err error
+		heads[next], err = readers[next].Next()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type replayReader struct {
+	name    string
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newReplayReader(name string) (*replayReader, error) {
+	if name == "-" {
+		reader := &replayReader{name: "stdin", scanner: bufio.NewScanner(os.Stdin)}
+		reader.scanner.Buffer(make([]byte, 64*1024), replayMaxLineSize)
+		return reader, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var input io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		input = gz
+	}
+
+	reader := &replayReader{name: name, file: file, scanner: bufio.NewScanner(input)}
+	reader.scanner.Buffer(make([]byte, 64*1024), replayMaxLineSize)
+	return reader, nil
+}
+
+// Next returns the next record, or nil at the end of the file.
+func (r *replayReader) Next() (*replayRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		record := &replayRecord{source: r.name, line: r.line}
+		record.err = parseReplayRecord(line, record)
+		return record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", r.name, err)
+	}
+	return nil, nil
+}
+
+func (r *replayReader) Close() {
+	if r.file != nil {
+		r.file.Close()
+	}
+}
+
+// parseReplayRecord reads a record in the form export and tail write it.
+func parseReplayRecord(line []byte, record *replayRecord) error {
+	var output struct {
+		PartitionKey                string          `json:"partition_key"`
+		ApproximateArrivalTimestamp string          `json:"approximate_arrival_timestamp"`
+		Data                        json.RawMessage `json:"data"`
+		RawData                     []byte          `json:"raw_data"`
+	}
+	if err := json.Unmarshal(line, &output); err != nil {
+		return err
+	}
+
+	if output.PartitionKey == "" {
+		return errors.New("no partition_key")
+	}
+	record.partitionKey = output.PartitionKey
+
+	if output.ApproximateArrivalTimestamp != "" {
+		arrival, err := time.Parse(time.RFC3339Nano, output.ApproximateArrivalTimestamp)
+		if err != nil {
+			return fmt.Errorf("invalid approximate_arrival_timestamp: %w", err)
+		}
+		record.arrival = arrival
+	}
+
+	switch {
+	case output.RawData != nil:
+		record.data = output.RawData
+	case output.Data != nil:
+		// Text payloads were decoded to a string; anything else was JSON
+		var text string
+		if json.Unmarshal(output.Data, &text) == nil {
+			record.data = []byte(text)
+		} else {
+			record.data = output.Data
+		}
+	default:
+		return errors.New("no raw_data or data")
+	}
+	return nil
+}
+
+// replayPacer spaces records out by the gaps between their arrival times, divided by speed.
+type replayPacer struct {
+	speed float64
+
+	// When the first record was published, and when it originally arrived
+	start        time.Time
+	firstArrival time.Time
+}
+
+// Delay returns how long to wait before publishing a record that originally arrived at arrival.
+func (p *replayPacer) Delay(arrival time.Time) time.Duration {
+	if p.speed == 0 {
+		return 0
+	}
+	if p.start.IsZero() {
+		p.start = time.Now()
+		p.firstArrival = arrival
+		return 0
+	}
+
+	due := p.start.Add(time.Duration(float64(arrival.Sub(p.firstArrival)) / p.speed))
+	return time.Until(due)
+}
@@ -1,14 +1,260 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/tailer"
+	"kin/pkg/telemetry"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/cobra"
 )
 
+// shutdownHooks run, most recently registered first, when a command finishes or is interrupted.
+// Long-running commands like tail only stop when interrupted, so anything that needs flushing on
+// the way out (telemetry, checkpoints) should register here.
+var (
+	shutdownHooksMu sync.Mutex
+	shutdownHooks   []func()
+)
+
+func onShutdown(hook func()) {
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+func runShutdownHooks() {
+	shutdownHooksMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownHooksMu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("config", "", "Config file of flag defaults, for every command at the top level or for one under its name (default ~/.kin.yaml)")
+	rootCmd.PersistentFlags().String("alias", "", "Stream alias from the config file's streams section whose flags to use, such as the stream, region, profile, --decode and --filter; @<alias> is short for --alias <alias>")
+	rootCmd.PersistentFlags().String("profile", "", "Shared config profile to use instead of the default")
+	rootCmd.PersistentFlags().String("region", "", "Region to use instead of the profile's")
+	rootCmd.PersistentFlags().String("role-arn", "", "Role to assume with the profile's credentials, such as one in another account")
+	rootCmd.PersistentFlags().String("external-id", "", "External ID the role requires, if any")
+	rootCmd.PersistentFlags().String("role-session-name", "", "Name of the assumed role's session, as seen in CloudTrail")
+	rootCmd.PersistentFlags().String("mfa-serial", "", "MFA device the --role-arn role requires, if the profile doesn't name it with mfa_serial")
+	rootCmd.PersistentFlags().String("mfa-token", "", "MFA code to assume a role with, rather than being prompted for one")
+	rootCmd.PersistentFlags().Int("max-retries", 2, "Times to retry a failed AWS API call")
+	rootCmd.PersistentFlags().String("retry-mode", "standard", "How to retry AWS API calls: standard, or adaptive to also slow down after throttling")
+	rootCmd.PersistentFlags().Duration("api-timeout", 0, "How long each attempt at an AWS API call may take (default unlimited)")
+	rootCmd.PersistentFlags().Duration("get-records-timeout", 30*time.Second, "How long each attempt at reading records from a shard may take")
+	rootCmd.PersistentFlags().Float64("get-records-rate", tailer.DefaultGetRecordsRate, "Most GetRecords calls to make per second on each shard, leaving the rest of the five Kinesis allows for other consumers such as KCL applications; 0 for no limit")
+	rootCmd.PersistentFlags().String("proxy", "", "Proxy to send AWS requests through, rather than HTTPS_PROXY's")
+	rootCmd.PersistentFlags().String("ca-bundle", "", "PEM file of additional CA certificates to trust, such as a proxy's")
+	rootCmd.PersistentFlags().Bool("use-fips-endpoint", false, "Use FIPS endpoints, as required in GovCloud and FedRAMP environments (also AWS_USE_FIPS_ENDPOINT)")
+	rootCmd.PersistentFlags().Bool("use-dualstack-endpoint", false, "Use dual-stack endpoints, reachable over IPv6 (also AWS_USE_DUALSTACK_ENDPOINT)")
+	rootCmd.PersistentFlags().String("stream-arn", "", "ARN of the stream to use in place of --stream-name, setting the region and reaching other accounts' streams through their resource policies")
+	rootCmd.PersistentFlags().String("endpoint-url", "", "Kinesis endpoint to use instead of the region's, such as an emulator or VPC endpoint")
+	rootCmd.PersistentFlags().String("mock", "", "Run against an in-memory mock of Kinesis rather than AWS; --mock=<file> keeps its streams in a file between commands")
+	rootCmd.PersistentFlags().Lookup("mock").NoOptDefVal = mockInMemory
+	rootCmd.PersistentFlags().String("otel-endpoint", "", "OTLP/HTTP endpoint to export traces and metrics to (ex: http://localhost:4318)")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log informational messages to stderr")
+	rootCmd.PersistentFlags().Bool("debug", false, "Log debug messages to stderr; implies --verbose")
+	rootCmd.PersistentFlags().Bool("debug-aws", false, "Log every AWS API call and attempt to stderr, with its parameters (payloads elided), status and request ID")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log errors to stderr")
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "kin",
 	Short: "A friendly CLI for working with Amazon Kinesis",
+	Long: `A friendly CLI for working with Amazon Kinesis.
+
+Every flag can also be set with an environment variable named KIN_ followed by the flag's name in
+upper case, with underscores for dashes, such as KIN_STREAM_NAME for --stream-name or KIN_REGION
+for --region, and given a default in the config file (see kin config). Flags override environment
+variables, which override the config file.`,
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnv(cmd); err != nil {
+			return err
+		}
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		configureLogging(cmd)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			runShutdownHooks()
+			os.Exit(130)
+		}()
+
+		if err := configureAWS(cmd); err != nil {
+			return err
+		}
+		if err := configureGetRecordsRate(cmd); err != nil {
+			return err
+		}
+
+		otelEndpoint, _ := cmd.Flags().GetString("otel-endpoint")
+		if otelEndpoint == "" {
+			return nil
+		}
+
+		shutdownTelemetry, err := telemetry.Setup(context.Background(), otelEndpoint)
+		if err != nil {
+			return err
+		}
+		onShutdown(func() {
+			shutdownTelemetry(context.Background())
+		})
+
+		return nil
+	},
+
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		runShutdownHooks()
+	},
+}
+
+// configureLogging installs the default structured logger, writing to stderr so that it never
+// interferes with record output on stdout.
+func configureLogging(cmd *cobra.Command) {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	debug, _ := cmd.Flags().GetBool("debug")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	level := slog.LevelWarn
+	switch {
+	case debug:
+		level = slog.LevelDebug
+	case verbose:
+		level = slog.LevelInfo
+	case quiet:
+		level = slog.LevelError
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// configureAWS applies the global AWS flags to every client.
+func configureAWS(cmd *cobra.Command) error {
+	profile, _ := cmd.Flags().GetString("profile")
+	region, _ := cmd.Flags().GetString("region")
+	aws.SetProfile(profile)
+	aws.SetRegion(region)
+
+	if err := configureStreamARN(cmd, region); err != nil {
+		return err
+	}
+
+	roleARN, _ := cmd.Flags().GetString("role-arn")
+	externalID, _ := cmd.Flags().GetString("external-id")
+	sessionName, _ := cmd.Flags().GetString("role-session-name")
+	role := aws.AssumeRoleOptions{
+		RoleARN:     roleARN,
+		ExternalID:  externalID,
+		SessionName: sessionName,
+	}
+	if role.RoleARN == "" && (role.ExternalID != "" || role.SessionName != "") {
+		return fmt.Errorf("--external-id and --role-session-name require --role-arn")
+	}
+	aws.SetAssumeRole(role)
+	mfaSerial, _ := cmd.Flags().GetString("mfa-serial")
+	mfaToken, _ := cmd.Flags().GetString("mfa-token")
+	aws.SetMFA(mfaSerial, mfaToken)
+
+	maxRetries, _ := cmd.Flags().GetInt("max-retries")
+	retryMode, _ := cmd.Flags().GetString("retry-mode")
+	apiTimeout, _ := cmd.Flags().GetDuration("api-timeout")
+	getRecordsTimeout, _ := cmd.Flags().GetDuration("get-records-timeout")
+	if maxRetries < 0 {
+		return fmt.Errorf("--max-retries can't be negative")
+	}
+	if retryMode != "standard" && retryMode != "adaptive" {
+		return fmt.Errorf("invalid --retry-mode %q: must be standard or adaptive", retryMode)
+	}
+	aws.SetRetryOptions(aws.RetryOptions{
+		MaxAttempts:       maxRetries + 1,
+		Mode:              awssdk.RetryMode(retryMode),
+		APITimeout:        apiTimeout,
+		GetRecordsTimeout: getRecordsTimeout,
+	})
+
+	proxy, _ := cmd.Flags().GetString("proxy")
+	caBundle, _ := cmd.Flags().GetString("ca-bundle")
+	aws.SetHTTPOptions(aws.HTTPOptions{
+		Proxy:    proxy,
+		CABundle: caBundle,
+	})
+
+	debugAWS, _ := cmd.Flags().GetBool("debug-aws")
+	aws.SetDebugLogging(debugAWS)
+
+	fips, _ := cmd.Flags().GetBool("use-fips-endpoint")
+	dualStack, _ := cmd.Flags().GetBool("use-dualstack-endpoint")
+	aws.SetEndpointVariants(fips, dualStack)
+
+	if err := configureMock(cmd); err != nil {
+		return err
+	}
+
+	endpoint, _ := cmd.Flags().GetString("endpoint-url")
+	if endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint URL %q: must be http:// or https:// followed by a host", endpoint)
+	}
+	aws.SetKinesisEndpointURL(endpoint)
+
+	return nil
+}
+
+// configureStreamARN makes --stream-arn stand in for --stream-name, and take the region from the
+// ARN.
+func configureStreamARN(cmd *cobra.Command, region string) error {
+	value, _ := cmd.Flags().GetString("stream-arn")
+	if value == "" {
+		return nil
+	}
+
+	stream, err := aws.ParseStreamARN(value)
+	if err != nil {
+		return err
+	}
+	if region != "" && region != stream.Region {
+		slog.Warn("the stream ARN's region overrides --region", "region", region, "stream_region", stream.Region)
+	}
+	aws.SetRegion(stream.Region)
+	aws.SetStreamARN(stream)
+
+	nameFlag := cmd.Flags().Lookup("stream-name")
+	if nameFlag == nil {
+		return nil
+	}
+	if nameFlag.Changed && nameFlag.Value.String() != stream.Name {
+		return fmt.Errorf("--stream-name %s doesn't match the stream ARN's %s", nameFlag.Value, stream.Name)
+	}
+	return cmd.Flags().Set("stream-name", stream.Name)
 }
 
 func Execute() error {
+	registerFlagCompletions(rootCmd)
+	rootCmd.SetArgs(expandAliasArgs(os.Args[1:]))
 	return rootCmd.Execute()
 }
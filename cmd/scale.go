@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	scaleCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	scaleCmd.Flags().Int32("shards", 0, "Target number of open shards (required)")
+	scaleCmd.Flags().Bool("wait", false, "Wait for resharding to finish, then print the resulting shards")
+	scaleCmd.MarkFlagRequired("stream-name")
+	scaleCmd.MarkFlagRequired("shards")
+
+	rootCmd.AddCommand(scaleCmd)
+}
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Change the number of shards in a provisioned stream",
+	Long: `Changes a provisioned stream's open shard count with UpdateShardCount, splitting or merging shards
+so that the hash key space is divided evenly between them.
+
+A single call can at most double the shard count or halve it; to go further, scale in steps.
+Resharding can take several minutes on a large stream. With --wait, kin reports progress until it
+finishes, then prints the resulting shard map.`,
+	Run: runScaleCmd,
+}
+
+func runScaleCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	target, _ := cmd.Flags().GetInt32("shards")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	output, err := client.DescribeStreamSummary(cmd.Context(), &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	summary := output.StreamDescriptionSummary
+	current := awssdk.ToInt32(summary.OpenShardCount)
+
+	if err := validateShardCountChange(summary, target); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	_, err = client.UpdateShardCount(cmd.Context(), &kinesis.UpdateShardCountInput{
+		StreamName:       &streamName,
+		TargetShardCount: &target,
+		ScalingType:      types.ScalingTypeUniformScaling,
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	cmd.PrintErrf("Scaling %s from %d to %d shards\n", streamName, current, target)
+
+	if !wait {
+		return
+	}
+
+	err = waitForStreamActive(cmd.Context(), client, streamName, func(s *types.StreamDescriptionSummary) {
+		if s.StreamStatus != types.StreamStatusActive {
+			cmd.PrintErrf("%s: %d open shards\n", s.StreamStatus, awssdk.ToInt32(s.OpenShardCount))
+		}
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if err := printOpenShardMap(cmd, client, streamName); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// validateShardCountChange checks a target shard count against the limits of a single
+// UpdateShardCount call, so that we can give a clearer error than the API does.
+func validateShardCountChange(summary *types.StreamDescriptionSummary, target int32) error {
+	current := awssdk.ToInt32(summary.OpenShardCount)
+
+	switch {
+	case summary.StreamModeDetails != nil && summary.StreamModeDetails.StreamMode == types.StreamModeOnDemand:
+		return fmt.Errorf("%s is on-demand, and manages its own shards", *summary.StreamName)
+	case summary.StreamStatus != types.StreamStatusActive:
+		return fmt.Errorf("%s is %s; it can only be resharded when ACTIVE", *summary.StreamName, summary.StreamStatus)
+	case target < 1:
+		return fmt.Errorf("--shards must be at least 1")
+	case target == current:
+		return fmt.Errorf("%s already has %d open shards", *summary.StreamName, current)
+	case target > current*2:
+		return fmt.Errorf("can't scale from %d to %d shards in one step: at most %d (double)", current, target, current*2)
+	case target*2 < current:
+		return fmt.Errorf("can't scale from %d to %d shards in one step: at least %d (half)", current, target, (current+1)/2)
+	}
+	return nil
+}
+
+// printOpenShardMap prints the hash key range of each open shard.
+func printOpenShardMap(cmd *cobra.Command, client aws.KinesisAPI, streamName string) error {
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, shard := range shards {
+		s := NewShardListing(shard)
+		if !s.Open {
+			continue
+		}
+		rows = append(rows, []string{s.ShardId, s.StartingHashKey, s.EndingHashKey, fmt.Sprintf("%.2f%%", s.KeyspacePercent)})
+	}
+	printTable(cmd.OutOrStdout(), []string{"SHARD", "START HASH", "END HASH", "KEYSPACE"}, rows)
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"kin/pkg/aws"
+	"kin/pkg/tailer"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Kinesis allows five GetRecords calls per second per shard, so a scan reading as fast as it can
+// still waits this long between calls, even with no --get-records-rate limit
+const scanPollInterval = 200 * time.Millisecond
+
+// errStopScan is returned to the Tailer to stop a scan when its fn returns false
+var errStopScan = errors.New("scan stopped")
+
+// scanShard reads a shard from the position given by tailOptions (its trim horizon by default),
+// calling fn with each record until fn returns false, the shard is closed, or the scan catches up
+// with the tip of the shard. Unlike tailStreamShard, it never waits for new records. Like it, a
+// panic restarts the shard after the record it panicked on, up to maxShardRestarts times.
+func scanShard(
+	ctx context.Context,
+	client aws.KinesisReader,
+	streamName, shardId string,
+	tailOptions *TailOptions,
+	fn func(record types.Record, millisBehindLatest *int64) bool,
+) error {
+	t := tailer.New(client, streamName, append(
+		tailerOptions(tailOptions),
+		tailer.WithPollInterval(scanPollInterval),
+		tailer.WithStopAtLatest(),
+	)...)
+
+	err := t.TailShard(ctx, shardId, func(record *tailer.Record) error {
+		if !fn(record.Record, record.MillisBehindLatest) {
+			return errStopScan
+		}
+		return nil
+	})
+	if errors.Is(err, errStopScan) {
+		return nil
+	}
+	if err == nil && ctx.Err() != nil {
+		// The Tailer stops quietly when cancelled, but a scan cut short is incomplete
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+func init() {
+	schemaInferCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	schemaInferCmd.Flags().Int("sample", 1000, "Number of records to infer the schema from")
+	schemaInferCmd.Flags().String("from", "1h", "Start reading records from this time, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	schemaInferCmd.Flags().String("until", "", "Read no records later than this time, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	schemaInferCmd.Flags().Int("max-enum", 10, "Largest number of distinct values a string field may have to be listed as an enum; 0 never lists them")
+	schemaInferCmd.MarkFlagRequired("stream-name")
+
+	schemaCmd.AddCommand(schemaInferCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Work with the schema of a stream's payloads",
+}
+
+var schemaInferCmd = &cobra.Command{
+	Use:   "infer",
+	Short: "Infer a JSON Schema from a sample of a stream's records",
+	Long: `Reads up to --sample JSON payloads from every shard of a stream, starting at --from, and prints a
+JSON Schema describing them: the type of every field, nested objects and arrays included, which
+fields are present in every object they could appear in, and, for string fields with only a few
+distinct values that each occur more than once, those values as an enum. Strings that are all
+RFC 3339 timestamps are given the date-time format. Payloads that aren't JSON are skipped.
+
+The schema only describes what was in the sample, so review it before using it with validate or
+tail --schema: rare fields and values may be missing, and fields may be optional that appeared
+in every sampled record.
+
+Example:
+  kin schema infer -n orders --sample 5000 > order.schema.json`,
+	Run: runSchemaInferCmd,
+}
+
+func runSchemaInferCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	sample, _ := cmd.Flags().GetInt("sample")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	maxEnum, _ := cmd.Flags().GetInt("max-enum")
+
+	if sample <= 0 {
+		cmd.PrintErrln("--sample must be positive")
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	samples, err := samplePayloads(cmd.Context(), client, streamName, shards, &TailOptions{AtTimestamp: &from}, until, sample)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if len(samples) == 0 {
+		cmd.PrintErrf("no JSON records found in %s between %s and %s\n", streamName, from.Format(time.RFC3339), until.Format(time.RFC3339))
+		os.Exit(1)
+	}
+
+	root := &schemaNode{}
+	for _, value := range samples {
+		root.add(value)
+	}
+
+	schema := root.jsonSchema(maxEnum)
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = streamName
+	schema["description"] = fmt.Sprintf("Inferred by kin from %d records", len(samples))
+
+	jsonBytes, _ := json.MarshalIndent(schema, "", "  ")
+	fmt.Println(string(jsonBytes))
+}
+
+// schemaNode accumulates the values seen at one place in the payloads, such as a field of an
+// object or the items of an array, to infer a JSON Schema for them.
+type schemaNode struct {
+	types map[string]bool
+
+	// objects is the number of objects seen, and properties the values of their fields
+	objects    int
+	properties map[string]*schemaNode
+	present    map[string]int
+
+	items *schemaNode
+
+	// Occurrences of each distinct string, until there are too many to be an enum
+	strings     map[string]int
+	stringCount int
+	tooMany     bool
+	notDateTime bool
+}
+
+// Once a field has more distinct strings than this, they stop being counted whatever --max-enum is
+const maxEnumTracked = 1000
+
+func (n *schemaNode) add(value interface{}) {
+	if n.types == nil {
+		n.types = map[string]bool{}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		n.types["null"] = true
+
+	case bool:
+		n.types["boolean"] = true
+
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+
+	case string:
+		n.types["string"] = true
+		n.stringCount++
+		if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+			n.notDateTime = true
+		}
+		if !n.tooMany {
+			if n.strings == nil {
+				n.strings = map[string]int{}
+			}
+			n.strings[v]++
+			if len(n.strings) > maxEnumTracked {
+				n.tooMany = true
+				n.strings = nil
+			}
+		}
+
+	case map[string]interface{}:
+		n.types["object"] = true
+		n.objects++
+		if n.properties == nil {
+			n.properties = map[string]*schemaNode{}
+			n.present = map[string]int{}
+		}
+		for key, field := range v {
+			property, ok := n.properties[key]
+			if !ok {
+				property = &schemaNode{}
+				n.properties[key] = property
+			}
+			property.add(field)
+			n.present[key]++
+		}
+
+	case []interface{}:
+		n.types["array"] = true
+		if n.items == nil {
+			n.items = &schemaNode{}
+		}
+		for _, item := range v {
+			n.items.add(item)
+		}
+	}
+}
+
+// jsonSchema returns the schema of the values seen, listing the distinct strings as an enum if
+// there are no more than maxEnum of them and each was seen at least twice.
+func (n *schemaNode) jsonSchema(maxEnum int) map[string]interface{} {
+	schema := map[string]interface{}{}
+
+	// Integers are numbers too, so there's no need to list both
+	if n.types["number"] {
+		delete(n.types, "integer")
+	}
+	var types []string
+	for typ := range n.types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	switch len(types) {
+	case 0:
+		// Only ever an empty array's items, which could be anything
+		return schema
+	case 1:
+		schema["type"] = types[0]
+	default:
+		schema["type"] = types
+	}
+
+	if n.types["string"] {
+		if !n.notDateTime {
+			schema["format"] = "date-time"
+		}
+
+		if !n.tooMany && len(n.strings) <= maxEnum && n.stringCount >= 2*len(n.strings) && isEnumType(types) {
+			values := make([]string, 0, len(n.strings))
+			for value := range n.strings {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+
+			enum := []interface{}{}
+			for _, value := range values {
+				enum = append(enum, value)
+			}
+			if n.types["null"] {
+				enum = append(enum, nil)
+			}
+			schema["enum"] = enum
+		}
+	}
+
+	if n.types["object"] {
+		properties := map[string]interface{}{}
+		required := []string{}
+		for key, property := range n.properties {
+			properties[key] = property.jsonSchema(maxEnum)
+			if n.present[key] == n.objects {
+				required = append(required, key)
+			}
+		}
+		sort.Strings(required)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+
+	if n.types["array"] {
+		schema["items"] = n.items.jsonSchema(maxEnum)
+	}
+	return schema
+}
+
+// isEnumType returns whether values of types, which include string, can be listed as an enum:
+// only strings and null can.
+func isEnumType(types []string) bool {
+	for _, typ := range types {
+		if typ != "string" && typ != "null" {
+			return false
+		}
+	}
+	return true
+}
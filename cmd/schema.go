@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Types of payload fields, named as in Avro
+const (
+	fieldBoolean   = "boolean"
+	fieldLong      = "long"
+	fieldDouble    = "double"
+	fieldString    = "string"
+	fieldTimestamp = "timestamp-millis"
+)
+
+// payloadField is a top-level field of JSON record payloads, given a column of its own when
+// exporting to a typed format.
+type payloadField struct {
+	// Name of the column, which is the key made into a valid Avro name
+	Name string
+	// Key of the field in the payload
+	Key  string
+	Type string
+}
+
+// inferPayloadFields infers a field for every top-level key of the JSON object payloads in
+// samples. A key whose values are all booleans, all integers or all numbers is typed that way;
+// anything else, including nested objects and arrays, is a string holding the value's JSON.
+// Column names are made unique, and different from the reserved names, with trailing underscores.
+func inferPayloadFields(samples []interface{}, reserved []string) []payloadField {
+	types := map[string]string{}
+	for _, sample := range samples {
+		object, ok := sample.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range object {
+			types[key] = mergeFieldTypes(types[key], jsonFieldType(value))
+		}
+	}
+
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	taken := map[string]bool{}
+	for _, name := range reserved {
+		taken[name] = true
+	}
+
+	fields := []payloadField{}
+	for _, key := range keys {
+		typ := types[key]
+		if typ == "" {
+			// Only ever null in the sample
+			typ = fieldString
+		}
+
+		name := avroName(key)
+		for taken[name] {
+			name += "_"
+		}
+		taken[name] = true
+		fields = append(fields, payloadField{Name: name, Key: key, Type: typ})
+	}
+	return fields
+}
+
+// jsonFieldType returns the type of a decoded JSON value, or "" for null.
+func jsonFieldType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return fieldBoolean
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return fieldLong
+		}
+		return fieldDouble
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return fieldLong
+		}
+		return fieldDouble
+	default:
+		return fieldString
+	}
+}
+
+// mergeFieldTypes returns a type that can hold values of both types.
+func mergeFieldTypes(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case (a == fieldLong && b == fieldDouble) || (a == fieldDouble && b == fieldLong):
+		return fieldDouble
+	default:
+		return fieldString
+	}
+}
+
+// avroName makes a JSON key into a valid Avro (and Parquet) name, replacing anything other than
+// letters, digits and underscores.
+func avroName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// loadAvroSchemaFields reads the payload fields from an Avro record schema. Fields must be
+// primitives, or unions of null and a primitive, since payloads are flattened into columns.
+func loadAvroSchemaFields(path string) ([]payloadField, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema struct {
+		Type   string `json:"type"`
+		Fields []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if schema.Type != "record" {
+		return nil, fmt.Errorf("%s: schema must be a record, not %q", path, schema.Type)
+	}
+
+	fields := []payloadField{}
+	for _, field := range schema.Fields {
+		typ, err := avroFieldType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: field %s: %w", path, field.Name, err)
+		}
+		if avroName(field.Name) != field.Name {
+			return nil, fmt.Errorf("%s: %q isn't a valid field name", path, field.Name)
+		}
+		fields = append(fields, payloadField{Name: field.Name, Key: field.Name, Type: typ})
+	}
+	return fields, nil
+}
+
+// avroFieldType maps the type of an Avro field onto a payload field type.
+func avroFieldType(raw json.RawMessage) (string, error) {
+	var union []json.RawMessage
+	if json.Unmarshal(raw, &union) == nil {
+		var types []string
+		for _, branch := range union {
+			if string(branch) == `"null"` {
+				continue
+			}
+			typ, err := avroFieldType(branch)
+			if err != nil {
+				return "", err
+			}
+			types = append(types, typ)
+		}
+		if len(types) != 1 {
+			return "", fmt.Errorf("unions must be of null and one other type")
+		}
+		return types[0], nil
+	}
+
+	var primitive string
+	if json.Unmarshal(raw, &primitive) != nil {
+		var complex struct {
+			Type        string `json:"type"`
+			LogicalType string `json:"logicalType"`
+		}
+		if err := json.Unmarshal(raw, &complex); err != nil {
+			return "", err
+		}
+		if complex.LogicalType == fieldTimestamp && complex.Type == "long" {
+			return fieldTimestamp, nil
+		}
+		primitive = complex.Type
+	}
+
+	switch primitive {
+	case "boolean", "string", "long", "double":
+		return primitive, nil
+	case "int":
+		return fieldLong, nil
+	case "float":
+		return fieldDouble, nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", raw)
+	}
+}
+
+// payloadValue converts a decoded JSON value to the type of a field: a bool, int64, float64,
+// string, or int64 milliseconds for a timestamp. Values that can't be converted are null.
+func payloadValue(typ string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch typ {
+	case fieldBoolean:
+		if v, ok := value.(bool); ok {
+			return v
+		}
+
+	case fieldLong:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+				return int64(v)
+			}
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+		}
+
+	case fieldDouble:
+		switch v := value.(type) {
+		case float64:
+			return v
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f
+			}
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+
+	case fieldTimestamp:
+		switch v := value.(type) {
+		case float64:
+			// Numeric timestamps are taken to be milliseconds, as in the column
+			return int64(v)
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.UnixMilli()
+			}
+		}
+
+	case fieldString:
+		return jsonString(value)
+	}
+	return nil
+}
+
+// jsonString returns a string as it is and anything else as JSON.
+func jsonString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// sampleAndInferPayloadFields reads up to n records from the position given by tailOptions,
+// across every shard and no later than until, and infers payload fields from them.
+func sampleAndInferPayloadFields(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	shards []types.Shard,
+	tailOptions *TailOptions,
+	until time.Time,
+	n int,
+) ([]payloadField, error) {
+	samples, err := samplePayloads(ctx, client, streamName, shards, tailOptions, until, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var reserved []string
+	for _, column := range exportMetadataColumns {
+		reserved = append(reserved, column.name)
+	}
+	return inferPayloadFields(samples, reserved), nil
+}
+
+// samplePayloads reads up to n JSON payloads from the position given by tailOptions, across every
+// shard and no later than until, skipping payloads that aren't JSON.
+func samplePayloads(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	shards []types.Shard,
+	tailOptions *TailOptions,
+	until time.Time,
+	n int,
+) ([]interface{}, error) {
+	var mu sync.Mutex
+	var samples []interface{}
+	var errs []error
+
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(ctx, client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				var sample interface{}
+				if json.Unmarshal(record.Data, &sample) != nil {
+					return true
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if len(samples) >= n {
+					return false
+				}
+				samples = append(samples, sample)
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", shardId, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"kin/pkg/release"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	selfUpdateCmd.Flags().Bool("check", false, "Only report whether there's a newer release, without installing it")
+	selfUpdateCmd.Flags().Bool("force", false, "Install the latest release even if it isn't newer, such as over a development build")
+
+	rootCmd.AddCommand(selfUpdateCmd)
+}
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Replace kin with its latest release",
+	Long: `Downloads the latest release of kin from GitHub for this OS and architecture, verifies it against
+the release's SHA-256 checksums, and replaces the running binary with it. The checksums must be
+signed with the minisign key built into kin, so a release published without the maintainers' key
+is refused. The new binary is written alongside the old one and renamed over it, so an
+interrupted update leaves the old one in place.
+
+kin must be able to write to the directory it's installed in; if it was installed with a package
+manager, update it with that instead. GITHUB_TOKEN is used if it's set, to avoid GitHub's rate
+limits.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, _ := cmd.Flags().GetBool("check")
+		force, _ := cmd.Flags().GetBool("force")
+
+		current := versionInfo().Version
+		client := release.NewClient()
+		latest, err := client.Latest(cmd.Context())
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if !release.Newer(latest.Version, current) && !force {
+			cmd.PrintErrf("kin %s is up to date; the latest release is %s\n", current, latest.Version)
+			return
+		}
+		if check {
+			cmd.PrintErrf("kin %s is available (you have %s): %s\n", latest.Version, current, latest.URL)
+			return
+		}
+
+		if err := installRelease(cmd, client, latest); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		cmd.PrintErrf("Updated kin from %s to %s\n", current, latest.Version)
+	},
+}
+
+// installRelease replaces the running binary with the release's binary for this platform.
+func installRelease(cmd *cobra.Command, client *release.Client, latest *release.Release) error {
+	asset, err := latest.Binary(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	checksums, err := client.Checksums(cmd.Context(), latest)
+	if err != nil {
+		return err
+	}
+	checksum, ok := checksums[asset.Name]
+	if !ok {
+		return fmt.Errorf("release %s has no checksum for %s", latest.Version, asset.Name)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	// Renaming is only atomic within a filesystem, so the new binary is written next to the old
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".kin-update-*")
+	if err != nil {
+		return fmt.Errorf("can't write to %s, where kin is installed: %w", filepath.Dir(exe), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	cmd.PrintErrf("Downloading %s\n", asset.Name)
+	if err := client.DownloadBinary(cmd.Context(), asset, checksum, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// Windows won't replace a running binary, but will rename it out of the way
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
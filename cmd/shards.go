@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"kin/pkg/aws"
+	"math/big"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// listShards returns every shard of the stream, following pagination.
+func listShards(ctx context.Context, client aws.KinesisReader, streamName string) ([]types.Shard, error) {
+	var shards []types.Shard
+	input := &kinesis.ListShardsInput{StreamName: &streamName}
+	for {
+		output, err := client.ListShards(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, output.Shards...)
+
+		if output.NextToken == nil {
+			return shards, nil
+		}
+		// The stream name must be omitted when continuing from a token
+		input = &kinesis.ListShardsInput{NextToken: output.NextToken}
+	}
+}
+
+// hashKeyForPartitionKey returns the 128-bit hash key Kinesis uses to route a partition key:
+// the MD5 digest of the key, read as a big-endian unsigned integer.
+func hashKeyForPartitionKey(partitionKey string) *big.Int {
+	digest := md5.Sum([]byte(partitionKey))
+	return new(big.Int).SetBytes(digest[:])
+}
+
+// shardForHashKey returns the open shard whose hash key range contains hashKey, or nil if none
+// does.
+func shardForHashKey(shards []types.Shard, hashKey *big.Int) *types.Shard {
+	for i, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+
+		start, end := shardHashRange(shard)
+		if hashKey.Cmp(start) >= 0 && hashKey.Cmp(end) <= 0 {
+			return &shards[i]
+		}
+	}
+	return nil
+}
+
+// findShard returns the shard with the given ID, or nil if there isn't one.
+func findShard(shards []types.Shard, shardId string) *types.Shard {
+	for i, shard := range shards {
+		if *shard.ShardId == shardId {
+			return &shards[i]
+		}
+	}
+	return nil
+}
+
+// isOpenShard reports whether a shard is still accepting records. Closed shards have an ending
+// sequence number.
+func isOpenShard(shard types.Shard) bool {
+	return shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil
+}
+
+// shardHashRange returns the inclusive range of hash keys a shard covers.
+func shardHashRange(shard types.Shard) (start, end *big.Int) {
+	start, _ = new(big.Int).SetString(*shard.HashKeyRange.StartingHashKey, 10)
+	end, _ = new(big.Int).SetString(*shard.HashKeyRange.EndingHashKey, 10)
+	return start, end
+}
+
+// shardsAdjacent reports whether two shards' hash key ranges meet with no gap between them, which
+// Kinesis requires of shards being merged.
+func shardsAdjacent(a, b types.Shard) bool {
+	aStart, aEnd := shardHashRange(a)
+	bStart, bEnd := shardHashRange(b)
+	one := big.NewInt(1)
+	return new(big.Int).Add(aEnd, one).Cmp(bStart) == 0 || new(big.Int).Add(bEnd, one).Cmp(aStart) == 0
+}
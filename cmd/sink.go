@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/producer"
+	"kin/pkg/sink"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func addSinkFlags(flags *pflag.FlagSet) {
+	flags.StringP("output", "o", "json", "Record format: json, logfmt for key=value lines of shard, key, seq, ts and the payload's fields, or raw0 for each payload as it was put, followed by a NUL byte")
+	flags.StringArray("sink", nil, "Where to write records: stdout, file://<path>, s3://<bucket>/<prefix>, kinesis://<stream> or an http(s):// URL to POST them to; may be repeated (default stdout)")
+	flags.Duration("flush-interval", time.Second, "How often records buffered for a sink are sent; each flush writes an object for s3:// sinks")
+	flags.String("output-dir", "", "Directory to write records to, in a file per shard as --split-by says, rather than stdout")
+	flags.StringSlice("split-by", []string{"shard"}, "How --output-dir files are split: shard, or shard,hour for a file per shard per hour records arrived in")
+	flags.String("compress", "", "Compress file, --output-dir and s3:// output: gzip or none (default gzip for s3:// sinks, none otherwise)")
+}
+
+// newSinkFromFlags opens every sink given with --sink and --output-dir, or stdout if none were,
+// writing records in the --output format.
+func newSinkFromFlags(flags *pflag.FlagSet, fieldCase string) (sink.Sink, error) {
+	output, err := flags.GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	format, err := sinkFormat(output, fieldCase)
+	if err != nil {
+		return nil, err
+	}
+
+	compress, err := flags.GetString("compress")
+	if err != nil {
+		return nil, err
+	}
+	if compress != "" && compress != "gzip" && compress != "none" {
+		return nil, fmt.Errorf("invalid --compress %q: must be gzip or none", compress)
+	}
+
+	flushInterval, err := flags.GetDuration("flush-interval")
+	if err != nil {
+		return nil, err
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("--flush-interval must be positive")
+	}
+
+	uris, err := flags.GetStringArray("sink")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := flags.GetString("output-dir")
+	if err != nil {
+		return nil, err
+	}
+	if len(uris) == 0 && dir == "" {
+		uris = []string{"stdout"}
+	}
+
+	var sinks []sink.Sink
+	if dir != "" {
+		splitBy, err := flags.GetStringSlice("split-by")
+		if err != nil {
+			return nil, err
+		}
+		byHour, err := parseSplitBy(splitBy)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := sink.NewDir(dir, byHour, format, sinkCompression(compress, sink.NoCompression))
+		if err != nil {
+			return nil, fmt.Errorf("--output-dir %s: %w", dir, err)
+		}
+		sinks = append(sinks, s)
+	}
+	for _, uri := range uris {
+		s, err := newSink(uri, format, compress)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("--sink %s: %w", uri, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return sink.Multi(sinks...), nil
+}
+
+// sinkFormat returns the format named by --output.
+func sinkFormat(output, fieldCase string) (sink.Format, error) {
+	if err := validateOutput(output, "json", "logfmt", "raw0"); err != nil {
+		return sink.Format{}, err
+	}
+
+	switch output {
+	case "logfmt":
+		return sink.Logfmt(), nil
+	case "raw0":
+		return sink.Raw0(), nil
+	default:
+		return sink.JSON(fieldCase), nil
+	}
+}
+
+// sinkCompression returns the compression named by --compress, or def if it wasn't given.
+func sinkCompression(compress string, def sink.Compression) sink.Compression {
+	switch compress {
+	case "":
+		return def
+	case "gzip":
+		return sink.Gzip
+	default:
+		return sink.NoCompression
+	}
+}
+
+// parseSplitBy reports whether --split-by splits files by hour as well as shard, which they
+// always are.
+func parseSplitBy(splitBy []string) (byHour bool, err error) {
+	byShard := false
+	for _, by := range splitBy {
+		switch by {
+		case "shard":
+			byShard = true
+		case "hour":
+			byHour = true
+		default:
+			return false, fmt.Errorf("invalid --split-by %q: must be shard or hour", by)
+		}
+	}
+	if !byShard {
+		return false, fmt.Errorf("--split-by must include shard")
+	}
+	return byHour, nil
+}
+
+// newSink opens a sink from a URI. A bare path is treated as a file. compress is the --compress
+// value, applying to files and S3 objects.
+func newSink(uri string, format sink.Format, compress string) (sink.Sink, error) {
+	switch {
+	case uri == "stdout" || uri == "-":
+		return sink.NewStdout(format), nil
+
+	case strings.HasPrefix(uri, "s3://"):
+		bucket, prefix, err := parseS3URI(uri)
+		if err != nil {
+			return nil, err
+		}
+		client, err := aws.GetS3Client()
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewS3(client, bucket, prefix, format, sinkCompression(compress, sink.Gzip)), nil
+
+	case strings.HasPrefix(uri, "kinesis://"):
+		streamName := strings.TrimPrefix(uri, "kinesis://")
+		if streamName == "" {
+			return nil, fmt.Errorf("expected kinesis://<stream>")
+		}
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewKinesis(producer.New(client, streamName), format), nil
+
+	case strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://"):
+		return sink.NewHTTP(nil, uri, format), nil
+
+	default:
+		return sink.NewFile(strings.TrimPrefix(uri, "file://"), format, sinkCompression(compress, sink.NoCompression))
+	}
+}
+
+// sinkWriter writes records to a sink, checkpointing each shard only once the records up to the
+// checkpoint have been flushed, so that no record is checkpointed without having been written.
+// Once a flush drops records, the shards they may have come from aren't checkpointed again, so
+// that a resumed read retries them. It's safe for concurrent use.
+type sinkWriter struct {
+	mu           sync.Mutex
+	sink         sink.Sink
+	checkpointer Checkpointer
+
+	// pending is the last sequence number written from each shard since the last flush
+	pending map[string]string
+	// finished holds shards marked as fully read, whose checkpoints mustn't be overwritten
+	finished map[string]bool
+	// held holds shards with records that were dropped, whose checkpoints stay where they were
+	held map[string]bool
+}
+
+func newSinkWriter(s sink.Sink, checkpointer Checkpointer) *sinkWriter {
+	return &sinkWriter{
+		sink:         s,
+		checkpointer: checkpointer,
+		pending:      map[string]string{},
+		finished:     map[string]bool{},
+		held:         map[string]bool{},
+	}
+}
+
+func (w *sinkWriter) Write(ctx context.Context, record *RecordOutput) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.sink.Write(ctx, record); err != nil {
+		return err
+	}
+	if w.checkpointer != nil && !w.finished[*record.ShardId] && !w.held[*record.ShardId] {
+		w.pending[*record.ShardId] = *record.SequenceNumber
+	}
+	return nil
+}
+
+// Flush flushes the sink, then checkpoints what it flushed.
+func (w *sinkWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush(ctx)
+}
+
+func (w *sinkWriter) flush(ctx context.Context) error {
+	if err := w.sink.Flush(ctx); err != nil {
+		var dropped *sink.DroppedError
+		if errors.As(err, &dropped) {
+			// The sink doesn't say which records were dropped, so hold back every shard that had
+			// records waiting to be flushed
+			for shardId := range w.pending {
+				slog.Warn("records were dropped; no longer checkpointing shard, so that a resumed read retries them", "shard", shardId)
+				w.held[shardId] = true
+				delete(w.pending, shardId)
+			}
+		}
+		return err
+	}
+
+	for shardId, sequenceNumber := range w.pending {
+		w.checkpointer.Set(shardId, sequenceNumber)
+		delete(w.pending, shardId)
+	}
+	return nil
+}
+
+// FinishShard flushes what's been written, then checkpoints a shard as fully read.
+func (w *sinkWriter) FinishShard(ctx context.Context, shardId string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.flush(ctx); err != nil {
+		return err
+	}
+	if w.held[shardId] {
+		return nil
+	}
+	w.finished[shardId] = true
+	w.checkpointer.Set(shardId, kclShardEnd)
+	return nil
+}
+
+// FlushEvery flushes every interval until ctx is cancelled, reporting failures to onError; the
+// records stay buffered to be retried by the next flush.
+func (w *sinkWriter) FlushEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Flush(ctx); err != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close flushes and closes the sink.
+func (w *sinkWriter) Close() error {
+	if err := w.Flush(context.Background()); err != nil {
+		return err
+	}
+	return w.sink.Close()
+}
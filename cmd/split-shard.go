@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"math/big"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	splitShardCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	splitShardCmd.Flags().StringP("shard", "s", "", "ID of the shard to split (required)")
+	splitShardCmd.Flags().String("hash-key", "", "Starting hash key of the second child shard, as a decimal 128-bit integer; defaults to the midpoint of the shard's range")
+	splitShardCmd.Flags().Bool("wait", false, "Wait for the split to finish, then print the resulting shards")
+	splitShardCmd.MarkFlagRequired("stream-name")
+	splitShardCmd.MarkFlagRequired("shard")
+
+	rootCmd.AddCommand(splitShardCmd)
+}
+
+var splitShardCmd = &cobra.Command{
+	Use:   "split-shard",
+	Short: "Split a shard in two",
+	Long: `Splits an open shard into two children. The first covers the parent's hash keys below
+--hash-key, and the second those from --hash-key upwards. Without --hash-key, the range is split in
+half.
+
+Splitting a single hot shard is cheaper than scaling the whole stream with the scale command, and
+lets you divide the range unevenly when a few partition keys account for most of the traffic.`,
+	Run: runSplitShardCmd,
+}
+
+func runSplitShardCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	shardId, _ := cmd.Flags().GetString("shard")
+	hashKeyS, _ := cmd.Flags().GetString("hash-key")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shard := findShard(shards, shardId)
+	if shard == nil {
+		cmd.PrintErrf("%s has no shard %s\n", streamName, shardId)
+		os.Exit(1)
+	}
+
+	var hashKey *big.Int
+	if hashKeyS != "" {
+		var ok bool
+		hashKey, ok = new(big.Int).SetString(hashKeyS, 10)
+		if !ok {
+			cmd.PrintErrf("invalid --hash-key %q: must be a decimal integer\n", hashKeyS)
+			os.Exit(1)
+		}
+	}
+
+	if err := splitShard(cmd.Context(), client, streamName, *shard, hashKey); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if !wait {
+		return
+	}
+	if err := waitForStreamActive(cmd.Context(), client, streamName, nil); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if err := printOpenShardMap(cmd, client, streamName); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// splitShard splits shard at hashKey, or at the midpoint of its range if hashKey is nil, after
+// checking that the split is one Kinesis will accept.
+func splitShard(ctx context.Context, client aws.KinesisAPI, streamName string, shard types.Shard, hashKey *big.Int) error {
+	if !isOpenShard(shard) {
+		return fmt.Errorf("%s is closed and can't be split", *shard.ShardId)
+	}
+
+	hashKey, err := splitHashKey(shard, hashKey)
+	if err != nil {
+		return err
+	}
+
+	newStartingHashKey := hashKey.String()
+	_, err = client.SplitShard(ctx, &kinesis.SplitShardInput{
+		StreamName:         &streamName,
+		ShardToSplit:       shard.ShardId,
+		NewStartingHashKey: &newStartingHashKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Splitting %s at %s\n", *shard.ShardId, newStartingHashKey)
+	return nil
+}
+
+// splitHashKey returns the starting hash key of the second child of splitting shard at hashKey,
+// or at the midpoint of its range if hashKey is nil, checking that the split is within the range.
+func splitHashKey(shard types.Shard, hashKey *big.Int) (*big.Int, error) {
+	start, end := shardHashRange(shard)
+	if start.Cmp(end) == 0 {
+		return nil, fmt.Errorf("%s covers a single hash key and can't be split", *shard.ShardId)
+	}
+	if hashKey == nil {
+		// Round up so that the second child is never empty
+		hashKey = new(big.Int).Add(start, end)
+		hashKey.Add(hashKey, big.NewInt(1))
+		hashKey.Rsh(hashKey, 1)
+	}
+	if hashKey.Cmp(start) <= 0 || hashKey.Cmp(end) > 0 {
+		return nil, fmt.Errorf("hash key %s is outside %s's range (%s, %s]", hashKey, *shard.ShardId, start, end)
+	}
+	return hashKey, nil
+}
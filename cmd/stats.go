@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type ShardProfile struct {
+	ShardId          string     `json:"shard_id"`
+	Records          int        `json:"records"`
+	Bytes            int        `json:"bytes"`
+	RecordsPerSecond float64    `json:"records_per_second"`
+	BytesPerSecond   float64    `json:"bytes_per_second"`
+	AverageSize      float64    `json:"average_size"`
+	TopKeys          []KeyCount `json:"top_keys"`
+}
+
+type KeyCount struct {
+	PartitionKey string `json:"partition_key"`
+	Records      int    `json:"records"`
+}
+
+// shardProfiler accumulates the records seen on each shard.
+type shardProfiler struct {
+	mu     sync.Mutex
+	shards map[string]*shardSample
+}
+
+type shardSample struct {
+	records int
+	bytes   int
+	keys    map[string]int
+}
+
+func (p *shardProfiler) Observe(shardId, partitionKey string, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.shards[shardId]
+	if !ok {
+		s = &shardSample{keys: map[string]int{}}
+		p.shards[shardId] = s
+	}
+	s.records++
+	s.bytes += size
+	s.keys[partitionKey]++
+}
+
+func (p *shardProfiler) Profiles(shardIds []string, window time.Duration, top int) []ShardProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profiles := []ShardProfile{}
+	for _, shardId := range shardIds {
+		profile := ShardProfile{ShardId: shardId, TopKeys: []KeyCount{}}
+		if s, ok := p.shards[shardId]; ok {
+			profile.Records = s.records
+			profile.Bytes = s.bytes
+			profile.RecordsPerSecond = float64(s.records) / window.Seconds()
+			profile.BytesPerSecond = float64(s.bytes) / window.Seconds()
+			if s.records > 0 {
+				profile.AverageSize = float64(s.bytes) / float64(s.records)
+			}
+
+			for key, count := range s.keys {
+				profile.TopKeys = append(profile.TopKeys, KeyCount{key, count})
+			}
+			sort.Slice(profile.TopKeys, func(i, j int) bool {
+				if profile.TopKeys[i].Records != profile.TopKeys[j].Records {
+					return profile.TopKeys[i].Records > profile.TopKeys[j].Records
+				}
+				return profile.TopKeys[i].PartitionKey < profile.TopKeys[j].PartitionKey
+			})
+			profile.TopKeys = profile.TopKeys[:min(top, len(profile.TopKeys))]
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+func init() {
+	statsCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	statsCmd.Flags().Duration("duration", 30*time.Second, "How long to sample new records for")
+	statsCmd.Flags().String("from", "", "Profile a past time range starting here instead of sampling new records, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	statsCmd.Flags().String("until", "", "End of the past time range, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	statsCmd.Flags().Int("top", 3, "Number of busiest partition keys to report per shard")
+	statsCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	statsCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(statsCmd)
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Profile the throughput of each shard",
+	Long: `Reports the records and bytes per second, average record size, and busiest partition keys of
+every open shard, to show how load is spread across a stream.
+
+By default, new records are sampled for --duration. With --from, a past time range is read
+instead, which is quicker for long windows but includes shards that have since been closed.`,
+	Run: runStatsCmd,
+}
+
+func runStatsCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	top, _ := cmd.Flags().GetInt("top")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	profiler, shardIds, window, err := profileShards(cmd, client, streamName, shards, duration, fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	profiles := profiler.Profiles(shardIds, window, top)
+	if output == "json" {
+		for _, profile := range profiles {
+			printJSON(profile)
+		}
+		return
+	}
+
+	rows := [][]string{}
+	for _, p := range profiles {
+		var keys []string
+		for _, key := range p.TopKeys {
+			keys = append(keys, fmt.Sprintf("%s (%.0f%%)", key.PartitionKey, 100*float64(key.Records)/float64(p.Records)))
+		}
+		rows = append(rows, []string{
+			p.ShardId,
+			fmt.Sprintf("%.1f", p.RecordsPerSecond),
+			formatBytes(p.BytesPerSecond) + "/s",
+			formatBytes(p.AverageSize),
+			orDash(strings.Join(keys, ", ")),
+		})
+	}
+	printTable(os.Stdout, []string{"SHARD", "RECORDS/S", "BYTES/S", "AVG SIZE", "TOP KEYS"}, rows)
+}
+
+// profileShards samples new records on every open shard for duration or, if fromS is set, reads
+// every shard over a past time range. It returns the profiler, the shards profiled and the length
+// of the window profiled.
+func profileShards(
+	cmd *cobra.Command,
+	client aws.KinesisAPI,
+	streamName string,
+	shards []types.Shard,
+	duration time.Duration,
+	fromS, untilS string,
+) (*shardProfiler, []string, time.Duration, error) {
+	profiler := &shardProfiler{shards: map[string]*shardSample{}}
+	var shardIds []string
+
+	if fromS != "" {
+		from, until, err := parseTimeRange(fromS, untilS)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		tailOptions := &TailOptions{AtTimestamp: &from}
+		var wg sync.WaitGroup
+		for _, shard := range shards {
+			shardId := *shard.ShardId
+			shardIds = append(shardIds, shardId)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+					if record.ApproximateArrivalTimestamp.After(until) {
+						return false
+					}
+					profiler.Observe(shardId, *record.PartitionKey, len(record.Data))
+					return true
+				})
+				if err != nil {
+					cmd.PrintErrf("%s: %s\n", shardId, err)
+				}
+			}()
+		}
+		wg.Wait()
+		return profiler, shardIds, until.Sub(from), nil
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), duration)
+	defer cancel()
+
+	start := time.Now()
+	tailOptions := &TailOptions{AtTimestamp: &start, NoData: true, PollInterval: time.Second}
+	records := make(chan *RecordOutput)
+	for _, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+		shardIds = append(shardIds, *shard.ShardId)
+		go tailStreamShard(ctx, client, &streamName, shard.ShardId, tailOptions, records)
+	}
+
+	cmd.PrintErrf("Sampling %d shards for %s\n", len(shardIds), duration)
+	for {
+		select {
+		case record := <-records:
+			profiler.Observe(*record.ShardId, *record.PartitionKey, *record.Size)
+		case <-ctx.Done():
+			return profiler, shardIds, duration, nil
+		}
+	}
+}
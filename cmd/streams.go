@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+const (
+	// Resharding a large stream can take a long time, so --wait is generous
+	streamWaitTimeout = 30 * time.Minute
+
+	streamPollInterval = 5 * time.Second
+)
+
+// waitForStreamActive polls until the stream is ACTIVE, calling onPoll (if set) with each summary
+// along the way so that callers can report progress.
+func waitForStreamActive(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	onPoll func(*types.StreamDescriptionSummary),
+) error {
+	ctx, cancel := context.WithTimeout(ctx, streamWaitTimeout)
+	defer cancel()
+
+	for {
+		output, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+			StreamName: &streamName,
+		})
+		if err != nil {
+			return err
+		}
+
+		summary := output.StreamDescriptionSummary
+		if onPoll != nil {
+			onPoll(summary)
+		}
+		slog.Info("waiting for stream", "stream", streamName, "status", summary.StreamStatus)
+
+		if summary.StreamStatus == types.StreamStatusActive {
+			return nil
+		}
+
+		aws.SleepContext(ctx, streamPollInterval)
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for %s to become ACTIVE: %w", streamName, ctx.Err())
+		}
+	}
+}
+
+// waitForStreamDeleted polls until the stream no longer exists.
+func waitForStreamDeleted(ctx context.Context, client aws.KinesisAPI, streamName string) error {
+	ctx, cancel := context.WithTimeout(ctx, streamWaitTimeout)
+	defer cancel()
+
+	for {
+		output, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+			StreamName: &streamName,
+		})
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info(
+			"waiting for stream to be deleted",
+			"stream", streamName,
+			"status", output.StreamDescriptionSummary.StreamStatus,
+		)
+
+		aws.SleepContext(ctx, streamPollInterval)
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for %s to be deleted: %w", streamName, ctx.Err())
+		}
+	}
+}
+
+// listStreamConsumers returns every enhanced fan-out consumer registered with the stream.
+func listStreamConsumers(ctx context.Context, client aws.KinesisAPI, streamARN string) ([]types.Consumer, error) {
+	var consumers []types.Consumer
+	paginator := kinesis.NewListStreamConsumersPaginator(client, &kinesis.ListStreamConsumersInput{
+		StreamARN: &streamARN,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, page.Consumers...)
+	}
+	return consumers, nil
+}
+
+// parseTags parses key=value pairs into a tag map.
+func parseTags(pairs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q: must be key=value", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
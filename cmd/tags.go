@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"kin/pkg/aws"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/spf13/cobra"
+)
+
+// Per-call limits of AddTagsToStream and RemoveTagsFromStream
+const (
+	maxTagsPerAdd    = 10
+	maxTagsPerRemove = 50
+)
+
+func init() {
+	tagsCmd.PersistentFlags().StringP("stream-name", "n", "", "Stream name (required)")
+	tagsCmd.MarkPersistentFlagRequired("stream-name")
+
+	tagsListCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	tagsAddCmd.Flags().StringP("file", "f", "", "File of key=value lines to add; blank lines and lines starting with # are ignored")
+
+	tagsCmd.AddCommand(tagsListCmd, tagsAddCmd, tagsRemoveCmd)
+	rootCmd.AddCommand(tagsCmd)
+}
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "List, add or remove a stream's tags",
+}
+
+var tagsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a stream's tags",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := validateOutput(output, "table", "json"); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		tags, err := listStreamTags(cmd.Context(), client, streamName)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if output == "json" {
+			printJSON(tags)
+			return
+		}
+
+		rows := [][]string{}
+		for _, key := range slices.Sorted(maps.Keys(tags)) {
+			rows = append(rows, []string{key, tags[key]})
+		}
+		printTable(os.Stdout, []string{"KEY", "VALUE"}, rows)
+	},
+}
+
+var tagsAddCmd = &cobra.Command{
+	Use:   "add [key=value...]",
+	Short: "Add or update tags on a stream",
+	Long: `Adds tags to a stream, replacing the values of any that already exist. Tags are given as
+key=value arguments, read from a file with --file, or both.
+
+Example:
+  kin tags add -n my-stream team=payments env=prod
+  kin tags add -n my-stream -f tags.txt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+		file, _ := cmd.Flags().GetString("file")
+
+		pairs := args
+		if file != "" {
+			filePairs, err := readTagFile(file)
+			if err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+			pairs = append(filePairs, pairs...)
+		}
+		if len(pairs) == 0 {
+			cmd.PrintErrln("no tags given")
+			os.Exit(1)
+		}
+
+		tags, err := parseTags(pairs)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		keys := slices.Sorted(maps.Keys(tags))
+		for batch := range slices.Chunk(keys, maxTagsPerAdd) {
+			batchTags := map[string]string{}
+			for _, key := range batch {
+				batchTags[key] = tags[key]
+			}
+
+			_, err := client.AddTagsToStream(cmd.Context(), &kinesis.AddTagsToStreamInput{
+				StreamName: &streamName,
+				Tags:       batchTags,
+			})
+			if err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+		}
+		cmd.PrintErrf("Added %d tags to %s\n", len(tags), streamName)
+	},
+}
+
+var tagsRemoveCmd = &cobra.Command{
+	Use:   "remove key...",
+	Short: "Remove tags from a stream",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		streamName, _ := cmd.Flags().GetString("stream-name")
+
+		client, err := aws.GetKinesisClient()
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		for batch := range slices.Chunk(args, maxTagsPerRemove) {
+			_, err := client.RemoveTagsFromStream(cmd.Context(), &kinesis.RemoveTagsFromStreamInput{
+				StreamName: &streamName,
+				TagKeys:    batch,
+			})
+			if err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+		}
+		cmd.PrintErrf("Removed %d tags from %s\n", len(args), streamName)
+	},
+}
+
+// listStreamTags returns every tag on the stream, following pagination.
+func listStreamTags(ctx context.Context, client aws.KinesisAPI, streamName string) (map[string]string, error) {
+	tags := map[string]string{}
+	input := &kinesis.ListTagsForStreamInput{StreamName: &streamName}
+	for {
+		output, err := client.ListTagsForStream(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range output.Tags {
+			tags[*tag.Key] = awssdk.ToString(tag.Value)
+		}
+
+		if !awssdk.ToBool(output.HasMoreTags) || len(output.Tags) == 0 {
+			return tags, nil
+		}
+		input.ExclusiveStartTagKey = output.Tags[len(output.Tags)-1].Key
+	}
+}
+
+// readTagFile reads key=value lines from a file, skipping blank lines and # comments.
+func readTagFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairs []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !strings.Contains(text, "=") {
+			return nil, fmt.Errorf("%s:%d: expected key=value", path, line)
+		}
+		pairs = append(pairs, text)
+	}
+	return pairs, scanner.Err()
+}
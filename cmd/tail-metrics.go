@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TailMetrics holds the Prometheus collectors exposed while tailing a stream. All metrics are
+// labelled by shard so that a single hot or lagging shard stands out.
+type TailMetrics struct {
+	registry *prometheus.Registry
+
+	recordsConsumed    *prometheus.CounterVec
+	bytesConsumed      *prometheus.CounterVec
+	getRecordsLatency  *prometheus.HistogramVec
+	throttles          *prometheus.CounterVec
+	millisBehindLatest *prometheus.GaugeVec
+}
+
+func NewTailMetrics(streamName string) *TailMetrics {
+	constLabels := prometheus.Labels{"stream": streamName}
+	labels := []string{"shard"}
+
+	m := &TailMetrics{
+		registry: prometheus.NewRegistry(),
+
+		recordsConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "kin_records_consumed_total",
+			Help:        "Number of records read from the stream.",
+			ConstLabels: constLabels,
+		}, labels),
+		bytesConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "kin_bytes_consumed_total",
+			Help:        "Number of payload bytes read from the stream.",
+			ConstLabels: constLabels,
+		}, labels),
+		getRecordsLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "kin_get_records_duration_seconds",
+			Help:        "Latency of GetRecords calls.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
+		}, labels),
+		throttles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "kin_get_records_throttled_total",
+			Help:        "Number of GetRecords calls rejected with ProvisionedThroughputExceeded.",
+			ConstLabels: constLabels,
+		}, labels),
+		millisBehindLatest: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "kin_millis_behind_latest",
+			Help:        "MillisBehindLatest reported by the most recent GetRecords call.",
+			ConstLabels: constLabels,
+		}, labels),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.recordsConsumed,
+		m.bytesConsumed,
+		m.getRecordsLatency,
+		m.throttles,
+		m.millisBehindLatest,
+	)
+
+	return m
+}
+
+// ObserveGetRecords records the outcome of a successful GetRecords call for a shard.
+func (m *TailMetrics) ObserveGetRecords(
+	shardId string,
+	latency time.Duration,
+	records, bytes int,
+	millisBehindLatest *int64,
+) {
+	m.getRecordsLatency.WithLabelValues(shardId).Observe(latency.Seconds())
+	m.recordsConsumed.WithLabelValues(shardId).Add(float64(records))
+	m.bytesConsumed.WithLabelValues(shardId).Add(float64(bytes))
+
+	if millisBehindLatest != nil {
+		m.millisBehindLatest.WithLabelValues(shardId).Set(float64(*millisBehindLatest))
+	}
+}
+
+func (m *TailMetrics) ObserveThrottle(shardId string) {
+	m.throttles.WithLabelValues(shardId).Inc()
+}
+
+// ListenAndServe exposes the metrics at /metrics on the given address. It blocks until the
+// server fails.
+func (m *TailMetrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TailStats accumulates throughput counters across all shards being tailed so that a periodic
+// status line can be reported without interfering with record output on stdout.
+type TailStats struct {
+	mu sync.Mutex
+
+	totalRecords int64
+	totalBytes   int64
+
+	// Counters since the last report, used to compute rates
+	intervalRecords int64
+	intervalBytes   int64
+	intervalStart   time.Time
+
+	millisBehindLatest map[string]int64
+	shards             map[string]*ShardTotals
+}
+
+// ShardTotals are the cumulative counters for a single shard.
+type ShardTotals struct {
+	Records            int64
+	Bytes              int64
+	Throttles          int64
+	MillisBehindLatest int64
+}
+
+func NewTailStats() *TailStats {
+	return &TailStats{
+		intervalStart:      time.Now(),
+		millisBehindLatest: map[string]int64{},
+		shards:             map[string]*ShardTotals{},
+	}
+}
+
+func (s *TailStats) shard(shardId string) *ShardTotals {
+	totals, ok := s.shards[shardId]
+	if !ok {
+		totals = &ShardTotals{}
+		s.shards[shardId] = totals
+	}
+	return totals
+}
+
+// Observe records the result of a single GetRecords call for a shard.
+func (s *TailStats) Observe(shardId string, records, bytes int, millisBehindLatest *int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalRecords += int64(records)
+	s.totalBytes += int64(bytes)
+	s.intervalRecords += int64(records)
+	s.intervalBytes += int64(bytes)
+
+	totals := s.shard(shardId)
+	totals.Records += int64(records)
+	totals.Bytes += int64(bytes)
+
+	if millisBehindLatest != nil {
+		s.millisBehindLatest[shardId] = *millisBehindLatest
+		totals.MillisBehindLatest = *millisBehindLatest
+	}
+}
+
+// ObserveGetRecords is Observe, for TailStats to be a tailer.Observer; latency isn't reported.
+func (s *TailStats) ObserveGetRecords(shardId string, latency time.Duration, records, bytes int, millisBehindLatest *int64) {
+	s.Observe(shardId, records, bytes, millisBehindLatest)
+}
+
+// ObserveThrottle records a GetRecords call for a shard that was throttled.
+func (s *TailStats) ObserveThrottle(shardId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shard(shardId).Throttles++
+}
+
+// Shards returns a copy of the cumulative counters of every shard observed so far.
+func (s *TailStats) Shards() map[string]ShardTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards := make(map[string]ShardTotals, len(s.shards))
+	for shardId, totals := range s.shards {
+		shards[shardId] = *totals
+	}
+	return shards
+}
+
+// Report writes a single status line describing throughput since the previous report, then
+// resets the interval counters.
+func (s *TailStats) Report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(s.intervalStart).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+
+	shardIds := make([]string, 0, len(s.millisBehindLatest))
+	for shardId := range s.millisBehindLatest {
+		shardIds = append(shardIds, shardId)
+	}
+	sort.Strings(shardIds)
+
+	lag := make([]string, 0, len(shardIds))
+	for _, shardId := range shardIds {
+		lag = append(lag, fmt.Sprintf("%s=%dms", shardId, s.millisBehindLatest[shardId]))
+	}
+
+	fmt.Fprintf(
+		w,
+		"[stats] %.1f records/s, %s/s | total: %d records, %s | behind: %s\n",
+		float64(s.intervalRecords)/elapsed,
+		formatBytes(float64(s.intervalBytes)/elapsed),
+		s.totalRecords,
+		formatBytes(float64(s.totalBytes)),
+		strings.Join(lag, " "),
+	)
+
+	s.intervalRecords = 0
+	s.intervalBytes = 0
+	s.intervalStart = now
+}
+
+// Run reports stats to w every interval, forever.
+func (s *TailStats) Run(w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.Report(w)
+	}
+}
+
+func formatBytes(b float64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%.0f B", b)
+	}
+
+	div, exp := float64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", b/div, "KMGTPE"[exp])
+}
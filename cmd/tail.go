@@ -2,29 +2,66 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"kin/pkg/aws"
+	"kin/pkg/checkpoint"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"kin/pkg/tailer"
+	"kin/pkg/transform"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
-	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
-type TailOptions struct {
-	AtTimestamp *time.Time
-}
+// By default we poll slowly enough to leave room for other consumers
+const defaultPollInterval = tailer.DefaultPollInterval
+
+// maxShardRestarts is how many times a shard is restarted after panicking, skipping the record it
+// panicked on each time, before it's given up on
+const maxShardRestarts = 3
 
-type RecordOutput struct {
-	ShardId                     *string
-	PartitionKey                *string
-	SequenceNumber              *string
-	ApproximateArrivalTimestamp *time.Time
-	EncryptionType              types.EncryptionType
-	Data                        *interface{}
+type TailOptions struct {
+	AtTimestamp     *time.Time
+	NoData          bool
+	IncludeRaw      bool
+	TimestampFormat *TimestampFormat
+	FieldCase       string
+	Stats           *TailStats
+	Metrics         *TailMetrics
+
+	// Decoder, if set, decodes payloads in place of the default of JSON, then text, then base64
+	Decoder decode.Decoder
+	// PreserveKeyOrder decodes JSON objects left to the default as *decode.Object, keeping the
+	// order of their keys
+	PreserveKeyOrder bool
+
+	// PollInterval is how long to wait between GetRecords calls on each shard, defaulting to
+	// defaultPollInterval when zero
+	PollInterval time.Duration
+
+	// Checkpointer, if set, records the last sequence number output for each shard. With Resume,
+	// shards that have a checkpoint start immediately after it instead of at AtTimestamp.
+	Checkpointer Checkpointer
+	Resume       bool
+
+	// ConsumerGroup, if set, is the lease table used to split shards between every kin process
+	// tailing the stream with the same group name. WorkerId identifies this process within it.
+	ConsumerGroup string
+	WorkerId      string
+
+	// Errors is how records that fail to decode are handled, leaving it to the command if nil
+	Errors *errorPolicy
+
+	// Progress, if set, is told about shards' iterators and every batch read from them
+	Progress *progressReporter
+
+	// Gaps, if set, checks that the records read from each shard are continuous
+	Gaps *gapDetector
 }
 
 func init() {
@@ -32,6 +69,21 @@ func init() {
 	tailCmd.Flags().StringP("shard", "s", "", "Shard id; if not specified, all shards will be tailed")
 	tailCmd.Flags().StringP("timestamp", "t", "", "Timestamp at which to begin consuming events (ex: 2021-09-10T11:12:13Z")
 	tailCmd.Flags().String("from", "", "Start tailing events starting from this long ago (ex: 1h)")
+	addRecordOutputFlags(tailCmd.Flags())
+	addTransformFlags(tailCmd.Flags())
+	addSinkFlags(tailCmd.Flags())
+	addErrorPolicyFlags(tailCmd.Flags())
+	addProgressFlag(tailCmd.Flags())
+	tailCmd.Flags().Bool("detect-gaps", false, "Warn whenever records appear to have been skipped or read out of order in a shard, such as when its iterator is restarted past the last record read, and count them when tail stops")
+	tailCmd.Flags().Bool("stats", false, "Periodically write throughput and lag statistics to stderr")
+	tailCmd.Flags().Duration("stats-interval", 5*time.Second, "How often to write statistics when --stats is enabled")
+	tailCmd.Flags().String("checkpoint-file", "", "File in which to persist the last sequence number read from each shard (default ~/.kin/checkpoints/<stream>.json when --resume is given)")
+	tailCmd.Flags().String("checkpoint", "", "Checkpoint store URI, either file://<path> or dynamodb://<table> for a KCL lease table")
+	tailCmd.Flags().String("app-name", "", "KCL application name; used as the lease table name when --checkpoint is dynamodb:// without a table")
+	tailCmd.Flags().Bool("resume", false, "Resume each shard immediately after its checkpointed sequence number")
+	tailCmd.Flags().String("consumer-group", "", "Split shards between all kin processes using this group name, coordinating through a DynamoDB lease table of the same name")
+	tailCmd.Flags().String("metrics-listen", "", "Address on which to expose Prometheus metrics while tailing (ex: :9100)")
+	tailCmd.Flags().String("schema", "", "JSON Schema file to validate each payload against, logging a warning for every record that doesn't match")
 	tailCmd.MarkFlagRequired("stream-name")
 
 	rootCmd.AddCommand(tailCmd)
@@ -41,7 +93,26 @@ var tailCmd = &cobra.Command{
 	Use:   "tail",
 	Short: "Tail records from a Kinesis Data Stream",
 	Long: `Continuously reads records from the target stream. Each record's payload will be
-deserialized as JSON if possible; otherwise it will be returned as a base64-encoded string.`,
+deserialized as JSON if possible; otherwise it will be returned as a plain string if it is
+printable UTF-8 text, or as a base64-encoded string if it is binary. --decode chains other
+decoders, such as gzip,kpl,json. Decoded records then pass through --unwrap, --transform,
+--redact, --fields and --filter, in that order.
+
+Records are written as newline-delimited JSON, or logfmt lines with --output logfmt, to stdout,
+or with --sink to files, S3, another stream or an HTTP endpoint, which are sent what's buffered
+every --flush-interval. --output-dir writes each shard's records to a file of its own, in order,
+optionally split by hour too. --compress gzip compresses files as they're written, flushing with
+each --flush-interval so they can be read while open; S3 objects are gzipped unless --compress
+none is given. Checkpoints only cover records that have been sent.
+
+--output raw0 writes each payload exactly as it was put, whatever it decodes or is transformed
+to, followed by a NUL byte rather than a newline, so that binary payloads can be piped to tools
+like xargs -0. Records --filter drops are still left out.
+
+Records that fail to decode are output undecoded, and ones that fail to be transformed or written
+stop tail. --strict stops at any failure, --filter expressions that fail included, having first
+written out and checkpointed what came before; --skip-errors leaves failing records out instead,
+summarizing how many were when tail stops.`,
 	Run: runTailCmd,
 }
 
@@ -53,6 +124,34 @@ func runTailCmd(cmd *cobra.Command, args []string) {
 		cmd.PrintErrln(err)
 		os.Exit(1)
 	}
+	errs := tailOptions.Errors
+	onShutdown(func() {
+		errs.Summarize(os.Stderr)
+		tailOptions.Gaps.Summarize(os.Stderr)
+	})
+
+	// Records are validated as they were decoded, before being transformed
+	var stages []transform.Func
+	if schemaPath, _ := cmd.Flags().GetString("schema"); schemaPath != "" {
+		if tailOptions.NoData {
+			cmd.PrintErrln("--schema can't be used with --no-data")
+			os.Exit(1)
+		}
+
+		validator, err := newPayloadValidator(schemaPath)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+		stages = append(stages, validator.Transform())
+	}
+
+	transforms, err := transformsFromFlags(cmd.Flags(), tailOptions.NoData, errs)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	stages = append(stages, transforms...)
 
 	client, err := aws.GetKinesisClient()
 	if err != nil {
@@ -60,25 +159,156 @@ func runTailCmd(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if tailOptions.Stats != nil {
+		statsInterval, _ := cmd.Flags().GetDuration("stats-interval")
+		if statsInterval <= 0 {
+			cmd.PrintErrln("--stats-interval must be positive")
+			os.Exit(1)
+		}
+		go tailOptions.Stats.Run(os.Stderr, statsInterval)
+	}
+
+	metricsListen, _ := cmd.Flags().GetString("metrics-listen")
+	if metricsListen != "" {
+		tailOptions.Metrics = NewTailMetrics(streamName)
+		go func() {
+			err := tailOptions.Metrics.ListenAndServe(metricsListen)
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}()
+	}
+
+	if tailOptions.Checkpointer != nil {
+		checkpointer := tailOptions.Checkpointer
+		go runCheckpointer(checkpointer, time.Second, func(err error) {
+			slog.Error("failed to write checkpoint", "error", err)
+		})
+		onShutdown(func() {
+			if err := checkpointer.Flush(); err != nil {
+				slog.Error("failed to write checkpoint", "error", err)
+			}
+		})
+	}
+
+	out, err := newSinkFromFlags(cmd.Flags(), tailOptions.FieldCase)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	writer := newSinkWriter(transform.NewSink(out, stages...), tailOptions.Checkpointer)
+
+	// Registered after the checkpoint flush hook so that it runs first, checkpointing everything
+	// written before the checkpoints are flushed
+	onShutdown(func() {
+		if err := writer.Close(); err != nil {
+			slog.Error("failed to write records", "error", err)
+		}
+	})
+	flushInterval, _ := cmd.Flags().GetDuration("flush-interval")
+	go writer.FlushEvery(context.Background(), flushInterval, func(err error) {
+		if errs.Strict() {
+			cmd.PrintErrln("failed to write records:", err)
+			runShutdownHooks()
+			os.Exit(1)
+		}
+		var dropped *sink.DroppedError
+		if errors.As(err, &dropped) {
+			slog.Error("failed to write records", "error", err)
+			return
+		}
+		slog.Error("failed to write records; retrying", "error", err)
+	})
+
 	records := make(chan *RecordOutput)
 
-	if shardId != "" {
-		go tailStreamShard(client, &streamName, &shardId, tailOptions, records)
+	if tailOptions.ConsumerGroup != "" {
+		if shardId != "" {
+			cmd.PrintErrln("--shard can't be used with --consumer-group")
+			os.Exit(1)
+		}
+
+		coordinator, err := NewLeaseCoordinator(
+			client,
+			tailOptions.ConsumerGroup,
+			streamName,
+			tailOptions.WorkerId,
+			func(ctx context.Context, shardId string) error {
+				err := tailStreamShard(ctx, client, &streamName, &shardId, tailOptions, records)
+				if err != nil || ctx.Err() != nil {
+					return err
+				}
+
+				// The shard has been closed and fully read; mark it as such so that no worker
+				// picks it up again
+				if err := writer.FinishShard(ctx, shardId); err != nil {
+					return err
+				}
+				return tailOptions.Checkpointer.Flush()
+			},
+		)
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		// Registered after the checkpoint flush hook so that it runs first: leases have to be held
+		// for checkpoints to be written, so flush before giving them up
+		onShutdown(func() {
+			if err := tailOptions.Checkpointer.Flush(); err != nil {
+				slog.Error("failed to write checkpoint", "error", err)
+			}
+			coordinator.ReleaseAll()
+		})
+
+		go func() {
+			if err := coordinator.Run(context.Background()); err != nil {
+				cmd.PrintErrln(err)
+				os.Exit(1)
+			}
+		}()
+	} else if shardId != "" {
+		tailOptions.Progress.ShardsDiscovered([]string{shardId})
+		go tailStreamShard(context.Background(), client, &streamName, &shardId, tailOptions, records)
 	} else {
 		shardIds, err := getShardIds(client, &streamName)
 		if err != nil {
 			cmd.PrintErrln(err)
 			os.Exit(1)
 		}
+		tailOptions.Progress.ShardsDiscovered(shardIdsOf(shardIds))
 
 		for _, shardId := range shardIds {
-			go tailStreamShard(client, &streamName, shardId, tailOptions, records)
+			go tailStreamShard(context.Background(), client, &streamName, shardId, tailOptions, records)
 		}
 	}
 
 	for record := range records {
-		jsonBytes, _ := json.Marshal(record)
-		fmt.Println(string(jsonBytes))
+		if record.DecodeErr != nil {
+			skip, stop := errs.Handle(errDecode, record, record.DecodeErr)
+			if stop != nil {
+				cmd.PrintErrln(stop)
+				runShutdownHooks()
+				os.Exit(1)
+			}
+			if skip {
+				continue
+			}
+		}
+
+		if err := writer.Write(cmd.Context(), record); err != nil {
+			skip, stop := errs.Handle(errWrite, record, err)
+			if skip {
+				continue
+			}
+			if stop != nil {
+				// Write out and checkpoint everything before the record that failed
+				cmd.PrintErrln(stop)
+				runShutdownHooks()
+				os.Exit(1)
+			}
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
 	}
 }
 
@@ -100,12 +330,12 @@ func parseTailOpts(flags *pflag.FlagSet) (*TailOptions, error) {
 	}
 
 	// If timestamp wasn't specified, try getting "from" and calculating that as a duration
-	if atTimestamp == nil {
-		fromS, err := flags.GetString("from")
-		if err != nil {
-			return nil, err
-		}
+	fromS, err := flags.GetString("from")
+	if err != nil {
+		return nil, err
+	}
 
+	if atTimestamp == nil && fromS != "" {
 		from, err := time.ParseDuration(fromS)
 		if err != nil {
 			return nil, err
@@ -114,12 +344,127 @@ func parseTailOpts(flags *pflag.FlagSet) (*TailOptions, error) {
 		atTimestamp = &t
 	}
 
-	return &TailOptions{
-		AtTimestamp: atTimestamp,
-	}, nil
+	tailOptions := &TailOptions{AtTimestamp: atTimestamp}
+	if err := parseRecordOutputOpts(flags, tailOptions); err != nil {
+		return nil, err
+	}
+
+	tailOptions.Errors, err = errorPolicyFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := flags.GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	if output == "raw0" {
+		// raw0 outputs payloads as they were put, so they have to be kept
+		tailOptions.IncludeRaw = true
+	}
+
+	showStats, err := flags.GetBool("stats")
+	if err != nil {
+		return nil, err
+	}
+
+	var stats *TailStats
+	if showStats {
+		stats = NewTailStats()
+	}
+
+	resume, err := flags.GetBool("resume")
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointFile, err := flags.GetString("checkpoint-file")
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointURI, err := flags.GetString("checkpoint")
+	if err != nil {
+		return nil, err
+	}
+
+	appName, err := flags.GetString("app-name")
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpointURI != "" && checkpointFile != "" {
+		return nil, errors.New("--checkpoint and --checkpoint-file are mutually exclusive")
+	}
+	if checkpointURI == "" {
+		checkpointURI = checkpointFile
+	}
+
+	consumerGroup, err := flags.GetString("consumer-group")
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpointer Checkpointer
+	var workerId string
+	if consumerGroup != "" {
+		if checkpointURI != "" {
+			return nil, errors.New("--consumer-group checkpoints to its lease table; --checkpoint can't also be used")
+		}
+
+		// Group members always resume from the checkpoints in the lease table, and may only
+		// write checkpoints for the shards they currently hold
+		workerId = NewWorkerId()
+		dynamoCheckpointer, err := newDynamoDBCheckpointer(consumerGroup)
+		if err != nil {
+			return nil, err
+		}
+		dynamoCheckpointer.Owner = workerId
+
+		checkpointer = dynamoCheckpointer
+		resume = true
+	} else if checkpointURI != "" || resume {
+		streamName, err := flags.GetString("stream-name")
+		if err != nil {
+			return nil, err
+		}
+
+		if checkpointURI == "" {
+			checkpointURI, err = checkpoint.DefaultPath(streamName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		checkpointer, err = NewCheckpointer(checkpointURI, streamName, appName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	progress, err := progressFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	detectGaps, err := flags.GetBool("detect-gaps")
+	if err != nil {
+		return nil, err
+	}
+	if detectGaps {
+		tailOptions.Gaps = newGapDetector(progress)
+	}
+
+	tailOptions.Stats = stats
+	tailOptions.Progress = progress
+	tailOptions.Checkpointer = progress.Checkpointer(checkpointer)
+	tailOptions.Resume = resume
+	tailOptions.ConsumerGroup = consumerGroup
+	tailOptions.WorkerId = workerId
+	return tailOptions, nil
 }
 
-func getShardIds(client *kinesis.Client, streamName *string) ([]*string, error) {
+func getShardIds(client aws.KinesisReader, streamName *string) ([]*string, error) {
 	output, err := client.ListShards(context.TODO(), &kinesis.ListShardsInput{
 		StreamName: streamName,
 	})
@@ -134,85 +479,68 @@ func getShardIds(client *kinesis.Client, streamName *string) ([]*string, error)
 	return streamNames, nil
 }
 
+// tailStreamShard reads records from a single shard and sends them to out until the shard is
+// closed or ctx is cancelled.
 func tailStreamShard(
-	client *kinesis.Client,
+	ctx context.Context,
+	client aws.KinesisAPI,
 	streamName, shardId *string,
 	tailOptions *TailOptions,
 	out chan *RecordOutput,
 ) error {
-	shardIterator, err := getShardIterator(client, streamName, shardId, tailOptions)
-	if err != nil {
-		// FIXME What is the right way to handle the error? Right now I think we just totally ignore
-		// it, which seems bad.
-		fmt.Fprintln(os.Stderr, err)
-		return err
-	}
-
-	for {
-		res, err := client.GetRecords(
-			context.TODO(),
-			&kinesis.GetRecordsInput{ShardIterator: shardIterator},
-		)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return err
-		}
+	logger := slog.With("shard", *shardId)
 
-		for _, record := range res.Records {
-			var data interface{}
+	t := tailer.New(client, *streamName, tailerOptions(tailOptions)...)
+	return t.TailShard(ctx, *shardId, func(record *tailer.Record) error {
+		output := newRecordOutput(shardId, record.Record, record.MillisBehindLatest, tailOptions, logger)
+		tailOptions.Gaps.ObserveRecord(*shardId, *record.SequenceNumber)
 
-			err = json.Unmarshal(record.Data, &data)
-			if err != nil {
-				// If we can't decode it as JSON, fallback to base64-encoded binary
-				// TODO Logging the error at debug-level could be informative
-				data = record.Data
-			}
-
-			output := RecordOutput{
-				ShardId:                     shardId,
-				PartitionKey:                record.PartitionKey,
-				SequenceNumber:              record.SequenceNumber,
-				ApproximateArrivalTimestamp: record.ApproximateArrivalTimestamp,
-				EncryptionType:              record.EncryptionType,
-				Data:                        &data,
-			}
-			out <- &output
-		}
-
-		shardIterator = res.NextShardIterator
-		if shardIterator == nil {
-			break
+		select {
+		case out <- &output:
+		case <-ctx.Done():
 		}
+		return nil
+	})
+}
 
-		time.Sleep(2 * time.Second)
+// tailerOptions configures a Tailer to read as tailOptions describe.
+func tailerOptions(tailOptions *TailOptions) []tailer.Option {
+	opts := []tailer.Option{
+		tailer.WithPollInterval(tailOptions.PollInterval),
+		tailer.WithGetRecordsRate(getRecordsRate),
+		tailer.WithPanicRecovery(maxShardRestarts),
 	}
-
-	return nil
+	if tailOptions.AtTimestamp != nil {
+		opts = append(opts, tailer.WithStartPosition(tailer.AtTimestamp(*tailOptions.AtTimestamp)))
+	}
+	if tailOptions.Resume && tailOptions.Checkpointer != nil {
+		// Commands checkpoint records themselves once they've been output, so the Tailer only
+		// resumes from them
+		opts = append(opts, tailer.WithCheckpointer(resumeOnlyCheckpointer{tailOptions.Checkpointer}))
+	}
+	if tailOptions.Stats != nil {
+		opts = append(opts, tailer.WithObserver(tailOptions.Stats))
+	}
+	if tailOptions.Metrics != nil {
+		opts = append(opts, tailer.WithObserver(tailOptions.Metrics))
+	}
+	if tailOptions.Progress != nil {
+		opts = append(opts, tailer.WithObserver(tailOptions.Progress))
+	}
+	if tailOptions.Gaps != nil {
+		opts = append(opts, tailer.WithObserver(tailOptions.Gaps))
+	}
+	return opts
 }
 
-func getShardIterator(client *kinesis.Client, streamName *string, shardId *string, options *TailOptions) (*string, error) {
-	var iteratorType types.ShardIteratorType = types.ShardIteratorTypeAtTimestamp
-	switch {
-	case options.AtTimestamp != nil:
-		iteratorType = types.ShardIteratorTypeAtTimestamp
-
-	default:
-		iteratorType = types.ShardIteratorTypeTrimHorizon
-	}
+// resumeOnlyCheckpointer reads checkpoints but ignores the Tailer's updates to them.
+type resumeOnlyCheckpointer struct {
+	Checkpointer
+}
 
-	shardIteratorOutput, err := client.GetShardIterator(
-		context.TODO(),
-		&kinesis.GetShardIteratorInput{
-			ShardId:           shardId,
-			ShardIteratorType: iteratorType,
-			StreamName:        streamName,
-			Timestamp:         options.AtTimestamp,
-		},
-	)
+func (resumeOnlyCheckpointer) Set(shardId, sequenceNumber string) {}
 
-	if err != nil {
-		return nil, err
-	} else {
-		return shardIteratorOutput.ShardIterator, nil
-	}
+func getShardIterator(client aws.KinesisReader, streamName *string, shardId *string, options *TailOptions) (*string, error) {
+	t := tailer.New(client, *streamName, tailerOptions(options)...)
+	return t.ShardIterator(context.TODO(), *shardId)
 }
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseTimeOrAgo parses either an RFC 3339 timestamp or a duration, which is taken to mean that
+// long before now (ex: 2h).
+func ParseTimeOrAgo(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	ago, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a duration", s)
+	}
+	return now.Add(-ago), nil
+}
@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/spf13/cobra"
+)
+
+// Kinesis accepts up to 1,000 records or 1 MiB per second of writes into each shard; the
+// throughput bars in top show how close each shard is to whichever limit it's nearer
+const (
+	shardRecordsPerSecondLimit = 1000
+	shardBytesPerSecondLimit   = 1024 * 1024
+)
+
+// How many records the preview pane keeps, and how often records are handed to the UI
+const (
+	topPreviewSize   = 500
+	topFlushInterval = 250 * time.Millisecond
+)
+
+var (
+	topTitleStyle  = lipgloss.NewStyle().Bold(true)
+	topHeaderStyle = lipgloss.NewStyle().Bold(true).Underline(true)
+	topHelpStyle   = lipgloss.NewStyle().Faint(true)
+	topAlertStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+	topBarStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	topHotBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+func init() {
+	topCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	topCmd.Flags().Duration("window", 10*time.Second, "Period over which throughput is averaged")
+	topCmd.Flags().Duration("poll-interval", defaultPollInterval, "How long to wait between GetRecords calls on each shard")
+	topCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(topCmd)
+}
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Live dashboard of a stream's shards and records",
+	Long: `Tails every open shard of a stream and shows a live dashboard: throughput of each shard against
+the per-shard write limits, how far behind the latest record each shard's reader is, how often
+reads have been throttled, and a scrolling preview of the records arriving.
+
+Keys:
+  p, space   pause or resume the record preview
+  /          filter the record preview by partition key or payload
+  esc        clear the filter
+  q          quit`,
+	Run: runTopCmd,
+}
+
+func runTopCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	window, _ := cmd.Flags().GetDuration("window")
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	// Anything logged to the terminal would be drawn over by the dashboard
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	now := time.Now()
+	tailOptions := &TailOptions{
+		AtTimestamp:  &now,
+		Stats:        NewTailStats(),
+		PollInterval: pollInterval,
+	}
+
+	model := &topModel{
+		streamName: streamName,
+		stats:      tailOptions.Stats,
+		window:     window,
+	}
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+
+	records := make(chan *RecordOutput)
+	for _, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+		model.shardIds = append(model.shardIds, *shard.ShardId)
+
+		go func() {
+			if err := tailStreamShard(ctx, client, &streamName, shard.ShardId, tailOptions, records); err != nil {
+				program.Send(topErrorMsg{*shard.ShardId, err})
+			}
+		}()
+	}
+	go forwardTopRecords(ctx, program, records)
+
+	if _, err := program.Run(); err != nil && ctx.Err() == nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+}
+
+// forwardTopRecords hands records to the UI in batches, so that a busy stream doesn't redraw the
+// screen for every record.
+func forwardTopRecords(ctx context.Context, program *tea.Program, records <-chan *RecordOutput) {
+	ticker := time.NewTicker(topFlushInterval)
+	defer ticker.Stop()
+
+	var batch topRecordsMsg
+	for {
+		select {
+		case record := <-records:
+			batch = append(batch, record)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				program.Send(batch)
+				batch = nil
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type topTickMsg time.Time
+
+type topRecordsMsg []*RecordOutput
+
+type topErrorMsg struct {
+	shardId string
+	err     error
+}
+
+type topSnapshot struct {
+	at     time.Time
+	shards map[string]ShardTotals
+}
+
+type topModel struct {
+	streamName string
+	shardIds   []string
+	stats      *TailStats
+	window     time.Duration
+
+	// Snapshots of the shard counters over the last window, oldest first, to compute rates from
+	snapshots []topSnapshot
+
+	previews []*RecordOutput
+	paused   bool
+	filter   string
+
+	// editing is set while a new filter is being typed into input
+	editing bool
+	input   string
+
+	lastError     string
+	width, height int
+}
+
+func topTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return topTickMsg(t)
+	})
+}
+
+func (m *topModel) Init() tea.Cmd {
+	m.snapshots = []topSnapshot{{time.Now(), m.stats.Shards()}}
+	return topTick()
+}
+
+func (m *topModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case topTickMsg:
+		now := time.Time(msg)
+		m.snapshots = append(m.snapshots, topSnapshot{now, m.stats.Shards()})
+
+		// Keep the newest snapshot that's at least a window old as the baseline for rates
+		cutoff := now.Add(-m.window)
+		for len(m.snapshots) > 2 && !m.snapshots[1].at.After(cutoff) {
+			m.snapshots = m.snapshots[1:]
+		}
+		return m, topTick()
+
+	case topRecordsMsg:
+		if m.paused {
+			break
+		}
+		for _, record := range msg {
+			if m.matches(record) {
+				m.previews = append(m.previews, record)
+			}
+		}
+		if len(m.previews) > topPreviewSize {
+			m.previews = m.previews[len(m.previews)-topPreviewSize:]
+		}
+
+	case topErrorMsg:
+		m.lastError = fmt.Sprintf("%s: %s", msg.shardId, msg.err)
+
+	case tea.KeyMsg:
+		if m.editing {
+			switch msg.Type {
+			case tea.KeyEnter:
+				m.filter = m.input
+				m.previews = nil
+				m.editing = false
+			case tea.KeyEsc:
+				m.editing = false
+			case tea.KeyBackspace:
+				if len(m.input) > 0 {
+					runes := []rune(m.input)
+					m.input = string(runes[:len(runes)-1])
+				}
+			case tea.KeyRunes, tea.KeySpace:
+				m.input += string(msg.Runes)
+			case tea.KeyCtrlC:
+				return m, tea.Quit
+			}
+			break
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "p", " ":
+			m.paused = !m.paused
+		case "/":
+			m.editing = true
+			m.input = m.filter
+		case "esc":
+			if m.filter != "" {
+				m.filter = ""
+				m.previews = nil
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// matches reports whether a record's partition key or payload contains the filter, ignoring case.
+func (m *topModel) matches(record *RecordOutput) bool {
+	if m.filter == "" {
+		return true
+	}
+	filter := strings.ToLower(m.filter)
+	return strings.Contains(strings.ToLower(*record.PartitionKey), filter) ||
+		strings.Contains(strings.ToLower(previewData(record)), filter)
+}
+
+func (m *topModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	var lines []string
+
+	// Rates of each shard over the snapshots we have
+	first, last := m.snapshots[0], m.snapshots[len(m.snapshots)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+
+	var totalRecords, totalBytes float64
+	shardLines := []string{topHeaderStyle.Render(fmt.Sprintf("%-22s %-22s %10s %11s %10s %9s", "SHARD", "% OF WRITE LIMIT", "RECORDS/S", "BYTES/S", "BEHIND", "THROTTLES"))}
+	for _, shardId := range m.shardIds {
+		now, before := last.shards[shardId], first.shards[shardId]
+		recordsPerSecond := float64(now.Records-before.Records) / elapsed
+		bytesPerSecond := float64(now.Bytes-before.Bytes) / elapsed
+		totalRecords += recordsPerSecond
+		totalBytes += bytesPerSecond
+
+		load := shardLoad(recordsPerSecond, bytesPerSecond)
+		throttles := fmt.Sprintf("%9d", now.Throttles)
+		if now.Throttles > before.Throttles {
+			throttles = topAlertStyle.Render(throttles)
+		}
+
+		shardLines = append(shardLines, fmt.Sprintf(
+			"%-22s %s %10.1f %11s %10s %s",
+			shardId,
+			loadBar(load, 16),
+			recordsPerSecond,
+			formatBytes(bytesPerSecond)+"/s",
+			formatMillis(float64(now.MillisBehindLatest), 0),
+			throttles,
+		))
+	}
+
+	status := ""
+	if m.paused {
+		status += "  " + topAlertStyle.Render("PAUSED")
+	}
+	if m.filter != "" {
+		status += fmt.Sprintf("  filter: %q", m.filter)
+	}
+	lines = append(lines, topTitleStyle.Render(fmt.Sprintf(
+		"kin top · %s · %d shards · %.1f records/s · %s/s",
+		m.streamName, len(m.shardIds), totalRecords, formatBytes(totalBytes),
+	))+status, "")
+	lines = append(lines, shardLines...)
+	lines = append(lines, "", topHeaderStyle.Render("RECORDS"))
+
+	footer := topHelpStyle.Render("q quit · p pause · / filter · esc clear filter")
+	switch {
+	case m.editing:
+		footer = "filter: " + m.input + "█"
+	case m.lastError != "":
+		footer = topAlertStyle.Render(m.lastError)
+	}
+
+	// The preview pane takes whatever height is left, showing the newest records
+	room := max(m.height-len(lines)-1, 0)
+	previews := m.previews[max(len(m.previews)-room, 0):]
+	for _, record := range previews {
+		lines = append(lines, fmt.Sprintf(
+			"%s %s %s %s",
+			record.ApproximateArrivalTimestamp.Local().Format(time.TimeOnly),
+			*record.ShardId,
+			*record.PartitionKey,
+			previewData(record),
+		))
+	}
+	for range room - len(previews) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer)
+
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, m.width, "…")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// loadBar draws a fraction between 0 and 1 as a bar of the given width, followed by a percentage.
+func loadBar(fraction float64, width int) string {
+	filled := min(int(fraction*float64(width)+0.5), width)
+	style := topBarStyle
+	if fraction >= hotShardLoad {
+		style = topHotBarStyle
+	}
+	return style.Render(strings.Repeat("█", filled)) + strings.Repeat("░", width-filled) + fmt.Sprintf(" %4.0f%%", 100*fraction)
+}
+
+// previewData renders a record's payload on a single line.
+func previewData(record *RecordOutput) string {
+	if record.Data == nil {
+		return ""
+	}
+	if s, ok := (*record.Data).(string); ok {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	data, _ := json.Marshal(*record.Data)
+	return string(data)
+}
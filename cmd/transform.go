@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"kin/pkg/transform"
+
+	"github.com/spf13/pflag"
+)
+
+// addTransformFlags registers the flags selecting the stages records pass through between being
+// decoded and being output.
+func addTransformFlags(flags *pflag.FlagSet) {
+	flags.String("unwrap", "", "Replace payloads wrapped in an event envelope with what's inside, keeping the envelope's other fields as envelope: sns, eventbridge, lambda (destination records), or auto for any of them")
+	addCELTransformFlag(flags)
+	flags.StringSlice("redact", nil, "Replace these fields of JSON payloads with [REDACTED], as dot-separated paths (ex: customer.email)")
+	flags.StringSlice("fields", nil, "Only output these fields of JSON payloads, as dot-separated paths (ex: orderId,customer.id)")
+	flags.String("filter", "", "jq expression a record's payload must make true for it to be output, applied after the others (ex: '.status==\"FAILED\"')")
+}
+
+// addCELTransformFlag registers --transform, for commands that rewrite payloads with it alone.
+func addCELTransformFlag(flags *pflag.FlagSet) {
+	flags.String("transform", "", "CEL expression whose result replaces each payload, which it sees as data (ex: 'data.omit(\"ssn\").set(\"total\", data.price * data.qty)')")
+}
+
+// celTransformFromFlags returns the --transform stage, or nil if there isn't one.
+func celTransformFromFlags(flags *pflag.FlagSet) (transform.Func, error) {
+	expression, err := flags.GetString("transform")
+	if err != nil || expression == "" {
+		return nil, err
+	}
+
+	stage, err := transform.CEL(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --transform: %w", err)
+	}
+	return stage, nil
+}
+
+// transformsFromFlags returns the stages given with addTransformFlags's flags, in the order they
+// apply: payloads are rewritten, then filtered. Records they fail on are handled by errs; by
+// default, failing to rewrite one stops the command, and a --filter that fails doesn't match.
+func transformsFromFlags(flags *pflag.FlagSet, noData bool, errs *errorPolicy) ([]transform.Func, error) {
+	unwrapS, err := flags.GetString("unwrap")
+	if err != nil {
+		return nil, err
+	}
+
+	celTransform, err := celTransformFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	redact, err := flags.GetStringSlice("redact")
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := flags.GetStringSlice("fields")
+	if err != nil {
+		return nil, err
+	}
+
+	filterS, err := flags.GetString("filter")
+	if err != nil {
+		return nil, err
+	}
+
+	if noData && (unwrapS != "" || celTransform != nil || len(redact) > 0 || len(fields) > 0 || filterS != "") {
+		return nil, errors.New("--unwrap, --transform, --redact, --fields and --filter can't be used with --no-data")
+	}
+
+	var stages []transform.Func
+	if unwrapS != "" {
+		unwrap, err := transform.Unwrap(unwrapS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --unwrap: %w", err)
+		}
+		stages = append(stages, errs.Stage(errTransform, unwrap))
+	}
+	if celTransform != nil {
+		stages = append(stages, errs.Stage(errTransform, celTransform))
+	}
+	if len(redact) > 0 {
+		stages = append(stages, transform.Redact(redact))
+	}
+	if len(fields) > 0 {
+		stages = append(stages, transform.Fields(fields))
+	}
+	if filterS != "" {
+		filter, err := newJQFilter(filterS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter: %w", err)
+		}
+		stages = append(stages, errs.Stage(errFilter, transform.Filter(func(ctx context.Context, record *sink.RecordOutput) (bool, error) {
+			if record.Data == nil {
+				return false, nil
+			}
+			if errs.Lenient() {
+				return filter.Match(ctx, *record.Data), nil
+			}
+			return filter.Eval(ctx, *record.Data)
+		})))
+	}
+	return stages, nil
+}
+
+// transformPayload applies stage to a record about to be published again, decoding its payload
+// as tail does and returning the transformed payload to publish, or false if it was dropped.
+// Strings and bytes are published as they are, and anything else as JSON.
+func transformPayload(ctx context.Context, stage transform.Func, record *RecordOutput, data []byte) ([]byte, bool, error) {
+	decoded, _ := decode.Auto(data)
+	record.Data = &decoded
+
+	record, err := stage(ctx, record)
+	if record == nil || err != nil {
+		return nil, false, err
+	}
+
+	switch payload := (*record.Data).(type) {
+	case []byte:
+		return payload, true, nil
+	case string:
+		return []byte(payload), true, nil
+	default:
+		encoded, err := json.Marshal(payload)
+		return encoded, err == nil, err
+	}
+}
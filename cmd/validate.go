@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"kin/pkg/transform"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/spf13/cobra"
+)
+
+type ValidationReport struct {
+	Records int `json:"records"`
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+
+	// Violations are grouped by where in the schema and payload they occur, most frequent first
+	Violations []ViolationSummary `json:"violations"`
+}
+
+type ViolationSummary struct {
+	SchemaViolation
+	Count   int               `json:"count"`
+	Samples []ViolationSample `json:"samples"`
+}
+
+type ViolationSample struct {
+	ShardId        string          `json:"shard_id"`
+	SequenceNumber string          `json:"sequence_number"`
+	Message        string          `json:"message"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// SchemaViolation is one way in which a payload fails to match a schema.
+type SchemaViolation struct {
+	// Path is the JSON pointer to the offending value in the payload, with array indexes
+	// replaced by * so that violations in different elements are counted together
+	Path string `json:"path"`
+	// Keyword is the JSON pointer to the schema keyword that failed
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+func init() {
+	validateCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	validateCmd.Flags().String("schema", "", "JSON Schema file to validate payloads against (required)")
+	validateCmd.Flags().String("from", "1h", "Start of the time range to validate, as an RFC 3339 timestamp or a duration ago (ex: 2h)")
+	validateCmd.Flags().String("until", "", "End of the time range to validate, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	validateCmd.Flags().Int("samples", 3, "Number of sample records to keep for each violation")
+	validateCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	validateCmd.MarkFlagRequired("stream-name")
+	validateCmd.MarkFlagRequired("schema")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that record payloads match a JSON Schema",
+	Long: `Reads every shard of a stream over a time range and validates each payload against a JSON
+Schema, reporting each kind of violation with the number of records it was found in and a few
+sample records. Payloads that aren't JSON are reported as violations too.
+
+The command exits non-zero if any record is invalid, so it can be used as a contract check in CI.
+To validate records as they arrive instead, use tail --schema.
+
+Example:
+  kin validate -n orders --schema order.schema.json --from 30m`,
+	Run: runValidateCmd,
+}
+
+func runValidateCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	schemaPath, _ := cmd.Flags().GetString("schema")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	maxSamples, _ := cmd.Flags().GetInt("samples")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	validator, err := newPayloadValidator(schemaPath)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	report, err := validateStream(cmd.Context(), client, streamName, validator, from, until, maxSamples)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if output == "json" {
+		printJSON(report)
+	} else {
+		fmt.Printf("%d records: %d valid, %d invalid\n", report.Records, report.Valid, report.Invalid)
+
+		if len(report.Violations) > 0 {
+			fmt.Println()
+			rows := [][]string{}
+			for _, violation := range report.Violations {
+				var sequenceNumbers []string
+				for _, sample := range violation.Samples {
+					sequenceNumbers = append(sequenceNumbers, sample.SequenceNumber)
+				}
+				rows = append(rows, []string{
+					orDash(violation.Path),
+					orDash(violation.Keyword),
+					violation.Message,
+					strconv.Itoa(violation.Count),
+					orDash(strings.Join(sequenceNumbers, ", ")),
+				})
+			}
+			printTable(os.Stdout, []string{"PATH", "KEYWORD", "MESSAGE", "RECORDS", "SAMPLES"}, rows)
+		}
+	}
+
+	if report.Invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// validateStream validates every record of a stream that arrived from from until until.
+func validateStream(
+	ctx context.Context,
+	client aws.KinesisAPI,
+	streamName string,
+	validator *payloadValidator,
+	from, until time.Time,
+	maxSamples int,
+) (*ValidationReport, error) {
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	report := &ValidationReport{Violations: []ViolationSummary{}}
+	summaries := map[SchemaViolation]*ViolationSummary{}
+	var errs []error
+
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(ctx, client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				var violations []SchemaViolation
+				payload, err := jsonschema.UnmarshalJSON(bytes.NewReader(record.Data))
+				if err != nil {
+					violations = []SchemaViolation{{Message: "payload is not JSON"}}
+				} else {
+					violations = validator.Validate(payload)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				report.Records++
+				if len(violations) == 0 {
+					report.Valid++
+					return true
+				}
+				report.Invalid++
+
+				// A record counts once towards each kind of violation, however often it occurs
+				seen := map[SchemaViolation]bool{}
+				for _, violation := range violations {
+					key := violation
+					key.Message = groupMessage(violation)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+
+					summary, ok := summaries[key]
+					if !ok {
+						summary = &ViolationSummary{SchemaViolation: violation, Samples: []ViolationSample{}}
+						summaries[key] = summary
+					}
+					summary.Count++
+					if len(summary.Samples) < maxSamples {
+						sample := ViolationSample{ShardId: shardId, SequenceNumber: *record.SequenceNumber, Message: violation.Message}
+						if json.Valid(record.Data) {
+							sample.Data = record.Data
+						}
+						summary.Samples = append(summary.Samples, sample)
+					}
+				}
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", shardId, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	for _, summary := range summaries {
+		report.Violations = append(report.Violations, *summary)
+	}
+	sort.Slice(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Keyword < b.Keyword
+	})
+	return report, nil
+}
+
+// groupMessage returns the message violations are grouped by. Messages for keywords that compare
+// against the value, such as maxLength, include the value and are left out so that every record
+// failing the same keyword is counted together; summaries show the first record's message, and
+// samples their own.
+func groupMessage(violation SchemaViolation) string {
+	switch violation.Keyword[strings.LastIndex(violation.Keyword, "/")+1:] {
+	case "type", "required", "enum", "const", "additionalProperties", "":
+		return violation.Message
+	default:
+		return ""
+	}
+}
+
+// payloadValidator checks decoded payloads against a JSON Schema.
+type payloadValidator struct {
+	schema *jsonschema.Schema
+}
+
+func newPayloadValidator(path string) (*payloadValidator, error) {
+	schema, err := jsonschema.NewCompiler().Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadValidator{schema}, nil
+}
+
+// Transform returns a stage which logs a warning for every way in which a record's payload fails
+// to match the schema, passing every record on regardless.
+func (v *payloadValidator) Transform() transform.Func {
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		if record.Data == nil {
+			return record, nil
+		}
+
+		for _, violation := range v.Validate(*record.Data) {
+			slog.Warn(
+				"record doesn't match schema",
+				"shard_id", *record.ShardId,
+				"sequence_number", *record.SequenceNumber,
+				"path", violation.Path,
+				"error", violation.Message,
+			)
+		}
+		return record, nil
+	}
+}
+
+// Validate returns every way in which a decoded payload fails to match the schema, or nil if it
+// matches.
+func (v *payloadValidator) Validate(payload interface{}) []SchemaViolation {
+	err := v.schema.Validate(decode.Plain(payload))
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+
+	// Only the innermost errors say what's wrong; the ones above them just say that a
+	// subschema failed
+	var violations []SchemaViolation
+	var collect func(unit *jsonschema.OutputUnit)
+	collect = func(unit *jsonschema.OutputUnit) {
+		if len(unit.Errors) > 0 {
+			for i := range unit.Errors {
+				collect(&unit.Errors[i])
+			}
+			return
+		}
+
+		violation := SchemaViolation{
+			Path:    wildcardIndexes(unit.InstanceLocation),
+			Keyword: unit.KeywordLocation,
+		}
+		if unit.Error != nil {
+			violation.Message = unit.Error.String()
+		}
+		violations = append(violations, violation)
+	}
+	collect(validationErr.DetailedOutput())
+	return violations
+}
+
+// wildcardIndexes replaces the array indexes in a JSON pointer with *.
+func wildcardIndexes(pointer string) string {
+	tokens := strings.Split(pointer, "/")
+	for i, token := range tokens {
+		if _, err := strconv.Atoi(token); err == nil {
+			tokens[i] = "*"
+		}
+	}
+	return strings.Join(tokens, "/")
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+// maxVerifyProblems is how many problems are listed for each run; the rest are only counted
+const maxVerifyProblems = 20
+
+// VerifyResult is what verify found for one run of generate --verifiable.
+type VerifyResult struct {
+	Run        string   `json:"run"`
+	Keys       int      `json:"keys"`
+	Records    int      `json:"records"`
+	Duplicates int      `json:"duplicates"`
+	Missing    int      `json:"missing"`
+	OutOfOrder int      `json:"out_of_order"`
+	Passed     bool     `json:"passed"`
+	Problems   []string `json:"problems,omitempty"`
+
+	// omitted is how many problems there were beyond the ones listed
+	omitted int
+}
+
+// verifiableRecord is the payload generate --verifiable publishes
+type verifiableRecord struct {
+	Run *string `json:"run"`
+	Key *string `json:"key"`
+	N   *int64  `json:"n"`
+}
+
+func init() {
+	verifyCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	verifyCmd.Flags().String("from", "1h", "Start of the time range to verify, as an RFC 3339 timestamp or a duration ago (ex: 2h); must be before the run started")
+	verifyCmd.Flags().String("until", "", "End of the time range to verify, as an RFC 3339 timestamp or a duration ago; defaults to now")
+	verifyCmd.Flags().String("run", "", "ID of the run to verify, as printed by generate --verifiable; defaults to every run found")
+	verifyCmd.Flags().Int64("expect", 0, "Number of records the run published (its --count), to also catch the last records of a key going missing")
+	verifyCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	verifyCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that records from generate --verifiable were all delivered, in order",
+	Long: `Reads every shard from --from until --until and checks the records published by
+kin generate --verifiable, which numbers each key's records from 0. For each run it reports:
+
+  duplicates    records read more than once
+  missing       numbers skipped in a key's records, and with --expect, records never read at all
+  out of order  records read after a later record of the same key from the same shard, not
+                counting duplicates
+
+and passes if there are none, exiting non-zero otherwise. Other records in the stream are ignored.
+--from must be before the run started, since the records before it would otherwise be missing.
+
+Example:
+  kin generate -n my-stream --verifiable --count 10000 --keys 10
+  kin verify -n my-stream --from 10m --run 3fa85f64 --expect 10000`,
+	Run: runVerifyCmd,
+}
+
+// verifyKey is what has been read of one key's records in a run
+type verifyKey struct {
+	seen map[int64]bool
+	// last is the number of the latest record read from each shard, which can differ when the
+	// key's records moved to a new shard when the stream was resharded
+	last map[string]int64
+}
+
+// verifyRuns accounts for the records of each run as they're read. It isn't safe for concurrent
+// use.
+type verifyRuns struct {
+	// run, if set, is the only run accounted for
+	run     string
+	keys    map[string]map[string]*verifyKey
+	results map[string]*VerifyResult
+	// ignored counts records that weren't published by generate --verifiable
+	ignored int
+}
+
+func newVerifyRuns(run string) *verifyRuns {
+	return &verifyRuns{run: run, keys: map[string]map[string]*verifyKey{}, results: map[string]*VerifyResult{}}
+}
+
+// add accounts for a record read from a shard, counting it as a duplicate if its number has been
+// read before, or out of order if a higher number for its key was read from the shard before it.
+func (v *verifyRuns) add(shardId string, payload verifiableRecord) {
+	if payload.Run == nil || payload.Key == nil || payload.N == nil {
+		v.ignored++
+		return
+	}
+	if v.run != "" && *payload.Run != v.run {
+		return
+	}
+
+	keys, ok := v.keys[*payload.Run]
+	if !ok {
+		keys = map[string]*verifyKey{}
+		v.keys[*payload.Run] = keys
+		v.results[*payload.Run] = &VerifyResult{Run: *payload.Run}
+	}
+	result := v.results[*payload.Run]
+	key, ok := keys[*payload.Key]
+	if !ok {
+		key = &verifyKey{seen: map[int64]bool{}, last: map[string]int64{}}
+		keys[*payload.Key] = key
+	}
+
+	n := *payload.N
+	if key.seen[n] {
+		result.Duplicates++
+		result.problem("%s: n=%d read more than once", *payload.Key, n)
+		return
+	}
+	key.seen[n] = true
+
+	if last, ok := key.last[shardId]; ok && n < last {
+		result.OutOfOrder++
+		result.problem("%s: n=%d read after n=%d from %s", *payload.Key, n, last, shardId)
+	} else {
+		key.last[shardId] = n
+	}
+	result.Records++
+}
+
+// finish counts the records missing from each run, including, if expect is set, those beyond the
+// highest number read, and returns the runs' results in order of their IDs.
+func (v *verifyRuns) finish(expect int64) []*VerifyResult {
+	sorted := []*VerifyResult{}
+	for id, keys := range v.keys {
+		result := v.results[id]
+		result.Keys = len(keys)
+
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// Each key's records are numbered from 0, so any number below the highest one read that
+		// wasn't read is missing
+		for _, name := range names {
+			numbers := make([]int64, 0, len(keys[name].seen))
+			for n := range keys[name].seen {
+				numbers = append(numbers, n)
+			}
+			sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+			next := int64(0)
+			for _, n := range numbers {
+				if n > next {
+					result.Missing += int(n - next)
+					if n-next == 1 {
+						result.problem("%s: n=%d missing", name, next)
+					} else {
+						result.problem("%s: n=%d..%d missing", name, next, n-1)
+					}
+				}
+				next = n + 1
+			}
+		}
+
+		if expect > 0 && int64(result.Records+result.Missing) < expect {
+			unread := int(expect) - result.Records - result.Missing
+			result.Missing += unread
+			result.problem("%d of the %d records published were never read", unread, expect)
+		}
+
+		result.Passed = result.Duplicates == 0 && result.Missing == 0 && result.OutOfOrder == 0
+		sorted = append(sorted, result)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Run < sorted[j].Run })
+	return sorted
+}
+
+// problem lists a problem with the run, or only counts it once maxVerifyProblems are listed.
+func (r *VerifyResult) problem(format string, args ...interface{}) {
+	if len(r.Problems) < maxVerifyProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	} else {
+		r.omitted++
+	}
+}
+
+func runVerifyCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	fromS, _ := cmd.Flags().GetString("from")
+	untilS, _ := cmd.Flags().GetString("until")
+	run, _ := cmd.Flags().GetString("run")
+	expect, _ := cmd.Flags().GetInt64("expect")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if expect > 0 && run == "" {
+		cmd.PrintErrln("--expect needs --run, since it's the number of records one run published")
+		os.Exit(1)
+	}
+
+	from, until, err := parseTimeRange(fromS, untilS)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	shards, err := listShards(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	var mu sync.Mutex
+	runs := newVerifyRuns(run)
+	tailOptions := &TailOptions{AtTimestamp: &from}
+	var wg sync.WaitGroup
+	failed := false
+	for _, shard := range shards {
+		shardId := *shard.ShardId
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := scanShard(cmd.Context(), client, streamName, shardId, tailOptions, func(record types.Record, _ *int64) bool {
+				if record.ApproximateArrivalTimestamp.After(until) {
+					return false
+				}
+
+				var payload verifiableRecord
+				if err := json.Unmarshal(record.Data, &payload); err != nil {
+					payload = verifiableRecord{}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				runs.add(shardId, payload)
+				return true
+			})
+			if err != nil {
+				mu.Lock()
+				cmd.PrintErrf("%s: %s\n", shardId, err)
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	slog.Info("verify complete", "runs", len(runs.keys), "ignored", runs.ignored, "shards", len(shards))
+	if len(runs.keys) == 0 {
+		if run != "" {
+			cmd.PrintErrf("No records from run %s found between %s and %s\n", run, from.Format(time.RFC3339), until.Format(time.RFC3339))
+		} else {
+			cmd.PrintErrf("No records from generate --verifiable found between %s and %s\n", from.Format(time.RFC3339), until.Format(time.RFC3339))
+		}
+		os.Exit(1)
+	}
+
+	sorted := runs.finish(expect)
+	for _, result := range sorted {
+		if !result.Passed {
+			failed = true
+		}
+	}
+
+	if output == "json" {
+		for _, result := range sorted {
+			printJSON(result)
+		}
+	} else {
+		rows := [][]string{}
+		for _, result := range sorted {
+			status := "PASS"
+			if !result.Passed {
+				status = "FAIL"
+			}
+			rows = append(rows, []string{result.Run, fmt.Sprint(result.Keys), fmt.Sprint(result.Records), fmt.Sprint(result.Duplicates), fmt.Sprint(result.Missing), fmt.Sprint(result.OutOfOrder), status})
+		}
+		printTable(os.Stdout, []string{"RUN", "KEYS", "RECORDS", "DUPLICATES", "MISSING", "OUT OF ORDER", "RESULT"}, rows)
+
+		for _, result := range sorted {
+			if len(result.Problems) == 0 {
+				continue
+			}
+			fmt.Printf("\nRun %s:\n", result.Run)
+			for _, p := range result.Problems {
+				fmt.Printf("  %s\n", p)
+			}
+			if result.omitted > 0 {
+				fmt.Printf("  ... and %d more\n", result.omitted)
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
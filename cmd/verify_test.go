@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// addVerifiable accounts for a record published by generate --verifiable as read from a shard.
+func addVerifiable(runs *verifyRuns, shardId, run, key string, n int64) {
+	runs.add(shardId, verifiableRecord{Run: &run, Key: &key, N: &n})
+}
+
+func TestVerifyRuns(t *testing.T) {
+	runs := newVerifyRuns("")
+	// run-a's records are all read once, in order, with key b's moving to another shard partway
+	// through after a reshard
+	for n := range int64(3) {
+		addVerifiable(runs, "shard-0", "run-a", "a", n)
+	}
+	addVerifiable(runs, "shard-0", "run-a", "b", 0)
+	addVerifiable(runs, "shard-1", "run-a", "b", 1)
+
+	// run-b has a duplicate, a record out of order and gaps
+	addVerifiable(runs, "shard-0", "run-b", "a", 0)
+	addVerifiable(runs, "shard-0", "run-b", "a", 2)
+	addVerifiable(runs, "shard-0", "run-b", "a", 1)
+	addVerifiable(runs, "shard-0", "run-b", "a", 2)
+	addVerifiable(runs, "shard-0", "run-b", "b", 3)
+
+	runs.add("shard-0", verifiableRecord{})
+	if runs.ignored != 1 {
+		t.Errorf("ignored = %d; want 1", runs.ignored)
+	}
+
+	results := runs.finish(0)
+	if len(results) != 2 || results[0].Run != "run-a" || results[1].Run != "run-b" {
+		t.Fatalf("finish = %+v; want run-a and run-b", results)
+	}
+
+	a := results[0]
+	if a.Keys != 2 || a.Records != 5 || a.Duplicates != 0 || a.Missing != 0 || a.OutOfOrder != 0 || !a.Passed || len(a.Problems) != 0 {
+		t.Errorf("run-a = %+v; want 5 records of 2 keys passed", a)
+	}
+
+	b := results[1]
+	wantProblems := []string{
+		"a: n=1 read after n=2 from shard-0",
+		"a: n=2 read more than once",
+		"b: n=0..2 missing",
+	}
+	if b.Keys != 2 || b.Records != 4 || b.Duplicates != 1 || b.Missing != 3 || b.OutOfOrder != 1 || b.Passed || !slices.Equal(b.Problems, wantProblems) {
+		t.Errorf("run-b = %+v; want 4 records, 1 duplicate, 3 missing and 1 out of order", b)
+	}
+}
+
+func TestVerifyRunsExpect(t *testing.T) {
+	runs := newVerifyRuns("run-a")
+	for n := range int64(4) {
+		if n != 1 {
+			addVerifiable(runs, "shard-0", "run-a", "a", n)
+		}
+	}
+	addVerifiable(runs, "shard-0", "run-b", "a", 0)
+
+	results := runs.finish(10)
+	if len(results) != 1 {
+		t.Fatalf("finish = %+v; want only run-a", results)
+	}
+	// n=1 is missing, and so are the 6 records published after n=3
+	result := results[0]
+	wantProblems := []string{"a: n=1 missing", "6 of the 10 records published were never read"}
+	if result.Records != 3 || result.Missing != 7 || result.Passed || !slices.Equal(result.Problems, wantProblems) {
+		t.Errorf("run-a = %+v; want 3 records and 7 missing", result)
+	}
+}
+
+func TestVerifyRunsLimitsProblems(t *testing.T) {
+	runs := newVerifyRuns("")
+	for n := range int64(maxVerifyProblems + 5) {
+		addVerifiable(runs, "shard-0", "run-a", fmt.Sprintf("key-%d", n), 1)
+	}
+
+	result := runs.finish(0)[0]
+	if result.Missing != maxVerifyProblems+5 || len(result.Problems) != maxVerifyProblems || result.omitted != 5 {
+		t.Errorf("run-a has %d missing, %d problems listed and %d omitted; want %d, %d and 5", result.Missing, len(result.Problems), result.omitted, maxVerifyProblems+5, maxVerifyProblems)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"kin/pkg/release"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set when building releases with
+//
+//	go build -ldflags "-X kin/cmd.version=v1.2.3 -X kin/cmd.commit=... -X kin/cmd.buildDate=..."
+//
+// and otherwise taken from what the Go toolchain records in the binary, if anything.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// updateCheckTimeout is how long kin version waits for GitHub once it's printed its own version
+const updateCheckTimeout = 2 * time.Second
+
+type VersionInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	BuildDate  string `json:"build_date,omitempty"`
+	GoVersion  string `json:"go_version"`
+	SDKVersion string `json:"aws_sdk_version"`
+	Platform   string `json:"platform"`
+}
+
+func init() {
+	versionCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	versionCmd.Flags().Bool("check-update", true, "Check GitHub for a newer release and note it on stderr, waiting at most 2s; set check-update: false under version in the config file to never check")
+
+	rootCmd.AddCommand(versionCmd)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print kin's version and build details",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		checkUpdate, _ := cmd.Flags().GetBool("check-update")
+
+		if err := validateOutput(output, "table", "json"); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		info := versionInfo()
+
+		var latest chan *release.Release
+		ctx, cancel := context.WithTimeout(cmd.Context(), updateCheckTimeout)
+		defer cancel()
+		if checkUpdate {
+			latest = checkForUpdate(ctx, info.Version)
+		}
+
+		if output == "json" {
+			printJSON(info)
+		} else {
+			orNone := func(s string) string {
+				if s == "" {
+					return "-"
+				}
+				return s
+			}
+			printTable(os.Stdout, []string{"FIELD", "VALUE"}, [][]string{
+				{"Version", info.Version},
+				{"Commit", orNone(info.Commit)},
+				{"Built", orNone(info.BuildDate)},
+				{"Go", info.GoVersion},
+				{"AWS SDK", info.SDKVersion},
+				{"Platform", info.Platform},
+			})
+		}
+
+		if latest == nil {
+			return
+		}
+		select {
+		case newer := <-latest:
+			if newer != nil {
+				cmd.PrintErrf("kin %s is available (you have %s): %s\n", newer.Version, info.Version, newer.URL)
+			}
+		case <-ctx.Done():
+			slog.Debug("gave up checking for a newer release", "timeout", updateCheckTimeout)
+		}
+	},
+}
+
+// versionInfo returns the version and build details of the running binary.
+func versionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:    version,
+		Commit:     commit,
+		BuildDate:  buildDate,
+		GoVersion:  runtime.Version(),
+		SDKVersion: awssdk.SDKVersion,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = setting.Value
+		}
+	}
+	return info
+}
+
+// checkForUpdate looks up the latest release in the background, sending it if it's newer than
+// current and nil otherwise, including when the check fails, since it's only ever a courtesy.
+func checkForUpdate(ctx context.Context, current string) chan *release.Release {
+	latest := make(chan *release.Release, 1)
+	go func() {
+		found, err := release.NewClient().Latest(ctx)
+		if err != nil {
+			slog.Debug("couldn't check for a newer release", "error", err)
+			latest <- nil
+			return
+		}
+		if !release.Newer(found.Version, current) {
+			latest <- nil
+			return
+		}
+		latest <- found
+	}()
+	return latest
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"kin/pkg/aws"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	waitCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	waitCmd.Flags().String("consumer", "", "Wait for this enhanced fan-out consumer of the stream rather than the stream itself")
+	waitCmd.Flags().String("status", "", "Status to wait for: ACTIVE, CREATING, UPDATING or DELETING (consumers are never UPDATING)")
+	waitCmd.Flags().Bool("deleted", false, "Wait until the stream or consumer no longer exists")
+	waitCmd.Flags().Duration("poll-interval", streamPollInterval, "How often to check the status")
+	waitCmd.Flags().Duration("timeout", streamWaitTimeout, "How long to wait before giving up")
+	waitCmd.MarkFlagRequired("stream-name")
+	waitCmd.MarkFlagsMutuallyExclusive("status", "deleted")
+	waitCmd.MarkFlagsOneRequired("status", "deleted")
+
+	rootCmd.AddCommand(waitCmd)
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait for a stream or consumer to reach a status",
+	Long: `Polls a stream, or one of its enhanced fan-out consumers, until it reaches --status or, with
+--deleted, until it no longer exists. A stream or consumer that doesn't exist yet is waited for,
+so wait can be started before whatever creates it. The command exits non-zero if --timeout
+passes first.
+
+Example:
+  kin wait -n orders --status ACTIVE --timeout 10m
+  kin wait -n orders --consumer analytics --status ACTIVE
+  kin wait -n orders-old --deleted`,
+	Run: runWaitCmd,
+}
+
+func runWaitCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	consumerName, _ := cmd.Flags().GetString("consumer")
+	status, _ := cmd.Flags().GetString("status")
+	deleted, _ := cmd.Flags().GetBool("deleted")
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	if pollInterval <= 0 {
+		cmd.PrintErrln("--poll-interval must be positive")
+		os.Exit(1)
+	}
+
+	status = strings.ToUpper(status)
+	statuses := []string{"ACTIVE", "CREATING", "UPDATING", "DELETING"}
+	if consumerName != "" {
+		statuses = []string{"ACTIVE", "CREATING", "DELETING"}
+	}
+	if status != "" && !slices.Contains(statuses, status) {
+		cmd.PrintErrf("invalid --status %q: must be one of %s\n", status, strings.Join(statuses, ", "))
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	name := streamName
+	getStatus := func(ctx context.Context) (string, error) {
+		return getStreamStatus(ctx, client, streamName)
+	}
+	if consumerName != "" {
+		name = consumerName
+		getStatus = func(ctx context.Context) (string, error) {
+			return getConsumerStatus(ctx, client, streamName, consumerName)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+
+	for {
+		current, err := getStatus(ctx)
+		if err != nil && ctx.Err() == nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		if err == nil {
+			if deleted && current == "" {
+				cmd.PrintErrf("%s has been deleted\n", name)
+				return
+			}
+			if !deleted && current == status {
+				cmd.PrintErrf("%s is %s\n", name, status)
+				return
+			}
+			slog.Info("waiting", "name", name, "status", orDash(current))
+		}
+
+		aws.SleepContext(ctx, pollInterval)
+		if ctx.Err() != nil {
+			want := status
+			if deleted {
+				want = "deleted"
+			}
+			cmd.PrintErrf("timed out after %s waiting for %s to be %s\n", timeout, name, want)
+			os.Exit(1)
+		}
+	}
+}
+
+// getStreamStatus returns the status of a stream, or "" if it doesn't exist.
+func getStreamStatus(ctx context.Context, client aws.KinesisAPI, streamName string) (string, error) {
+	output, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(output.StreamDescriptionSummary.StreamStatus), nil
+}
+
+// getConsumerStatus returns the status of a stream's consumer, or "" if either doesn't exist.
+func getConsumerStatus(ctx context.Context, client aws.KinesisAPI, streamName, consumerName string) (string, error) {
+	summary, err := client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+		StreamName: &streamName,
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	output, err := client.DescribeStreamConsumer(ctx, &kinesis.DescribeStreamConsumerInput{
+		StreamARN:    summary.StreamDescriptionSummary.StreamARN,
+		ConsumerName: &consumerName,
+	})
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(output.ConsumerDescription.ConsumerStatus), nil
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/spf13/cobra"
+)
+
+type StreamChange struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Field  string    `json:"field"`
+	Old    string    `json:"old,omitempty"`
+	New    string    `json:"new,omitempty"`
+}
+
+// streamSnapshot is the configuration watch compares from one poll to the next.
+type streamSnapshot struct {
+	description *StreamDescription
+	// Open shards by ID, with a description of where each came from
+	openShards map[string]string
+}
+
+func init() {
+	watchCmd.Flags().StringP("stream-name", "n", "", "Stream name (required)")
+	watchCmd.Flags().Duration("interval", 10*time.Second, "How often to poll the stream's configuration")
+	watchCmd.Flags().StringP("output", "o", "table", "Output format: table, or json for a line per change")
+	watchCmd.MarkFlagRequired("stream-name")
+
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print changes to a stream's configuration as they happen",
+	Long: `Polls a stream's summary, shards and consumers every --interval and prints a line for each
+change since the last poll: status, capacity mode, retention period, encryption, enhanced
+monitoring, shards opening and closing as the stream is resharded, and consumers being
+registered, deregistered or changing status. The stream being deleted, or created again, is
+reported too. Runs until interrupted.
+
+Example:
+  kin watch -n orders --interval 5s`,
+	Run: runWatchCmd,
+}
+
+func runWatchCmd(cmd *cobra.Command, args []string) {
+	streamName, _ := cmd.Flags().GetString("stream-name")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	output, _ := cmd.Flags().GetString("output")
+
+	if err := validateOutput(output, "table", "json"); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if interval <= 0 {
+		cmd.PrintErrln("--interval must be positive")
+		os.Exit(1)
+	}
+
+	client, err := aws.GetKinesisClient()
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	last, err := snapshotStream(cmd.Context(), client, streamName)
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+	if last == nil {
+		cmd.PrintErrf("Watching %s, which doesn't exist yet\n", streamName)
+	} else {
+		d := last.description
+		cmd.PrintErrf(
+			"Watching %s: %s, %s, %d open shards, %d hours retention, %d consumers\n",
+			streamName, d.Status, d.Mode, d.OpenShardCount, d.RetentionPeriodHours, len(d.Consumers),
+		)
+	}
+
+	for {
+		aws.SleepContext(cmd.Context(), interval)
+		if cmd.Context().Err() != nil {
+			return
+		}
+
+		snapshot, err := snapshotStream(cmd.Context(), client, streamName)
+		if err != nil {
+			// Keep watching through transient errors, comparing against the last good snapshot
+			cmd.PrintErrln(err)
+			continue
+		}
+
+		for _, change := range diffStreamSnapshots(last, snapshot) {
+			change.Time = time.Now().UTC()
+			change.Stream = streamName
+			if output == "json" {
+				printJSON(change)
+				continue
+			}
+
+			line := fmt.Sprintf("%s  %s", change.Time.Format(time.RFC3339), change.Field)
+			switch {
+			case change.Old != "" && change.New != "":
+				line += fmt.Sprintf(": %s -> %s", change.Old, change.New)
+			case change.New != "":
+				line += ": " + change.New
+			case change.Old != "":
+				line += ": " + change.Old
+			}
+			fmt.Println(line)
+		}
+		last = snapshot
+	}
+}
+
+// snapshotStream returns the stream's current configuration, or nil if it doesn't exist.
+func snapshotStream(ctx context.Context, client aws.KinesisAPI, streamName string) (*streamSnapshot, error) {
+	description, err := describeStream(ctx, client, streamName)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shards, err := listShards(ctx, client, streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &streamSnapshot{description: description, openShards: map[string]string{}}
+	for _, shard := range shards {
+		if !isOpenShard(shard) {
+			continue
+		}
+
+		var parents []string
+		for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			if parent != nil {
+				parents = append(parents, *parent)
+			}
+		}
+		origin := ""
+		if len(parents) > 0 {
+			origin = "from " + strings.Join(parents, " and ")
+		}
+		snapshot.openShards[*shard.ShardId] = origin
+	}
+	return snapshot, nil
+}
+
+// diffStreamSnapshots returns the changes from one snapshot to the next, either of which may be
+// nil if the stream didn't exist.
+func diffStreamSnapshots(prev, next *streamSnapshot) []StreamChange {
+	switch {
+	case prev == nil && next == nil:
+		return nil
+	case prev == nil:
+		return []StreamChange{{Field: "created", New: next.description.Status}}
+	case next == nil:
+		return []StreamChange{{Field: "deleted"}}
+	}
+
+	var changes []StreamChange
+	compare := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, StreamChange{Field: field, Old: orDash(before), New: orDash(after)})
+		}
+	}
+
+	o, n := prev.description, next.description
+	compare("status", o.Status, n.Status)
+	compare("mode", o.Mode, n.Mode)
+	compare("retention", fmt.Sprintf("%d hours", o.RetentionPeriodHours), fmt.Sprintf("%d hours", n.RetentionPeriodHours))
+	compare("encryption", strings.TrimSpace(o.EncryptionType+" "+o.KeyId), strings.TrimSpace(n.EncryptionType+" "+n.KeyId))
+	// Enhanced monitoring metrics come back in no particular order
+	compare("enhanced monitoring", strings.Join(slices.Sorted(slices.Values(o.EnhancedMonitoring)), ", "), strings.Join(slices.Sorted(slices.Values(n.EnhancedMonitoring)), ", "))
+	compare("open shards", fmt.Sprint(o.OpenShardCount), fmt.Sprint(n.OpenShardCount))
+
+	for _, shardId := range slices.Sorted(maps.Keys(prev.openShards)) {
+		if _, ok := next.openShards[shardId]; !ok {
+			changes = append(changes, StreamChange{Field: "shard closed", Old: shardId})
+		}
+	}
+	for _, shardId := range slices.Sorted(maps.Keys(next.openShards)) {
+		if _, ok := prev.openShards[shardId]; !ok {
+			changes = append(changes, StreamChange{Field: "shard opened", New: strings.TrimSpace(shardId + " " + next.openShards[shardId])})
+		}
+	}
+
+	oldConsumers := map[string]string{}
+	for _, consumer := range o.Consumers {
+		oldConsumers[consumer.ConsumerName] = consumer.Status
+	}
+	newConsumers := map[string]string{}
+	for _, consumer := range n.Consumers {
+		newConsumers[consumer.ConsumerName] = consumer.Status
+	}
+	for _, name := range slices.Sorted(maps.Keys(oldConsumers)) {
+		if _, ok := newConsumers[name]; !ok {
+			changes = append(changes, StreamChange{Field: "consumer deregistered", Old: name})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(newConsumers)) {
+		status, existed := oldConsumers[name]
+		switch {
+		case !existed:
+			changes = append(changes, StreamChange{Field: "consumer registered", New: fmt.Sprintf("%s (%s)", name, newConsumers[name])})
+		case status != newConsumers[name]:
+			changes = append(changes, StreamChange{Field: "consumer " + name, Old: status, New: newConsumers[name]})
+		}
+	}
+	return changes
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"kin/cmd"
+	"os"
 )
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
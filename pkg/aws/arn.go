@@ -0,0 +1,72 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// StreamARN identifies a stream in any account and region.
+type StreamARN struct {
+	ARN       string
+	Region    string
+	AccountID string
+	Name      string
+}
+
+// ParseStreamARN parses an ARN such as arn:aws:kinesis:us-east-1:123456789012:stream/orders.
+func ParseStreamARN(s string) (*StreamARN, error) {
+	parsed, err := arn.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream ARN %q: %w", s, err)
+	}
+	name, found := strings.CutPrefix(parsed.Resource, "stream/")
+	if parsed.Service != "kinesis" || !found || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid stream ARN %q: not a Kinesis stream", s)
+	}
+
+	return &StreamARN{ARN: s, Region: parsed.Region, AccountID: parsed.AccountID, Name: name}, nil
+}
+
+// streamARN is the stream that calls naming it by name are made with the ARN of instead
+var streamARN *StreamARN
+
+// SetStreamARN makes Kinesis clients created afterwards address the stream by its ARN whenever a
+// call names it, which lets a stream in another account be reached through its resource policy.
+func SetStreamARN(stream *StreamARN) {
+	streamARN = stream
+}
+
+// addressByARN is an API option which replaces the stream's name with its ARN in the parameters
+// of any call that accepts either.
+func addressByARN(stack *middleware.Stack) error {
+	stream := streamARN
+	if stream == nil {
+		return nil
+	}
+
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+		"KinStreamARN",
+		func(
+			ctx context.Context,
+			in middleware.InitializeInput,
+			next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			params := reflect.ValueOf(in.Parameters)
+			if params.Kind() == reflect.Pointer && !params.IsNil() && params.Elem().Kind() == reflect.Struct {
+				name := params.Elem().FieldByName("StreamName")
+				arnField := params.Elem().FieldByName("StreamARN")
+				if name.IsValid() && arnField.IsValid() && !name.IsNil() && arnField.IsNil() &&
+					name.Elem().String() == stream.Name {
+					arnField.Set(reflect.ValueOf(&stream.ARN))
+					name.Set(reflect.Zero(name.Type()))
+				}
+			}
+			return next.HandleInitialize(ctx, in)
+		},
+	), middleware.Before)
+}
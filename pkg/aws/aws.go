@@ -2,16 +2,284 @@ package aws
 
 import (
 	"context"
+	"fmt"
+	"kin/pkg/telemetry"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-func GetKinesisClient() (*kinesis.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// profile and region, when set, take the place of AWS_PROFILE and AWS_REGION for every client
+var (
+	profile string
+	region  string
+)
+
+// SetProfile makes every client created afterwards use a shared config profile.
+func SetProfile(name string) {
+	profile = name
+}
+
+// SetRegion makes every client created afterwards use a region, unless it's created for another.
+func SetRegion(name string) {
+	region = name
+}
+
+// Region returns the region set with SetRegion, or "" if clients use the configured one.
+func Region() string {
+	return region
+}
+
+// AssumeRoleOptions describe a role every client assumes, using the profile's credentials.
+type AssumeRoleOptions struct {
+	RoleARN string
+	// ExternalID is required by roles that other accounts trust with a condition on it
+	ExternalID string
+	// SessionName identifies the session in CloudTrail; it defaults to kin- and a timestamp
+	SessionName string
+}
+
+var assumeRole AssumeRoleOptions
+
+// SetAssumeRole makes every client created afterwards assume a role. Roles can be chained: if the
+// profile itself assumes a role, that role's credentials are used to assume this one.
+func SetAssumeRole(options AssumeRoleOptions) {
+	assumeRole = options
+}
+
+// kinesisEndpointURL replaces the Kinesis endpoint, for emulators and VPC endpoints
+var kinesisEndpointURL string
+
+// SetKinesisEndpointURL makes every Kinesis client created afterwards use url rather than the
+// region's endpoint. Other services are unaffected.
+func SetKinesisEndpointURL(url string) {
+	kinesisEndpointURL = url
+}
+
+// offline replaces every client's credentials with dummy ones, for when Kinesis is mocked and
+// there may be no AWS account to use
+var offline bool
+
+// SetOffline makes every client created afterwards use dummy credentials rather than looking
+// for real ones.
+func SetOffline(enabled bool) {
+	offline = enabled
+}
+
+// KinesisEndpointURL returns the endpoint Kinesis clients created from cfg use.
+func KinesisEndpointURL(cfg aws.Config) string {
+	if local, _ := activeLocalEndpoint(); local != nil {
+		return local.URL
+	}
+
+	options := kinesis.NewFromConfig(cfg, withKinesisEndpoint).Options()
+	if options.BaseEndpoint != nil {
+		return *options.BaseEndpoint
+	}
+
+	endpoint, err := options.EndpointResolverV2.ResolveEndpoint(context.TODO(), kinesis.EndpointParameters{
+		Region:       aws.String(options.Region),
+		UseFIPS:      aws.Bool(options.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		UseDualStack: aws.Bool(options.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+	})
+	if err != nil {
+		return fmt.Sprintf("https://kinesis.%s.amazonaws.com", cfg.Region)
+	}
+	return endpoint.URI.String()
+}
+
+// fipsEndpoints and dualStackEndpoints make clients use the FIPS 140-2 validated or IPv6 capable
+// endpoints of every service
+var (
+	fipsEndpoints      bool
+	dualStackEndpoints bool
+)
+
+// SetEndpointVariants makes every client created afterwards use FIPS and/or dual-stack endpoints.
+// Not every service offers them in every region.
+func SetEndpointVariants(fips, dualStack bool) {
+	fipsEndpoints = fips
+	dualStackEndpoints = dualStack
+}
+
+func GetKinesisClient(optFns ...func(*kinesis.Options)) (KinesisAPI, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients for other regions or accounts are for other streams, so only this one addresses the
+	// --stream-arn stream by ARN, or uses the local emulator
+	addARN := func(o *kinesis.Options) {
+		o.APIOptions = append(o.APIOptions, addressByARN)
+	}
+	clientOptFns := []func(*kinesis.Options){withKinesisEndpoint, addARN}
+
+	local, err := activeLocalEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if local != nil {
+		clientOptFns = append(clientOptFns, withLocalEndpoint(local))
+	}
+	return kinesis.NewFromConfig(cfg, append(clientOptFns, optFns...)...), nil
+}
+
+// GetKinesisClientWithConfig is like GetKinesisClient, but applies cfgOptFns when loading the
+// configuration, for reaching a stream in another region or account.
+func GetKinesisClientWithConfig(cfgOptFns ...func(*config.LoadOptions) error) (KinesisAPI, error) {
+	cfg, err := loadConfig(cfgOptFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return kinesis.NewFromConfig(cfg, withKinesisEndpoint), err
+}
+
+func withKinesisEndpoint(o *kinesis.Options) {
+	if kinesisEndpointURL != "" {
+		o.BaseEndpoint = aws.String(kinesisEndpointURL)
+	}
+}
+
+func GetDynamoDBClient() (*dynamodb.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamodb.NewFromConfig(cfg), err
+}
+
+func GetKMSClient() (*kms.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kms.NewFromConfig(cfg), err
+}
+
+func GetS3Client() (*s3.Client, error) {
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	return kinesis.NewFromConfig(cfg), err
+	return s3.NewFromConfig(cfg), err
+}
+
+func GetSTSClient() (*sts.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return sts.NewFromConfig(cfg), err
+}
+
+func GetIAMClient() (*iam.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return iam.NewFromConfig(cfg), err
+}
+
+// GetConfig returns the configuration every client is created with, for inspecting the resolved
+// region and credentials.
+func GetConfig() (aws.Config, error) {
+	return loadConfig()
+}
+
+func loadConfig(optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	// The global settings come first, so that a client for another region or account can override
+	// them
+	var globalOptFns []func(*config.LoadOptions) error
+	if profile != "" {
+		globalOptFns = append(globalOptFns, config.WithSharedConfigProfile(profile))
+	}
+	if region != "" {
+		globalOptFns = append(globalOptFns, config.WithRegion(region))
+	}
+	// Profiles naming an mfa_serial prompt for a code when their role is assumed
+	globalOptFns = append(globalOptFns, config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+		o.TokenProvider = mfaTokenProvider
+	}))
+	if fipsEndpoints {
+		globalOptFns = append(globalOptFns, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if dualStackEndpoints {
+		globalOptFns = append(globalOptFns, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	globalOptFns = append(globalOptFns, retryConfigOptions(retryOptions)...)
+	httpOptFns, err := httpConfigOptions(httpOptions)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	globalOptFns = append(globalOptFns, httpOptFns...)
+	optFns = append(globalOptFns, optFns...)
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), optFns...)
+	if err != nil {
+		return cfg, err
+	}
+
+	shared := sharedConfigOf(cfg)
+	if session := ssoSessionOf(shared); session != nil {
+		cfg.Credentials = aws.NewCredentialsCache(&ssoLoginProvider{cfg: cfg, session: *session, provider: cfg.Credentials})
+	}
+
+	usesMFA := shared.RoleARN != "" && shared.MFASerial != ""
+	if assumeRole.RoleARN != "" {
+		// A profile that doesn't assume a role of its own may still name the user's MFA device
+		serial := mfaSerial
+		if serial == "" && shared.RoleARN == "" {
+			serial = shared.MFASerial
+		}
+		useAssumedRole(&cfg, assumeRole, serial)
+		usesMFA = usesMFA || serial != ""
+	}
+	if usesMFA {
+		cache := newSessionCache(cfg.Credentials, shared.Profile, assumeRole.RoleARN, assumeRole.ExternalID, mfaSerial)
+		cfg.Credentials = aws.NewCredentialsCache(cache)
+	}
+
+	if offline {
+		cfg.Credentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+	}
+
+	// Instrumentation is a no-op unless telemetry has been configured
+	cfg.APIOptions = append(cfg.APIOptions, telemetry.InstrumentAWS, timeoutAttempts, logAPICalls)
+
+	return cfg, nil
+}
+
+func useAssumedRole(cfg *aws.Config, options AssumeRoleOptions, serial string) {
+	sessionName := options.SessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("kin-%d", time.Now().Unix())
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), options.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if options.ExternalID != "" {
+			o.ExternalID = aws.String(options.ExternalID)
+		}
+		if serial != "" {
+			o.SerialNumber = aws.String(serial)
+			o.TokenProvider = mfaTokenProvider
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
 }
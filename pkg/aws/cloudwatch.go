@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// CloudWatchClient fetches metrics from CloudWatch in bulk with GetMetricData.
+type CloudWatchClient struct {
+	client *cloudwatch.Client
+}
+
+// MetricQuery requests one statistic of a metric, identified by Id in the results.
+type MetricQuery struct {
+	Id         string
+	Namespace  string
+	MetricName string
+	Dimensions map[string]string
+	Stat       string
+	Period     time.Duration
+}
+
+// MetricResult holds the datapoints returned for a MetricQuery, in ascending time order.
+type MetricResult struct {
+	Id         string
+	Timestamps []time.Time
+	Values     []float64
+}
+
+func GetCloudWatchClient() (*CloudWatchClient, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured")
+	}
+
+	return &CloudWatchClient{client: cloudwatch.NewFromConfig(cfg)}, nil
+}
+
+// GetMetricData accepts at most this many queries per request
+const maxMetricDataQueries = 500
+
+// GetMetricData returns the datapoints of each query between start and end, in the same order as
+// the queries, following pagination and splitting the queries into as many requests as needed.
+func (c *CloudWatchClient) GetMetricData(ctx context.Context, queries []MetricQuery, start, end time.Time) ([]MetricResult, error) {
+	results := make([]MetricResult, 0, len(queries))
+	for batch := range slices.Chunk(queries, maxMetricDataQueries) {
+		batchResults, err := c.getMetricData(ctx, batch, start, end)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batchResults...)
+	}
+	return results, nil
+}
+
+func (c *CloudWatchClient) getMetricData(ctx context.Context, queries []MetricQuery, start, end time.Time) ([]MetricResult, error) {
+	input := &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(start.UTC()),
+		EndTime:   aws.Time(end.UTC()),
+		ScanBy:    types.ScanByTimestampAscending,
+	}
+	for _, query := range queries {
+		var dimensions []types.Dimension
+		for name, value := range query.Dimensions {
+			dimensions = append(dimensions, types.Dimension{Name: aws.String(name), Value: aws.String(value)})
+		}
+
+		input.MetricDataQueries = append(input.MetricDataQueries, types.MetricDataQuery{
+			Id: aws.String(query.Id),
+			MetricStat: &types.MetricStat{
+				Metric: &types.Metric{
+					Namespace:  aws.String(query.Namespace),
+					MetricName: aws.String(query.MetricName),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(int32(query.Period.Seconds())),
+				Stat:   aws.String(query.Stat),
+			},
+		})
+	}
+
+	results := map[string]*MetricResult{}
+	paginator := cloudwatch.NewGetMetricDataPaginator(c.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range output.MetricDataResults {
+			id := aws.ToString(r.Id)
+			result, ok := results[id]
+			if !ok {
+				result = &MetricResult{Id: id}
+				results[id] = result
+			}
+			n := min(len(r.Timestamps), len(r.Values))
+			result.Timestamps = append(result.Timestamps, r.Timestamps[:n]...)
+			result.Values = append(result.Values, r.Values[:n]...)
+		}
+	}
+
+	ordered := make([]MetricResult, 0, len(queries))
+	for _, query := range queries {
+		if result, ok := results[query.Id]; ok {
+			ordered = append(ordered, *result)
+		} else {
+			ordered = append(ordered, MetricResult{Id: query.Id})
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// debugLogger logs AWS API calls when enabled, independently of the --verbose level, since it's
+// asked for specifically
+var debugLogger *slog.Logger
+
+// SetDebugLogging makes every client created afterwards log each API call and each attempt at it
+// to stderr, with its parameters, HTTP status and request ID. Record payloads are elided.
+func SetDebugLogging(enabled bool) {
+	debugLogger = nil
+	if enabled {
+		debugLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+}
+
+// logAPICalls is an API option which logs the call, then each attempt at it as it's made.
+func logAPICalls(stack *middleware.Stack) error {
+	logger := debugLogger
+	if logger == nil {
+		return nil
+	}
+
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+		"KinDebugCall",
+		func(
+			ctx context.Context,
+			in middleware.InitializeInput,
+			next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			var params strings.Builder
+			encoder := json.NewEncoder(&params)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(elidePayloads(reflect.ValueOf(in.Parameters)))
+			logger.Info("aws call",
+				"service", awsmiddleware.GetServiceID(ctx),
+				"operation", awsmiddleware.GetOperationName(ctx),
+				"params", strings.TrimSpace(params.String()),
+			)
+			return next.HandleInitialize(ctx, in)
+		},
+	), middleware.After)
+	if err != nil {
+		return err
+	}
+
+	// The stack is built for each call, so this counts the call's attempts
+	attempt := 0
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(
+		"KinDebugAttempt",
+		func(
+			ctx context.Context,
+			in middleware.FinalizeInput,
+			next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			attempt++
+			start := time.Now()
+			out, metadata, err := next.HandleFinalize(ctx, in)
+
+			attrs := []any{
+				"service", awsmiddleware.GetServiceID(ctx),
+				"operation", awsmiddleware.GetOperationName(ctx),
+				"attempt", attempt,
+				"duration", time.Since(start).Round(time.Millisecond),
+			}
+			if raw, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+				attrs = append(attrs, "status", raw.StatusCode)
+			} else if responseErr := (*smithyhttp.ResponseError)(nil); errors.As(err, &responseErr) {
+				attrs = append(attrs, "status", responseErr.HTTPStatusCode())
+			}
+			if requestId, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+				attrs = append(attrs, "request_id", requestId)
+			}
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) {
+				attrs = append(attrs, "error_code", apiErr.ErrorCode())
+			}
+			if err != nil {
+				attrs = append(attrs, "error", err.Error())
+			}
+			logger.Info("aws attempt", attrs...)
+
+			return out, metadata, err
+		},
+	), "Retry", middleware.After)
+}
+
+// elidePayloads converts API parameters to something that can be logged, replacing the contents
+// of byte slices, which hold record data, with their size.
+func elidePayloads(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return elidePayloads(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("<%d bytes>", v.Len())
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = elidePayloads(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		fields := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			fields[fmt.Sprint(key.Interface())] = elidePayloads(v.MapIndex(key))
+		}
+		return fields
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t
+		}
+		fields := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if value := elidePayloads(v.Field(i)); value != nil {
+				fields[field.Name] = value
+			}
+		}
+		return fields
+	default:
+		return v.Interface()
+	}
+}
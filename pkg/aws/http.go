@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// HTTPOptions configure how clients reach AWS, for networks that only allow egress through a
+// proxy, often one with a private CA.
+type HTTPOptions struct {
+	// Proxy is the URL of the proxy to send every request through; "" uses HTTPS_PROXY and
+	// NO_PROXY as usual
+	Proxy string
+	// CABundle is a PEM file of certificates to trust in addition to the system's; "" uses
+	// AWS_CA_BUNDLE if it's set
+	CABundle string
+}
+
+var httpOptions HTTPOptions
+
+// SetHTTPOptions makes every client created afterwards connect as described.
+func SetHTTPOptions(options HTTPOptions) {
+	httpOptions = options
+}
+
+func httpConfigOptions(options HTTPOptions) ([]func(*config.LoadOptions) error, error) {
+	var optFns []func(*config.LoadOptions) error
+
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", options.Proxy)
+		}
+		client := awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.Proxy = http.ProxyURL(proxy)
+		})
+		optFns = append(optFns, config.WithHTTPClient(client))
+	}
+
+	if options.CABundle != "" {
+		bundle, err := os.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		optFns = append(optFns, config.WithCustomCABundle(bytes.NewReader(bundle)))
+	}
+
+	return optFns, nil
+}
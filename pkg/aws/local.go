@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+)
+
+// LocalEndpoint is a local Kinesis emulator started by kin local up. While one is running, Kinesis
+// clients are pointed at it instead of AWS, unless a profile, role, endpoint or another region
+// was given.
+type LocalEndpoint struct {
+	ContainerId string `json:"container_id"`
+	Emulator    string `json:"emulator"`
+	URL         string `json:"url"`
+	Region      string `json:"region"`
+}
+
+// LocalEndpointPath returns the file the running emulator is recorded in.
+func LocalEndpointPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".kin", "local.json"), nil
+}
+
+// LoadLocalEndpoint returns the running emulator, or nil if there isn't one.
+func LoadLocalEndpoint() (*LocalEndpoint, error) {
+	path, err := LocalEndpointPath()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoint LocalEndpoint
+	if err := json.Unmarshal(contents, &endpoint); err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// SaveLocalEndpoint records the running emulator for subsequent commands.
+func SaveLocalEndpoint(endpoint *LocalEndpoint) error {
+	path, err := LocalEndpointPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(endpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, 0o644)
+}
+
+// RemoveLocalEndpoint forgets the emulator, so that clients go back to AWS.
+func RemoveLocalEndpoint() error {
+	path, err := LocalEndpointPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// localEndpointDialTimeout is how long to wait to connect to the emulator before deciding that
+// it's down
+const localEndpointDialTimeout = 500 * time.Millisecond
+
+var (
+	localEndpointOnce  sync.Once
+	localEndpointInUse *LocalEndpoint
+	localEndpointErr   error
+)
+
+// activeLocalEndpoint returns the emulator Kinesis clients should use, or nil if they should use
+// AWS. It's nil if there's no emulator, if the settings given name somewhere else explicitly, or
+// and an error if the emulator can no longer be reached: commands meant for it mustn't fall back to
+// AWS, and only the local commands forget it. The result is the same for every client in a
+// process.
+func activeLocalEndpoint() (*LocalEndpoint, error) {
+	localEndpointOnce.Do(func() {
+		endpoint, err := LoadLocalEndpoint()
+		if err != nil || endpoint == nil {
+			localEndpointErr = err
+			return
+		}
+
+		switch {
+		case profile != "", assumeRole.RoleARN != "", kinesisEndpointURL != "":
+			slog.Info("not using the local emulator, since a profile, role or endpoint was given", "url", endpoint.URL)
+			return
+		case region != "" && region != endpoint.Region:
+			slog.Info("not using the local emulator, since its streams are in another region", "url", endpoint.URL, "region", endpoint.Region)
+			return
+		}
+
+		if !localEndpointReachable(endpoint) {
+			localEndpointErr = fmt.Errorf("the local emulator at %s can't be reached; run kin local up to start it again, or kin local down to use AWS", endpoint.URL)
+			return
+		}
+
+		slog.Warn("using the local emulator rather than AWS; run kin local down to use AWS again", "emulator", endpoint.Emulator, "url", endpoint.URL)
+		localEndpointInUse = endpoint
+	})
+	return localEndpointInUse, localEndpointErr
+}
+
+// localEndpointReachable reports whether anything is listening at the emulator's address.
+func localEndpointReachable(endpoint *LocalEndpoint) bool {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return false
+	}
+
+	conn, err := net.DialTimeout("tcp", u.Host, localEndpointDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// withLocalEndpoint points a Kinesis client at the emulator, in the region its streams were
+// created in. Emulators accept any credentials, and real ones shouldn't be sent to them, so static
+// dummy credentials are used.
+func withLocalEndpoint(endpoint *LocalEndpoint) func(*kinesis.Options) {
+	return func(o *kinesis.Options) {
+		o.BaseEndpoint = aws.String(endpoint.URL)
+		o.Region = endpoint.Region
+		o.Credentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+	}
+}
+
+// GetLocalKinesisClient returns a Kinesis client for the emulator, whether or not it's reachable
+// yet, for starting it and waiting until it is.
+func GetLocalKinesisClient(endpoint *LocalEndpoint) (KinesisAPI, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kinesis.NewFromConfig(cfg, withLocalEndpoint(endpoint)), nil
+}
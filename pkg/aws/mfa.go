@@ -0,0 +1,137 @@
+package aws
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// mfaSerial and mfaToken are the MFA device and code given on the command line. Without a code,
+// the user is prompted for one when a role needs it.
+var (
+	mfaSerial string
+	mfaToken  string
+)
+
+// SetMFA sets the MFA device used to assume the --role-arn role, and the code to assume it with.
+// Either may be "": roles in a profile name their own device, and without a code the user is
+// prompted for one.
+func SetMFA(serial, token string) {
+	mfaSerial = serial
+	mfaToken = token
+}
+
+// mfaTokenProvider returns the MFA code, prompting for it if it wasn't given.
+func mfaTokenProvider() (string, error) {
+	if mfaToken != "" {
+		return mfaToken, nil
+	}
+
+	code, err := promptTerminal("MFA code: ")
+	if errors.Is(err, errNoTerminal) {
+		return "", fmt.Errorf("assuming the role requires an MFA code; pass it with --mfa-token")
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading MFA code: %w", err)
+	}
+	return code, nil
+}
+
+var errNoTerminal = errors.New("no terminal to prompt on")
+
+// promptTerminal asks the user for a line of input on the terminal rather than stdin, which may
+// be records being put.
+func promptTerminal(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoTerminal
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// sharedConfigOf returns the shared config profile cfg was loaded from, if any.
+func sharedConfigOf(cfg aws.Config) config.SharedConfig {
+	for _, source := range cfg.ConfigSources {
+		if shared, ok := source.(config.SharedConfig); ok {
+			return shared
+		}
+	}
+	return config.SharedConfig{}
+}
+
+// sessionCacheMu keeps concurrently created clients from each prompting for an MFA code, by
+// having all but the first wait for the credentials it caches.
+var sessionCacheMu sync.Mutex
+
+// sessionCache keeps credentials obtained with an MFA code under ~/.kin, so that the next
+// command can reuse them until they expire instead of prompting again.
+type sessionCache struct {
+	key      string
+	provider aws.CredentialsProvider
+}
+
+// newSessionCache caches the credentials from provider under a key made of everything that
+// determines which session they're for.
+func newSessionCache(provider aws.CredentialsProvider, parts ...string) *sessionCache {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return &sessionCache{key: hex.EncodeToString(sum[:16]), provider: provider}
+}
+
+func (c *sessionCache) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	sessionCacheMu.Lock()
+	defer sessionCacheMu.Unlock()
+
+	path, err := c.path()
+	if err != nil {
+		return c.provider.Retrieve(ctx)
+	}
+
+	// Leave a margin, so that credentials don't expire part way through a command
+	var cached aws.Credentials
+	if contents, err := os.ReadFile(path); err == nil && json.Unmarshal(contents, &cached) == nil {
+		if cached.HasKeys() && time.Until(cached.Expires) > 5*time.Minute {
+			return cached, nil
+		}
+	}
+
+	credentials, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		return credentials, err
+	}
+
+	// Failing to cache only means prompting again next time
+	if contents, err := json.Marshal(credentials); err == nil {
+		if os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+			os.WriteFile(path, contents, 0o600)
+		}
+	}
+	return credentials, nil
+}
+
+func (c *sessionCache) path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".kin", "sessions", c.key+".json"), nil
+}
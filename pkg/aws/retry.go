@@ -0,0 +1,128 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// RetryOptions control how API calls are retried and how long each attempt may take.
+type RetryOptions struct {
+	// MaxAttempts is the number of attempts at each call, including the first; 0 keeps the SDK's
+	// default of 3
+	MaxAttempts int
+	// Mode is standard or adaptive, which also rate limits calls after throttling; "" keeps the
+	// SDK's default of standard
+	Mode aws.RetryMode
+	// APITimeout limits each attempt at a call, other than the long-lived SubscribeToShard; 0
+	// leaves attempts unlimited
+	APITimeout time.Duration
+	// GetRecordsTimeout limits each attempt at GetRecords in place of APITimeout, since a hung
+	// read would otherwise stall a shard indefinitely
+	GetRecordsTimeout time.Duration
+}
+
+var retryOptions RetryOptions
+
+// SetRetryOptions makes every client created afterwards retry and time out calls as described.
+func SetRetryOptions(options RetryOptions) {
+	retryOptions = options
+}
+
+func retryConfigOptions(options RetryOptions) []func(*config.LoadOptions) error {
+	var optFns []func(*config.LoadOptions) error
+	if options.MaxAttempts > 0 {
+		optFns = append(optFns, config.WithRetryMaxAttempts(options.MaxAttempts))
+	}
+	if options.Mode != "" {
+		optFns = append(optFns, config.WithRetryMode(options.Mode))
+	}
+	return optFns
+}
+
+// timeoutAttempts is an API option which gives each attempt at a call its own deadline, so that
+// an attempt that times out is retried like any other failure.
+func timeoutAttempts(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(
+		"KinAttemptTimeout",
+		func(
+			ctx context.Context,
+			in middleware.FinalizeInput,
+			next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			timeout := retryOptions.APITimeout
+			switch awsmiddleware.GetOperationName(ctx) {
+			case "GetRecords":
+				if retryOptions.GetRecordsTimeout > 0 {
+					timeout = retryOptions.GetRecordsTimeout
+				}
+			case "SubscribeToShard":
+				// Its events are read after the call returns, for up to 5 minutes
+				timeout = 0
+			}
+			if timeout <= 0 {
+				return next.HandleFinalize(ctx, in)
+			}
+
+			attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			out, metadata, err := next.HandleFinalize(attemptCtx, in)
+			// The SDK won't retry a canceled call, so a timed out attempt is reported as something
+			// it will retry
+			if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+				err = &attemptTimeoutError{timeout: timeout}
+			}
+			return out, metadata, err
+		},
+	), "Retry", middleware.After)
+}
+
+type attemptTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *attemptTimeoutError) Error() string {
+	return fmt.Sprintf("attempt timed out after %s", e.timeout)
+}
+
+func (e *attemptTimeoutError) RetryableError() bool {
+	return true
+}
+
+// Backoff returns an exponentially increasing delay with full jitter, capped at 10 seconds.
+func Backoff(retry int) time.Duration {
+	maxDelay := 100 * time.Millisecond << retry
+	if maxDelay > 10*time.Second || maxDelay <= 0 {
+		maxDelay = 10 * time.Second
+	}
+
+	return time.Duration(rand.Int63n(int64(maxDelay)))
+}
+
+// SleepContext sleeps for d, returning early if ctx is cancelled.
+func SleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// ErrorCode returns the code of an API error, such as ProvisionedThroughputExceededException, or
+// RequestError if the request failed without a response.
+func ErrorCode(err error) string {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "RequestError"
+}
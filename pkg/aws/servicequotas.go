@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+)
+
+// ServiceQuotasClient lists a service's quotas, merging the AWS defaults with the account's
+// applied values.
+type ServiceQuotasClient struct {
+	client *servicequotas.Client
+	region string
+}
+
+// ServiceQuota is the value of one quota in the client's region.
+type ServiceQuota struct {
+	QuotaCode  string  `json:"QuotaCode"`
+	QuotaName  string  `json:"QuotaName"`
+	Value      float64 `json:"Value"`
+	Unit       string  `json:"Unit"`
+	Adjustable bool    `json:"Adjustable"`
+	// Applied is set for quotas that have been raised (or lowered) from the AWS default
+	Applied bool `json:"-"`
+}
+
+// GetServiceQuotasClient returns a client for the configured region, after applying cfgOptFns
+// when loading the configuration.
+func GetServiceQuotasClient(cfgOptFns ...func(*config.LoadOptions) error) (*ServiceQuotasClient, error) {
+	cfg, err := loadConfig(cfgOptFns...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured")
+	}
+
+	return &ServiceQuotasClient{client: servicequotas.NewFromConfig(cfg), region: cfg.Region}, nil
+}
+
+// Region returns the region the client lists quotas for.
+func (c *ServiceQuotasClient) Region() string {
+	return c.region
+}
+
+// ListQuotas returns every quota of a service, such as "kinesis": the AWS defaults, replaced by
+// the account's applied values where it has any.
+func (c *ServiceQuotasClient) ListQuotas(ctx context.Context, serviceCode string) ([]ServiceQuota, error) {
+	var quotas []ServiceQuota
+	defaults := servicequotas.NewListAWSDefaultServiceQuotasPaginator(c.client, &servicequotas.ListAWSDefaultServiceQuotasInput{
+		ServiceCode: aws.String(serviceCode),
+	})
+	for defaults.HasMorePages() {
+		output, err := defaults.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, quota := range output.Quotas {
+			quotas = append(quotas, serviceQuota(quota))
+		}
+	}
+
+	applied := servicequotas.NewListServiceQuotasPaginator(c.client, &servicequotas.ListServiceQuotasInput{
+		ServiceCode: aws.String(serviceCode),
+	})
+	for applied.HasMorePages() {
+		output, err := applied.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, q := range output.Quotas {
+			quota := serviceQuota(q)
+			quota.Applied = true
+			replaced := false
+			for i := range quotas {
+				if quotas[i].QuotaCode == quota.QuotaCode {
+					quotas[i] = quota
+					replaced = true
+				}
+			}
+			if !replaced {
+				quotas = append(quotas, quota)
+			}
+		}
+	}
+	return quotas, nil
+}
+
+func serviceQuota(quota types.ServiceQuota) ServiceQuota {
+	return ServiceQuota{
+		QuotaCode:  aws.ToString(quota.QuotaCode),
+		QuotaName:  aws.ToString(quota.QuotaName),
+		Value:      aws.ToFloat64(quota.Value),
+		Unit:       aws.ToString(quota.Unit),
+		Adjustable: quota.Adjustable,
+	}
+}
@@ -0,0 +1,231 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/aws/smithy-go"
+)
+
+// ssoSession is where an SSO profile's token comes from: either an sso-session section, or the
+// legacy sso_start_url and sso_region in the profile itself.
+type ssoSession struct {
+	profile  string
+	name     string
+	startURL string
+	region   string
+}
+
+// cacheKey returns the key the SDK looks the session's cached token up by.
+func (s ssoSession) cacheKey() string {
+	if s.name != "" {
+		return s.name
+	}
+	return s.startURL
+}
+
+// ssoSessionOf returns the SSO session the profile's credentials come from, following
+// source_profile, or nil if they don't come from SSO.
+func ssoSessionOf(shared config.SharedConfig) *ssoSession {
+	for profile := &shared; profile != nil; profile = profile.Source {
+		switch {
+		case profile.SSOSession != nil:
+			return &ssoSession{
+				profile:  shared.Profile,
+				name:     profile.SSOSession.Name,
+				startURL: profile.SSOSession.SSOStartURL,
+				region:   profile.SSOSession.SSORegion,
+			}
+		case profile.SSOStartURL != "":
+			return &ssoSession{profile: shared.Profile, startURL: profile.SSOStartURL, region: profile.SSORegion}
+		}
+	}
+	return nil
+}
+
+// ssoLoginMu keeps concurrently created clients from each starting a login.
+var ssoLoginMu sync.Mutex
+
+// ssoLoginProvider retrieves credentials for an SSO profile, offering to log in again when the
+// session has expired rather than failing.
+type ssoLoginProvider struct {
+	cfg      aws.Config
+	session  ssoSession
+	provider aws.CredentialsProvider
+}
+
+func (p *ssoLoginProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	credentials, err := p.provider.Retrieve(ctx)
+	if err == nil || !isExpiredSSOSession(err) {
+		return credentials, err
+	}
+
+	ssoLoginMu.Lock()
+	defer ssoLoginMu.Unlock()
+
+	// Another client may have logged in while this one waited
+	if credentials, err := p.provider.Retrieve(ctx); err == nil {
+		return credentials, nil
+	}
+
+	answer, promptErr := promptTerminal(fmt.Sprintf("There's no current SSO session for profile %s. Log in now? [Y/n] ", p.session.profile))
+	if promptErr != nil || (answer != "" && !strings.HasPrefix(strings.ToLower(answer), "y")) {
+		return credentials, fmt.Errorf("no current SSO session; run aws sso login --profile %s: %w", p.session.profile, err)
+	}
+	if err := ssoLogin(ctx, p.cfg, p.session); err != nil {
+		return credentials, fmt.Errorf("logging in to SSO: %w", err)
+	}
+
+	return p.provider.Retrieve(ctx)
+}
+
+// isExpiredSSOSession returns whether err means the SSO token is missing, expired or revoked.
+func isExpiredSSOSession(err error) bool {
+	var invalidToken *ssocreds.InvalidTokenError
+	if errors.As(err, &invalidToken) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "UnauthorizedException", "InvalidGrantException", "ExpiredTokenException":
+			return true
+		}
+	}
+
+	// The token provider's own errors, such as for a missing cache file, aren't typed
+	return strings.Contains(err.Error(), "SSO token")
+}
+
+// ssoLogin runs the device authorization flow, as aws sso login does: the user approves the
+// login in a browser while it's polled for, then the token is cached where the SDK finds it.
+func ssoLogin(ctx context.Context, cfg aws.Config, session ssoSession) error {
+	client := ssooidc.NewFromConfig(cfg, func(o *ssooidc.Options) {
+		o.Region = session.region
+	})
+
+	registerInput := &ssooidc.RegisterClientInput{
+		ClientName: aws.String("kin"),
+		ClientType: aws.String("public"),
+	}
+	// Tokens for sso-session sections can be refreshed, so they outlive the login
+	if session.name != "" {
+		registerInput.GrantTypes = []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"}
+		registerInput.IssuerUrl = aws.String(session.startURL)
+		registerInput.Scopes = []string{"sso:account:access"}
+	}
+	registration, err := client.RegisterClient(ctx, registerInput)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     registration.ClientId,
+		ClientSecret: registration.ClientSecret,
+		StartUrl:     aws.String(session.startURL),
+	})
+	if err != nil {
+		return err
+	}
+
+	verificationURL := aws.ToString(authorization.VerificationUriComplete)
+	fmt.Fprintf(os.Stderr, "Approve the login at %s\nand check that it shows the code %s\n", verificationURL, aws.ToString(authorization.UserCode))
+	openBrowser(verificationURL)
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+
+	for {
+		token, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     registration.ClientId,
+			ClientSecret: registration.ClientSecret,
+			DeviceCode:   authorization.DeviceCode,
+			GrantType:    aws.String("urn:ietf:params:oauth:grant-type:device_code"),
+		})
+		if err == nil {
+			return cacheSSOToken(session, registration, token)
+		}
+
+		var pending *types.AuthorizationPendingException
+		var slowDown *types.SlowDownException
+		switch {
+		case errors.As(err, &slowDown):
+			interval += 5 * time.Second
+		case !errors.As(err, &pending):
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the login wasn't approved in time")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// cacheSSOToken writes the token in the format the SDK (and the AWS CLI) read it in.
+func cacheSSOToken(session ssoSession, registration *ssooidc.RegisterClientOutput, token *ssooidc.CreateTokenOutput) error {
+	path, err := ssocreds.StandardCachedTokenFilepath(session.cacheKey())
+	if err != nil {
+		return err
+	}
+
+	cached := map[string]string{
+		"accessToken": aws.ToString(token.AccessToken),
+		"expiresAt":   time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+		"region":      session.region,
+		"startUrl":    session.startURL,
+	}
+	if token.RefreshToken != nil {
+		cached["refreshToken"] = *token.RefreshToken
+		cached["clientId"] = aws.ToString(registration.ClientId)
+		cached["clientSecret"] = aws.ToString(registration.ClientSecret)
+		cached["registrationExpiresAt"] = time.Unix(registration.ClientSecretExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	contents, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, 0o600)
+}
+
+// openBrowser tries to open url in the user's browser; they can always open it themselves.
+func openBrowser(url string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
@@ -0,0 +1,30 @@
+// Package checkpoint stores the last sequence number consumed from each shard of a stream, so that
+// a consumer can resume where it stopped. Stores keep checkpoints in memory as they're set and
+// persist them when flushed: to a local file, a Kinesis Client Library lease table in DynamoDB, or
+// nowhere at all.
+package checkpoint
+
+// Store tracks the last sequence number consumed from each shard of a stream. Set only updates
+// in-memory state; checkpoints are persisted by Flush, which callers invoke periodically and on
+// shutdown. Stores are safe for concurrent use.
+type Store interface {
+	// Get returns the last checkpointed sequence number for a shard, if any.
+	Get(shardId string) (string, bool, error)
+	Set(shardId, sequenceNumber string)
+	Flush() error
+}
+
+// IsSequenceNumber reports whether s is a sequence number rather than one of the sentinel values
+// the KCL also stores as checkpoints, such as TRIM_HORIZON or SHARD_END.
+func IsSequenceNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
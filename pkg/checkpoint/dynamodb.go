@@ -0,0 +1,140 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attribute names used by the Kinesis Client Library's lease table
+const (
+	LeaseKeyAttribute                     = "leaseKey"
+	CheckpointAttribute                   = "checkpoint"
+	CheckpointSubSequenceNumberAttribute  = "checkpointSubSequenceNumber"
+	LeaseCounterAttribute                 = "leaseCounter"
+	OwnerSwitchesSinceCheckpointAttribute = "ownerSwitchesSinceCheckpoint"
+	LeaseOwnerAttribute                   = "leaseOwner"
+)
+
+// ShardEnd is the checkpoint the KCL writes once a shard has been fully processed
+const ShardEnd = "SHARD_END"
+
+// DynamoDB reads and writes checkpoints in a KCL lease table, which lets kin inspect
+// or seed the position of a real KCL application. Only the checkpoint attributes are written;
+// lease ownership is left alone so as not to disturb running workers.
+type DynamoDB struct {
+	client *dynamodb.Client
+	table  string
+
+	// Owner, if set, restricts writes to leases currently owned by this worker, so that a worker
+	// which has lost a lease can't clobber the checkpoints of its new owner.
+	Owner string
+
+	mu    sync.Mutex
+	dirty map[string]string
+}
+
+// NewDynamoDB returns a store for the lease table of that name.
+func NewDynamoDB(client *dynamodb.Client, table string) *DynamoDB {
+	return &DynamoDB{
+		client: client,
+		table:  table,
+		dirty:  map[string]string{},
+	}
+}
+
+// Get returns the checkpointed sequence number for a shard. The KCL also stores sentinel values
+// like TRIM_HORIZON, LATEST and SHARD_END in the checkpoint attribute; these aren't sequence
+// numbers we can resume after, so they're treated as having no checkpoint.
+func (c *DynamoDB) Get(shardId string) (string, bool, error) {
+	output, err := c.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      &c.table,
+		Key:            map[string]types.AttributeValue{LeaseKeyAttribute: &types.AttributeValueMemberS{Value: shardId}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	checkpoint, ok := output.Item[CheckpointAttribute].(*types.AttributeValueMemberS)
+	if !ok || !IsSequenceNumber(checkpoint.Value) {
+		return "", false, nil
+	}
+
+	return checkpoint.Value, true, nil
+}
+
+func (c *DynamoDB) Set(shardId, sequenceNumber string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dirty[shardId] = sequenceNumber
+}
+
+// Flush writes every checkpoint that changed since the last flush. New lease items are created
+// with the counters the KCL expects to find, so that a KCL application can pick them up later.
+func (c *DynamoDB) Flush() error {
+	c.mu.Lock()
+	dirty := c.dirty
+	c.dirty = map[string]string{}
+	c.mu.Unlock()
+
+	var firstErr error
+	for shardId, sequenceNumber := range dirty {
+		if err := c.writeCheckpoint(shardId, sequenceNumber); err != nil {
+			var lostLease *types.ConditionalCheckFailedException
+			if errors.As(err, &lostLease) {
+				// Another worker owns this shard now; its checkpoints take precedence
+				continue
+			}
+
+			// Put it back so the next flush retries, unless a newer checkpoint has arrived since
+			c.mu.Lock()
+			if _, ok := c.dirty[shardId]; !ok {
+				c.dirty[shardId] = sequenceNumber
+			}
+			c.mu.Unlock()
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func (c *DynamoDB) writeCheckpoint(shardId, sequenceNumber string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: &c.table,
+		Key:       map[string]types.AttributeValue{LeaseKeyAttribute: &types.AttributeValueMemberS{Value: shardId}},
+		UpdateExpression: aws.String(
+			"SET #checkpoint = :checkpoint, #subSequenceNumber = :zero, " +
+				"#leaseCounter = if_not_exists(#leaseCounter, :zero), " +
+				"#ownerSwitches = if_not_exists(#ownerSwitches, :zero)",
+		),
+		ExpressionAttributeNames: map[string]string{
+			"#checkpoint":        CheckpointAttribute,
+			"#subSequenceNumber": CheckpointSubSequenceNumberAttribute,
+			"#leaseCounter":      LeaseCounterAttribute,
+			"#ownerSwitches":     OwnerSwitchesSinceCheckpointAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":checkpoint": &types.AttributeValueMemberS{Value: sequenceNumber},
+			":zero":       &types.AttributeValueMemberN{Value: "0"},
+		},
+	}
+
+	if c.Owner != "" {
+		input.ConditionExpression = aws.String("#owner = :owner")
+		input.ExpressionAttributeNames["#owner"] = LeaseOwnerAttribute
+		input.ExpressionAttributeValues[":owner"] = &types.AttributeValueMemberS{Value: c.Owner}
+	}
+
+	_, err := c.client.UpdateItem(context.TODO(), input)
+	return err
+}
@@ -0,0 +1,132 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// File tracks the last sequence number consumed from each shard of a stream and persists them
+// to a local JSON file so a later tail can resume exactly where this one stopped.
+type File struct {
+	path string
+
+	mu    sync.Mutex
+	dirty bool
+	state checkpointFile
+}
+
+type checkpointFile struct {
+	StreamName string            `json:"streamName"`
+	Shards     map[string]string `json:"shards"`
+}
+
+// DefaultPath returns the checkpoint file used for a stream when none is specified.
+func DefaultPath(streamName string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".kin", "checkpoints", streamName+".json"), nil
+}
+
+// LoadFile reads any existing checkpoints from path. A missing file is not an error;
+// it simply means there is nothing to resume from yet.
+func LoadFile(path, streamName string) (*File, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &File{
+		path: path,
+		state: checkpointFile{
+			StreamName: streamName,
+			Shards:     map[string]string{},
+		},
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &c.state); err != nil {
+		return nil, err
+	}
+	if c.state.Shards == nil {
+		c.state.Shards = map[string]string{}
+	}
+
+	return c, nil
+}
+
+func (c *File) Get(shardId string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sequenceNumber, ok := c.state.Shards[shardId]
+	return sequenceNumber, ok, nil
+}
+
+// Set records sequenceNumber as the last record consumed from a shard. It is only written to
+// disk on the next Flush.
+func (c *File) Set(shardId, sequenceNumber string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Shards[shardId] = sequenceNumber
+	c.dirty = true
+}
+
+// Flush atomically writes the current checkpoints to disk if anything has changed.
+func (c *File) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	contents, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place so an interrupted write can't leave a
+	// truncated checkpoint behind
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,36 @@
+package checkpoint
+
+import (
+	"sync"
+)
+
+// Memory keeps checkpoints only in memory, for consumers that resume within a single process or
+// don't need to resume at all.
+type Memory struct {
+	mu     sync.Mutex
+	shards map[string]string
+}
+
+func NewMemory() *Memory {
+	return &Memory{shards: map[string]string{}}
+}
+
+func (m *Memory) Get(shardId string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sequenceNumber, ok := m.shards[shardId]
+	return sequenceNumber, ok, nil
+}
+
+func (m *Memory) Set(shardId, sequenceNumber string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shards[shardId] = sequenceNumber
+}
+
+// Flush does nothing, since there's nowhere to persist to.
+func (m *Memory) Flush() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package decode
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// newAvroDecoder decodes Avro. Given a schema file, payloads are single binary-encoded datums of
+// that schema; without one, they're object container files carrying their own schema, and decode
+// to a list if they hold more than one datum.
+func newAvroDecoder(schemaFile string) (Decoder, error) {
+	if schemaFile == "" {
+		return DecoderFunc(decodeAvroContainer), nil
+	}
+
+	schema, err := os.ReadFile(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	return DecoderFunc(func(data []byte) (interface{}, error) {
+		value, rest, err := codec.NativeFromBinary(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("%d bytes left over after the datum", len(rest))
+		}
+		return value, nil
+	}), nil
+}
+
+func decodeAvroContainer(data []byte) (interface{}, error) {
+	reader, err := goavro.NewOCFReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for reader.Scan() {
+		value, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if err := reader.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	return values, nil
+}
@@ -0,0 +1,158 @@
+package decode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"kin/pkg/kpl"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("auto", orderedArg(Auto, AutoOrdered))
+	Register("json", orderedArg(JSON, JSONOrdered))
+	Register("text", noArg(Text))
+	Register("base64", noArg(Base64))
+	Register("gzip", noArg(Gzip))
+	Register("zlib", noArg(Zlib))
+	Register("kpl", noArg(KPL))
+	Register("avro", newAvroDecoder)
+	Register("protobuf", newProtobufDecoder)
+}
+
+// noArg makes a Factory for a decoder that takes no argument.
+func noArg(f func(data []byte) (interface{}, error)) Factory {
+	return func(arg string) (Decoder, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("takes no argument")
+		}
+		return DecoderFunc(f), nil
+	}
+}
+
+// orderedArg makes a Factory for a JSON decoder that takes "ordered" as its argument to keep the
+// keys of objects in order, as *Object.
+func orderedArg(f, ordered func(data []byte) (interface{}, error)) Factory {
+	return func(arg string) (Decoder, error) {
+		switch arg {
+		case "":
+			return DecoderFunc(f), nil
+		case "ordered":
+			return DecoderFunc(ordered), nil
+		default:
+			return nil, fmt.Errorf("unknown argument %q; expected ordered or none", arg)
+		}
+	}
+}
+
+// Auto decodes JSON, falling back to plain text or, failing that, returning the bytes themselves,
+// so it never fails.
+func Auto(data []byte) (interface{}, error) {
+	return auto(data, JSON)
+}
+
+// AutoOrdered is Auto, but decodes JSON as JSONOrdered does.
+func AutoOrdered(data []byte) (interface{}, error) {
+	return auto(data, JSONOrdered)
+}
+
+func auto(data []byte, decodeJSON func(data []byte) (interface{}, error)) (interface{}, error) {
+	if value, err := decodeJSON(data); err == nil {
+		return value, nil
+	}
+	if IsPrintableText(data) {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+// Text returns the payload as a string, failing if it isn't printable UTF-8.
+func Text(data []byte) (interface{}, error) {
+	if !IsPrintableText(data) {
+		return nil, fmt.Errorf("payload isn't printable text")
+	}
+	return string(data), nil
+}
+
+// Base64 decodes standard base64, such as payloads that were base64-encoded before being put.
+func Base64(data []byte) (interface{}, error) {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(decoded, bytes.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
+}
+
+// Gzip decompresses a gzipped payload, such as those from CloudWatch Logs subscriptions.
+func Gzip(data []byte) (interface{}, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return readDecompressed(reader)
+}
+
+// Zlib decompresses a zlib-compressed payload.
+func Zlib(data []byte) (interface{}, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return readDecompressed(reader)
+}
+
+// maxDecompressedSize is the most a compressed payload may decompress to. Records are at most
+// 1 MiB, so this leaves room for compression ratios of 8 to 1 while refusing decompression bombs.
+const maxDecompressedSize = 8 * kpl.MaxRecordSize
+
+// readDecompressed reads a decompressing reader to the end, failing once it's read more than
+// maxDecompressedSize.
+func readDecompressed(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("payload decompresses to more than %d MiB", maxDecompressedSize>>20)
+	}
+	return data, nil
+}
+
+// KPL unpacks the user records from a KPL aggregated record. Other records are passed on as they
+// are, since producers only aggregate when it's worthwhile.
+func KPL(data []byte) (interface{}, error) {
+	if !kpl.IsAggregated(data) {
+		return data, nil
+	}
+
+	userRecords, err := kpl.Deaggregate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]interface{}, len(userRecords))
+	for i, userRecord := range userRecords {
+		items[i] = userRecord.Data
+	}
+	return items, nil
+}
+
+// IsPrintableText reports whether data is valid UTF-8 made up only of printable characters and
+// whitespace.
+func IsPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package decode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func TestDecompressLimitsSize(t *testing.T) {
+	compress := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"zlib": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+	}
+	decoders := map[string]func([]byte) (interface{}, error){"gzip": Gzip, "zlib": Zlib}
+
+	for name, newWriter := range compress {
+		for _, size := range []int{maxDecompressedSize, maxDecompressedSize + 1} {
+			var buf bytes.Buffer
+			w := newWriter(&buf)
+			w.Write(make([]byte, size))
+			w.Close()
+
+			decoded, err := decoders[name](buf.Bytes())
+			if size <= maxDecompressedSize && (err != nil || len(decoded.([]byte)) != size) {
+				t.Errorf("%s of %d bytes failed: %v", name, size, err)
+			}
+			if size > maxDecompressedSize && err == nil {
+				t.Errorf("%s of %d bytes succeeded; want an error", name, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package decode turns record payloads into values that can be printed. Decoders are registered
+// by name, so that a chain of them can be given as a spec like "gzip,json", and programs embedding
+// kin can register their own alongside the built-in ones.
+//
+// Decoders that unwrap payloads, such as gzip, return []byte for the next decoder in a chain to
+// decode further. Those that split a payload into several, such as kpl, return []interface{} of
+// []byte, and the rest of the chain decodes each in turn.
+package decode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decoder decodes a record's payload.
+type Decoder interface {
+	Decode(data []byte) (interface{}, error)
+}
+
+// DecoderFunc adapts a function to a Decoder.
+type DecoderFunc func(data []byte) (interface{}, error)
+
+func (f DecoderFunc) Decode(data []byte) (interface{}, error) {
+	return f(data)
+}
+
+// Factory creates a Decoder from the argument given after its name in a spec, such as the schema
+// file in "avro:order.avsc", which is "" if there wasn't one.
+type Factory func(arg string) (Decoder, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a decoder available by name. It panics if the name is empty, contains a comma or
+// colon, or is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || strings.ContainsAny(name, ",:") {
+		panic(fmt.Sprintf("decode: invalid decoder name %q", name))
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("decode: decoder %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// Names returns the names of every registered decoder, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the chain of decoders described by spec: comma-separated decoder names, each
+// optionally followed by a colon and an argument (ex: "gzip,kpl,avro:order.avsc").
+func New(spec string) (Decoder, error) {
+	var decoders []Decoder
+	for _, part := range strings.Split(spec, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+
+		registryMu.RLock()
+		factory, ok := registry[name]
+		registryMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown decoder %q; expected one of %s", name, strings.Join(Names(), ", "))
+		}
+
+		decoder, err := factory(arg)
+		if err != nil {
+			return nil, fmt.Errorf("decoder %s: %w", name, err)
+		}
+		decoders = append(decoders, decoder)
+	}
+	return Chain(decoders...), nil
+}
+
+// Chain returns a Decoder which applies each decoder to the output of the one before.
+func Chain(decoders ...Decoder) Decoder {
+	if len(decoders) == 1 {
+		return decoders[0]
+	}
+
+	return DecoderFunc(func(data []byte) (interface{}, error) {
+		return decodeChain(decoders, data)
+	})
+}
+
+func decodeChain(decoders []Decoder, value interface{}) (interface{}, error) {
+	for i, decoder := range decoders {
+		switch v := value.(type) {
+		case []byte:
+			decoded, err := decoder.Decode(v)
+			if err != nil {
+				return nil, err
+			}
+			value = decoded
+
+		case []interface{}:
+			// A payload split into several; decode each with what's left of the chain
+			items := make([]interface{}, len(v))
+			for j, item := range v {
+				decoded, err := decodeChain(decoders[i:], item)
+				if err != nil {
+					return nil, err
+				}
+				items[j] = decoded
+			}
+			return items, nil
+
+		default:
+			return nil, fmt.Errorf("payload was already decoded to %T, so it can't be decoded further", value)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,179 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// JSON decodes a JSON document. Numbers are decoded as json.Number, so that integers too large
+// for a float64, such as IDs, and decimals with more precision than one are output as they were.
+func JSON(data []byte) (interface{}, error) {
+	decoder := newJSONDecoder(data)
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, checkJSONEnd(decoder)
+}
+
+// JSONOrdered is JSON, but decodes objects as *Object, keeping their keys in the order they were
+// in rather than sorting them when they're output.
+func JSONOrdered(data []byte) (interface{}, error) {
+	decoder := newJSONDecoder(data)
+	value, err := decodeOrdered(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return value, checkJSONEnd(decoder)
+}
+
+func newJSONDecoder(data []byte) *json.Decoder {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder
+}
+
+// checkJSONEnd fails if there's anything but whitespace after the document, as json.Unmarshal
+// does.
+func checkJSONEnd(decoder *json.Decoder) error {
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := &Object{Values: map[string]interface{}{}}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(key.(string), value)
+		}
+		_, err := decoder.Token()
+		return object, err
+
+	case json.Delim('['):
+		items := []interface{}{}
+		for decoder.More() {
+			item, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := decoder.Token()
+		return items, err
+
+	default:
+		// A string, json.Number, bool or nil
+		return token, nil
+	}
+}
+
+// Object is a JSON object that keeps its keys in order. It's output with its keys in that order,
+// but anything that works with objects as maps needs it converted with Plain first.
+type Object struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+// Set sets the value of a key, adding the key after the others if it's new.
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.Values[key]; !ok {
+		o.Keys = append(o.Keys, key)
+	}
+	o.Values[key] = value
+}
+
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range o.Keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(o.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(encodedKey)
+		buffer.WriteByte(':')
+		buffer.Write(encodedValue)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// Plain returns value with every *Object within it converted to a map[string]interface{}, copying
+// only what has to change so that value itself is left as it was.
+func Plain(value interface{}) interface{} {
+	if !containsObject(value) {
+		return value
+	}
+
+	switch v := value.(type) {
+	case *Object:
+		plain := make(map[string]interface{}, len(v.Values))
+		for key, item := range v.Values {
+			plain[key] = Plain(item)
+		}
+		return plain
+
+	case map[string]interface{}:
+		plain := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			plain[key] = Plain(item)
+		}
+		return plain
+
+	case []interface{}:
+		plain := make([]interface{}, len(v))
+		for i, item := range v {
+			plain[i] = Plain(item)
+		}
+		return plain
+
+	default:
+		return value
+	}
+}
+
+func containsObject(value interface{}) bool {
+	switch v := value.(type) {
+	case *Object:
+		return true
+	case map[string]interface{}:
+		for _, item := range v {
+			if containsObject(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if containsObject(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package decode
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newProtobufDecoder decodes protobuf messages. The argument is a descriptor set, as written by
+// protoc --include_imports --descriptor_set_out, and the full name of the message type
+// (ex: orders.binpb#shop.v1.Order). Without one, messages are decoded without a schema, as
+// protoc --decode_raw does, into an object keyed by field number.
+func newProtobufDecoder(arg string) (Decoder, error) {
+	if arg == "" {
+		return DecoderFunc(decodeRawProtobuf), nil
+	}
+
+	descriptorFile, messageName, ok := strings.Cut(arg, "#")
+	if !ok || messageName == "" {
+		return nil, fmt.Errorf("expected <descriptor set file>#<message name>, not %q", arg)
+	}
+
+	contents, err := os.ReadFile(descriptorFile)
+	if err != nil {
+		return nil, err
+	}
+	var descriptorSet descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(contents, &descriptorSet); err != nil {
+		return nil, fmt.Errorf("reading descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(&descriptorSet)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, err
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a message", messageName)
+	}
+
+	return DecoderFunc(func(data []byte) (interface{}, error) {
+		message := dynamicpb.NewMessage(messageDescriptor)
+		if err := proto.Unmarshal(data, message); err != nil {
+			return nil, err
+		}
+
+		// Going through protojson gives the message's canonical JSON form
+		jsonBytes, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		return JSON(jsonBytes)
+	}), nil
+}
+
+// decodeRawProtobuf decodes a message without its schema. Length-delimited fields are decoded as
+// text where possible, then as nested messages, then left as bytes. Fields that repeat become
+// lists.
+func decodeRawProtobuf(data []byte) (interface{}, error) {
+	fields := map[string]interface{}{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value, data = v, data[n:]
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value, data = v, data[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value, data = v, data[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+
+			if IsPrintableText(v) {
+				value = string(v)
+			} else if nested, err := decodeRawProtobuf(v); err == nil {
+				value = nested
+			} else {
+				value = v
+			}
+		default:
+			return nil, fmt.Errorf("field %d has unsupported wire type %d", num, typ)
+		}
+
+		key := fmt.Sprint(num)
+		switch existing := fields[key].(type) {
+		case nil:
+			fields[key] = value
+		case []interface{}:
+			fields[key] = append(existing, value)
+		default:
+			fields[key] = []interface{}{existing, value}
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,254 @@
+// Package docker is a minimal client for the parts of the Docker Engine API kin needs to run a
+// local Kinesis emulator, to avoid depending on the full Docker SDK.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned when a container or image doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// ContainerConfig describes a container to create.
+type ContainerConfig struct {
+	Image  string
+	Env    []string
+	Labels map[string]string
+	// Ports maps container ports, such as "4566/tcp", to the host ports they're published on
+	// (on 127.0.0.1)
+	Ports map[string]string
+}
+
+// Container is the state of an existing container.
+type Container struct {
+	Id      string
+	Name    string
+	Image   string
+	Labels  map[string]string
+	Status  string
+	Running bool
+	// Ports maps container ports to the host ports they're published on
+	Ports map[string]string
+}
+
+// NewClient returns a client for the daemon at DOCKER_HOST, or the default local socket.
+func NewClient() (*Client, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &Client{http: http.DefaultClient, base: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST scheme %q", u.Scheme)
+	}
+}
+
+// Ping checks that the daemon is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+}
+
+// HasImage returns whether the image has already been pulled.
+func (c *Client) HasImage(ctx context.Context, image string) (bool, error) {
+	err := c.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PullImage pulls an image, returning once the pull has finished.
+func (c *Client) PullImage(ctx context.Context, image string) error {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	query := url.Values{"fromImage": {name}, "tag": {tag}}
+
+	res, err := c.request(ctx, http.MethodPost, "/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Progress is streamed as a series of JSON messages, and failures part way through are
+	// reported in them rather than in the status code
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message.Error != "" {
+			return fmt.Errorf("pulling %s: %s", image, message.Error)
+		}
+	}
+}
+
+// CreateContainer creates a container with the given name, returning its ID.
+func (c *Client) CreateContainer(ctx context.Context, name string, config ContainerConfig) (string, error) {
+	type portBinding struct {
+		HostIp   string `json:"HostIp"`
+		HostPort string `json:"HostPort"`
+	}
+	exposed := map[string]struct{}{}
+	bindings := map[string][]portBinding{}
+	for containerPort, hostPort := range config.Ports {
+		exposed[containerPort] = struct{}{}
+		bindings[containerPort] = []portBinding{{HostIp: "127.0.0.1", HostPort: hostPort}}
+	}
+
+	body := map[string]interface{}{
+		"Image":        config.Image,
+		"Env":          config.Env,
+		"Labels":       config.Labels,
+		"ExposedPorts": exposed,
+		"HostConfig":   map[string]interface{}{"PortBindings": bindings},
+	}
+	var response struct {
+		Id string `json:"Id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/containers/create?"+url.Values{"name": {name}}.Encode(), body, &response)
+	return response.Id, err
+}
+
+// StartContainer starts a created or stopped container.
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil)
+}
+
+// InspectContainer returns the state of a container, by ID or name.
+func (c *Client) InspectContainer(ctx context.Context, id string) (*Container, error) {
+	var response struct {
+		Id     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+		State struct {
+			Status  string `json:"Status"`
+			Running bool   `json:"Running"`
+		} `json:"State"`
+		NetworkSettings struct {
+			Ports map[string][]struct {
+				HostPort string `json:"HostPort"`
+			} `json:"Ports"`
+		} `json:"NetworkSettings"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, &response); err != nil {
+		return nil, err
+	}
+
+	container := &Container{
+		Id:      response.Id,
+		Name:    strings.TrimPrefix(response.Name, "/"),
+		Image:   response.Config.Image,
+		Labels:  response.Config.Labels,
+		Status:  response.State.Status,
+		Running: response.State.Running,
+		Ports:   map[string]string{},
+	}
+	for containerPort, bindings := range response.NetworkSettings.Ports {
+		if len(bindings) > 0 {
+			container.Ports[containerPort] = bindings[0].HostPort
+		}
+	}
+	return container, nil
+}
+
+// RemoveContainer stops and removes a container.
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/containers/"+id+"?force=true", nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, request, response interface{}) error {
+	res, err := c.request(ctx, method, path, request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if response == nil {
+		_, err := io.Copy(io.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+func (c *Client) request(ctx context.Context, method, path string, request interface{}) (*http.Response, error) {
+	var body io.Reader
+	if request != nil {
+		contents, err := json.Marshal(request)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(contents)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach the Docker daemon: %w", err)
+	}
+	if res.StatusCode < 300 || res.StatusCode == http.StatusNotModified {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	contents, _ := io.ReadAll(res.Body)
+	message := strings.TrimSpace(string(contents))
+	if json.Unmarshal(contents, &apiErr) == nil && apiErr.Message != "" {
+		message = apiErr.Message
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, message)
+	}
+	return nil, fmt.Errorf("docker: %s", message)
+}
@@ -0,0 +1,620 @@
+// Package kinesismock is an in-memory stand-in for the subset of the Kinesis API kin uses:
+// creating, describing and listing streams, listing shards, putting and reading records, and
+// resharding. It speaks Kinesis's JSON protocol over HTTP, so real SDK clients work against it
+// unchanged, which makes it suitable for tests and offline demos without AWS or Docker.
+//
+// It doesn't enforce throughput limits, expire records or iterators, or support enhanced fan-out.
+package kinesismock
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Region and AccountID appear in the ARNs of mocked streams.
+const (
+	Region    = "us-east-1"
+	AccountID = "000000000000"
+)
+
+// maxHashKey is the largest hash key, 2^128 - 1
+var maxHashKey = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+// Error is a Kinesis API error, returned to clients as the exception named by Code.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func errorf(code, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func streamNotFound(name string) error {
+	return errorf("ResourceNotFoundException", "Stream %s under account %s not found.", name, AccountID)
+}
+
+// Mock holds the state of every mocked stream. It's safe for concurrent use.
+type Mock struct {
+	mu      sync.Mutex
+	streams map[string]*Stream
+
+	autoCreate int
+	now        func() time.Time
+}
+
+// Option configures a Mock.
+type Option func(*Mock)
+
+// WithAutoCreate makes streams that don't exist spring into being with the given number of
+// shards when they're first named, so that any command can be pointed at the mock without
+// creating its stream first.
+func WithAutoCreate(shards int) Option {
+	return func(m *Mock) {
+		m.autoCreate = shards
+	}
+}
+
+// WithClock replaces the clock records' arrival timestamps are taken from.
+func WithClock(now func() time.Time) Option {
+	return func(m *Mock) {
+		m.now = now
+	}
+}
+
+// New returns a Mock without any streams.
+func New(opts ...Option) *Mock {
+	m := &Mock{streams: map[string]*Stream{}, now: time.Now}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Load returns a Mock with the streams saved to path by Save, or none if path doesn't exist.
+func Load(path string, opts ...Option) (*Mock, error) {
+	m := New(opts...)
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []*Stream
+	if err := json.Unmarshal(contents, &streams); err != nil {
+		return nil, fmt.Errorf("reading mock streams from %s: %w", path, err)
+	}
+	for _, stream := range streams {
+		m.streams[stream.Name] = stream
+	}
+	return m, nil
+}
+
+// Save writes every stream and its records to path, for Load to restore.
+func (m *Mock) Save(path string) error {
+	m.mu.Lock()
+	streams := make([]*Stream, 0, len(m.streams))
+	for _, name := range m.streamNames() {
+		streams = append(streams, m.streams[name])
+	}
+	contents, err := json.Marshal(streams)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0o644)
+}
+
+// Stream is a mocked stream.
+type Stream struct {
+	Name           string
+	Status         string
+	Mode           string
+	RetentionHours int32
+	Created        time.Time
+	Shards         []*Shard
+	LastSequence   int64
+}
+
+// ARN returns the stream's ARN.
+func (s *Stream) ARN() string {
+	return fmt.Sprintf("arn:aws:kinesis:%s:%s:stream/%s", Region, AccountID, s.Name)
+}
+
+// Shard is a shard of a mocked stream. A closed shard has an EndingSequence.
+type Shard struct {
+	Id               string
+	Parent           string `json:",omitempty"`
+	AdjacentParent   string `json:",omitempty"`
+	StartingHashKey  string
+	EndingHashKey    string
+	StartingSequence string
+	EndingSequence   string `json:",omitempty"`
+	Records          []Record
+}
+
+func (s *Shard) open() bool {
+	return s.EndingSequence == ""
+}
+
+func (s *Shard) hashRange() (*big.Int, *big.Int) {
+	start, _ := new(big.Int).SetString(s.StartingHashKey, 10)
+	end, _ := new(big.Int).SetString(s.EndingHashKey, 10)
+	return start, end
+}
+
+// Record is a record stored in a mocked shard.
+type Record struct {
+	SequenceNumber string
+	PartitionKey   string
+	Data           []byte
+	Arrival        time.Time
+}
+
+// CreateStream creates a stream with shards evenly dividing the hash key space between them.
+func (m *Mock) CreateStream(name string, shards int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createStream(name, shards, "PROVISIONED")
+}
+
+func (m *Mock) createStream(name string, shards int, mode string) error {
+	if name == "" {
+		return errorf("ValidationException", "1 validation error detected: Value null at 'streamName' failed to satisfy constraint: Member must not be null")
+	}
+	if shards < 1 {
+		return errorf("InvalidArgumentException", "ShardCount must be at least 1.")
+	}
+	if _, ok := m.streams[name]; ok {
+		return errorf("ResourceInUseException", "Stream %s under account %s already exists.", name, AccountID)
+	}
+
+	stream := &Stream{
+		Name:           name,
+		Status:         "ACTIVE",
+		Mode:           mode,
+		RetentionHours: 24,
+		Created:        m.now().UTC(),
+	}
+	stream.addShards(shards, nil)
+	m.streams[name] = stream
+	return nil
+}
+
+// addShards opens count shards evenly dividing the hash key space, each a child of whichever
+// closed shards covered its range.
+func (s *Stream) addShards(count int, parents []*Shard) {
+	width := new(big.Int).Div(new(big.Int).Add(maxHashKey, big.NewInt(1)), big.NewInt(int64(count)))
+	for i := 0; i < count; i++ {
+		start := new(big.Int).Mul(width, big.NewInt(int64(i)))
+		end := new(big.Int).Sub(new(big.Int).Add(start, width), big.NewInt(1))
+		if i == count-1 {
+			end = maxHashKey
+		}
+
+		shard := s.addShard(start, end)
+		for _, parent := range parents {
+			parentStart, parentEnd := parent.hashRange()
+			if parentStart.Cmp(end) > 0 || parentEnd.Cmp(start) < 0 {
+				continue
+			}
+			if shard.Parent == "" {
+				shard.Parent = parent.Id
+			} else if shard.AdjacentParent == "" {
+				shard.AdjacentParent = parent.Id
+			}
+		}
+	}
+}
+
+// addShard opens a shard covering the hash keys from start to end. Shards are never removed, so
+// they're numbered in the order they were opened.
+func (s *Stream) addShard(start, end *big.Int) *Shard {
+	shard := &Shard{
+		Id:               fmt.Sprintf("shardId-%012d", len(s.Shards)),
+		StartingHashKey:  start.String(),
+		EndingHashKey:    end.String(),
+		StartingSequence: s.nextSequence(),
+	}
+	s.Shards = append(s.Shards, shard)
+	return shard
+}
+
+// nextSequence returns a sequence number greater than every one before it. They're padded to the
+// same length, so they sort the same as strings as they do as numbers.
+func (s *Stream) nextSequence() string {
+	s.LastSequence++
+	return fmt.Sprintf("49%054d", s.LastSequence)
+}
+
+// DeleteStream deletes a stream, named by name or ARN, and its records.
+func (m *Mock) DeleteStream(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(name)
+	if err != nil {
+		return err
+	}
+	delete(m.streams, stream.Name)
+	return nil
+}
+
+// Streams returns the names of every stream, in order.
+func (m *Mock) Streams() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.streamNames()
+}
+
+func (m *Mock) streamNames() []string {
+	names := make([]string, 0, len(m.streams))
+	for name := range m.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stream returns a stream by name or ARN, creating it if the Mock auto-creates streams.
+func (m *Mock) stream(nameOrARN string) (*Stream, error) {
+	name := nameOrARN
+	if _, after, found := strings.Cut(nameOrARN, ":stream/"); found {
+		name = after
+	}
+
+	if stream, ok := m.streams[name]; ok {
+		return stream, nil
+	}
+	if m.autoCreate > 0 && name != "" {
+		if err := m.createStream(name, m.autoCreate, "PROVISIONED"); err != nil {
+			return nil, err
+		}
+		return m.streams[name], nil
+	}
+	return nil, streamNotFound(name)
+}
+
+func (s *Stream) shard(id string) (*Shard, error) {
+	for _, shard := range s.Shards {
+		if shard.Id == id {
+			return shard, nil
+		}
+	}
+	return nil, errorf("ResourceNotFoundException", "Shard %s in stream %s under account %s does not exist", id, s.Name, AccountID)
+}
+
+func (s *Stream) openShards() []*Shard {
+	var shards []*Shard
+	for _, shard := range s.Shards {
+		if shard.open() {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// Put appends a record to the open shard whose range contains its hash key: explicitHashKey if
+// it's given, otherwise the MD5 digest of its partition key.
+func (m *Mock) Put(streamName, partitionKey, explicitHashKey string, data []byte) (shardId, sequenceNumber string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return "", "", err
+	}
+	return m.put(stream, partitionKey, explicitHashKey, data)
+}
+
+func (m *Mock) put(stream *Stream, partitionKey, explicitHashKey string, data []byte) (string, string, error) {
+	if partitionKey == "" || len(partitionKey) > 256 {
+		return "", "", errorf("ValidationException", "1 validation error detected: Value at 'partitionKey' failed to satisfy constraint: Member must have length between 1 and 256")
+	}
+	if len(data) > 1024*1024 {
+		return "", "", errorf("ValidationException", "1 validation error detected: Value at 'data' failed to satisfy constraint: Member must have length less than or equal to 1048576")
+	}
+
+	var hashKey *big.Int
+	if explicitHashKey != "" {
+		var ok bool
+		hashKey, ok = new(big.Int).SetString(explicitHashKey, 10)
+		if !ok || hashKey.Sign() < 0 || hashKey.Cmp(maxHashKey) > 0 {
+			return "", "", errorf("InvalidArgumentException", "Invalid ExplicitHashKey. ExplicitHashKey must be in the range: [0, 2^128-1]. Specified value was %s", explicitHashKey)
+		}
+	} else {
+		digest := md5.Sum([]byte(partitionKey))
+		hashKey = new(big.Int).SetBytes(digest[:])
+	}
+
+	for _, shard := range stream.openShards() {
+		start, end := shard.hashRange()
+		if hashKey.Cmp(start) < 0 || hashKey.Cmp(end) > 0 {
+			continue
+		}
+
+		record := Record{
+			SequenceNumber: stream.nextSequence(),
+			PartitionKey:   partitionKey,
+			Data:           data,
+			Arrival:        m.now().UTC(),
+		}
+		shard.Records = append(shard.Records, record)
+		return shard.Id, record.SequenceNumber, nil
+	}
+	return "", "", errorf("InternalFailure", "no open shard covers hash key %s", hashKey)
+}
+
+// closeShards closes shards, so that records are no longer put to them.
+func (s *Stream) closeShards(shards ...*Shard) {
+	for _, shard := range shards {
+		shard.EndingSequence = s.nextSequence()
+	}
+}
+
+// SplitShard closes a shard, opening two children that divide its range at newStartingHashKey.
+func (m *Mock) SplitShard(streamName, shardId, newStartingHashKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return err
+	}
+	shard, err := stream.shard(shardId)
+	if err != nil {
+		return err
+	}
+	if !shard.open() {
+		return errorf("ResourceInUseException", "Shard %s in stream %s under account %s has already been merged or split, and thus is not eligible for merging or splitting.", shardId, stream.Name, AccountID)
+	}
+
+	start, end := shard.hashRange()
+	split, ok := new(big.Int).SetString(newStartingHashKey, 10)
+	if !ok || split.Cmp(start) <= 0 || split.Cmp(end) > 0 {
+		return errorf("InvalidArgumentException", "NewStartingHashKey %s used in SplitShard() on shard %s in stream %s under account %s is not both greater than one plus the shard's StartingHashKey %s and less than the shard's EndingHashKey %s.", newStartingHashKey, shardId, stream.Name, AccountID, start, end)
+	}
+
+	stream.closeShards(shard)
+	stream.addShard(start, new(big.Int).Sub(split, big.NewInt(1))).Parent = shard.Id
+	stream.addShard(split, end).Parent = shard.Id
+	return nil
+}
+
+// MergeShards closes two shards with adjacent ranges, opening one child covering both.
+func (m *Mock) MergeShards(streamName, shardId, adjacentShardId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return err
+	}
+	shard, err := stream.shard(shardId)
+	if err != nil {
+		return err
+	}
+	adjacent, err := stream.shard(adjacentShardId)
+	if err != nil {
+		return err
+	}
+	if !shard.open() || !adjacent.open() {
+		return errorf("ResourceInUseException", "Shards %s and %s in stream %s under account %s have already been merged or split, and thus are not eligible for merging or splitting.", shardId, adjacentShardId, stream.Name, AccountID)
+	}
+
+	start, end := shard.hashRange()
+	adjacentStart, adjacentEnd := adjacent.hashRange()
+	lower, upper := start, adjacentEnd
+	switch {
+	case new(big.Int).Add(end, big.NewInt(1)).Cmp(adjacentStart) == 0:
+	case new(big.Int).Add(adjacentEnd, big.NewInt(1)).Cmp(start) == 0:
+		lower, upper = adjacentStart, end
+	default:
+		return errorf("InvalidArgumentException", "Shards %s and %s in stream %s under account %s are not an adjacent pair of shards eligible for merging", shardId, adjacentShardId, stream.Name, AccountID)
+	}
+
+	stream.closeShards(shard, adjacent)
+	child := stream.addShard(lower, upper)
+	child.Parent = shard.Id
+	child.AdjacentParent = adjacent.Id
+	return nil
+}
+
+// UpdateShardCount closes every open shard and opens target shards evenly dividing the hash key
+// space. Kinesis gets there with splits and merges, but the resulting shards are the same.
+func (m *Mock) UpdateShardCount(streamName string, target int) (current int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return 0, err
+	}
+	if target < 1 {
+		return 0, errorf("InvalidArgumentException", "TargetShardCount must be at least 1.")
+	}
+
+	open := stream.openShards()
+	stream.closeShards(open...)
+	stream.addShards(target, open)
+	return len(open), nil
+}
+
+// Describe returns a copy of a stream, without its records.
+func (m *Mock) Describe(streamName string) (*Stream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	described := *stream
+	described.Shards = make([]*Shard, len(stream.Shards))
+	for i, shard := range stream.Shards {
+		withoutRecords := *shard
+		withoutRecords.Records = nil
+		described.Shards[i] = &withoutRecords
+	}
+	return &described, nil
+}
+
+// Iterator types, as named by GetShardIterator.
+const (
+	TrimHorizon         = "TRIM_HORIZON"
+	Latest              = "LATEST"
+	AtSequenceNumber    = "AT_SEQUENCE_NUMBER"
+	AfterSequenceNumber = "AFTER_SEQUENCE_NUMBER"
+	AtTimestamp         = "AT_TIMESTAMP"
+)
+
+// iterator is the position in a shard a shard iterator points to
+type iterator struct {
+	Stream string `json:"s"`
+	Shard  string `json:"h"`
+	Index  int    `json:"i"`
+}
+
+// ShardIterator returns an iterator pointing into a shard as GetShardIterator's iteratorType
+// describes, starting from sequenceNumber or timestamp when the type needs one.
+func (m *Mock) ShardIterator(streamName, shardId, iteratorType, sequenceNumber string, timestamp time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.stream(streamName)
+	if err != nil {
+		return "", err
+	}
+	shard, err := stream.shard(shardId)
+	if err != nil {
+		return "", err
+	}
+
+	var index int
+	switch iteratorType {
+	case TrimHorizon:
+		index = 0
+	case Latest:
+		index = len(shard.Records)
+	case AtSequenceNumber, AfterSequenceNumber:
+		if sequenceNumber == "" {
+			return "", errorf("InvalidArgumentException", "StartingSequenceNumber must be provided for ShardIteratorType %s", iteratorType)
+		}
+		index = sort.Search(len(shard.Records), func(i int) bool {
+			return compareSequenceNumbers(shard.Records[i].SequenceNumber, sequenceNumber) >= 0
+		})
+		if iteratorType == AfterSequenceNumber && index < len(shard.Records) && shard.Records[index].SequenceNumber == sequenceNumber {
+			index++
+		}
+	case AtTimestamp:
+		index = sort.Search(len(shard.Records), func(i int) bool {
+			return !shard.Records[i].Arrival.Before(timestamp)
+		})
+	default:
+		return "", errorf("InvalidArgumentException", "Invalid ShardIteratorType %q", iteratorType)
+	}
+
+	return encodeIterator(iterator{Stream: stream.Name, Shard: shard.Id, Index: index}), nil
+}
+
+// compareSequenceNumbers compares two sequence numbers numerically.
+func compareSequenceNumbers(a, b string) int {
+	x, _ := new(big.Int).SetString(a, 10)
+	y, _ := new(big.Int).SetString(b, 10)
+	if x == nil || y == nil {
+		return strings.Compare(a, b)
+	}
+	return x.Cmp(y)
+}
+
+func encodeIterator(it iterator) string {
+	encoded, _ := json.Marshal(it)
+	return base64.StdEncoding.EncodeToString(encoded)
+}
+
+func decodeIterator(s string) (iterator, error) {
+	var it iterator
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(decoded, &it)
+	}
+	if err != nil || it.Index < 0 {
+		return it, errorf("InvalidArgumentException", "Invalid ShardIterator.")
+	}
+	return it, nil
+}
+
+// Records is a page of records read with GetRecords.
+type Records struct {
+	Records            []Record
+	NextShardIterator  string
+	MillisBehindLatest int64
+	// ChildShards are given once a closed shard has been read to its end, when NextShardIterator
+	// is empty
+	ChildShards []*Shard
+}
+
+// GetRecords reads up to limit records from where an iterator points.
+func (m *Mock) GetRecords(shardIterator string, limit int) (*Records, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	it, err := decodeIterator(shardIterator)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := m.streams[it.Stream]
+	if !ok {
+		return nil, streamNotFound(it.Stream)
+	}
+	shard, err := stream.shard(it.Shard)
+	if err != nil {
+		return nil, err
+	}
+	if it.Index > len(shard.Records) {
+		return nil, errorf("InvalidArgumentException", "Invalid ShardIterator.")
+	}
+
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	end := min(it.Index+limit, len(shard.Records))
+	page := &Records{Records: append([]Record(nil), shard.Records[it.Index:end]...)}
+
+	if end < len(shard.Records) {
+		page.MillisBehindLatest = m.now().Sub(shard.Records[end].Arrival).Milliseconds()
+	}
+	if end < len(shard.Records) || shard.open() {
+		page.NextShardIterator = encodeIterator(iterator{Stream: it.Stream, Shard: it.Shard, Index: end})
+		return page, nil
+	}
+
+	for _, child := range stream.Shards {
+		if child.Parent == shard.Id || child.AdjacentParent == shard.Id {
+			withoutRecords := *child
+			withoutRecords.Records = nil
+			page.ChildShards = append(page.ChildShards, &withoutRecords)
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,423 @@
+package kinesismock
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+)
+
+// targetPrefix precedes the operation named by each request's X-Amz-Target header
+const targetPrefix = "Kinesis_20131202."
+
+// Server serves a Mock over HTTP on a loopback port.
+type Server struct {
+	*Mock
+
+	// URL is the endpoint to point Kinesis clients at
+	URL string
+
+	server *httptest.Server
+}
+
+// NewServer starts serving m.
+func NewServer(m *Mock) *Server {
+	server := httptest.NewServer(m)
+	return &Server{Mock: m, URL: server.URL, server: server}
+}
+
+// Client returns a Kinesis client for the server, with dummy credentials.
+func (s *Server) Client(optFns ...func(*kinesis.Options)) *kinesis.Client {
+	return kinesis.New(kinesis.Options{
+		BaseEndpoint: aws.String(s.URL),
+		Region:       Region,
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+	}, optFns...)
+}
+
+// Close stops the server. The Mock's streams are kept.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// ServeHTTP handles a Kinesis API request. Requests aren't authenticated.
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation, found := strings.CutPrefix(r.Header.Get("X-Amz-Target"), targetPrefix)
+	handler, ok := operations[operation]
+	if r.Method != http.MethodPost || !found || !ok {
+		writeError(w, errorf("UnknownOperationException", "%s isn't supported by kinesismock", r.Header.Get("X-Amz-Target")))
+		return
+	}
+
+	output, err := handler(m, json.NewDecoder(r.Body))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(output)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = &Error{Code: "SerializationException", Message: err.Error()}
+	}
+
+	status := http.StatusBadRequest
+	if apiErr.Code == "InternalFailure" {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", apiErr.Code)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": apiErr.Code, "message": apiErr.Message})
+}
+
+// operation decodes a request's parameters and returns its response
+type operation func(m *Mock, decoder *json.Decoder) (interface{}, error)
+
+// handle adapts a function of an operation's input to an operation.
+func handle[Input any](fn func(m *Mock, input *Input) (interface{}, error)) operation {
+	return func(m *Mock, decoder *json.Decoder) (interface{}, error) {
+		var input Input
+		if err := decoder.Decode(&input); err != nil {
+			return nil, err
+		}
+		return fn(m, &input)
+	}
+}
+
+var operations = map[string]operation{
+	"CreateStream":          handle(createStream),
+	"DeleteStream":          handle(deleteStream),
+	"DescribeStreamSummary": handle(describeStreamSummary),
+	"ListStreams":           handle(listStreams),
+	"ListShards":            handle(listShards),
+	"ListStreamConsumers":   handle(listStreamConsumers),
+	"GetShardIterator":      handle(getShardIterator),
+	"GetRecords":            handle(getRecords),
+	"PutRecord":             handle(putRecord),
+	"PutRecords":            handle(putRecords),
+	"SplitShard":            handle(splitShard),
+	"MergeShards":           handle(mergeShards),
+	"UpdateShardCount":      handle(updateShardCount),
+}
+
+// streamInput is embedded by the inputs of operations on a stream, which name it by name or ARN
+type streamInput struct {
+	StreamName string
+	StreamARN  string
+}
+
+func (s streamInput) stream() string {
+	if s.StreamARN != "" {
+		return s.StreamARN
+	}
+	return s.StreamName
+}
+
+// epochSeconds is how the JSON protocol encodes timestamps
+type epochSeconds float64
+
+func toEpochSeconds(t time.Time) epochSeconds {
+	return epochSeconds(float64(t.UnixMilli()) / 1000)
+}
+
+func (e epochSeconds) Time() time.Time {
+	return time.UnixMilli(int64(float64(e) * 1000))
+}
+
+func createStream(m *Mock, input *struct {
+	StreamName        string
+	ShardCount        *int
+	StreamModeDetails *struct{ StreamMode string }
+}) (interface{}, error) {
+	mode := "PROVISIONED"
+	if input.StreamModeDetails != nil && input.StreamModeDetails.StreamMode != "" {
+		mode = input.StreamModeDetails.StreamMode
+	}
+
+	shards := 4
+	switch {
+	case input.ShardCount != nil:
+		shards = *input.ShardCount
+	case mode == "PROVISIONED":
+		return nil, errorf("InvalidArgumentException", "ShardCount is required for PROVISIONED streams.")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return struct{}{}, m.createStream(input.StreamName, shards, mode)
+}
+
+func deleteStream(m *Mock, input *streamInput) (interface{}, error) {
+	return struct{}{}, m.DeleteStream(input.stream())
+}
+
+func describeStreamSummary(m *Mock, input *streamInput) (interface{}, error) {
+	stream, err := m.Describe(input.stream())
+	if err != nil {
+		return nil, err
+	}
+
+	type streamModeDetails struct{ StreamMode string }
+	return map[string]interface{}{
+		"StreamDescriptionSummary": map[string]interface{}{
+			"StreamName":              stream.Name,
+			"StreamARN":               stream.ARN(),
+			"StreamStatus":            stream.Status,
+			"StreamModeDetails":       streamModeDetails{stream.Mode},
+			"RetentionPeriodHours":    stream.RetentionHours,
+			"StreamCreationTimestamp": toEpochSeconds(stream.Created),
+			"EnhancedMonitoring":      []interface{}{map[string]interface{}{"ShardLevelMetrics": []string{}}},
+			"EncryptionType":          "NONE",
+			"OpenShardCount":          len(stream.openShards()),
+			"ConsumerCount":           0,
+		},
+	}, nil
+}
+
+func listStreams(m *Mock, input *struct {
+	ExclusiveStartStreamName string
+	Limit                    int
+}) (interface{}, error) {
+	type streamSummary struct {
+		StreamName              string
+		StreamARN               string
+		StreamStatus            string
+		StreamModeDetails       struct{ StreamMode string }
+		StreamCreationTimestamp epochSeconds
+	}
+
+	names := []string{}
+	summaries := []streamSummary{}
+	for _, name := range m.Streams() {
+		if name <= input.ExclusiveStartStreamName {
+			continue
+		}
+		stream, err := m.Describe(name)
+		if err != nil {
+			continue
+		}
+
+		summary := streamSummary{
+			StreamName:              stream.Name,
+			StreamARN:               stream.ARN(),
+			StreamStatus:            stream.Status,
+			StreamCreationTimestamp: toEpochSeconds(stream.Created),
+		}
+		summary.StreamModeDetails.StreamMode = stream.Mode
+		names = append(names, name)
+		summaries = append(summaries, summary)
+	}
+
+	more := input.Limit > 0 && len(names) > input.Limit
+	if more {
+		names, summaries = names[:input.Limit], summaries[:input.Limit]
+	}
+	return map[string]interface{}{
+		"StreamNames":     names,
+		"StreamSummaries": summaries,
+		"HasMoreStreams":  more,
+	}, nil
+}
+
+// listStreamConsumers finds no consumers, since enhanced fan-out isn't supported.
+func listStreamConsumers(m *Mock, input *struct{ StreamARN string }) (interface{}, error) {
+	if _, err := m.Describe(input.StreamARN); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"Consumers": []interface{}{}}, nil
+}
+
+// wireShard is a shard as ListShards and GetRecords describe it
+type wireShard struct {
+	ShardId               string
+	ParentShardId         *string `json:",omitempty"`
+	AdjacentParentShardId *string `json:",omitempty"`
+	HashKeyRange          struct{ StartingHashKey, EndingHashKey string }
+	SequenceNumberRange   struct {
+		StartingSequenceNumber string
+		EndingSequenceNumber   *string `json:",omitempty"`
+	}
+}
+
+func toWireShard(shard *Shard) wireShard {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+
+	wire := wireShard{
+		ShardId:               shard.Id,
+		ParentShardId:         optional(shard.Parent),
+		AdjacentParentShardId: optional(shard.AdjacentParent),
+	}
+	wire.HashKeyRange.StartingHashKey = shard.StartingHashKey
+	wire.HashKeyRange.EndingHashKey = shard.EndingHashKey
+	wire.SequenceNumberRange.StartingSequenceNumber = shard.StartingSequence
+	wire.SequenceNumberRange.EndingSequenceNumber = optional(shard.EndingSequence)
+	return wire
+}
+
+// listShards returns every shard in one page, so there's never a NextToken.
+func listShards(m *Mock, input *struct {
+	streamInput
+	ExclusiveStartShardId string
+}) (interface{}, error) {
+	stream, err := m.Describe(input.stream())
+	if err != nil {
+		return nil, err
+	}
+
+	shards := []wireShard{}
+	for _, shard := range stream.Shards {
+		if shard.Id > input.ExclusiveStartShardId {
+			shards = append(shards, toWireShard(shard))
+		}
+	}
+	return map[string]interface{}{"Shards": shards}, nil
+}
+
+func getShardIterator(m *Mock, input *struct {
+	streamInput
+	ShardId                string
+	ShardIteratorType      string
+	StartingSequenceNumber string
+	Timestamp              epochSeconds
+}) (interface{}, error) {
+	iterator, err := m.ShardIterator(input.stream(), input.ShardId, input.ShardIteratorType, input.StartingSequenceNumber, input.Timestamp.Time())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"ShardIterator": iterator}, nil
+}
+
+func getRecords(m *Mock, input *struct {
+	ShardIterator string
+	Limit         int
+}) (interface{}, error) {
+	page, err := m.GetRecords(input.ShardIterator, input.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type wireRecord struct {
+		SequenceNumber              string
+		PartitionKey                string
+		Data                        []byte
+		ApproximateArrivalTimestamp epochSeconds
+	}
+	records := make([]wireRecord, len(page.Records))
+	for i, record := range page.Records {
+		records[i] = wireRecord{record.SequenceNumber, record.PartitionKey, record.Data, toEpochSeconds(record.Arrival)}
+	}
+
+	output := map[string]interface{}{
+		"Records":            records,
+		"MillisBehindLatest": page.MillisBehindLatest,
+	}
+	if page.NextShardIterator != "" {
+		output["NextShardIterator"] = page.NextShardIterator
+	}
+	if len(page.ChildShards) > 0 {
+		type childShard struct {
+			ShardId      string
+			ParentShards []string
+			HashKeyRange struct{ StartingHashKey, EndingHashKey string }
+		}
+		children := make([]childShard, len(page.ChildShards))
+		for i, child := range page.ChildShards {
+			children[i] = childShard{ShardId: child.Id, ParentShards: []string{child.Parent}, HashKeyRange: toWireShard(child).HashKeyRange}
+			if child.AdjacentParent != "" {
+				children[i].ParentShards = append(children[i].ParentShards, child.AdjacentParent)
+			}
+		}
+		output["ChildShards"] = children
+	}
+	return output, nil
+}
+
+// putRecordInput is a record to put, alone or as an entry of PutRecords
+type putRecordInput struct {
+	PartitionKey    string
+	ExplicitHashKey string
+	Data            []byte
+}
+
+func putRecord(m *Mock, input *struct {
+	streamInput
+	putRecordInput
+}) (interface{}, error) {
+	shardId, sequenceNumber, err := m.Put(input.stream(), input.PartitionKey, input.ExplicitHashKey, input.Data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"ShardId": shardId, "SequenceNumber": sequenceNumber, "EncryptionType": "NONE"}, nil
+}
+
+// putRecords puts each entry in turn. Nothing throttles them, so no entry ever fails on its own.
+func putRecords(m *Mock, input *struct {
+	streamInput
+	Records []putRecordInput
+}) (interface{}, error) {
+	if len(input.Records) == 0 || len(input.Records) > 500 {
+		return nil, errorf("ValidationException", "1 validation error detected: Value at 'records' failed to satisfy constraint: Member must have length less than or equal to 500 and greater than or equal to 1")
+	}
+
+	type resultEntry struct{ ShardId, SequenceNumber string }
+	results := make([]resultEntry, len(input.Records))
+	for i, record := range input.Records {
+		shardId, sequenceNumber, err := m.Put(input.stream(), record.PartitionKey, record.ExplicitHashKey, record.Data)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = resultEntry{shardId, sequenceNumber}
+	}
+	return map[string]interface{}{"FailedRecordCount": 0, "Records": results, "EncryptionType": "NONE"}, nil
+}
+
+func splitShard(m *Mock, input *struct {
+	streamInput
+	ShardToSplit       string
+	NewStartingHashKey string
+}) (interface{}, error) {
+	return struct{}{}, m.SplitShard(input.stream(), input.ShardToSplit, input.NewStartingHashKey)
+}
+
+func mergeShards(m *Mock, input *struct {
+	streamInput
+	ShardToMerge         string
+	AdjacentShardToMerge string
+}) (interface{}, error) {
+	return struct{}{}, m.MergeShards(input.stream(), input.ShardToMerge, input.AdjacentShardToMerge)
+}
+
+func updateShardCount(m *Mock, input *struct {
+	streamInput
+	TargetShardCount int
+}) (interface{}, error) {
+	current, err := m.UpdateShardCount(input.stream(), input.TargetShardCount)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := m.Describe(input.stream())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"StreamName":        stream.Name,
+		"CurrentShardCount": current,
+		"TargetShardCount":  input.TargetShardCount,
+	}, nil
+}
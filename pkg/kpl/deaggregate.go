@@ -0,0 +1,117 @@
+package kpl
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// UserRecord is a record packed into an aggregated record.
+type UserRecord struct {
+	PartitionKey string
+	Data         []byte
+}
+
+// IsAggregated reports whether data is a KPL aggregated record, by its magic prefix and digest.
+func IsAggregated(data []byte) bool {
+	if len(data) < len(Magic)+md5.Size || !bytes.HasPrefix(data, Magic) {
+		return false
+	}
+
+	message := data[len(Magic) : len(data)-md5.Size]
+	digest := md5.Sum(message)
+	return bytes.Equal(digest[:], data[len(data)-md5.Size:])
+}
+
+// Deaggregate unpacks the user records from an aggregated record.
+func Deaggregate(data []byte) ([]UserRecord, error) {
+	if !IsAggregated(data) {
+		return nil, fmt.Errorf("not a KPL aggregated record")
+	}
+
+	var partitionKeys []string
+	var records [][]byte
+	err := forEachField(data[len(Magic):len(data)-md5.Size], func(num protowire.Number, value []byte) error {
+		switch num {
+		case fieldPartitionKeyTable:
+			partitionKeys = append(partitionKeys, string(value))
+		case fieldRecords:
+			records = append(records, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	userRecords := make([]UserRecord, 0, len(records))
+	for _, record := range records {
+		var userRecord UserRecord
+		keyIndex := -1
+		err := forEachField(record, func(num protowire.Number, value []byte) error {
+			switch num {
+			case fieldRecordPartitionKeyIndex:
+				index, n := protowire.ConsumeVarint(value)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				keyIndex = int(index)
+			case fieldRecordData:
+				userRecord.Data = value
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if keyIndex < 0 || keyIndex >= len(partitionKeys) {
+			return nil, fmt.Errorf("user record has partition key index %d of %d", keyIndex, len(partitionKeys))
+		}
+		userRecord.PartitionKey = partitionKeys[keyIndex]
+		userRecords = append(userRecords, userRecord)
+	}
+	return userRecords, nil
+}
+
+// forEachField calls fn with the number and value of each varint or length-delimited field in a
+// protobuf message; varints are passed still encoded. Other fields are skipped.
+func forEachField(message []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, message = v, message[n:]
+		case protowire.VarintType:
+			_, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, message = message[:n], message[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+			continue
+		}
+
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
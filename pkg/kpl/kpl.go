@@ -0,0 +1,164 @@
+// Package kpl implements the record aggregation format used by the Kinesis Producer Library,
+// which packs many user records into a single Kinesis record.
+//
+// An aggregated record is the 4 magic bytes, followed by a protobuf-encoded AggregatedRecord
+// message, followed by the MD5 digest of that message:
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table = 1;
+//	  repeated string explicit_hash_key_table = 2;
+//	  repeated Record records = 3;
+//	}
+//
+//	message Record {
+//	  required uint64 partition_key_index = 1;
+//	  optional uint64 explicit_hash_key_index = 2;
+//	  required bytes data = 3;
+//	  repeated Tag tags = 4;
+//	}
+package kpl
+
+import (
+	"crypto/md5"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Magic is the prefix identifying a KPL aggregated record
+var Magic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// MaxRecordSize is the largest Kinesis record, including its partition key
+const MaxRecordSize = 1024 * 1024
+
+const (
+	fieldPartitionKeyTable = 1
+	fieldRecords           = 3
+
+	fieldRecordPartitionKeyIndex = 1
+	fieldRecordData              = 3
+)
+
+// Record is an aggregated record ready to be put onto a stream.
+type Record struct {
+	// PartitionKey is the key of the first user record; Kinesis routes the whole aggregate by it
+	PartitionKey string
+	Data         []byte
+
+	// Count is the number of user records in the aggregate
+	Count int
+}
+
+// Aggregator packs user records into aggregated records no larger than MaxRecordSize.
+type Aggregator struct {
+	partitionKeys []string
+	keyIndexes    map[string]uint64
+	records       [][]byte
+
+	// Size of the protobuf message built so far
+	size int
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{keyIndexes: map[string]uint64{}}
+}
+
+// Add appends a user record. If it doesn't fit in the current aggregate, the current aggregate is
+// returned and the user record starts a new one. It's an error for a single user record to be too
+// large to aggregate at all.
+func (a *Aggregator) Add(partitionKey string, data []byte) (*Record, error) {
+	if a.sizeWith(partitionKey, data) <= MaxRecordSize {
+		a.add(partitionKey, data)
+		return nil, nil
+	}
+
+	flushed := a.Flush()
+	if a.sizeWith(partitionKey, data) > MaxRecordSize {
+		return flushed, fmt.Errorf("record of %d bytes is too large to aggregate", len(data))
+	}
+
+	a.add(partitionKey, data)
+	return flushed, nil
+}
+
+// Flush returns the current aggregate, if any, and resets the aggregator.
+func (a *Aggregator) Flush() *Record {
+	if len(a.records) == 0 {
+		return nil
+	}
+
+	message := make([]byte, 0, a.size)
+	for _, key := range a.partitionKeys {
+		message = protowire.AppendTag(message, fieldPartitionKeyTable, protowire.BytesType)
+		message = protowire.AppendString(message, key)
+	}
+	for _, record := range a.records {
+		message = protowire.AppendTag(message, fieldRecords, protowire.BytesType)
+		message = protowire.AppendBytes(message, record)
+	}
+
+	digest := md5.Sum(message)
+
+	data := make([]byte, 0, len(Magic)+len(message)+len(digest))
+	data = append(data, Magic...)
+	data = append(data, message...)
+	data = append(data, digest[:]...)
+
+	aggregated := &Record{
+		PartitionKey: a.partitionKeys[0],
+		Data:         data,
+		Count:        len(a.records),
+	}
+
+	a.partitionKeys = nil
+	a.keyIndexes = map[string]uint64{}
+	a.records = nil
+	a.size = 0
+
+	return aggregated
+}
+
+func (a *Aggregator) add(partitionKey string, data []byte) {
+	keyIndex, ok := a.keyIndexes[partitionKey]
+	if !ok {
+		keyIndex = uint64(len(a.partitionKeys))
+		a.keyIndexes[partitionKey] = keyIndex
+		a.partitionKeys = append(a.partitionKeys, partitionKey)
+		a.size += keyTableEntrySize(partitionKey)
+	}
+
+	record := protowire.AppendTag(nil, fieldRecordPartitionKeyIndex, protowire.VarintType)
+	record = protowire.AppendVarint(record, keyIndex)
+	record = protowire.AppendTag(record, fieldRecordData, protowire.BytesType)
+	record = protowire.AppendBytes(record, data)
+
+	a.records = append(a.records, record)
+	a.size += protowire.SizeTag(fieldRecords) + protowire.SizeBytes(len(record))
+}
+
+// sizeWith returns the size of the final Kinesis record (including the aggregate's partition key)
+// if the given user record were added.
+func (a *Aggregator) sizeWith(partitionKey string, data []byte) int {
+	size := a.size
+
+	keyIndex, ok := a.keyIndexes[partitionKey]
+	if !ok {
+		keyIndex = uint64(len(a.partitionKeys))
+		size += keyTableEntrySize(partitionKey)
+	}
+
+	recordSize := protowire.SizeTag(fieldRecordPartitionKeyIndex) + protowire.SizeVarint(keyIndex) +
+		protowire.SizeTag(fieldRecordData) + protowire.SizeBytes(len(data))
+	size += protowire.SizeTag(fieldRecords) + protowire.SizeBytes(recordSize)
+
+	aggregateKey := partitionKey
+	if len(a.partitionKeys) > 0 {
+		aggregateKey = a.partitionKeys[0]
+	}
+
+	return len(Magic) + size + md5.Size + len(aggregateKey)
+}
+
+func keyTableEntrySize(partitionKey string) int {
+	return protowire.SizeTag(fieldPartitionKeyTable) + protowire.SizeBytes(len(partitionKey))
+}
@@ -0,0 +1,129 @@
+package kpl
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestAggregateRoundTrip(t *testing.T) {
+	records := []UserRecord{
+		{PartitionKey: "a", Data: []byte(`{"n":0}`)},
+		{PartitionKey: "b", Data: []byte(`{"n":1}`)},
+		{PartitionKey: "a", Data: []byte(`{"n":2}`)},
+		{PartitionKey: "c", Data: []byte{}},
+	}
+
+	aggregator := NewAggregator()
+	for _, record := range records {
+		flushed, err := aggregator.Add(record.PartitionKey, record.Data)
+		if err != nil || flushed != nil {
+			t.Fatalf("Add(%q) = %v, %v; want nothing flushed", record.PartitionKey, flushed, err)
+		}
+	}
+	aggregated := aggregator.Flush()
+	if aggregated.PartitionKey != "a" || aggregated.Count != len(records) {
+		t.Errorf("aggregate has key %q and %d records; want a and %d", aggregated.PartitionKey, aggregated.Count, len(records))
+	}
+	if !IsAggregated(aggregated.Data) {
+		t.Fatal("IsAggregated = false for an aggregate")
+	}
+
+	deaggregated, err := Deaggregate(aggregated.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, deaggregated, records)
+
+	if flushed := aggregator.Flush(); flushed != nil {
+		t.Errorf("Flush after Flush = %v; want nil", flushed)
+	}
+}
+
+func TestAggregateSplitsAtMaxRecordSize(t *testing.T) {
+	var records []UserRecord
+	for i := range 10 {
+		records = append(records, UserRecord{
+			PartitionKey: fmt.Sprintf("key-%d", i%3),
+			Data:         bytes.Repeat([]byte{byte(i)}, 300*1024),
+		})
+	}
+
+	var aggregates []*Record
+	aggregator := NewAggregator()
+	for _, record := range records {
+		flushed, err := aggregator.Add(record.PartitionKey, record.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flushed != nil {
+			aggregates = append(aggregates, flushed)
+		}
+	}
+	aggregates = append(aggregates, aggregator.Flush())
+
+	var deaggregated []UserRecord
+	for _, aggregated := range aggregates {
+		if size := len(aggregated.Data) + len(aggregated.PartitionKey); size > MaxRecordSize {
+			t.Errorf("aggregate of %d bytes is larger than MaxRecordSize", size)
+		}
+		userRecords, err := Deaggregate(aggregated.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(userRecords) != aggregated.Count {
+			t.Errorf("aggregate holds %d records; its Count is %d", len(userRecords), aggregated.Count)
+		}
+		deaggregated = append(deaggregated, userRecords...)
+	}
+	if len(aggregates) != 4 {
+		t.Errorf("got %d aggregates; want 4 of at most 3 records", len(aggregates))
+	}
+	assertRecords(t, deaggregated, records)
+}
+
+func TestAggregateRecordTooLarge(t *testing.T) {
+	aggregator := NewAggregator()
+	if _, err := aggregator.Add("a", []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+
+	flushed, err := aggregator.Add("a", make([]byte, MaxRecordSize))
+	if err == nil {
+		t.Fatal("Add of a record larger than MaxRecordSize succeeded")
+	}
+	if flushed == nil || flushed.Count != 1 {
+		t.Errorf("Add flushed %v; want the aggregate of the record before it", flushed)
+	}
+	if aggregator.Flush() != nil {
+		t.Error("the record that was too large was aggregated")
+	}
+}
+
+func TestDeaggregateRejectsCorruptData(t *testing.T) {
+	aggregator := NewAggregator()
+	aggregator.Add("a", []byte("data"))
+	data := aggregator.Flush().Data
+
+	for name, corrupt := range map[string][]byte{
+		"not aggregated": []byte(`{"n":0}`),
+		"truncated":      data[:len(data)-1],
+		"wrong digest":   append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^1),
+	} {
+		if _, err := Deaggregate(corrupt); err == nil {
+			t.Errorf("Deaggregate of %s data succeeded", name)
+		}
+	}
+}
+
+func assertRecords(t *testing.T, got, want []UserRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].PartitionKey != want[i].PartitionKey || !bytes.Equal(got[i].Data, want[i].Data) {
+			t.Errorf("record %d has key %q and %d bytes; want %q and %d bytes", i, got[i].PartitionKey, len(got[i].Data), want[i].PartitionKey, len(want[i].Data))
+		}
+	}
+}
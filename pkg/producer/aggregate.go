@@ -0,0 +1,73 @@
+package producer
+
+import (
+	"kin/pkg/kpl"
+)
+
+// maxOpenAggregates is how many partition keys an Aggregator keeps aggregates open for. With more
+// keys than that, the aggregate opened first is sent to make room, so that memory doesn't grow
+// with the number of keys.
+const maxOpenAggregates = 1000
+
+// Aggregator groups user records into KPL aggregates. When records have meaningful partition
+// keys, each key is aggregated separately so that records for a key keep going to the same shard,
+// in order; with random keys there's nothing to preserve and every record shares one aggregate.
+type Aggregator struct {
+	groupByKey  bool
+	aggregators map[string]*kpl.Aggregator
+	// opened lists the groups in aggregators in the order they were opened
+	opened []string
+}
+
+// NewAggregator returns an Aggregator, which keeps each partition key's records in aggregates of
+// their own if groupByKey is set.
+func NewAggregator(groupByKey bool) *Aggregator {
+	return &Aggregator{
+		groupByKey:  groupByKey,
+		aggregators: map[string]*kpl.Aggregator{},
+	}
+}
+
+// Add aggregates a user record, returning an aggregate which is ready to be put if one filled up
+// or was closed to make room for the record's key.
+func (a *Aggregator) Add(partitionKey string, data []byte) (*kpl.Record, error) {
+	group := ""
+	if a.groupByKey {
+		group = partitionKey
+	}
+
+	aggregator, ok := a.aggregators[group]
+	if ok {
+		return aggregator.Add(partitionKey, data)
+	}
+
+	var closed *kpl.Record
+	if len(a.opened) >= maxOpenAggregates {
+		oldest := a.opened[0]
+		a.opened = a.opened[1:]
+		closed = a.aggregators[oldest].Flush()
+		delete(a.aggregators, oldest)
+	}
+
+	aggregator = kpl.NewAggregator()
+	a.aggregators[group] = aggregator
+	a.opened = append(a.opened, group)
+
+	// A new aggregate never fills up with its first record, so there's only ever the closed one
+	// to return
+	_, err := aggregator.Add(partitionKey, data)
+	return closed, err
+}
+
+// Flush returns every partially filled aggregate.
+func (a *Aggregator) Flush() []*kpl.Record {
+	var records []*kpl.Record
+	for _, group := range a.opened {
+		if record := a.aggregators[group].Flush(); record != nil {
+			records = append(records, record)
+		}
+		delete(a.aggregators, group)
+	}
+	a.opened = nil
+	return records
+}
@@ -0,0 +1,375 @@
+// Package producer writes records to a Kinesis stream the way kin's put commands do: batching
+// them into PutRecords requests, retrying the entries that fail with backoff, optionally packing
+// them into KPL aggregated records and pacing them to a rate. It can be embedded in other programs
+// that want kin's write behavior without shelling out to it.
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/kpl"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+const (
+	// MaxBatchRecords and MaxBatchBytes are the limits on a single PutRecords request
+	MaxBatchRecords = 500
+	MaxBatchBytes   = 5 * 1024 * 1024
+
+	// DefaultMaxAttempts is how many times each record is tried before giving up on it
+	DefaultMaxAttempts = 5
+)
+
+// Record is a record to put onto a stream.
+type Record struct {
+	PartitionKey string
+	Data         []byte
+
+	// Count is the number of user records in Data if it's already a KPL aggregated record, so
+	// that the Summary counts user records rather than Kinesis records; 0 for an ordinary record
+	Count int
+}
+
+// PutResult is where a record put with Put landed.
+type PutResult struct {
+	ShardId        *string
+	SequenceNumber *string
+
+	// Records is the number of user records in the record, if it was aggregated
+	Records int
+}
+
+// Summary counts the user records a Producer has put, or given up on.
+type Summary struct {
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Retries   int            `json:"retries"`
+	Errors    map[string]int `json:"errors,omitempty"`
+}
+
+// Limiter paces writes; it's told the size of each record before it's sent.
+type Limiter interface {
+	Wait(ctx context.Context, size int) error
+}
+
+// Producer writes records to a stream. It's safe for concurrent use.
+type Producer struct {
+	client     aws.KinesisWriter
+	streamName string
+
+	maxAttempts     int
+	limiter         Limiter
+	explicitHashKey *string
+	aggregator      *Aggregator
+	orderedKeys     bool
+
+	// mu guards the pending batch and the aggregator
+	mu      sync.Mutex
+	entries []types.PutRecordsRequestEntry
+	size    int
+	// Number of user records in each entry
+	counts []int
+	// Partition keys in the pending batch, tracked with WithOrderedKeys
+	keys map[string]bool
+
+	summaryMu sync.Mutex
+	summary   Summary
+}
+
+// Option configures a Producer.
+type Option func(*Producer)
+
+// WithMaxAttempts sets how many times each record is tried before giving up on it; zero keeps
+// DefaultMaxAttempts.
+func WithMaxAttempts(attempts int) Option {
+	return func(p *Producer) {
+		if attempts > 0 {
+			p.maxAttempts = attempts
+		}
+	}
+}
+
+// WithLimiter paces every attempt at writing a record, retries included, since retried records
+// count against the stream's limits just the same.
+func WithLimiter(limiter Limiter) Option {
+	return func(p *Producer) {
+		p.limiter = limiter
+	}
+}
+
+// WithExplicitHashKey overrides the hash of every record's partition key, to target a specific
+// shard. The key is a decimal 128-bit integer.
+func WithExplicitHashKey(hashKey string) Option {
+	return func(p *Producer) {
+		p.explicitHashKey = &hashKey
+	}
+}
+
+// WithAggregation packs records into KPL aggregated records before they're sent. See
+// NewAggregator for groupByKey.
+func WithAggregation(groupByKey bool) Option {
+	return func(p *Producer) {
+		p.aggregator = NewAggregator(groupByKey)
+	}
+}
+
+// WithOrderedKeys keeps each partition key's records in the order they were added, by sending the
+// pending batch before queueing a record whose key is already in it. Otherwise a record that fails
+// and is retried can land after a later record for the same key that succeeded first.
+func WithOrderedKeys() Option {
+	return func(p *Producer) {
+		p.orderedKeys = true
+	}
+}
+
+// New returns a Producer for a stream.
+func New(client aws.KinesisWriter, streamName string, opts ...Option) *Producer {
+	p := &Producer{
+		client:      client,
+		streamName:  streamName,
+		maxAttempts: DefaultMaxAttempts,
+		summary:     Summary{Errors: map[string]int{}},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Put puts a single record straight away with PutRecord, returning where it landed. With
+// aggregation, the record is sent as an aggregate of one. Put doesn't retry beyond the client's
+// own retries, and isn't counted in the Summary.
+func (p *Producer) Put(ctx context.Context, record Record) (*PutResult, error) {
+	if p.aggregator != nil && record.Count == 0 {
+		aggregator := kpl.NewAggregator()
+		if _, err := aggregator.Add(record.PartitionKey, record.Data); err != nil {
+			return nil, err
+		}
+		aggregated := aggregator.Flush()
+		record = Record{PartitionKey: aggregated.PartitionKey, Data: aggregated.Data, Count: aggregated.Count}
+	}
+
+	if p.limiter != nil {
+		if err := p.limiter.Wait(ctx, len(record.Data)+len(record.PartitionKey)); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := p.client.PutRecord(ctx, &kinesis.PutRecordInput{
+		StreamName:      &p.streamName,
+		PartitionKey:    &record.PartitionKey,
+		ExplicitHashKey: p.explicitHashKey,
+		Data:            record.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PutResult{
+		ShardId:        output.ShardId,
+		SequenceNumber: output.SequenceNumber,
+		Records:        record.Count,
+	}, nil
+}
+
+// PutBatch adds records and flushes them, returning an error if any of them couldn't be put.
+func (p *Producer) PutBatch(ctx context.Context, records []Record) error {
+	before := p.Summary().Failed
+
+	var errs []error
+	for _, record := range records {
+		if err := p.Add(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.Flush(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if failed := p.Summary().Failed - before; failed > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d records failed", failed, len(records)))
+	}
+	return errors.Join(errs...)
+}
+
+// Add queues a record, sending the pending batch first if the record won't fit in it. Records are
+// only guaranteed to have been sent once Flush returns. An error means the record couldn't be
+// queued, and it's counted as failed.
+func (p *Producer) Add(ctx context.Context, record Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.aggregator == nil || record.Count > 0 {
+		return p.add(ctx, record)
+	}
+
+	aggregated, err := p.aggregator.Add(record.PartitionKey, record.Data)
+	if aggregated != nil {
+		if err := p.add(ctx, aggregatedRecord(aggregated)); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		p.CountFailure("RecordTooLarge", 1)
+		return err
+	}
+	return nil
+}
+
+// add queues a record; p.mu must be held.
+func (p *Producer) add(ctx context.Context, record Record) error {
+	entry := types.PutRecordsRequestEntry{
+		Data:            record.Data,
+		PartitionKey:    &record.PartitionKey,
+		ExplicitHashKey: p.explicitHashKey,
+	}
+
+	var err error
+	entrySize := len(entry.Data) + len(record.PartitionKey)
+	if len(p.entries) == MaxBatchRecords || p.size+entrySize > MaxBatchBytes || (p.orderedKeys && p.keys[record.PartitionKey]) {
+		err = p.flush(ctx)
+	}
+
+	if p.orderedKeys {
+		if p.keys == nil {
+			p.keys = map[string]bool{}
+		}
+		p.keys[record.PartitionKey] = true
+	}
+	p.entries = append(p.entries, entry)
+	p.counts = append(p.counts, max(1, record.Count))
+	p.size += entrySize
+	return err
+}
+
+// Flush sends any queued records, including partially filled aggregates, retrying failed entries
+// until they succeed or run out of attempts. It returns an error only if ctx is cancelled first.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.aggregator != nil {
+		for _, aggregated := range p.aggregator.Flush() {
+			if err := p.add(ctx, aggregatedRecord(aggregated)); err != nil {
+				return err
+			}
+		}
+	}
+	return p.flush(ctx)
+}
+
+// flush sends the pending batch; p.mu must be held.
+func (p *Producer) flush(ctx context.Context) error {
+	pending, counts := p.entries, p.counts
+	p.entries, p.counts = nil, nil
+	p.size = 0
+	clear(p.keys)
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			p.addSummary(func(s *Summary) { s.Retries += sum(counts) })
+			aws.SleepContext(ctx, aws.Backoff(attempt-1))
+		}
+
+		err := ctx.Err()
+		for _, entry := range pending {
+			if err != nil || p.limiter == nil {
+				break
+			}
+			err = p.limiter.Wait(ctx, len(entry.Data)+len(*entry.PartitionKey))
+		}
+		if err != nil {
+			// Cancelled, so give up on everything still pending
+			p.CountFailure(aws.ErrorCode(err), sum(counts))
+			return err
+		}
+
+		output, err := p.client.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: &p.streamName,
+			Records:    pending,
+		})
+
+		var failed []types.PutRecordsRequestEntry
+		var failedCounts []int
+		var errorCodes []string
+		succeeded := 0
+		if err != nil {
+			// The whole request failed, so every record in it needs to be retried
+			failed, failedCounts = pending, counts
+			for range pending {
+				errorCodes = append(errorCodes, aws.ErrorCode(err))
+			}
+		} else {
+			for i, result := range output.Records {
+				if result.ErrorCode == nil {
+					succeeded += counts[i]
+					continue
+				}
+
+				failed = append(failed, pending[i])
+				failedCounts = append(failedCounts, counts[i])
+				errorCodes = append(errorCodes, *result.ErrorCode)
+			}
+		}
+		p.addSummary(func(s *Summary) { s.Succeeded += succeeded })
+
+		if len(failed) > 0 && (attempt >= p.maxAttempts || ctx.Err() != nil) {
+			p.addSummary(func(s *Summary) {
+				s.Failed += sum(failedCounts)
+				for i, code := range errorCodes {
+					s.Errors[code] += failedCounts[i]
+				}
+			})
+			return ctx.Err()
+		}
+
+		pending, counts = failed, failedCounts
+	}
+	return nil
+}
+
+// Summary returns the counts of records put so far.
+func (p *Producer) Summary() Summary {
+	p.summaryMu.Lock()
+	defer p.summaryMu.Unlock()
+
+	summary := p.summary
+	summary.Errors = make(map[string]int, len(p.summary.Errors))
+	for code, count := range p.summary.Errors {
+		summary.Errors[code] = count
+	}
+	return summary
+}
+
+// CountFailure counts records that failed under the given error code, for callers reporting
+// records that never reached the Producer, such as ones that couldn't be parsed, in its Summary.
+func (p *Producer) CountFailure(code string, count int) {
+	p.addSummary(func(s *Summary) {
+		s.Failed += count
+		s.Errors[code] += count
+	})
+}
+
+func (p *Producer) addSummary(update func(*Summary)) {
+	p.summaryMu.Lock()
+	defer p.summaryMu.Unlock()
+
+	update(&p.summary)
+}
+
+func aggregatedRecord(aggregated *kpl.Record) Record {
+	return Record{PartitionKey: aggregated.PartitionKey, Data: aggregated.Data, Count: aggregated.Count}
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
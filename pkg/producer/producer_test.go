@@ -0,0 +1,159 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// fakeWriter records the data of every entry it's sent, failing the entries that fail says to.
+type fakeWriter struct {
+	mu       sync.Mutex
+	requests [][]string
+	// fail returns the error code for an entry on a given attempt at it, or "" to accept it
+	fail func(data string, attempt int) string
+	// requestErr fails the first this many requests outright
+	requestErr int
+
+	attempts map[string]int
+}
+
+func (w *fakeWriter) PutRecord(ctx context.Context, params *kinesis.PutRecordInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (w *fakeWriter) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var request []string
+	for _, entry := range params.Records {
+		request = append(request, string(entry.Data))
+	}
+	w.requests = append(w.requests, request)
+	if w.requestErr > 0 {
+		w.requestErr--
+		return nil, errors.New("connection reset")
+	}
+
+	if w.attempts == nil {
+		w.attempts = map[string]int{}
+	}
+	output := &kinesis.PutRecordsOutput{}
+	for _, data := range request {
+		w.attempts[data]++
+		result := types.PutRecordsResultEntry{}
+		if w.fail != nil {
+			if code := w.fail(data, w.attempts[data]); code != "" {
+				result.ErrorCode = &code
+				output.FailedRecordCount = new(int32)
+			}
+		}
+		output.Records = append(output.Records, result)
+	}
+	return output, nil
+}
+
+func addRecords(t *testing.T, p *Producer, keys ...string) {
+	t.Helper()
+	for i, key := range keys {
+		if err := p.Add(context.Background(), Record{PartitionKey: key, Data: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProducerRetriesOnlyFailedRecords(t *testing.T) {
+	writer := &fakeWriter{fail: func(data string, attempt int) string {
+		if (data == "1" || data == "3") && attempt == 1 {
+			return "ProvisionedThroughputExceededException"
+		}
+		return ""
+	}}
+	p := New(writer, "stream")
+	addRecords(t, p, "a", "b", "c", "d")
+
+	want := [][]string{{"0", "1", "2", "3"}, {"1", "3"}}
+	if !slices.EqualFunc(writer.requests, want, slices.Equal) {
+		t.Errorf("requests = %v; want %v", writer.requests, want)
+	}
+	summary := p.Summary()
+	if summary.Succeeded != 4 || summary.Failed != 0 || summary.Retries != 2 {
+		t.Errorf("summary = %+v; want 4 succeeded after 2 retries", summary)
+	}
+}
+
+func TestProducerGivesUpAfterMaxAttempts(t *testing.T) {
+	writer := &fakeWriter{fail: func(data string, attempt int) string {
+		if data == "0" {
+			return "InternalFailure"
+		}
+		return ""
+	}}
+	p := New(writer, "stream", WithMaxAttempts(3))
+	addRecords(t, p, "a", "b")
+
+	if len(writer.requests) != 3 {
+		t.Errorf("made %d requests; want 3 attempts", len(writer.requests))
+	}
+	summary := p.Summary()
+	if summary.Succeeded != 1 || summary.Failed != 1 || summary.Retries != 2 || summary.Errors["InternalFailure"] != 1 {
+		t.Errorf("summary = %+v; want 1 succeeded and 1 failed with InternalFailure after 2 retries", summary)
+	}
+}
+
+func TestProducerRetriesFailedRequests(t *testing.T) {
+	writer := &fakeWriter{requestErr: 1}
+	p := New(writer, "stream")
+	addRecords(t, p, "a", "b")
+
+	want := [][]string{{"0", "1"}, {"0", "1"}}
+	if !slices.EqualFunc(writer.requests, want, slices.Equal) {
+		t.Errorf("requests = %v; want %v", writer.requests, want)
+	}
+	summary := p.Summary()
+	if summary.Succeeded != 2 || summary.Failed != 0 || summary.Retries != 2 {
+		t.Errorf("summary = %+v; want 2 succeeded after 2 retries", summary)
+	}
+}
+
+func TestProducerCountsAggregatedRecords(t *testing.T) {
+	writer := &fakeWriter{fail: func(data string, attempt int) string {
+		return "InternalFailure"
+	}}
+	p := New(writer, "stream", WithAggregation(false), WithMaxAttempts(1))
+	addRecords(t, p, "a", "b", "c")
+
+	if len(writer.requests) != 1 || len(writer.requests[0]) != 1 {
+		t.Errorf("requests = %d; want one aggregate in one request", len(writer.requests))
+	}
+	if summary := p.Summary(); summary.Failed != 3 || summary.Errors["InternalFailure"] != 3 {
+		t.Errorf("summary = %+v; want the aggregate's 3 records failed", summary)
+	}
+}
+
+func TestProducerOrderedKeys(t *testing.T) {
+	writer := &fakeWriter{fail: func(data string, attempt int) string {
+		if data == "0" && attempt == 1 {
+			return "ProvisionedThroughputExceededException"
+		}
+		return ""
+	}}
+	p := New(writer, "stream", WithOrderedKeys())
+	addRecords(t, p, "a", "b", "a", "c", "a")
+
+	// Each record for a is only sent once the one before it has been retried
+	want := [][]string{{"0", "1"}, {"0"}, {"2", "3"}, {"4"}}
+	if !slices.EqualFunc(writer.requests, want, slices.Equal) {
+		t.Errorf("requests = %v; want %v", writer.requests, want)
+	}
+}
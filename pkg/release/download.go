@@ -0,0 +1,181 @@
+package release
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// binaryName is the name of kin's binary within release archives
+const binaryName = "kin"
+
+// Binary returns the asset holding the binary for an OS and architecture, named like
+// kin_1.2.3_linux_amd64, either as it is or in a .tar.gz archive.
+func (r *Release) Binary(goos, goarch string) (*Asset, error) {
+	suffix := "_" + goos + "_" + goarch
+	for i, asset := range r.Assets {
+		name := strings.TrimSuffix(strings.TrimSuffix(asset.Name, ".tar.gz"), ".exe")
+		if strings.HasPrefix(name, binaryName+"_") && strings.HasSuffix(name, suffix) {
+			return &r.Assets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no binary for %s/%s", r.Version, goos, goarch)
+}
+
+// Checksums returns the SHA-256 checksums of the release's assets by name, from its checksums.txt
+// (or <anything>_checksums.txt) asset, as written by sha256sum. The checksums must be signed with
+// PublicKey, in a .minisig asset alongside them, so that a binary matching them is known to come
+// from kin's maintainers rather than just from whoever could publish the release.
+func (c *Client) Checksums(ctx context.Context, r *Release) (map[string]string, error) {
+	var checksums, signature *Asset
+	for i, asset := range r.Assets {
+		if asset.Name == "checksums.txt" || strings.HasSuffix(asset.Name, "_checksums.txt") {
+			checksums = &r.Assets[i]
+			break
+		}
+	}
+	if checksums == nil {
+		return nil, fmt.Errorf("release %s has no checksums to verify its binaries against", r.Version)
+	}
+	for i, asset := range r.Assets {
+		if asset.Name == checksums.Name+signatureSuffix {
+			signature = &r.Assets[i]
+		}
+	}
+	if signature == nil {
+		return nil, fmt.Errorf("release %s has no signature of its checksums, so its binaries can't be trusted", r.Version)
+	}
+
+	content, err := c.downloadAll(ctx, checksums)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := c.downloadAll(ctx, signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(PublicKey, content, sig); err != nil {
+		return nil, fmt.Errorf("release %s's checksums aren't signed by kin's maintainers: %w", r.Version, err)
+	}
+
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks files it read in binary mode with a *
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", checksums.Name, err)
+	}
+	return sums, nil
+}
+
+// maxChecksumsSize is the most read of a checksums file or its signature
+const maxChecksumsSize = 1 << 20
+
+// downloadAll returns the content of a small asset.
+func (c *Client) downloadAll(ctx context.Context, asset *Asset) ([]byte, error) {
+	body, err := c.download(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxChecksumsSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+	if len(content) > maxChecksumsSize {
+		return nil, fmt.Errorf("%s is too large", asset.Name)
+	}
+	return content, nil
+}
+
+// DownloadBinary writes the binary in asset to w, failing if the asset's SHA-256 checksum isn't
+// checksum. Since that's only known once the whole asset has been read, w must be discarded on
+// error.
+func (c *Client) DownloadBinary(ctx context.Context, asset *Asset, checksum string, w io.Writer) error {
+	body, err := c.download(ctx, asset)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	content := io.TeeReader(body, hash)
+
+	if strings.HasSuffix(asset.Name, ".tar.gz") {
+		err = extractBinary(content, w)
+	} else {
+		_, err = io.Copy(w, content)
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+
+	// Read whatever follows the binary in an archive, so that all of it is checksummed
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != strings.ToLower(checksum) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, checksum, sum)
+	}
+	return nil
+}
+
+// extractBinary writes the kin binary in a .tar.gz archive to w.
+func extractBinary(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("no %s binary in the archive", binaryName)
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(path.Base(header.Name), ".exe")
+		if header.Typeflag == tar.TypeReg && name == binaryName {
+			_, err := io.Copy(w, archive)
+			return err
+		}
+	}
+}
+
+// download returns the content of an asset.
+func (c *Client) download(ctx context.Context, asset *Asset) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", asset.Name, res.Status)
+	}
+	return res.Body, nil
+}
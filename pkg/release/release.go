@@ -0,0 +1,84 @@
+// Package release finds kin's releases on GitHub, to tell users when there's a newer version than
+// theirs.
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Repository is the GitHub repository kin is released from
+const Repository = "jrnt30/kin"
+
+// Release is a published release of kin.
+type Release struct {
+	// Version is the release's tag, such as v1.2.3
+	Version string  `json:"tag_name"`
+	URL     string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release, such as a binary or a checksums file.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+type Client struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// NewClient returns a client for the GitHub API at GITHUB_API_URL, or api.github.com, using
+// GITHUB_TOKEN if it's set to avoid the lower rate limit of anonymous requests.
+func NewClient() *Client {
+	base := os.Getenv("GITHUB_API_URL")
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	return &Client{http: http.DefaultClient, base: strings.TrimSuffix(base, "/"), token: os.Getenv("GITHUB_TOKEN")}
+}
+
+// Latest returns the latest release, leaving out drafts and pre-releases.
+func (c *Client) Latest(ctx context.Context) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/repos/"+Repository+"/releases/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting the latest release of %s: %s", Repository, res.Status)
+	}
+
+	var release Release
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("getting the latest release of %s: %w", Repository, err)
+	}
+	return &release, nil
+}
+
+// Newer reports whether version is a later version than current. Development builds, whose
+// versions aren't semantic versions, are never older than a release.
+func Newer(version, current string) bool {
+	if !semver.IsValid(current) || !semver.IsValid(version) {
+		return false
+	}
+	return semver.Compare(version, current) > 0
+}
@@ -0,0 +1,74 @@
+package release
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// PublicKey is the minisign public key releases' checksums are signed with. Builds for a fork
+// can set their own with -ldflags "-X kin/pkg/release.PublicKey=<key>".
+var PublicKey = "RWSJpKTvZuVplk5FDeUUnhFTI8ZBV8Fhg6BPLw/Wy/FNTo8oOttMep/U"
+
+// signatureSuffix is appended to the name of the checksums asset to get its signature's, as
+// minisign names signatures
+const signatureSuffix = ".minisig"
+
+// Signature algorithms: Ed25519 over the file itself, or over its BLAKE2b-512 hash
+const (
+	algorithmEd25519       = "Ed"
+	algorithmEd25519Hashed = "ED"
+)
+
+// verifySignature checks that signature, the contents of a minisign .minisig file, is a valid
+// signature of data by the key publicKey, given as minisign prints it.
+func verifySignature(publicKey string, data, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != 2+8+ed25519.PublicKeySize || string(key[:2]) != algorithmEd25519 {
+		return errors.New("invalid public key")
+	}
+	keyId, publicKeyBytes := key[2:10], ed25519.PublicKey(key[10:])
+
+	// An untrusted comment, the signature, a trusted comment and a signature of the signature and
+	// the trusted comment
+	lines := strings.Split(strings.TrimRight(string(signature), "\r\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "untrusted comment: ") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+
+	if !bytes.Equal(sig[2:10], keyId) {
+		return fmt.Errorf("signed with key %X rather than kin's key %X", sig[2:10], keyId)
+	}
+
+	message := data
+	switch string(sig[:2]) {
+	case algorithmEd25519:
+	case algorithmEd25519Hashed:
+		hash := blake2b.Sum512(data)
+		message = hash[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(publicKeyBytes, message, sig[10:]) {
+		return errors.New("signature doesn't match")
+	}
+
+	trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ed25519.Verify(publicKeyBytes, append(append([]byte{}, sig[10:]...), trustedComment...), globalSig) {
+		return errors.New("trusted comment's signature doesn't match")
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir writes records to a file per shard in a directory, so that each shard's records are in
+// order on disk rather than interleaved with the others'. Files are named <shard>.ndjson or, split
+// by the hour records arrived in as export does, date=YYYY-MM-DD/hour=HH/<shard>.ndjson, with the
+// format's and compression's extensions. Existing files are appended to.
+type Dir struct {
+	dir         string
+	byHour      bool
+	format      Format
+	compression Compression
+
+	files map[string]*dirFile
+}
+
+// dirFile is the file a shard's records are being written to. Records are written to gz when
+// they're compressed, which writes to buffer, and otherwise to buffer directly.
+type dirFile struct {
+	file   *os.File
+	buffer *bufio.Writer
+	gz     *gzip.Writer
+	hour   time.Time
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+	if f.gz != nil {
+		return f.gz.Write(p)
+	}
+	return f.buffer.Write(p)
+}
+
+// flush writes out everything written so far.
+func (f *dirFile) flush() error {
+	if f.gz != nil {
+		if err := f.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.buffer.Flush()
+}
+
+func (f *dirFile) close() error {
+	var err error
+	if f.gz != nil {
+		err = f.gz.Close()
+	}
+	return errors.Join(err, f.buffer.Flush(), f.file.Close())
+}
+
+// NewDir returns a Dir writing to dir, creating it if it doesn't exist.
+func NewDir(dir string, byHour bool, format Format, compression Compression) (*Dir, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{dir: dir, byHour: byHour, format: format, compression: compression, files: map[string]*dirFile{}}, nil
+}
+
+func (d *Dir) Write(ctx context.Context, record *RecordOutput) error {
+	line, err := d.format.Encode(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := d.file(*record.ShardId, record.ApproximateArrivalTimestamp)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, d.format.Delimiter))
+	return err
+}
+
+// file returns the file for a shard's record that arrived at arrival, moving on to a new file
+// when the hour turns. Arrival times are approximate, so a record just before the hour turned
+// may follow one from just after; it stays in the newer file.
+func (d *Dir) file(shardId string, arrival *Timestamp) (*dirFile, error) {
+	var hour time.Time
+	if d.byHour {
+		hour = time.Now().UTC().Truncate(time.Hour)
+		if arrival != nil {
+			hour = arrival.UTC().Truncate(time.Hour)
+		}
+	}
+
+	current := d.files[shardId]
+	if current != nil && !hour.After(current.hour) {
+		return current, nil
+	}
+	if current != nil {
+		if err := current.close(); err != nil {
+			return nil, err
+		}
+		delete(d.files, shardId)
+	}
+
+	name := shardId + d.format.Extension + d.compression.Extension()
+	path := filepath.Join(d.dir, name)
+	if d.byHour {
+		path = filepath.Join(d.dir, hour.Format("date=2006-01-02"), hour.Format("hour=15"), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	file := &dirFile{file: f, buffer: bufio.NewWriter(f), hour: hour}
+	if d.compression == Gzip {
+		file.gz = gzip.NewWriter(file.buffer)
+	}
+	d.files[shardId] = file
+	return file, nil
+}
+
+// Flush writes out what's buffered for every shard.
+func (d *Dir) Flush(ctx context.Context) error {
+	var err error
+	for _, file := range d.files {
+		err = errors.Join(err, file.flush())
+	}
+	return err
+}
+
+func (d *Dir) Close() error {
+	var err error
+	for shardId, file := range d.files {
+		err = errors.Join(err, file.close())
+		delete(d.files, shardId)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package sink
+
+import "errors"
+
+// Format is how a sink encodes records. In files, objects and request bodies, each encoded
+// record is followed by Delimiter.
+type Format struct {
+	// Name is the format's name, as given to --output
+	Name string
+	// Extension ends the names of files and objects holding records in the format
+	Extension string
+	// ContentType describes a body of records in the format
+	ContentType string
+
+	Delimiter byte
+	Encode    func(record *RecordOutput) ([]byte, error)
+}
+
+// JSON returns the default format, newline-delimited JSON; see MarshalRecord for fieldCase.
+func JSON(fieldCase string) Format {
+	return Format{
+		Name:        "json",
+		Extension:   ".ndjson",
+		ContentType: "application/x-ndjson",
+		Delimiter:   '\n',
+		Encode: func(record *RecordOutput) ([]byte, error) {
+			return MarshalRecord(record, fieldCase)
+		},
+	}
+}
+
+// Raw0 returns a format writing each record's payload exactly as it was put, followed by a NUL
+// byte as find -print0 does, so that binary payloads can be piped to tools like xargs -0 without
+// being mangled by newlines. Records need RawData.
+func Raw0() Format {
+	return Format{
+		Name:        "raw0",
+		Extension:   ".bin",
+		ContentType: "application/octet-stream",
+		Delimiter:   0,
+		Encode: func(record *RecordOutput) ([]byte, error) {
+			if record.RawData == nil {
+				return nil, errors.New("record has no raw payload to output")
+			}
+			// Capped so that appending the delimiter copies it rather than writing into the record
+			return record.RawData[:len(record.RawData):len(record.RawData)], nil
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxRequestRecords is the most records an HTTP sink sends in one request.
+const DefaultMaxRequestRecords = 500
+
+// HTTP POSTs records to an endpoint, in batches of up to DefaultMaxRequestRecords. Any response
+// other than a 2xx is an error.
+type HTTP struct {
+	client *http.Client
+	url    string
+	format Format
+
+	buffer  bytes.Buffer
+	records int
+}
+
+// NewHTTP returns an HTTP sink posting to url with client, or http.DefaultClient if it's nil. A
+// client with its own Transport can add headers, such as for authentication.
+func NewHTTP(client *http.Client, url string, format Format) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTP{client: client, url: url, format: format}
+}
+
+func (h *HTTP) Write(ctx context.Context, record *RecordOutput) error {
+	line, err := h.format.Encode(record)
+	if err != nil {
+		return err
+	}
+
+	h.buffer.Write(line)
+	h.buffer.WriteByte(h.format.Delimiter)
+	h.records++
+
+	if h.records >= DefaultMaxRequestRecords {
+		return h.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends the buffered records, if there are any. They stay buffered if it fails, so that
+// the next Flush tries again.
+func (h *HTTP) Flush(ctx context.Context) error {
+	if h.records == 0 {
+		return nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(h.buffer.Bytes()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", h.format.ContentType)
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("POST %s: %s: %s", h.url, response.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, response.Body)
+
+	h.buffer.Reset()
+	h.records = 0
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	return h.Flush(context.Background())
+}
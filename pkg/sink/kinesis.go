@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/producer"
+)
+
+// Kinesis writes records to another stream, each encoded as a record of its own and keeping its
+// partition key so that records for a key stay in order. Records are batched by the producer
+// until flushed.
+type Kinesis struct {
+	producer *producer.Producer
+	format   Format
+
+	// failed is the producer's count of failed records as of the last Flush
+	failed int
+}
+
+// NewKinesis returns a Kinesis sink writing with p.
+func NewKinesis(p *producer.Producer, format Format) *Kinesis {
+	return &Kinesis{producer: p, format: format}
+}
+
+func (k *Kinesis) Write(ctx context.Context, record *RecordOutput) error {
+	data, err := k.format.Encode(record)
+	if err != nil {
+		return err
+	}
+
+	partitionKey := ""
+	switch {
+	case record.PartitionKey != nil:
+		partitionKey = *record.PartitionKey
+	case record.SequenceNumber != nil:
+		partitionKey = *record.SequenceNumber
+	default:
+		partitionKey = "-"
+	}
+
+	return k.producer.Add(ctx, producer.Record{PartitionKey: partitionKey, Data: data})
+}
+
+// DroppedError is returned by Flush when records couldn't be written and have been given up on,
+// rather than kept to be retried by the next Flush.
+type DroppedError struct {
+	Records int
+	// Errors counts the failures by error code
+	Errors map[string]int
+}
+
+func (e *DroppedError) Error() string {
+	return fmt.Sprintf("%d records couldn't be written to the stream: %v", e.Records, e.Errors)
+}
+
+// Flush writes the batched records, returning a *DroppedError if any of them couldn't be written.
+// The producer has already retried them, so they aren't retried again.
+func (k *Kinesis) Flush(ctx context.Context) error {
+	if err := k.producer.Flush(ctx); err != nil {
+		return err
+	}
+
+	summary := k.producer.Summary()
+	failed := summary.Failed - k.failed
+	k.failed = summary.Failed
+	if failed > 0 {
+		return &DroppedError{Records: failed, Errors: summary.Errors}
+	}
+	return nil
+}
+
+func (k *Kinesis) Close() error {
+	return k.Flush(context.Background())
+}
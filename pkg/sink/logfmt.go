@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"kin/pkg/decode"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Logfmt returns a format writing each record as a line of key=value pairs, for log tooling such
+// as Loki: shard, key (the partition key), seq and ts (the arrival time), then the payload. An
+// object payload's fields are flattened into dot-separated keys in sorted order, or the order they
+// were in if it was decoded keeping it, and any other payload is written as data. Arrays are
+// written as JSON.
+func Logfmt() Format {
+	return Format{
+		Name:        "logfmt",
+		Extension:   ".log",
+		ContentType: "text/plain",
+		Delimiter:   '\n',
+		Encode:      encodeLogfmt,
+	}
+}
+
+func encodeLogfmt(record *RecordOutput) ([]byte, error) {
+	var line bytes.Buffer
+	if record.ShardId != nil {
+		writeLogfmtPair(&line, "shard", *record.ShardId)
+	}
+	if record.PartitionKey != nil {
+		writeLogfmtPair(&line, "key", *record.PartitionKey)
+	}
+	if record.SequenceNumber != nil {
+		writeLogfmtPair(&line, "seq", *record.SequenceNumber)
+	}
+	if record.ApproximateArrivalTimestamp != nil {
+		ts, err := record.ApproximateArrivalTimestamp.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		writeLogfmtPair(&line, "ts", logfmtValue(json.RawMessage(ts)))
+	}
+
+	if record.Data != nil {
+		if keys, object, ok := logfmtObject(*record.Data); ok {
+			writeLogfmtObject(&line, "", keys, object)
+		} else {
+			writeLogfmtPair(&line, "data", logfmtValue(*record.Data))
+		}
+	}
+	return line.Bytes(), nil
+}
+
+// logfmtObject returns the keys of an object payload in the order they're written, which is
+// sorted unless the object keeps its own order, and its fields.
+func logfmtObject(value interface{}) ([]string, map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case *decode.Object:
+		return v.Keys, v.Values, true
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys, v, true
+	default:
+		return nil, nil, false
+	}
+}
+
+func writeLogfmtObject(line *bytes.Buffer, prefix string, keys []string, object map[string]interface{}) {
+	for _, key := range keys {
+		if nestedKeys, nested, ok := logfmtObject(object[key]); ok && len(nested) > 0 {
+			writeLogfmtObject(line, prefix+key+".", nestedKeys, nested)
+			continue
+		}
+		writeLogfmtPair(line, prefix+key, logfmtValue(object[key]))
+	}
+}
+
+// logfmtValue renders a decoded value as text: strings as they are, bytes as base64, and
+// anything else as JSON. Null is rendered as nothing.
+func logfmtValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case json.RawMessage:
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			return s
+		}
+		return string(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func writeLogfmtPair(line *bytes.Buffer, key, value string) {
+	if line.Len() > 0 {
+		line.WriteByte(' ')
+	}
+	line.WriteString(logfmtKey(key))
+	line.WriteByte('=')
+	if needsLogfmtQuoting(value) {
+		line.WriteString(strconv.Quote(value))
+	} else {
+		line.WriteString(value)
+	}
+}
+
+// logfmtKey replaces the characters keys can't contain.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func needsLogfmtQuoting(value string) bool {
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// RecordOutput is a record as kin outputs it.
+type RecordOutput struct {
+	ShardId                     *string              `json:"shard_id,omitempty"`
+	PartitionKey                *string              `json:"partition_key,omitempty"`
+	SequenceNumber              *string              `json:"sequence_number,omitempty"`
+	ApproximateArrivalTimestamp *Timestamp           `json:"approximate_arrival_timestamp,omitempty"`
+	EncryptionType              types.EncryptionType `json:"encryption_type,omitempty"`
+	MillisBehindLatest          *int64               `json:"millis_behind_latest,omitempty"`
+	Size                        *int                 `json:"size,omitempty"`
+	Data                        *interface{}         `json:"data,omitempty"`
+	RawData                     []byte               `json:"raw_data,omitempty"`
+
+	// EnvelopeType and Envelope are set when Data was unwrapped from an event envelope, such as
+	// an SNS notification, to what's left of the envelope
+	EnvelopeType string                 `json:"envelope_type,omitempty"`
+	Envelope     map[string]interface{} `json:"envelope,omitempty"`
+
+	// DecodeErr is set when the payload couldn't be decoded as asked, in which case Data holds it
+	// undecoded. It isn't output.
+	DecodeErr error `json:"-"`
+}
+
+// camelCaseRecordOutput is RecordOutput with camelCase field names. It must have exactly the same
+// fields as RecordOutput so that one can be converted to the other.
+type camelCaseRecordOutput struct {
+	ShardId                     *string              `json:"shardId,omitempty"`
+	PartitionKey                *string              `json:"partitionKey,omitempty"`
+	SequenceNumber              *string              `json:"sequenceNumber,omitempty"`
+	ApproximateArrivalTimestamp *Timestamp           `json:"approximateArrivalTimestamp,omitempty"`
+	EncryptionType              types.EncryptionType `json:"encryptionType,omitempty"`
+	MillisBehindLatest          *int64               `json:"millisBehindLatest,omitempty"`
+	Size                        *int                 `json:"size,omitempty"`
+	Data                        *interface{}         `json:"data,omitempty"`
+	RawData                     []byte               `json:"rawData,omitempty"`
+
+	EnvelopeType string                 `json:"envelopeType,omitempty"`
+	Envelope     map[string]interface{} `json:"envelope,omitempty"`
+
+	DecodeErr error `json:"-"`
+}
+
+// MarshalRecord encodes a record as JSON using either snake_case or camelCase field names.
+func MarshalRecord(record *RecordOutput, fieldCase string) ([]byte, error) {
+	if fieldCase == "camel" {
+		return json.Marshal((*camelCaseRecordOutput)(record))
+	}
+
+	return json.Marshal(record)
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultMaxObjectSize is the most records an S3 sink buffers, uncompressed, before writing them
+// out as an object.
+const DefaultMaxObjectSize = 64 * 1024 * 1024
+
+// S3 writes records to S3 as objects, compressed or not. Each Flush writes an object of the
+// records written since the last, so how often it's flushed trades latency against the number of
+// objects. Objects are named <prefix>/<time of first record>-<n>.ndjson.gz, with the format's and
+// compression's extensions.
+type S3 struct {
+	client        *s3.Client
+	bucket        string
+	prefix        string
+	format        Format
+	compression   Compression
+	maxObjectSize int
+
+	buffer  bytes.Buffer
+	size    int
+	opened  time.Time
+	objects int
+}
+
+// NewS3 returns an S3 sink writing objects under prefix in bucket.
+func NewS3(client *s3.Client, bucket, prefix string, format Format, compression Compression) *S3 {
+	return &S3{
+		client:        client,
+		bucket:        bucket,
+		prefix:        prefix,
+		format:        format,
+		compression:   compression,
+		maxObjectSize: DefaultMaxObjectSize,
+	}
+}
+
+func (s *S3) Write(ctx context.Context, record *RecordOutput) error {
+	line, err := s.format.Encode(record)
+	if err != nil {
+		return err
+	}
+
+	if s.size > 0 && s.size+len(line)+1 > s.maxObjectSize {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	if s.size == 0 {
+		s.opened = time.Now()
+	}
+
+	s.buffer.Write(line)
+	s.buffer.WriteByte(s.format.Delimiter)
+	s.size += len(line) + 1
+	return nil
+}
+
+// Flush writes the buffered records as an object, if there are any. They stay buffered if it
+// fails, so that the next Flush tries again.
+func (s *S3) Flush(ctx context.Context) error {
+	if s.size == 0 {
+		return nil
+	}
+
+	body := s.buffer.Bytes()
+	var contentEncoding *string
+	if s.compression == Gzip {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(body)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = compressed.Bytes()
+		contentEncoding = aws.String("gzip")
+	}
+
+	key := path.Join(s.prefix, fmt.Sprintf("%s-%d%s%s", s.opened.UTC().Format("20060102T150405.000Z"), s.objects, s.format.Extension, s.compression.Extension()))
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          &s.bucket,
+		Key:             &key,
+		Body:            bytes.NewReader(body),
+		ContentType:     aws.String(s.format.ContentType),
+		ContentEncoding: contentEncoding,
+	})
+	if err != nil {
+		return fmt.Errorf("writing s3://%s/%s: %w", s.bucket, key, err)
+	}
+
+	s.buffer.Reset()
+	s.size = 0
+	s.objects++
+	return nil
+}
+
+func (s *S3) Close() error {
+	return s.Flush(context.Background())
+}
@@ -0,0 +1,54 @@
+// Package sink writes records to where kin outputs them: stdout, a file, S3 objects, another
+// Kinesis stream or an HTTP endpoint. Each destination is a Sink, so commands write to whichever
+// were asked for without knowing which, and Multi writes to several at once.
+package sink
+
+import (
+	"context"
+	"errors"
+)
+
+// Sink is a destination for records. Sinks may buffer what's written, so records are only
+// guaranteed to have reached the destination once Flush returns. Sinks aren't safe for concurrent
+// use.
+type Sink interface {
+	Write(ctx context.Context, record *RecordOutput) error
+	Flush(ctx context.Context) error
+	// Close flushes any buffered records and releases the sink's resources.
+	Close() error
+}
+
+// Multi returns a Sink which writes every record to each of sinks.
+func Multi(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return multiSink(sinks)
+}
+
+type multiSink []Sink
+
+func (m multiSink) Write(ctx context.Context, record *RecordOutput) error {
+	for _, s := range m {
+		if err := s.Write(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) Flush(ctx context.Context) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
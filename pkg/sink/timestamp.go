@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimestampFormat controls how timestamps are rendered in output.
+type TimestampFormat struct {
+	// Layout is either a Go time layout or one of the special values "unix", "unix-millis" and
+	// "unix-nano", which render timestamps as numbers
+	Layout string
+
+	// Local renders timestamps in the local timezone rather than UTC
+	Local bool
+}
+
+// Named formats accepted by --timestamp-format, in addition to arbitrary Go time layouts
+var timestampLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"kitchen":     time.Kitchen,
+	"datetime":    time.DateTime,
+	"unix":        "unix",
+	"unix-millis": "unix-millis",
+	"unix-nano":   "unix-nano",
+}
+
+// ParseTimestampFormat accepts a named format (case-insensitive) or a Go time layout.
+func ParseTimestampFormat(name string, local bool) (*TimestampFormat, error) {
+	if name == "" {
+		name = "rfc3339nano"
+	}
+
+	layout, ok := timestampLayouts[strings.ToLower(name)]
+	if !ok {
+		// Anything that doesn't contain a reference time component is almost certainly a typo
+		// rather than a layout. Formatting any time other than the reference time with it would
+		// then leave it as it was.
+		if time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC).Format(name) == name {
+			return nil, fmt.Errorf("unknown timestamp format %q", name)
+		}
+		layout = name
+	}
+
+	return &TimestampFormat{Layout: layout, Local: local}, nil
+}
+
+// Format renders t as either a string or, for the unix formats, a number.
+func (f *TimestampFormat) Format(t time.Time) interface{} {
+	if f.Local {
+		t = t.Local()
+	} else {
+		t = t.UTC()
+	}
+
+	switch f.Layout {
+	case "unix":
+		return t.Unix()
+	case "unix-millis":
+		return t.UnixMilli()
+	case "unix-nano":
+		return t.UnixNano()
+	default:
+		return t.Format(f.Layout)
+	}
+}
+
+// Timestamp is a time which marshals to JSON using a configurable TimestampFormat. A nil format
+// uses Go's default RFC 3339 encoding.
+type Timestamp struct {
+	time.Time
+	format *TimestampFormat
+}
+
+func NewTimestamp(t *time.Time, format *TimestampFormat) *Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return &Timestamp{Time: *t, format: format}
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.format == nil {
+		return t.Time.MarshalJSON()
+	}
+
+	return json.Marshal(t.format.Format(t.Time))
+}
@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// Compression is how files and objects of records are compressed.
+type Compression string
+
+const (
+	NoCompression Compression = ""
+	// Gzip compresses as a stream, so that what's been flushed can be read before it's closed.
+	// Files that already exist are appended to as another gzip member, which readers treat as
+	// following on from the first.
+	Gzip Compression = "gzip"
+)
+
+// Extension ends the names of files and objects compressed this way.
+func (c Compression) Extension() string {
+	if c == Gzip {
+		return ".gz"
+	}
+	return ""
+}
+
+// Writer writes records to an io.Writer, such as stdout or a file, as each is written.
+type Writer struct {
+	w      io.Writer
+	format Format
+
+	// file is the file the Writer opened, and gz compresses what's written to it, if the Writer
+	// does
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// NewWriter returns a Writer for w.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: w, format: format}
+}
+
+// NewStdout returns a Writer for stdout.
+func NewStdout(format Format) *Writer {
+	return NewWriter(os.Stdout, format)
+}
+
+// NewFile returns a Writer appending to a file, which is created if it doesn't exist.
+func NewFile(path string, format Format, compression Compression) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{w: f, format: format, file: f}
+	if compression == Gzip {
+		w.gz = gzip.NewWriter(f)
+		w.w = w.gz
+	}
+	return w, nil
+}
+
+func (w *Writer) Write(ctx context.Context, record *RecordOutput) error {
+	line, err := w.format.Encode(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(append(line, w.format.Delimiter))
+	return err
+}
+
+// Flush writes out what's compressed so far, if the Writer compresses. Otherwise it does nothing,
+// since every record is written as it comes.
+func (w *Writer) Flush(ctx context.Context) error {
+	if w.gz != nil {
+		return w.gz.Flush()
+	}
+	return nil
+}
+
+// Close closes the file if the Writer opened one, after finishing compressing it; anything else,
+// such as stdout, is left open.
+func (w *Writer) Close() error {
+	var err error
+	if w.gz != nil {
+		err = w.gz.Close()
+	}
+	if w.file != nil {
+		err = errors.Join(err, w.file.Close())
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package tailer
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// Position is where in a shard reading starts.
+type Position struct {
+	Type           types.ShardIteratorType
+	Timestamp      *time.Time
+	SequenceNumber *string
+}
+
+// TrimHorizon starts at the oldest record still retained.
+func TrimHorizon() Position {
+	return Position{Type: types.ShardIteratorTypeTrimHorizon}
+}
+
+// Latest starts with the records put after reading starts.
+func Latest() Position {
+	return Position{Type: types.ShardIteratorTypeLatest}
+}
+
+// AtTimestamp starts at the first record that arrived at or after t.
+func AtTimestamp(t time.Time) Position {
+	return Position{Type: types.ShardIteratorTypeAtTimestamp, Timestamp: &t}
+}
+
+// AtSequenceNumber starts at the record with the given sequence number.
+func AtSequenceNumber(sequenceNumber string) Position {
+	return Position{Type: types.ShardIteratorTypeAtSequenceNumber, SequenceNumber: &sequenceNumber}
+}
+
+// AfterSequenceNumber starts at the record after the one with the given sequence number.
+func AfterSequenceNumber(sequenceNumber string) Position {
+	return Position{Type: types.ShardIteratorTypeAfterSequenceNumber, SequenceNumber: &sequenceNumber}
+}
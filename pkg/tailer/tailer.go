@@ -0,0 +1,522 @@
+// Package tailer reads records from a Kinesis stream the way kin tail does: polling each shard
+// with GetRecords, backing off when throttled, and optionally resuming from checkpoints. It can be
+// embedded in other programs that want kin's consumption behavior without shelling out to it.
+package tailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kin/pkg/aws"
+	"kin/pkg/decode"
+	"kin/pkg/telemetry"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultPollInterval is how long to wait between GetRecords calls on each shard. Kinesis
+	// allows five calls per second per shard, shared between every consumer, so this leaves room
+	// for others.
+	DefaultPollInterval = 2 * time.Second
+
+	// DefaultGetRecordsRate is the most GetRecords calls made per second on each shard, however
+	// short the poll interval, leaving most of the five Kinesis allows for other consumers.
+	DefaultGetRecordsRate = 2.0
+
+	// throttleBackoff is how long to wait before retrying a throttled GetRecords call
+	throttleBackoff = 2 * time.Second
+)
+
+// Record is a record read from a shard.
+type Record struct {
+	types.Record
+
+	ShardId            string
+	MillisBehindLatest *int64
+
+	// Decoded is the payload as decoded by the Tailer's Decoder, if it has one. DecodeErr is set
+	// instead if decoding failed.
+	Decoded   interface{}
+	DecodeErr error
+}
+
+// Decoder decodes a record's payload; see package decode for the built-in ones and chaining.
+type Decoder = decode.Decoder
+
+// Checkpointer tracks the last sequence number consumed from each shard.
+type Checkpointer interface {
+	// Get returns the last checkpointed sequence number for a shard, if any.
+	Get(shardId string) (string, bool, error)
+	Set(shardId, sequenceNumber string)
+}
+
+// Observer is told about every GetRecords call, for reporting throughput and lag.
+type Observer interface {
+	ObserveGetRecords(shardId string, latency time.Duration, records, bytes int, millisBehindLatest *int64)
+	ObserveThrottle(shardId string)
+}
+
+// IteratorObserver is an Observer that's also told whenever a shard iterator is acquired, which
+// happens once per shard as reading starts.
+type IteratorObserver interface {
+	ObserveShardIterator(shardId string, position Position)
+}
+
+// Tailer reads records from every shard of a stream, or a chosen few.
+type Tailer struct {
+	client     aws.KinesisReader
+	streamName string
+
+	start        Position
+	shardIds     []string
+	pollInterval time.Duration
+	callRate     float64
+	decoder      Decoder
+	checkpointer Checkpointer
+	observers    []Observer
+	maxRestarts  int
+	stopAtLatest bool
+}
+
+// PanicError is a panic recovered while reading a shard, with WithPanicRecovery.
+type PanicError struct {
+	ShardId string
+	// SequenceNumber is the record being read when the panic happened, if any
+	SequenceNumber string
+	Value          interface{}
+	Stack          []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.SequenceNumber == "" {
+		return fmt.Sprintf("%s: panic: %v", e.ShardId, e.Value)
+	}
+	return fmt.Sprintf("%s: panic at record %s: %v", e.ShardId, e.SequenceNumber, e.Value)
+}
+
+// Option configures a Tailer.
+type Option func(*Tailer)
+
+// WithStartPosition sets where in each shard reading starts; the default is TrimHorizon.
+func WithStartPosition(position Position) Option {
+	return func(t *Tailer) {
+		t.start = position
+	}
+}
+
+// WithShards limits reading to the given shards, rather than every shard of the stream.
+func WithShards(shardIds ...string) Option {
+	return func(t *Tailer) {
+		t.shardIds = shardIds
+	}
+}
+
+// WithPollInterval sets how long to wait between GetRecords calls on each shard; zero keeps
+// DefaultPollInterval.
+func WithPollInterval(interval time.Duration) Option {
+	return func(t *Tailer) {
+		if interval > 0 {
+			t.pollInterval = interval
+		}
+	}
+}
+
+// WithGetRecordsRate sets the most GetRecords calls made per second on each shard, counting
+// retries after throttling; zero or less removes the limit. The default is DefaultGetRecordsRate.
+func WithGetRecordsRate(perSecond float64) Option {
+	return func(t *Tailer) {
+		t.callRate = perSecond
+	}
+}
+
+// WithDecoder decodes every record's payload into Record.Decoded.
+func WithDecoder(decoder Decoder) Option {
+	return func(t *Tailer) {
+		t.decoder = decoder
+	}
+}
+
+// WithCheckpointer resumes each shard that has a checkpoint immediately after it, in place of the
+// start position, and checkpoints each record once it has been handled.
+func WithCheckpointer(checkpointer Checkpointer) Option {
+	return func(t *Tailer) {
+		t.checkpointer = checkpointer
+	}
+}
+
+// WithObserver adds an Observer to be told about every GetRecords call.
+func WithObserver(observer Observer) Option {
+	return func(t *Tailer) {
+		t.observers = append(t.observers, observer)
+	}
+}
+
+// WithPanicRecovery recovers from panics while reading a shard, such as in a Decoder or a handle
+// function given a malformed record, rather than letting them crash the program. The shard is
+// restarted after the record it panicked on, which is skipped, up to maxRestarts times before
+// TailShard gives up on it and returns a *PanicError.
+func WithPanicRecovery(maxRestarts int) Option {
+	return func(t *Tailer) {
+		t.maxRestarts = maxRestarts
+	}
+}
+
+// WithStopAtLatest stops reading each shard once it has caught up, when GetRecords returns no
+// records and none newer than the iterator, rather than waiting for new ones.
+func WithStopAtLatest() Option {
+	return func(t *Tailer) {
+		t.stopAtLatest = true
+	}
+}
+
+// New returns a Tailer for a stream.
+func New(client aws.KinesisReader, streamName string, opts ...Option) *Tailer {
+	t := &Tailer{
+		client:       client,
+		streamName:   streamName,
+		start:        TrimHorizon(),
+		pollInterval: DefaultPollInterval,
+		callRate:     DefaultGetRecordsRate,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Run reads every shard concurrently, calling handle with each record, until ctx is cancelled,
+// every shard has been closed and read to its end, or a shard fails. Calls to handle are
+// serialized, and records from each shard arrive in order. If handle returns an error, Run stops
+// and returns it.
+func (t *Tailer) Run(ctx context.Context, handle func(*Record) error) error {
+	shardIds, err := t.listShardIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		handleMu sync.Mutex
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, shardId := range shardIds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := t.TailShard(ctx, shardId, func(record *Record) error {
+				handleMu.Lock()
+				defer handleMu.Unlock()
+				return handle(record)
+			})
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// Records reads every shard in the background like Run, sending each record on the returned
+// channel. The channel is closed once reading stops, after which wait returns the reason, if it
+// was an error.
+func (t *Tailer) Records(ctx context.Context) (records <-chan *Record, wait func() error) {
+	out := make(chan *Record)
+	done := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		done <- t.Run(ctx, func(record *Record) error {
+			select {
+			case out <- record:
+				return nil
+			case <-ctx.Done():
+				return nil
+			}
+		})
+	}()
+
+	var once sync.Once
+	var err error
+	return out, func() error {
+		once.Do(func() { err = <-done })
+		return err
+	}
+}
+
+// TailShard reads a single shard, calling handle with each record in order, until ctx is
+// cancelled, the shard has been closed and read to its end, or handle returns an error.
+func (t *Tailer) TailShard(ctx context.Context, shardId string, handle func(*Record) error) error {
+	logger := slog.With("shard", shardId)
+
+	// Restarts share the limiter, so that they can't make calls any faster
+	limiter := NewGetRecordsLimiter(t.callRate)
+
+	// The sequence number of the last record read, to restart after if reading it panicked
+	var last string
+	for restarts := 0; ; restarts++ {
+		err := t.tailShard(ctx, shardId, &last, limiter, handle)
+
+		var panicked *PanicError
+		if !errors.As(err, &panicked) {
+			return err
+		}
+		logger.Error(
+			"recovered from panic reading shard",
+			"sequenceNumber", panicked.SequenceNumber,
+			"panic", panicked.Value,
+			"stack", string(panicked.Stack),
+		)
+		if restarts >= t.maxRestarts {
+			logger.Error("giving up on shard after too many panics", "restarts", restarts)
+			return err
+		}
+		if last != "" {
+			logger.Warn("restarting shard after the record it panicked on", "sequenceNumber", last)
+		}
+	}
+}
+
+// tailShard reads a shard as TailShard does, starting after the record last if it's set, and
+// setting it to each record as it's read. Panics are returned as a *PanicError if the Tailer
+// recovers from them.
+func (t *Tailer) tailShard(ctx context.Context, shardId string, last *string, limiter *rate.Limiter, handle func(*Record) error) (err error) {
+	logger := slog.With("shard", shardId)
+
+	// The span of the poll whose records are being handled, ended here if handling one panics
+	var span trace.Span
+	defer func() {
+		if span != nil && span.IsRecording() {
+			span.End()
+		}
+	}()
+
+	if t.maxRestarts > 0 {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{ShardId: shardId, SequenceNumber: *last, Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+
+	var shardIterator *string
+	if *last != "" {
+		shardIterator, err = t.shardIterator(ctx, shardId, AfterSequenceNumber(*last))
+	} else {
+		shardIterator, err = t.ShardIterator(ctx, shardId)
+	}
+	if err != nil {
+		logger.Error("failed to get shard iterator", "error", err)
+		return err
+	}
+	logger.Info("tailing shard")
+
+	shardAttrs := metric.WithAttributes(attribute.String("kin.shard_id", shardId))
+
+	for {
+		if ctx.Err() != nil {
+			logger.Info("stopped tailing shard")
+			return nil
+		}
+
+		if WaitGetRecords(ctx, limiter) != nil {
+			logger.Info("stopped tailing shard")
+			return nil
+		}
+
+		var pollCtx context.Context
+		pollCtx, span = telemetry.Tracer().Start(
+			ctx,
+			"kin.tail.poll",
+			trace.WithAttributes(attribute.String("kin.shard_id", shardId)),
+		)
+
+		start := time.Now()
+		res, err := t.client.GetRecords(pollCtx, &kinesis.GetRecordsInput{ShardIterator: shardIterator})
+		if err != nil {
+			span.RecordError(err)
+			span.End()
+
+			var throttled *types.ProvisionedThroughputExceededException
+			if errors.As(err, &throttled) {
+				// Back off and retry with the same iterator rather than giving up on the shard
+				logger.Warn("GetRecords throttled; backing off", "error", err)
+				for _, observer := range t.observers {
+					observer.ObserveThrottle(shardId)
+				}
+				aws.SleepContext(ctx, throttleBackoff)
+				continue
+			}
+
+			if ctx.Err() != nil {
+				continue
+			}
+
+			logger.Error("failed to get records", "error", err)
+			return err
+		}
+		latency := time.Since(start)
+		if res.MillisBehindLatest != nil {
+			logger.Debug(
+				"got records",
+				"records", len(res.Records),
+				"millisBehindLatest", *res.MillisBehindLatest,
+				"latency", latency,
+			)
+		}
+
+		bytes := 0
+		for _, record := range res.Records {
+			bytes += len(record.Data)
+		}
+		span.SetAttributes(attribute.Int("kin.records", len(res.Records)))
+		recordsCounter.Add(pollCtx, int64(len(res.Records)), shardAttrs)
+		bytesCounter.Add(pollCtx, int64(bytes), shardAttrs)
+		for _, observer := range t.observers {
+			observer.ObserveGetRecords(shardId, latency, len(res.Records), bytes, res.MillisBehindLatest)
+		}
+
+		for _, record := range res.Records {
+			if ctx.Err() != nil {
+				span.End()
+				logger.Info("stopped tailing shard")
+				return nil
+			}
+
+			*last = *record.SequenceNumber
+			if err := handle(t.newRecord(shardId, record, res.MillisBehindLatest)); err != nil {
+				span.End()
+				return err
+			}
+			if t.checkpointer != nil {
+				t.checkpointer.Set(shardId, *record.SequenceNumber)
+			}
+		}
+		span.End()
+
+		shardIterator = res.NextShardIterator
+		if shardIterator == nil {
+			logger.Info("shard closed")
+			return nil
+		}
+		if t.stopAtLatest && len(res.Records) == 0 && res.MillisBehindLatest != nil && *res.MillisBehindLatest == 0 {
+			logger.Info("caught up with shard")
+			return nil
+		}
+
+		aws.SleepContext(ctx, t.pollInterval)
+	}
+}
+
+// ShardIterator returns an iterator for a shard at its checkpoint, if the Tailer has a
+// Checkpointer and the shard has one, or otherwise at the start position.
+func (t *Tailer) ShardIterator(ctx context.Context, shardId string) (*string, error) {
+	position := t.start
+	if t.checkpointer != nil {
+		sequenceNumber, ok, err := t.checkpointer.Get(shardId)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			position = AfterSequenceNumber(sequenceNumber)
+		}
+	}
+	return t.shardIterator(ctx, shardId, position)
+}
+
+func (t *Tailer) shardIterator(ctx context.Context, shardId string, position Position) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:             &t.streamName,
+		ShardId:                &shardId,
+		ShardIteratorType:      position.Type,
+		StartingSequenceNumber: position.SequenceNumber,
+		Timestamp:              position.Timestamp,
+	}
+	output, err := t.client.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, observer := range t.observers {
+		if observer, ok := observer.(IteratorObserver); ok {
+			observer.ObserveShardIterator(shardId, position)
+		}
+	}
+	return output.ShardIterator, nil
+}
+
+func (t *Tailer) newRecord(shardId string, record types.Record, millisBehindLatest *int64) *Record {
+	r := &Record{Record: record, ShardId: shardId, MillisBehindLatest: millisBehindLatest}
+	if t.decoder != nil {
+		r.Decoded, r.DecodeErr = t.decoder.Decode(record.Data)
+	}
+	return r
+}
+
+func (t *Tailer) listShardIds(ctx context.Context) ([]string, error) {
+	if len(t.shardIds) > 0 {
+		return t.shardIds, nil
+	}
+
+	var shardIds []string
+	input := &kinesis.ListShardsInput{StreamName: &t.streamName}
+	for {
+		output, err := t.client.ListShards(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range output.Shards {
+			shardIds = append(shardIds, *shard.ShardId)
+		}
+
+		if output.NextToken == nil {
+			return shardIds, nil
+		}
+		// The stream name must be omitted when continuing from a token
+		input = &kinesis.ListShardsInput{NextToken: output.NextToken}
+	}
+}
+
+// NewGetRecordsLimiter returns a limiter allowing perSecond GetRecords calls per second on a
+// shard, or any number if perSecond is zero or less, for reading a shard other than with a Tailer.
+// Calls aren't allowed in bursts, since the shard's other consumers count on them being spread out.
+func NewGetRecordsLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
+
+// WaitGetRecords blocks until limiter allows a GetRecords call, returning ctx's error if it's
+// cancelled first. Unlike limiter.Wait, it still waits when the call would be allowed only after
+// ctx's deadline, rather than failing straight away.
+func WaitGetRecords(ctx context.Context, limiter *rate.Limiter) error {
+	if limiter.Wait(ctx) == nil {
+		return nil
+	}
+	if ctx.Err() == nil {
+		aws.SleepContext(ctx, limiter.Reserve().Delay())
+	}
+	return ctx.Err()
+}
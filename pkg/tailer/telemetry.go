@@ -0,0 +1,29 @@
+package tailer
+
+import (
+	"kin/pkg/telemetry"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OpenTelemetry instruments for tailing. These are created against the global meter provider,
+// which delegates to the real provider once telemetry.Setup has been called and is a no-op
+// otherwise.
+var (
+	recordsCounter metric.Int64Counter
+	bytesCounter   metric.Int64Counter
+)
+
+func init() {
+	meter := telemetry.Meter()
+
+	recordsCounter, _ = meter.Int64Counter(
+		"kin.tail.records",
+		metric.WithDescription("Number of records read from the stream"),
+	)
+	bytesCounter, _ = meter.Int64Counter(
+		"kin.tail.bytes",
+		metric.WithDescription("Number of payload bytes read from the stream"),
+		metric.WithUnit("By"),
+	)
+}
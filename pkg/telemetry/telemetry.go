@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "kin"
+
+// Setup configures the global OpenTelemetry tracer and meter providers to export over OTLP/HTTP
+// to the given endpoint (ex: http://localhost:4318). The returned function flushes any buffered
+// telemetry and must be called before exiting.
+//
+// Until Setup is called the global providers are no-ops, so instrumented code can always use
+// Tracer and Meter without checking whether telemetry is enabled.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(instrumentationName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	metricExporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+func Meter() metric.Meter {
+	return otel.Meter(instrumentationName)
+}
+
+// InstrumentAWS is an AWS SDK API option which wraps every API call in a client span and records
+// its duration.
+func InstrumentAWS(stack *middleware.Stack) error {
+	duration, err := Meter().Float64Histogram(
+		"kin.aws.api.duration",
+		metric.WithDescription("Duration of AWS API calls"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Added after the service metadata middleware so the operation name is available
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+		"KinTelemetry",
+		func(
+			ctx context.Context,
+			in middleware.InitializeInput,
+			next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			service := awsmiddleware.GetServiceID(ctx)
+			operation := awsmiddleware.GetOperationName(ctx)
+			attrs := []attribute.KeyValue{
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService(service),
+				semconv.RPCMethod(operation),
+			}
+
+			ctx, span := Tracer().Start(
+				ctx,
+				service+"."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			if requestId, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+				span.SetAttributes(semconv.AWSRequestID(requestId))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+
+			return out, metadata, err
+		},
+	), middleware.After)
+}
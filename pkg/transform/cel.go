@@ -0,0 +1,304 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// CEL returns a stage which replaces each decoded payload with the result of a CEL expression
+// (https://cel.dev). The expression sees the payload as data, and the record's metadata as
+// record.partition_key, record.shard_id, record.sequence_number and
+// record.approximate_arrival_timestamp. JSON numbers are doubles, so compare them with 1.0
+// rather than 1, except for 64-bit integers too large for a double to hold exactly, such as IDs,
+// which are ints (or uints) so that they're output as they were. Other numbers are output as they were
+// written, such as 1.50 or 1e3, unless they have more digits than a double holds, in which case
+// they're output as the nearest double.
+//
+// Besides CEL's standard library and its strings, math, encoders and cel.bind extensions, maps
+// have methods for reshaping payloads, each returning a new map:
+//
+//	m.set(key, value)   m with key set to value
+//	m.omit(key)         m without key, or without any of a list of keys
+//	m.merge(other)      m with every field of other
+//
+// For example, data.omit("ssn").set("total", data.price * data.quantity) drops a field and adds
+// a computed one, and data.omit("id").set("orderId", data.id) renames one.
+func CEL(expression string) (Func, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("data", cel.DynType),
+		cel.Variable("record", cel.MapType(cel.StringType, cel.DynType)),
+		ext.Strings(),
+		ext.Math(),
+		ext.Encoders(),
+		ext.Bindings(),
+		mapFunctions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		if record.Data == nil {
+			return record, nil
+		}
+
+		numbers := celNumbers{}
+		result, _, err := program.ContextEval(ctx, map[string]interface{}{
+			"data":   celInput(decode.Plain(*record.Data), numbers),
+			"record": celRecord(record),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := celToNative(result, numbers)
+		if err != nil {
+			return nil, err
+		}
+		record.Data = &data
+		return record, nil
+	}, nil
+}
+
+// celRecord returns the metadata of a record the expression can refer to.
+func celRecord(record *sink.RecordOutput) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if record.PartitionKey != nil {
+		fields["partition_key"] = *record.PartitionKey
+	}
+	if record.ShardId != nil {
+		fields["shard_id"] = *record.ShardId
+	}
+	if record.SequenceNumber != nil {
+		fields["sequence_number"] = *record.SequenceNumber
+	}
+	if record.ApproximateArrivalTimestamp != nil {
+		fields["approximate_arrival_timestamp"] = record.ApproximateArrivalTimestamp.Time
+	}
+	return fields
+}
+
+// maxExactInt is the largest integer a double holds exactly.
+const maxExactInt = 1 << 53
+
+// celNumbers maps each double an expression was given to the JSON number it was converted from,
+// or to "" if it came from more than one, so that numbers are output as they were written rather
+// than reformatted. Only numbers that a double holds every digit of are added: a double in the
+// result can't be told apart from one computed to the same value, which must not be output with
+// digits it doesn't have.
+type celNumbers map[float64]json.Number
+
+// celInput converts a decoded payload to what expressions see it as, with JSON numbers as doubles
+// or, if they're too large for one, ints, or uints if they're too large for an int. Numbers
+// converted to doubles are added to numbers if they're written exactly.
+func celInput(value interface{}, numbers celNumbers) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && (i > maxExactInt || i < -maxExactInt) {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil && u > maxExactInt {
+			return u
+		}
+		f, err := v.Float64()
+		if err != nil || !exactDouble(v, f) {
+			return f
+		}
+		if n, ok := numbers[f]; ok && n != v {
+			numbers[f] = ""
+		} else {
+			numbers[f] = v
+		}
+		return f
+
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = celInput(item, numbers)
+		}
+		return converted
+
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = celInput(item, numbers)
+		}
+		return converted
+
+	default:
+		return value
+	}
+}
+
+// exactDouble reports whether n is exactly the shortest decimal form of f, the double parsed from
+// it, however it's written.
+func exactDouble(n json.Number, f float64) bool {
+	written, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return false
+	}
+	shortest, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return ok && written.Cmp(shortest) == 0
+}
+
+// celToNative converts the result of an expression to the same types a decoded JSON payload
+// has, except for bytes, which stay bytes. Ints are output exactly, as json.Number, and doubles
+// equal to one of numbers are output as it was written.
+func celToNative(value ref.Val, numbers celNumbers) (interface{}, error) {
+	switch v := value.(type) {
+	case types.Bytes:
+		return []byte(v), nil
+
+	case types.Double:
+		if n := numbers[float64(v)]; n != "" {
+			return n, nil
+		}
+
+	case types.Int:
+		return json.Number(strconv.FormatInt(int64(v), 10)), nil
+
+	case types.Uint:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), nil
+
+	case traits.Mapper:
+		object := map[string]interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			name, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("can't output a map with %s keys", key.Type().TypeName())
+			}
+			item, err := celToNative(v.Get(key), numbers)
+			if err != nil {
+				return nil, err
+			}
+			object[string(name)] = item
+		}
+		return object, nil
+
+	case traits.Lister:
+		items := []interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			item, err := celToNative(it.Next(), numbers)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	converted, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, fmt.Errorf("can't output a %s: %w", value.Type().TypeName(), err)
+	}
+	return converted.(*structpb.Value).AsInterface(), nil
+}
+
+var mapType = cel.MapType(cel.StringType, cel.DynType)
+
+// mapFunctions are the methods for reshaping maps
+var mapFunctions = cel.Lib(mapLibrary{})
+
+type mapLibrary struct{}
+
+func (mapLibrary) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
+
+func (mapLibrary) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("set",
+			cel.MemberOverload("map_set", []*cel.Type{mapType, cel.StringType, cel.DynType}, mapType,
+				cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+					entries, err := mapEntries(args[0])
+					if err != nil {
+						return err
+					}
+					entries[args[1]] = args[2]
+					return types.NewRefValMap(types.DefaultTypeAdapter, entries)
+				}),
+			),
+		),
+		cel.Function("omit",
+			cel.MemberOverload("map_omit_string", []*cel.Type{mapType, cel.StringType}, mapType,
+				cel.BinaryBinding(func(m, key ref.Val) ref.Val {
+					entries, err := mapEntries(m)
+					if err != nil {
+						return err
+					}
+					delete(entries, key)
+					return types.NewRefValMap(types.DefaultTypeAdapter, entries)
+				}),
+			),
+			cel.MemberOverload("map_omit_list", []*cel.Type{mapType, cel.ListType(cel.StringType)}, mapType,
+				cel.BinaryBinding(func(m, keys ref.Val) ref.Val {
+					entries, err := mapEntries(m)
+					if err != nil {
+						return err
+					}
+					for it := keys.(traits.Lister).Iterator(); it.HasNext() == types.True; {
+						delete(entries, it.Next())
+					}
+					return types.NewRefValMap(types.DefaultTypeAdapter, entries)
+				}),
+			),
+		),
+		cel.Function("merge",
+			cel.MemberOverload("map_merge", []*cel.Type{mapType, mapType}, mapType,
+				cel.BinaryBinding(func(m, other ref.Val) ref.Val {
+					entries, err := mapEntries(m)
+					if err != nil {
+						return err
+					}
+					otherEntries, err := mapEntries(other)
+					if err != nil {
+						return err
+					}
+					for key, value := range otherEntries {
+						entries[key] = value
+					}
+					return types.NewRefValMap(types.DefaultTypeAdapter, entries)
+				}),
+			),
+		),
+	}
+}
+
+// mapEntries copies a map's entries, keyed by CEL strings so that lookups by a string argument
+// find them. It returns an error value for anything else, such as a payload that isn't an object.
+func mapEntries(value ref.Val) (map[ref.Val]ref.Val, ref.Val) {
+	m, ok := value.(traits.Mapper)
+	if !ok {
+		return nil, types.NewErr("expected a map, got %s", value.Type().TypeName())
+	}
+
+	entries := map[ref.Val]ref.Val{}
+	for it := m.Iterator(); it.HasNext() == types.True; {
+		key := it.Next()
+		entries[types.DefaultTypeAdapter.NativeToValue(key.Value())] = m.Get(key)
+	}
+	return entries, nil
+}
@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"context"
+	"strings"
+)
+
+// Redacted replaces the values of redacted fields.
+const Redacted = "[REDACTED]"
+
+// Fields returns a stage which keeps only the given fields of each JSON object payload. Paths are
+// dot-separated (ex: customer.email), and fields that don't exist are left out. Payloads that
+// aren't objects are passed on untouched.
+func Fields(paths []string) Func {
+	split := splitPaths(paths)
+	return Payload(func(ctx context.Context, data interface{}) (interface{}, error) {
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return data, nil
+		}
+
+		projected := map[string]interface{}{}
+		for _, path := range split {
+			if value, ok := lookup(object, path); ok {
+				set(projected, path, value)
+			}
+		}
+		return projected, nil
+	})
+}
+
+// Redact returns a stage which replaces the value of each of the given fields of JSON object
+// payloads with Redacted, wherever they exist. Paths are dot-separated, as for Fields.
+func Redact(paths []string) Func {
+	split := splitPaths(paths)
+	return Payload(func(ctx context.Context, data interface{}) (interface{}, error) {
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return data, nil
+		}
+
+		for _, path := range split {
+			if _, ok := lookup(object, path); ok {
+				set(object, path, Redacted)
+			}
+		}
+		return object, nil
+	})
+}
+
+func splitPaths(paths []string) [][]string {
+	split := make([][]string, len(paths))
+	for i, path := range paths {
+		split[i] = strings.Split(path, ".")
+	}
+	return split
+}
+
+// lookup returns the value at path within object, if there is one.
+func lookup(object map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = object
+	for _, key := range path {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = fields[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// set sets the value at path within object, creating objects along the way as needed.
+func set(object map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := object[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			object[key] = child
+		}
+		object = child
+	}
+	object[path[len(path)-1]] = value
+}
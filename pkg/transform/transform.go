@@ -0,0 +1,80 @@
+// Package transform applies stages to records between being decoded and being written to a sink:
+// rewriting payloads, projecting or redacting fields, and filtering records out. Stages are plain
+// functions, so they stack in whatever order they're given and new ones can be added without
+// touching the commands that run them.
+package transform
+
+import (
+	"context"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+)
+
+// Func is a stage applied to each record. It may modify the record in place or return another
+// one, and returns nil to drop the record.
+type Func func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error)
+
+// Chain returns a stage which applies each of stages in turn, stopping once a record is dropped.
+func Chain(stages ...Func) Func {
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		for _, stage := range stages {
+			var err error
+			record, err = stage(ctx, record)
+			if record == nil || err != nil {
+				return nil, err
+			}
+		}
+		return record, nil
+	}
+}
+
+// Filter returns a stage which drops the records match doesn't accept.
+func Filter(match func(ctx context.Context, record *sink.RecordOutput) (bool, error)) Func {
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		ok, err := match(ctx, record)
+		if !ok || err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+// Payload returns a stage which replaces each decoded payload with fn's result. Records without
+// a decoded payload, such as with --no-data, are passed on untouched. fn sees objects as maps, so
+// payloads decoded keeping their key order lose it.
+func Payload(fn func(ctx context.Context, data interface{}) (interface{}, error)) Func {
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		if record.Data == nil {
+			return record, nil
+		}
+
+		data, err := fn(ctx, decode.Plain(*record.Data))
+		if err != nil {
+			return nil, err
+		}
+		record.Data = &data
+		return record, nil
+	}
+}
+
+// NewSink returns a sink which applies stages to every record before writing it to s. Dropped
+// records are written nowhere, but aren't an error.
+func NewSink(s sink.Sink, stages ...Func) sink.Sink {
+	if len(stages) == 0 {
+		return s
+	}
+	return &transformSink{Sink: s, transform: Chain(stages...)}
+}
+
+type transformSink struct {
+	sink.Sink
+	transform Func
+}
+
+func (t *transformSink) Write(ctx context.Context, record *sink.RecordOutput) error {
+	record, err := t.transform(ctx, record)
+	if record == nil || err != nil {
+		return err
+	}
+	return t.Sink.Write(ctx, record)
+}
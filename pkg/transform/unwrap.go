@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"kin/pkg/decode"
+	"kin/pkg/sink"
+)
+
+// Envelope types Unwrap recognizes, and AnyEnvelope to recognize them all.
+const (
+	// SNS is an SNS notification, as delivered to subscribers, whose Message is the payload
+	SNS = "sns"
+	// EventBridge is an EventBridge event, whose detail is the payload
+	EventBridge = "eventbridge"
+	// LambdaDestination is the record Lambda sends an asynchronous invocation's destination,
+	// whose responsePayload is the payload
+	LambdaDestination = "lambda"
+
+	AnyEnvelope = "auto"
+)
+
+// envelope recognizes one type of envelope, returning the payload inside it and the rest of it
+type envelope func(object map[string]interface{}) (inner interface{}, rest map[string]interface{}, ok bool)
+
+var envelopes = map[string]envelope{
+	SNS:               unwrapSNS,
+	EventBridge:       unwrapField("detail", "detail-type", "source"),
+	LambdaDestination: unwrapField("responsePayload", "requestContext", "responseContext"),
+}
+
+// Unwrap returns a stage which replaces payloads wrapped in an envelope of the given type, or any
+// type with AnyEnvelope, with the payload inside. The envelope's other fields are kept in the
+// record's Envelope. Payloads that aren't wrapped are passed on untouched.
+func Unwrap(envelopeType string) (Func, error) {
+	types := []string{SNS, EventBridge, LambdaDestination}
+	if envelopeType != AnyEnvelope {
+		if _, ok := envelopes[envelopeType]; !ok {
+			return nil, fmt.Errorf("unknown envelope type %q: must be sns, eventbridge, lambda or auto", envelopeType)
+		}
+		types = []string{envelopeType}
+	}
+
+	return func(ctx context.Context, record *sink.RecordOutput) (*sink.RecordOutput, error) {
+		if record.Data == nil {
+			return record, nil
+		}
+		object, ok := decode.Plain(*record.Data).(map[string]interface{})
+		if !ok {
+			return record, nil
+		}
+
+		for _, envelopeType := range types {
+			inner, rest, ok := envelopes[envelopeType](object)
+			if !ok {
+				continue
+			}
+
+			record.Data = &inner
+			record.EnvelopeType = envelopeType
+			record.Envelope = rest
+			break
+		}
+		return record, nil
+	}, nil
+}
+
+// unwrapSNS unwraps an SNS notification. Its Message is always a string, so it's decoded if it's
+// JSON, as most are.
+func unwrapSNS(object map[string]interface{}) (interface{}, map[string]interface{}, bool) {
+	message, ok := object["Message"].(string)
+	if object["Type"] != "Notification" || !ok || object["TopicArn"] == nil {
+		return nil, nil, false
+	}
+
+	var inner interface{} = message
+	if decoded, err := decode.JSON([]byte(message)); err == nil {
+		inner = decoded
+	}
+	return inner, without(object, "Message"), true
+}
+
+// unwrapField returns an envelope recognized by having field and every one of markers, whose
+// payload is field.
+func unwrapField(field string, markers ...string) envelope {
+	return func(object map[string]interface{}) (interface{}, map[string]interface{}, bool) {
+		inner, ok := object[field]
+		if !ok {
+			return nil, nil, false
+		}
+		for _, marker := range markers {
+			if _, ok := object[marker]; !ok {
+				return nil, nil, false
+			}
+		}
+		return inner, without(object, field), true
+	}
+}
+
+func without(object map[string]interface{}, field string) map[string]interface{} {
+	rest := make(map[string]interface{}, len(object)-1)
+	for key, value := range object {
+		if key != field {
+			rest[key] = value
+		}
+	}
+	return rest
+}